@@ -1,12 +1,16 @@
 package v1
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type ServerInfo struct {
 	Version *ServerInfoVersion `json:"version"`
 	Contact *ServerInfoContact `json:"contact"`
 	Auth    any                `json:"auth"`
 	Renewal *ServerInfoRenewal `json:"renewal"`
+	Queue   []ServerInfoQueue  `json:"queue"`
 }
 
 type ServerInfoVersion struct {
@@ -25,6 +29,14 @@ type ServerInfoRenewal struct {
 	Failed     uint       `json:"failed"`
 }
 
+type ServerInfoQueue struct {
+	Kind    string `json:"kind"` // ca or dns
+	ID      string `json:"id"`
+	Limit   uint   `json:"limit"` // 0 if unlimited
+	Running uint   `json:"running"`
+	Waiting uint   `json:"waiting"`
+}
+
 type DNSHandlerInfo struct {
 	ID          string   `json:"id"`
 	Name        string   `json:"name"`
@@ -66,6 +78,165 @@ type CertClaimInfo struct {
 	Hints           CertClaimHints `json:"hints,omitempty"`
 }
 
+// Changes to the domains of an existing certificate. The first domain can only be
+// changed by toggling the wildcard. If AutoDNS is set, A records are created for added
+// and deleted for removed domains.
+type CertModifyInfo struct {
+	AddSubjectAltNames    []string     `json:"addSan,omitempty" validate:"dive,required,fqdn|fqdnWildcard"`
+	RemoveSubjectAltNames []string     `json:"removeSan,omitempty" validate:"dive,required,fqdn|fqdnWildcard"`
+	Wildcard              *bool        `json:"wildcard,omitempty"`
+	AutoDNS               *AutoDNSInfo `json:"autodns,omitempty"`
+}
+
+// Result of a claim dry run. Passed is true if no check has failed.
+type ClaimPrecheckReport struct {
+	Passed bool            `json:"passed"`
+	Checks []ClaimPrecheck `json:"checks"`
+}
+
+type ClaimPrecheck struct {
+	Check   string `json:"check"`
+	Domain  string `json:"domain,omitempty"`
+	Status  string `json:"status"` // ok, failed or skipped
+	Message string `json:"message,omitempty"`
+}
+
+type JobInfo struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	CAID    string    `json:"caID"`
+	Name    string    `json:"name"`
+	Status  string    `json:"status"` // claims: queued, dns-set, validating, issued or failed; others: running, succeeded or failed
+	Error   string    `json:"error,omitempty"`
+	Created string    `json:"created"`
+	Updated string    `json:"updated"`
+	Steps   []JobStep `json:"steps"`
+	// The RenewalRunReport of a renewal run, updated while the run progresses
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+type JobStep struct {
+	Status string `json:"status"`
+	Time   string `json:"time"`
+	Error  string `json:"error,omitempty"`
+}
+
+type AuditEntry struct {
+	ID        uint64 `json:"id"`
+	Time      string `json:"time"`
+	User      string `json:"user"`
+	UserEmail string `json:"email,omitempty"`
+	Action    string `json:"action"` // claim, modify, renew, delete, read_key or read_pem
+	CAID      string `json:"caID,omitempty"`
+	Name      string `json:"name"`
+	SourceIP  string `json:"sourceIP"`
+	Result    string `json:"result"` // success, denied or failure
+	Error     string `json:"error,omitempty"`
+}
+
+// A token limited to a subset of the domains and permissions of the user creating it
+type TokenCreateInfo struct {
+	Name        string   `json:"name" validate:"required,min=3,max=64,alphanumUnderscoreDashDot"`
+	Domains     []string `json:"domains" validate:"required,dive,required,fqdn"`
+	Write       bool     `json:"write"`
+	Admin       bool     `json:"admin"`
+	ValidFor    string   `json:"validFor" validate:"required"` // e.g. 90d or 36h
+	Scopes      []string `json:"scopes,omitempty"`             // e.g. cert:read-key, all of the user's if empty
+	CAs         []string `json:"cas,omitempty"`                // all of the user's if empty
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty" validate:"dive,cidr"`
+	NotBefore   string   `json:"notBefore,omitempty"` // RFC3339, valid from creation if empty
+}
+
+type TokenInfo struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Owner       string   `json:"owner"`
+	OwnerEmail  string   `json:"ownerEmail,omitempty"`
+	Domains     []string `json:"domains"`
+	Write       bool     `json:"write"`
+	Admin       bool     `json:"admin"`
+	Scopes      []string `json:"scopes,omitempty"`
+	CAs         []string `json:"cas,omitempty"`
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty"`
+	Created     string   `json:"created"`
+	NotBefore   string   `json:"notBefore,omitempty"`
+	Expires     string   `json:"expires"`
+	LastUsed    string   `json:"lastUsed,omitempty"`
+	Expired     bool     `json:"expired"`
+}
+
+// The token is only returned once, dns3ld stores its hash
+type TokenCreateResult struct {
+	TokenInfo
+	Token string `json:"token"`
+}
+
+type RenewalJobInfo struct {
+	ID       uint64 `json:"id"`
+	CAID     string `json:"caID"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`  // pending, running, succeeded or failed
+	Trigger  string `json:"trigger"` // scheduled, retry or manual
+	Attempt  uint   `json:"attempt"` // 1 for the first attempt since the last successful renewal
+	Created  string `json:"created"`
+	Started  string `json:"started,omitempty"`
+	Finished string `json:"finished,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type RenewalRunRequest struct {
+	CAID           string `json:"caID,omitempty"`
+	RootZone       string `json:"rtzn,omitempty"`
+	ExpiringBefore string `json:"expiringBefore,omitempty"` // RFC 3339, also renews certificates expiring before, even if not yet due
+	MaxDuration    string `json:"maxDuration,omitempty"`    // e.g. "10m", renewals are spread over this duration
+	DryRun         bool   `json:"dryRun"`                   // Only report what would be renewed.
+}
+
+type RenewalRunReport struct {
+	DryRun     bool             `json:"dryRun"`
+	Started    string           `json:"started"`
+	Finished   string           `json:"finished"`
+	Successful uint             `json:"successful"`
+	Failed     uint             `json:"failed"`
+	Certs      []RenewalRunCert `json:"certs"`
+}
+
+type RenewalRunCert struct {
+	CAID        string `json:"caID"`
+	Name        string `json:"name"`
+	ValidTo     string `json:"validTo"`
+	NextRenewal string `json:"nextRenewal"`
+	Forced      bool   `json:"forced"` // not yet due, but expiring before the requested time
+	Status      string `json:"status"` // planned, succeeded, skipped or failed
+	Error       string `json:"error,omitempty"`
+}
+
+// Readiness of the daemon and the services it depends on
+type ReadinessReport struct {
+	Ready      bool                 `json:"ready"`
+	Components []ComponentReadiness `json:"components"`
+}
+
+type ComponentReadiness struct {
+	Type     string `json:"type"` // db, ca, dns or oidc
+	Name     string `json:"name"` // ID of the CA or DNS provider, issuer URL for OIDC
+	Ready    bool   `json:"ready"`
+	Required bool   `json:"required"`        // the daemon is not ready while this component is not
+	Error    string `json:"error,omitempty"` // not returned by /readyz, see the log instead
+}
+
+type CertRenewInfo struct {
+	Force bool `json:"force"` // Renew even if the certificate is not yet due for renewal.
+}
+
+type CertRenewResult struct {
+	Name        string `json:"name"`
+	ValidFrom   string `json:"validFrom"`
+	ValidTo     string `json:"validTo"`
+	NextRenewal string `json:"nextRenewal"`
+	RenewCount  uint   `json:"renewCount"`
+}
+
 type CertClaimHints struct {
 	TTL uint16 `json:"ttl,omitempty"` // Time from now until cert expiry in days.
 }
@@ -96,6 +267,46 @@ type CertInfo struct {
 	SubjectCN   string `json:"subjectCN"`
 	IssuerCN    string `json:"issuerCN"`
 	Serial      string `json:"serial"`
+	//Failed renewal attempts since the last successful renewal, only set for single certificates
+	RenewFailures  uint   `json:"renewFailures,omitempty"`
+	LastRenewError string `json:"lastRenewError,omitempty"`
+}
+
+// Certificates expiring within a period, grouped by CA and root zone
+type ExpiryReport struct {
+	Until  string              `json:"until"`
+	Groups []ExpiryReportGroup `json:"groups"`
+}
+
+type ExpiryReportGroup struct {
+	CAID     string             `json:"caID"`
+	RootZone string             `json:"rtzn"`
+	Certs    []ExpiringCertInfo `json:"certs"`
+}
+
+type ExpiringCertInfo struct {
+	Name     string `json:"name"`
+	ValidTo  string `json:"validTo"`
+	DaysLeft int    `json:"daysLeft"` // negative if already expired
+	Owner    struct {
+		Name  string `json:"name"`
+		EMail string `json:"email"`
+	} `json:"owner"`
+	NextRenewal    string `json:"nextRenewal"`
+	LastRenewError string `json:"lastRenewError,omitempty"`
+}
+
+// An issued version of a certificate
+type CertVersionInfo struct {
+	Version   uint   `json:"version"`
+	Current   bool   `json:"current"`
+	Issued    string `json:"issued"`
+	ValidFrom string `json:"validFrom"`
+	ValidTo   string `json:"validTo"`
+	Valid     bool   `json:"valid"`
+	SubjectCN string `json:"subjectCN"`
+	IssuerCN  string `json:"issuerCN"`
+	Serial    string `json:"serial"`
 }
 
 type ErrorMsg struct {
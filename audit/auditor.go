@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	Retention     time.Duration `yaml:"retention" default:"8760h"`   //entries older than this are deleted
+	PurgeInterval time.Duration `yaml:"purgeInterval" default:"24h"` //how often expired entries are deleted
+}
+
+// The Auditor writes audit entries and deletes them after the retention period.
+type Auditor struct {
+	Config *Config
+	State  AuditStateManager
+	//Optional, if it returns false expired entries are not purged by this instance (e.g. if
+	//another instance is the leader)
+	ShouldRunFunc func() bool
+
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func (a *Auditor) Init() error {
+	a.stop = make(chan struct{})
+	return nil
+}
+
+// Record stores the entry. Errors are logged, the audited operation is not affected by them.
+func (a *Auditor) Record(entry *Entry) {
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l := log.WithFields(logrus.Fields{"action": entry.Action, "caID": entry.CAID, "name": entry.CertName,
+		"user": entry.UserName, "email": entry.UserEmail, "sourceIP": entry.SourceIP, "result": entry.Result})
+
+	sess, err := a.State.NewSession()
+	if err != nil {
+		l.WithError(err).Error("Could not store audit entry")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	err = sess.PutAuditEntry(entry)
+	if err != nil {
+		l.WithError(err).Error("Could not store audit entry")
+		return
+	}
+	l.Debug("Stored audit entry")
+
+}
+
+// Starts deleting expired entries every PurgeInterval.
+func (a *Auditor) Start() {
+	purgeInterval := a.Config.PurgeInterval
+	if purgeInterval <= 0 {
+		purgeInterval = 24 * time.Hour
+	}
+
+	a.stopped.Add(1)
+	go func() {
+		defer a.stopped.Done()
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+		for {
+			a.Purge(time.Now())
+			select {
+			case <-a.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (a *Auditor) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stop)
+	})
+	a.stopped.Wait()
+}
+
+// Purge deletes the entries which are older than the retention period at the given time.
+func (a *Auditor) Purge(now time.Time) {
+
+	if a.Config.Retention <= 0 {
+		return
+	}
+	if a.ShouldRunFunc != nil && !a.ShouldRunFunc() {
+		return
+	}
+
+	sess, err := a.State.NewSession()
+	if err != nil {
+		log.WithError(err).Error("Could not open audit log")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	deleted, err := sess.DelAuditEntriesBefore(now.Add(-a.Config.Retention))
+	if err != nil {
+		log.WithError(err).Error("Could not delete expired audit entries")
+		return
+	}
+	if deleted > 0 {
+		log.WithField("deleted", deleted).Info("Deleted audit entries older than the retention period")
+	}
+
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+// memAuditState is an in-memory AuditStateManager for testing
+type memAuditState struct {
+	entries []Entry
+}
+
+func (m *memAuditState) NewSession() (AuditStateManagerSession, error) {
+	return m, nil
+}
+
+func (m *memAuditState) Close() error {
+	return nil
+}
+
+func (m *memAuditState) PutAuditEntry(entry *Entry) error {
+	e := *entry
+	e.ID = uint64(len(m.entries) + 1)
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func (m *memAuditState) ListAuditEntries(filter *Filter, pginfo *util.PaginationInfo) ([]Entry, error) {
+	res := make([]Entry, 0, len(m.entries))
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		e := m.entries[i]
+		if filter.CertName != "" && e.CertName != filter.CertName {
+			continue
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func (m *memAuditState) DelAuditEntriesBefore(t time.Time) (int64, error) {
+	kept := m.entries[:0]
+	for _, e := range m.entries {
+		if !e.Time.Before(t) {
+			kept = append(kept, e)
+		}
+	}
+	deleted := int64(len(m.entries) - len(kept))
+	m.entries = kept
+	return deleted, nil
+}
+
+func TestAuditorRecordAndPurge(t *testing.T) {
+	state := &memAuditState{}
+	a := &Auditor{Config: &Config{Retention: 24 * time.Hour}, State: state}
+	if err := a.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	a.Record(&Entry{Time: now.Add(-48 * time.Hour), UserName: "alice", Action: ActionReadKey,
+		CAID: "le", CertName: "a.example.com.", Result: ResultSuccess})
+	a.Record(&Entry{UserName: "bob", Action: ActionDelete, CAID: "le", CertName: "a.example.com.",
+		Result: ResultDenied})
+	if len(state.entries) != 2 || state.entries[1].Time.IsZero() {
+		t.Fatalf("unexpected entries %+v", state.entries)
+	}
+
+	a.Purge(now)
+	if len(state.entries) != 1 || state.entries[0].UserName != "bob" {
+		t.Fatalf("expected only the entry within the retention period to be kept, got %+v", state.entries)
+	}
+}
+
+func TestAuditorPurgesOnlyOnLeader(t *testing.T) {
+	state := &memAuditState{}
+	leader := false
+	a := &Auditor{Config: &Config{Retention: 24 * time.Hour}, State: state,
+		ShouldRunFunc: func() bool { return leader }}
+	if err := a.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	a.Record(&Entry{Time: now.Add(-48 * time.Hour), UserName: "alice", Action: ActionReadKey,
+		CAID: "le", CertName: "a.example.com.", Result: ResultSuccess})
+
+	a.Purge(now)
+	if len(state.entries) != 1 {
+		t.Fatal("entries must not be purged by other instances than the leader")
+	}
+
+	leader = true
+	a.Purge(now)
+	if len(state.entries) != 0 {
+		t.Fatalf("expected the leader to purge the expired entry, got %+v", state.entries)
+	}
+}
+
+func TestResultFromErr(t *testing.T) {
+	for err, expected := range map[error]Result{
+		nil:                                ResultSuccess,
+		&common.UnauthzedError{Msg: "no"}:  ResultDenied,
+		&common.NotAuthnedError{Msg: "no"}: ResultDenied,
+		fmt.Errorf("wrapped: %w", &common.UnauthzedError{}): ResultDenied,
+		errors.New("acme: rate limited"):                    ResultFailure,
+	} {
+		if got := ResultFromErr(err); got != expected {
+			t.Errorf("%v: expected %s, got %s", err, expected, got)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+package audit
+
+import "github.com/sirupsen/logrus"
+
+var log = logrus.WithField("module", "audit")
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/dns3l/dns3l-core/state"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+type AuditStateManagerSQL struct {
+	Prov state.SQLDBProvider
+}
+
+type AuditStateManagerSQLSession struct {
+	prov *AuditStateManagerSQL
+	db   *sql.DB
+}
+
+func (m *AuditStateManagerSQL) NewSession() (AuditStateManagerSession, error) {
+	db, err := m.Prov.GetDBConn()
+	if err != nil {
+		return nil, err
+	}
+	return &AuditStateManagerSQLSession{db: db, prov: m}, nil
+}
+
+func (s *AuditStateManagerSQLSession) Close() error {
+	//Nothing to do
+	return nil
+}
+
+func (s *AuditStateManagerSQLSession) PutAuditEntry(entry *Entry) error {
+
+	_, err := s.db.Exec(`INSERT INTO `+s.prov.Prov.DBName("audit")+` (created_time, user_name, user_email, action, `+
+		`ca_id, key_name, source_ip, result, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		entry.Time.UTC(), entry.UserName, entry.UserEmail, entry.Action, entry.CAID, entry.CertName,
+		entry.SourceIP, entry.Result, entry.Error)
+	if err != nil {
+		return fmt.Errorf("problem while storing audit entry: %w", err)
+	}
+	return nil
+
+}
+
+func (s *AuditStateManagerSQLSession) ListAuditEntries(filter *Filter, pginfo *util.PaginationInfo) ([]Entry, error) {
+
+	q := squirrel.Select("id", "created_time", "user_name", "user_email", "action", "ca_id", "key_name",
+		"source_ip", "result", "error", "COUNT(*) OVER () AS total_count").
+		From(s.prov.Prov.DBName("audit")).OrderBy("id DESC")
+
+	if filter != nil {
+		if filter.User != "" {
+			q = q.Where(squirrel.Or{squirrel.Eq{"user_name": filter.User}, squirrel.Eq{"user_email": filter.User}})
+		}
+		if filter.Action != "" {
+			q = q.Where(squirrel.Eq{"action": filter.Action})
+		}
+		if filter.CAID != "" {
+			q = q.Where(squirrel.Eq{"ca_id": filter.CAID})
+		}
+		if filter.CertName != "" {
+			q = q.Where(squirrel.Eq{"key_name": filter.CertName})
+		}
+		if filter.Result != "" {
+			q = q.Where(squirrel.Eq{"result": filter.Result})
+		}
+		if !filter.Since.IsZero() {
+			q = q.Where(squirrel.GtOrEq{"created_time": filter.Since.UTC()})
+		}
+		if !filter.Until.IsZero() {
+			q = q.Where(squirrel.Lt{"created_time": filter.Until.UTC()})
+		}
+	}
+
+	if pginfo != nil && pginfo.Limit > 0 {
+		q = q.Limit(pginfo.Limit).Offset(pginfo.Offset)
+	}
+
+	qStr, qArgs, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(qStr, qArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]Entry, 0, 100)
+	var totalCount uint64
+	for rows.Next() {
+		var e Entry
+		err := rows.Scan(&e.ID, &e.Time, &e.UserName, &e.UserEmail, &e.Action, &e.CAID, &e.CertName,
+			&e.SourceIP, &e.Result, &e.Error, &totalCount)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+
+	if pginfo != nil {
+		pginfo.TotalCount = totalCount
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+
+}
+
+func (s *AuditStateManagerSQLSession) DelAuditEntriesBefore(t time.Time) (int64, error) {
+
+	res, err := s.db.Exec(`DELETE FROM `+s.prov.Prov.DBName("audit")+` WHERE created_time < ?;`, t.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("problem while deleting expired audit entries: %w", err)
+	}
+	return res.RowsAffected()
+
+}
@@ -0,0 +1,24 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/dns3l/dns3l-core/util"
+)
+
+type AuditStateManager interface {
+	NewSession() (AuditStateManagerSession, error)
+}
+
+// The audit log is append-only, entries are only removed after the retention period.
+type AuditStateManagerSession interface {
+	Close() error
+
+	PutAuditEntry(entry *Entry) error
+
+	//Newest entries first. pginfo is optional, its TotalCount is set.
+	ListAuditEntries(filter *Filter, pginfo *util.PaginationInfo) ([]Entry, error)
+
+	//Returns the number of deleted entries
+	DelAuditEntriesBefore(t time.Time) (int64, error)
+}
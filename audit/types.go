@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dns3l/dns3l-core/common"
+)
+
+type Action string
+
+const (
+	ActionClaim    Action = "claim"
+	ActionModify   Action = "modify"
+	ActionRenew    Action = "renew"
+	ActionDelete   Action = "delete"
+	ActionReadKey  Action = "read_key"  // private key downloaded
+	ActionReadPEM  Action = "read_pem"  // public PEM material read
+	ActionRollback Action = "rollback"  // earlier certificate version made current
+	ActionRenewRun Action = "renew_run" // renewal run triggered manually
+
+	ActionTokenCreate Action = "token_create" // API token created, the token name is logged as name
+	ActionTokenRevoke Action = "token_revoke"
+)
+
+type Result string
+
+const (
+	ResultSuccess Result = "success"
+	ResultDenied  Result = "denied" // not authenticated or not authorized
+	ResultFailure Result = "failure"
+)
+
+// ResultFromErr returns the result of an operation which ended with err
+func ResultFromErr(err error) Result {
+	if err == nil {
+		return ResultSuccess
+	}
+	var unauthzed *common.UnauthzedError
+	var notauthned *common.NotAuthnedError
+	if errors.As(err, &unauthzed) || errors.As(err, &notauthned) {
+		return ResultDenied
+	}
+	return ResultFailure
+}
+
+type Entry struct {
+	ID        uint64
+	Time      time.Time
+	UserName  string //name of the user or token
+	UserEmail string
+	Action    Action
+	CAID      string //empty if the operation affected all CAs
+	CertName  string //or the token name for token actions
+	SourceIP  string
+	Result    Result
+	Error     string
+}
+
+// Filter for listing audit entries, empty fields do not filter
+type Filter struct {
+	User     string //matches the user name or e-mail address
+	Action   Action
+	CAID     string
+	CertName string
+	Result   Result
+	Since    time.Time
+	Until    time.Time
+}
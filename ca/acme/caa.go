@@ -0,0 +1,64 @@
+package acme
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// checkCAA evaluates a CAA record set as described in RFC 8659 and returns an error if the CA
+// with the given issuer domain names would not be permitted to issue for the (wildcard) domain.
+func checkCAA(records []*dns.CAA, wildcard bool, identities []string) error {
+
+	issue := make([]*dns.CAA, 0, len(records))
+	issuewild := make([]*dns.CAA, 0, len(records))
+
+	for _, rec := range records {
+		switch strings.ToLower(rec.Tag) {
+		case "issue":
+			issue = append(issue, rec)
+		case "issuewild":
+			issuewild = append(issuewild, rec)
+		case "iodef", "contactemail", "contactphone", "issuemail", "issuevmc":
+			//not relevant for issuance
+		default:
+			if rec.Flag&128 != 0 {
+				return fmt.Errorf("unknown critical CAA property '%s' prohibits issuance", rec.Tag)
+			}
+		}
+	}
+
+	relevant := issue
+	if wildcard && len(issuewild) > 0 {
+		relevant = issuewild
+	}
+
+	if len(relevant) <= 0 {
+		//no restrictions for this kind of certificate
+		return nil
+	}
+
+	for _, rec := range relevant {
+		issuer := strings.ToLower(strings.TrimSpace(strings.SplitN(rec.Value, ";", 2)[0]))
+		if issuer == "" {
+			continue
+		}
+		for _, id := range identities {
+			if strings.ToLower(strings.TrimSuffix(id, ".")) == issuer {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("CAA records do not permit issuance by %s", strings.Join(identities, ", "))
+
+}
+
+func caaRecordsToString(records []*dns.CAA) string {
+	res := make([]string, len(records))
+	for i, rec := range records {
+		res[i] = fmt.Sprintf("%d %s \"%s\"", rec.Flag, rec.Tag, rec.Value)
+	}
+	return strings.Join(res, ", ")
+}
@@ -0,0 +1,35 @@
+package acme
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func caa(flag uint8, tag, value string) *dns.CAA {
+	return &dns.CAA{Flag: flag, Tag: tag, Value: value}
+}
+
+func TestCheckCAA(t *testing.T) {
+
+	ids := []string{"letsencrypt.org"}
+
+	assert.NoError(t, checkCAA([]*dns.CAA{}, false, ids))
+	assert.NoError(t, checkCAA([]*dns.CAA{caa(0, "iodef", "mailto:foo@example.com")}, false, ids))
+
+	assert.NoError(t, checkCAA([]*dns.CAA{caa(0, "issue", "letsencrypt.org")}, false, ids))
+	assert.NoError(t, checkCAA([]*dns.CAA{caa(0, "issue", "LetsEncrypt.org; validationmethods=dns-01")}, false, ids))
+	assert.Error(t, checkCAA([]*dns.CAA{caa(0, "issue", "pki.goog")}, false, ids))
+	assert.Error(t, checkCAA([]*dns.CAA{caa(0, "issue", ";")}, false, ids))
+
+	//issuewild takes precedence for wildcard domains only
+	records := []*dns.CAA{caa(0, "issue", "letsencrypt.org"), caa(0, "issuewild", "pki.goog")}
+	assert.NoError(t, checkCAA(records, false, ids))
+	assert.Error(t, checkCAA(records, true, ids))
+	assert.NoError(t, checkCAA([]*dns.CAA{caa(0, "issue", "letsencrypt.org")}, true, ids))
+
+	assert.Error(t, checkCAA([]*dns.CAA{caa(128, "foo", "bar")}, false, ids))
+	assert.NoError(t, checkCAA([]*dns.CAA{caa(0, "foo", "bar")}, false, ids))
+
+}
@@ -1,16 +1,23 @@
 package acme
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	cacmn "github.com/dns3l/dns3l-core/ca/common"
 	castate "github.com/dns3l/dns3l-core/ca/state"
 	"github.com/dns3l/dns3l-core/ca/types"
 	"github.com/dns3l/dns3l-core/common"
+	dnscommon "github.com/dns3l/dns3l-core/dns/common"
 	"github.com/dns3l/dns3l-core/util"
 )
 
+const directoryCheckTimeout = 10 * time.Second
+
 type CAProvider struct {
 	engine     *Engine
 	userScheme ACMEUserScheme
@@ -71,12 +78,47 @@ func makeACMEStateManager(c types.ProviderConfigurationContext) (ACMEStateManage
 	}
 }
 
+// CheckReachability fetches the ACME directory of the CA.
+func (p *CAProvider) CheckReachability() error {
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.C.HTTPInsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Transport: transport, Timeout: directoryCheckTimeout}
+
+	resp, err := client.Get(p.C.API)
+	if err != nil {
+		return err
+	}
+	defer util.LogDefer(log, resp.Body.Close)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ACME directory %s returned HTTP status %d", p.C.API, resp.StatusCode)
+	}
+	var dir struct {
+		NewOrder string `json:"newOrder"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&dir)
+	if err != nil || dir.NewOrder == "" {
+		return fmt.Errorf("%s is not an ACME directory", p.C.API)
+	}
+	return nil
+
+}
+
 func (p *CAProvider) IsEnabled() bool {
 
 	return !p.C.Disabled
 
 }
 
+// CheckConfig checks the TTL bounds and the ACME user scheme.
+func (p *CAProvider) CheckConfig() error {
+	_, err := GetACMEUserScheme(p.C.ACMEUserScheme)
+	return errors.Join(p.C.TTL.Check(), err)
+}
+
 func (p *CAProvider) PrecheckClaimCertificate(cinfo *types.CertificateClaimInfo) error {
 	if p.C.DisableSAN {
 		if len(cinfo.Domains) > 1 {
@@ -93,6 +135,84 @@ func (p *CAProvider) PrecheckClaimCertificate(cinfo *types.CertificateClaimInfo)
 	return nil
 }
 
+func (p *CAProvider) DryRunClaimCertificate(cinfo *types.CertificateClaimInfo) []types.PrecheckResult {
+
+	res := []types.PrecheckResult{
+		types.NewPrecheckResult("ca-constraints", "", p.PrecheckClaimCertificate(cinfo), "SAN and wildcard constraints met"),
+	}
+
+	ttl, err := cacmn.GetTTL(cinfo, p.C.TTL)
+	ttlMsg := "CA default"
+	if ttl > 0 {
+		ttlMsg = fmt.Sprintf("%dd", util.DurationToDays(ttl))
+	}
+	res = append(res, types.NewPrecheckResult("ttl", "", err, "certificate TTL: "+ttlMsg))
+
+	for _, domain := range cinfo.Domains {
+		res = append(res, p.dryRunCAA(domain))
+	}
+
+	return append(res, p.dryRunRateLimit(cinfo))
+
+}
+
+func (p *CAProvider) dryRunCAA(domain string) types.PrecheckResult {
+
+	records, name, err := dnscommon.LookupCAA(domain, p.C.CAACheckServers, 0)
+	if err != nil {
+		return types.NewPrecheckResult("caa", domain, err, "")
+	}
+	if len(records) <= 0 {
+		return types.NewPrecheckResult("caa", domain, nil, "no CAA records found, any CA may issue")
+	}
+	if len(p.C.CAAIdentities) <= 0 {
+		return types.PrecheckResult{Check: "caa", Domain: domain, Status: types.PrecheckSkipped,
+			Message: fmt.Sprintf("CAA records found on %s (%s), but no caaIdentities configured for CA",
+				name, caaRecordsToString(records))}
+	}
+
+	err = checkCAA(records, util.IsWildcard(domain), p.C.CAAIdentities)
+	return types.NewPrecheckResult("caa", domain, err, fmt.Sprintf("issuance permitted by CAA records on %s", name))
+
+}
+
+func (p *CAProvider) dryRunRateLimit(cinfo *types.CertificateClaimInfo) types.PrecheckResult {
+
+	rl := p.C.RateLimit
+	if rl.CertsPerRootZone <= 0 {
+		return types.PrecheckResult{Check: "ratelimit", Status: types.PrecheckSkipped,
+			Message: "no rate limit configured for CA"}
+	}
+	if cinfo.NameRZ == "" {
+		return types.PrecheckResult{Check: "ratelimit", Status: types.PrecheckSkipped,
+			Message: "root zone of certificate unknown"}
+	}
+	period := rl.Period
+	if period <= 0 {
+		period = 7 * 24 * time.Hour
+	}
+
+	castate, err := p.Ctxt.GetStateMgr().NewSession()
+	if err != nil {
+		return types.NewPrecheckResult("ratelimit", "", err, "")
+	}
+	defer util.LogDefer(log, castate.Close)
+
+	issued, err := castate.GetNumberOfCertsIssuedSince(p.ID, cinfo.NameRZ, time.Now().Add(-period))
+	if err != nil {
+		return types.NewPrecheckResult("ratelimit", "", err, "")
+	}
+
+	if issued >= rl.CertsPerRootZone {
+		err = fmt.Errorf("rate limit reached, %d of %d certificates issued for root zone %s within %s",
+			issued, rl.CertsPerRootZone, cinfo.NameRZ, period)
+	}
+	return types.NewPrecheckResult("ratelimit", "", err, fmt.Sprintf(
+		"%d of %d certificates issued for root zone %s within %s, headroom %d",
+		issued, rl.CertsPerRootZone, cinfo.NameRZ, period, rl.CertsPerRootZone-issued))
+
+}
+
 func (p *CAProvider) ClaimCertificate(cinfo *types.CertificateClaimInfo) error {
 
 	acmeuser := p.userScheme.GetUserFor(cinfo.Name, cinfo.IssuedBy)
@@ -102,8 +222,8 @@ func (p *CAProvider) ClaimCertificate(cinfo *types.CertificateClaimInfo) error {
 		return err
 	}
 
-	return p.engine.TriggerUpdate(acmeuser, cinfo.Name, cinfo.Domains,
-		cinfo.IssuedBy, ttl, true)
+	return p.engine.TriggerUpdate(cinfo.Context(), acmeuser, cinfo.Name, cinfo.Domains,
+		cinfo.IssuedBy, ttl, true, false, cinfo.ReportProgress)
 
 }
 
@@ -114,7 +234,17 @@ func (p *CAProvider) RenewCertificate(cinfo *types.CertificateRenewInfo) error {
 			"Certificate to renew (caID '%s') does not belong to CA provider '%s'", cinfo.CAID, p.ID)}
 	}
 
-	return p.engine.TriggerUpdate("", cinfo.CertKey, nil, nil, cinfo.TTLSelected, false)
+	return p.engine.TriggerUpdate(cinfo.Context(), "", cinfo.CertKey, nil, nil, cinfo.TTLSelected, false, cinfo.Force, nil)
+
+}
+
+func (p *CAProvider) ModifyCertificate(cinfo *types.CertificateClaimInfo) error {
+
+	//the ACME user must stay the same, so the original issuer is expected in cinfo
+	acmeuser := p.userScheme.GetUserFor(cinfo.Name, cinfo.IssuedBy)
+
+	return p.engine.TriggerUpdate(cinfo.Context(), acmeuser, cinfo.Name, cinfo.Domains,
+		cinfo.IssuedBy, cinfo.TTLSelected, false, false, cinfo.ReportProgress)
 
 }
 
@@ -0,0 +1,33 @@
+package acme
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReachability(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/directory":
+			_, _ = w.Write([]byte(`{"newNonce":"https://ca/nonce","newOrder":"https://ca/order"}`))
+		case "/html":
+			_, _ = w.Write([]byte(`<html></html>`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	check := func(path string) error {
+		return (&CAProvider{C: &Config{API: srv.URL + path}}).CheckReachability()
+	}
+
+	assert.NoError(t, check("/directory"))
+	assert.ErrorContains(t, check("/html"), "not an ACME directory")
+	assert.ErrorContains(t, check("/down"), "503")
+
+}
@@ -1,6 +1,8 @@
 package acme
 
 import (
+	"time"
+
 	"github.com/dns3l/dns3l-core/ca/common"
 	ca_types "github.com/dns3l/dns3l-core/ca/types"
 )
@@ -28,6 +30,16 @@ type Config struct {
 	RootCertUrls               []string         `yaml:"rootCertUrls"`
 	DisableAIARetrieval        bool             `yaml:"disableAIARetrieval"`
 	DisableRootValidityCheck   bool             `yaml:"disableRootValidityCheck"`
+	CAAIdentities              []string         `yaml:"caaIdentities"`   //issuer domain names of the CA in CAA records, only used by claim dry runs
+	CAACheckServers            []string         `yaml:"caaCheckServers"` //DNS servers for CAA lookups, resolv.conf if empty
+	RateLimit                  RateLimitConfig  `yaml:"rateLimit"`
+}
+
+// Mirrors the CA's rate limit for certificates per root zone, only used by claim dry runs
+// to report the remaining headroom. Disabled if CertsPerRootZone is 0.
+type RateLimitConfig struct {
+	CertsPerRootZone uint          `yaml:"certsPerRootZone"`
+	Period           time.Duration `yaml:"period"` //defaults to one week
 }
 
 func (c *Config) NewInstance() (ca_types.CAProvider, error) {
@@ -2,6 +2,7 @@ package acme
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -17,11 +18,15 @@ import (
 	"github.com/dns3l/dns3l-core/ca/types"
 	cmn "github.com/dns3l/dns3l-core/common"
 	dnscommon "github.com/dns3l/dns3l-core/dns/common"
+	dnstypes "github.com/dns3l/dns3l-core/dns/types"
+	"github.com/dns3l/dns3l-core/metrics"
 	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/tracing"
 	"github.com/dns3l/dns3l-core/util"
 	"github.com/go-acme/lego/v4/certificate"
 	"github.com/go-acme/lego/v4/challenge/dns01"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const keyBitLength = 2048
@@ -40,9 +45,35 @@ type Engine struct {
 // TriggerUpdate ensures that a key/certificate pair of the given line is available. It expects that the user
 // is authenticated and authorized for the requested domain.
 // It will look up the current state of the user and the key/certificate and ensures that the user and
-// the requested key/cert is present.
-func (e *Engine) TriggerUpdate(acmeuser string, keyname string, domains []string,
-	issuedBy *authtypes.UserInfo, ttl time.Duration, mustNotExist bool) error {
+// the requested key/cert is present. If forceRenew is set, an existing cert is renewed even if
+// no renewal is due yet. progress is optional and called when the ACME flow reaches a ClaimStep.
+// The update is traced as a child span of ctx.
+func (e *Engine) TriggerUpdate(ctx context.Context, acmeuser string, keyname string, domains []string,
+	issuedBy *authtypes.UserInfo, ttl time.Duration, mustNotExist, forceRenew bool,
+	progress func(step string)) error {
+
+	ctx, span := tracing.Start(ctx, "acme.TriggerUpdate",
+		attribute.String("dns3l.ca", e.CAID),
+		attribute.String("dns3l.key", keyname))
+	err := e.triggerUpdate(ctx, acmeuser, keyname, domains, issuedBy, ttl, mustNotExist, forceRenew, progress)
+	var norenew *cmn.NoRenewalDueError
+	if errors.As(err, &norenew) {
+		span.SetAttributes(attribute.Bool("dns3l.renewal_due", false))
+		tracing.End(span, nil)
+	} else {
+		tracing.End(span, err)
+	}
+	return err
+
+}
+
+func (e *Engine) triggerUpdate(ctx context.Context, acmeuser string, keyname string, domains []string,
+	issuedBy *authtypes.UserInfo, ttl time.Duration, mustNotExist, forceRenew bool,
+	progress func(step string)) error {
+
+	if progress == nil {
+		progress = func(string) {}
+	}
 
 	keyMustExist := acmeuser == "" || issuedBy == nil || len(domains) <= 0
 
@@ -75,7 +106,7 @@ func (e *Engine) TriggerUpdate(acmeuser string, keyname string, domains []string
 	}
 	defer util.LogDefer(log, state.Close)
 
-	castate, err := e.Context.GetStateMgr().NewSession()
+	castate, err := e.Context.GetStateMgr().NewSessionContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -93,17 +124,23 @@ func (e *Engine) TriggerUpdate(acmeuser string, keyname string, domains []string
 	}
 
 	noKey := info == nil
+	domainsChanged := false
 
 	if !noKey {
 		if mustNotExist {
 			return &cmn.AlreadyExistsError{RequestedResource: keyname}
 		}
 		forceUpdate := false
+		if forceRenew {
+			log.Warnf("Renewal of key %s is forced, skipping due date check.", keyname)
+			forceUpdate = true
+		}
 		if len(domainsSanitized) > 0 && !util.StringSlicesEqual(info.Domains, domainsSanitized) {
 			log.Warnf("Domains for key %s have changed from %v to %v, must force update.",
 				keyname, info.Domains, domainsSanitized)
 			info.Domains = domainsSanitized
 			forceUpdate = true
+			domainsChanged = true
 		}
 		if acmeuser != "" && acmeuser != info.ACMEUser {
 			log.Warnf("ACME user for key %s has changed from %s to %s, must force update.",
@@ -129,7 +166,7 @@ func (e *Engine) TriggerUpdate(acmeuser string, keyname string, domains []string
 			}
 			if now.Before(renewalDate) {
 				//Not yet due for renewal
-				return &NoRenewalDueError{RenewalDate: renewalDate}
+				return &cmn.NoRenewalDueError{RenewalDate: renewalDate}
 			}
 			log.Infof("Key '%s' exists, cert is due for renewal", keyname)
 		}
@@ -171,10 +208,14 @@ func (e *Engine) TriggerUpdate(acmeuser string, keyname string, domains []string
 	}
 
 	dnsprov := e.NewDNSProviderDNS3L(e.Context)
+	dnsprov.Progress = progress
+	dnsprov.Ctx = ctx
 
 	err = u.GetClient().Challenge.SetDNS01Provider(dnsprov,
 		dns01.WrapPreCheck(func(domain, fqdn, value string, check dns01.PreCheckFunc) (bool, error) {
 			log.Debug("Skipping lego's DNS01 propagation check (ignore the previous 2 log lines).")
+			//lego calls this right before the challenge is validated
+			progress(types.ClaimStepValidating)
 			return true, nil
 		}))
 
@@ -198,7 +239,11 @@ func (e *Engine) TriggerUpdate(acmeuser string, keyname string, domains []string
 	}
 	log.Debugf("Requesting new certificate for key '%s', user '%s' via ACME",
 		keyname, acmeuser)
+	orderStart := time.Now()
+	_, orderSpan := tracing.Start(ctx, "acme.Obtain", attribute.StringSlice("dns3l.domains", info.Domains))
 	certificates, err := u.GetClient().Certificate.Obtain(request)
+	tracing.End(orderSpan, err)
+	metrics.ObserveSince(metrics.ACMEOrderDuration.WithLabelValues(e.CAID, metrics.Result(err)), orderStart)
 	if err != nil {
 		return err
 	}
@@ -233,8 +278,13 @@ func (e *Engine) TriggerUpdate(acmeuser string, keyname string, domains []string
 		return castate.PutCACertData(keyname, e.CAID, info, certStr, issuerCertStr)
 	}
 
+	var newDomains []string
+	if domainsChanged {
+		newDomains = info.Domains
+	}
+
 	return castate.UpdateCACertData(keyname, e.CAID, info.RenewedTime, info.NextRenewalTime,
-		info.ValidStartTime, info.ValidEndTime, certStr, issuerCertStr)
+		info.ValidStartTime, info.ValidEndTime, certStr, issuerCertStr, newDomains)
 
 }
 
@@ -397,14 +447,28 @@ func (e *Engine) NewDNSProviderDNS3L(ctx types.ProviderConfigurationContext) *DN
 
 // The DNSProviderWrapper implements lego's DNS01 validation hook with acmeotc
 type DNSProviderWrapper struct {
-	Context types.ProviderConfigurationContext
+	Context  types.ProviderConfigurationContext
+	Progress func(step string)
+	Ctx      context.Context //optional, the DNS provider calls are traced as child spans of it
+}
+
+func (p *DNSProviderWrapper) getDNSProviderForDomain(domain string) (dnstypes.DNSProvider, error) {
+	ctx := p.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	dnsprovider, err := p.Context.GetDNSProviderForDomain(ctx, domain, true)
+	if err != nil {
+		return nil, err
+	}
+	return dnscommon.TraceDNSProvider(p.Ctx, dnsprovider.GetInfo().Name, dnsprovider), nil
 }
 
 // Present is called when the DNS01 challenge record shall be set up in the DNS.
 // It wraps the acmeotc's DNS01 challenge setter into lego's DNS01 Present function.
 func (p *DNSProviderWrapper) Present(domain, token, keyAuth string) error {
 
-	dnsprovider, err := p.Context.GetDNSProviderForDomain(domain, true)
+	dnsprovider, err := p.getDNSProviderForDomain(domain)
 	if err != nil {
 		return err
 	}
@@ -422,7 +486,7 @@ func (p *DNSProviderWrapper) Present(domain, token, keyAuth string) error {
 		log.WithFields(logrus.Fields{"fqdn": fqdn, "challenge": challenge}).Debug("Starting DNS propagation check...")
 		rt := dnscommon.ResolveTester{}
 		rt.ConfigureFromPrecheckConf(chkconf)
-		err := rt.WaitForChallengeActive(fqdn, challenge)
+		err := rt.WaitForChallengeActive(p.Ctx, fqdn, challenge)
 		if err != nil {
 			return fmt.Errorf("DNS propagation pre-check did not succeed: %w", err)
 		}
@@ -431,6 +495,10 @@ func (p *DNSProviderWrapper) Present(domain, token, keyAuth string) error {
 		log.WithFields(logrus.Fields{"fqdn": fqdn, "challenge": challenge}).Debug("DNS propagation check disabled.")
 	}
 
+	if p.Progress != nil {
+		p.Progress(types.ClaimStepDNSSet)
+	}
+
 	return nil
 }
 
@@ -438,7 +506,7 @@ func (p *DNSProviderWrapper) Present(domain, token, keyAuth string) error {
 // It wraps the acmeotc's DNS01 challenge deleter into lego's DNS01 CleanUp function.
 func (p *DNSProviderWrapper) CleanUp(domain, token, keyAuth string) error {
 
-	dnsprovider, err := p.Context.GetDNSProviderForDomain(domain, true)
+	dnsprovider, err := p.getDNSProviderForDomain(domain)
 	if err != nil {
 		return err
 	}
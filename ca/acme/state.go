@@ -1,8 +1,9 @@
 package acme
 
 import (
-	"fmt"
 	"time"
+
+	cmn "github.com/dns3l/dns3l-core/common"
 )
 
 type ACMEStateManager interface {
@@ -20,12 +21,5 @@ type ACMEStateManagerSession interface {
 	DeleteACMEUser(userid string) error
 }
 
-//A NoRenewalDueError is thrown if the certificate is not yet outdated enough to be renewed
-//The service refuses to renew it in order not to hit rate limits on the ACME provider
-type NoRenewalDueError struct {
-	RenewalDate time.Time
-}
-
-func (e *NoRenewalDueError) Error() string {
-	return fmt.Sprintf("No renewal is due yet, earliest on %s", e.RenewalDate)
-}
+//Kept for compatibility, the error is defined in common so that users do not need to depend on the ACME provider
+type NoRenewalDueError = cmn.NoRenewalDueError
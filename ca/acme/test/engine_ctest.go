@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 	"github.com/dns3l/dns3l-core/ca/acme"
 	castate "github.com/dns3l/dns3l-core/ca/state"
 	"github.com/dns3l/dns3l-core/ca/types"
+	"github.com/dns3l/dns3l-core/common"
 	dns "github.com/dns3l/dns3l-core/dns"
 	dnscommon "github.com/dns3l/dns3l-core/dns/common"
 	dnstypes "github.com/dns3l/dns3l-core/dns/types"
@@ -42,7 +44,7 @@ func (ctx *ProvConfigurationContextImpl) GetStateMgr() types.CAStateManager {
 	return ctx.state
 }
 
-func (ctx *ProvConfigurationContextImpl) GetDNSProviderForDomain(domain string, challenge bool) (dnstypes.DNSProvider, error) {
+func (ctx *ProvConfigurationContextImpl) GetDNSProviderForDomain(_ context.Context, domain string, challenge bool) (dnstypes.DNSProvider, error) {
 	return ctx.dnsprov, nil
 }
 
@@ -119,10 +121,10 @@ func TestWithLEStaging() {
 		panic(err)
 	}
 
-	err = e.TriggerUpdate(acmeuser, domainName1, []string{domainName1, domainName2},
-		issuedBy, time.Duration(720)*time.Hour, false)
+	err = e.TriggerUpdate(context.Background(), acmeuser, domainName1, []string{domainName1, domainName2},
+		issuedBy, time.Duration(720)*time.Hour, false, false, nil)
 	if err != nil {
-		var norenew *acme.NoRenewalDueError
+		var norenew *common.NoRenewalDueError
 		if errors.As(err, &norenew) {
 			log.Infof("No renewal due yet, continuing. %s",
 				norenew.RenewalDate.Format(time.RFC3339))
@@ -132,9 +134,9 @@ func TestWithLEStaging() {
 	}
 
 	//this should trigger updating the existing key while getting details from database
-	err = e.TriggerUpdate("", domainName1, nil, nil, time.Duration(720)*time.Hour, false)
+	err = e.TriggerUpdate(context.Background(), "", domainName1, nil, nil, time.Duration(720)*time.Hour, false, false, nil)
 	if err != nil {
-		var norenew *acme.NoRenewalDueError
+		var norenew *common.NoRenewalDueError
 		if errors.As(err, &norenew) {
 			log.Infof("No renewal due yet, continuing. %s",
 				norenew.RenewalDate.Format(time.RFC3339))
@@ -54,13 +54,27 @@ func (p *CAProvider) IsEnabled() bool {
 
 }
 
+func (p *CAProvider) CheckConfig() error {
+	return p.C.TTL.Check()
+}
+
 func (p *CAProvider) PrecheckClaimCertificate(cinfo *types.CertificateClaimInfo) error {
 	return nil
 }
 
+func (p *CAProvider) DryRunClaimCertificate(cinfo *types.CertificateClaimInfo) []types.PrecheckResult {
+	ttl := 90 * 24 * time.Hour
+	if cinfo.TTLSelected > 0 {
+		ttl = cinfo.TTLSelected
+	}
+	return []types.PrecheckResult{
+		types.NewPrecheckResult("ttl", "", nil, fmt.Sprintf("certificate will be valid for %dd", util.DurationToDays(ttl))),
+	}
+}
+
 func (p *CAProvider) ClaimCertificate(cinfo *types.CertificateClaimInfo) error {
 
-	castate, err := p.Context.GetStateMgr().NewSession()
+	castate, err := p.Context.GetStateMgr().NewSessionContext(cinfo.Context())
 	if err != nil {
 		return err
 	}
@@ -97,19 +111,45 @@ func (p *CAProvider) ClaimCertificate(cinfo *types.CertificateClaimInfo) error {
 		log.Debugf("Using TTL %d for renewal (custom).", ttl/24/time.Hour)
 	}
 
+	certPem, issuerChain, err := createBogusCert(key, cinfo.Name, ttl)
+	if err != nil {
+		return err
+	}
+
+	info := &types.CACertInfo{
+		Name:            cinfo.Name,
+		PrivKey:         string(keyPem),
+		IssuedBy:        cinfo.IssuedBy,
+		ClaimTime:       time.Now(),
+		RenewedTime:     time.Now(),
+		NextRenewalTime: time.Now().Add(ttl),
+		ValidStartTime:  time.Now(),
+		ValidEndTime:    time.Now().Add(ttl),
+		Domains:         cinfo.Domains,
+		CertPEM:         certPem,
+		TTLSelected:     cinfo.TTLSelected,
+	} //TODO maybe there is the need to configure specific lifetimes for our tests
+
+	return castate.PutCACertData(cinfo.Name, p.ID, info,
+		info.CertPEM, issuerChain)
+
+}
+
+func createBogusCert(key *rsa.PrivateKey, name string, ttl time.Duration) (string, string, error) {
+
 	certStruct := x509.Certificate{
 		NotBefore:    time.Now(),
 		NotAfter:     time.Now().Add(ttl),
 		SerialNumber: big.NewInt(123456),
 		Subject: pkix.Name{
-			CommonName:   cinfo.Name,
+			CommonName:   name,
 			Organization: []string{"DNS3L Bogus Org"},
 		},
 		BasicConstraintsValid: true,
 	}
 	cert, err := x509.CreateCertificate(rand.Reader, &certStruct, &certStruct, &key.PublicKey, key)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	// Generate a pem block with the certificate
@@ -125,7 +165,7 @@ func (p *CAProvider) ClaimCertificate(cinfo *types.CertificateClaimInfo) error {
 		Bytes: cert,
 	})
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	err = pem.Encode(&issuerChain, &pem.Block{
@@ -133,26 +173,10 @@ func (p *CAProvider) ClaimCertificate(cinfo *types.CertificateClaimInfo) error {
 		Bytes: cert,
 	})
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
-	info := &types.CACertInfo{
-		Name:            cinfo.Name,
-		PrivKey:         string(keyPem),
-		IssuedBy:        cinfo.IssuedBy,
-		ClaimTime:       time.Now(),
-		RenewedTime:     time.Now(),
-		NextRenewalTime: time.Now().Add(ttl),
-		ValidStartTime:  time.Now(),
-		ValidEndTime:    time.Now().Add(ttl),
-		Domains:         cinfo.Domains,
-		CertPEM:         string(certPem),
-		TTLSelected:     cinfo.TTLSelected,
-	} //TODO maybe there is the need to configure specific lifetimes for our tests
-
-	return castate.PutCACertData(cinfo.Name, p.ID, info,
-		info.CertPEM, issuerChain.String())
-
+	return string(certPem), issuerChain.String(), nil
 }
 
 func (p *CAProvider) RenewCertificate(cinfo *types.CertificateRenewInfo) error {
@@ -187,7 +211,50 @@ func (p *CAProvider) RenewCertificate(cinfo *types.CertificateRenewInfo) error {
 
 	return castate.UpdateCACertData(cinfo.CertKey, p.ID, info.RenewedTime,
 		info.NextRenewalTime, info.ValidStartTime, info.ValidEndTime,
-		info.CertPEM, "BOGUS - IssuerCert (renewed)")
+		info.CertPEM, "BOGUS - IssuerCert (renewed)", nil)
+
+}
+
+func (p *CAProvider) ModifyCertificate(cinfo *types.CertificateClaimInfo) error {
+
+	castate, err := p.Context.GetStateMgr().NewSessionContext(cinfo.Context())
+	if err != nil {
+		return err
+	}
+	defer util.LogDefer(log, castate.Close)
+
+	info, err := castate.GetCACertByID(cinfo.Name, p.ID)
+	if err != nil {
+		return err
+	}
+
+	if info == nil {
+		return fmt.Errorf("key %s does not exist, cannot modify", cinfo.Name)
+	}
+
+	block, _ := pem.Decode([]byte(info.PrivKey))
+	if block == nil {
+		return fmt.Errorf("key %s has no valid PEM-encoded private key", cinfo.Name)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	var ttl = 90 * 24 * time.Hour
+	if cinfo.TTLSelected > 0 {
+		ttl = cinfo.TTLSelected
+	}
+
+	certPem, issuerChain, err := createBogusCert(key, cinfo.Name, ttl)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	return castate.UpdateCACertData(cinfo.Name, p.ID, now, now.Add(ttl), now, now.Add(ttl),
+		certPem, issuerChain, cinfo.Domains)
 
 }
 
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -16,6 +17,21 @@ type TTLConfig struct {
 	IgnoreUserTTL bool   `yaml:"ignoreUserTTL"`
 }
 
+// Check returns an error if the TTL bounds contradict each other.
+func (c *TTLConfig) Check() error {
+	var errs []error
+	if c.Max > 0 && c.Min > c.Max {
+		errs = append(errs, fmt.Errorf("ttl.min (%dd) is larger than ttl.max (%dd)", c.Min, c.Max))
+	}
+	if c.Default > 0 && c.Default < c.Min {
+		errs = append(errs, fmt.Errorf("ttl.default (%dd) is smaller than ttl.min (%dd)", c.Default, c.Min))
+	}
+	if c.Max > 0 && c.Default > c.Max {
+		errs = append(errs, fmt.Errorf("ttl.default (%dd) is larger than ttl.max (%dd)", c.Default, c.Max))
+	}
+	return errors.Join(errs...)
+}
+
 func GetTTL(cinfo *types.CertificateClaimInfo, config TTLConfig) (time.Duration, error) {
 	var ttl time.Duration = 0
 	if !config.IgnoreUserTTL && cinfo.TTLSelected > 0 {
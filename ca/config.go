@@ -1,6 +1,7 @@
 package ca
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/dns3l/dns3l-core/ca/types"
 	"github.com/dns3l/dns3l-core/dns"
 	dnstypes "github.com/dns3l/dns3l-core/dns/types"
+	"github.com/dns3l/dns3l-core/secrets"
 	"github.com/dns3l/dns3l-core/util"
 
 	"github.com/dns3l/dns3l-core/state"
@@ -17,6 +19,7 @@ import (
 
 type Config struct {
 	Providers map[string]*ProviderInfo `validate:"required,dive"` //configured DNS providers mapped with their ID
+	Queue     QueueConfig              `yaml:"queue"`
 	Functions *CAFunctionHandler
 }
 
@@ -33,6 +36,7 @@ type ProviderConfigurationContextImpl struct {
 	stateMgr types.CAStateManager
 	ctx      types.CAConfigurationContext
 	pinfo    *ProviderInfo
+	queue    *WorkQueue
 }
 
 // Can spawn a new instance of a DNS provider.
@@ -52,10 +56,12 @@ func (c *Config) Init(ctx types.CAConfigurationContext) error {
 		return err
 	}
 
-	c.Functions = &CAFunctionHandler{
-		Config: c,
-		State:  sm,
+	//a preset handler keeps its work queue and event emitter, e.g. on config reload
+	if c.Functions == nil {
+		c.Functions = &CAFunctionHandler{}
 	}
+	c.Functions.Config = c
+	c.Functions.State = sm
 
 	err = c.Functions.Init()
 	if err != nil {
@@ -70,6 +76,7 @@ func (c *Config) Init(ctx types.CAConfigurationContext) error {
 			stateMgr: sm,
 			ctx:      ctx,
 			pinfo:    v,
+			queue:    c.Functions.Queue,
 		})
 		if err != nil {
 			return err
@@ -108,6 +115,10 @@ func (f *ProviderInfo) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err != nil {
 		return err
 	}
+	err = secrets.ResolveAll(builder)
+	if err != nil {
+		return err
+	}
 	f.Type = t.Type
 	f.Prov, err = builder.NewInstance()
 	if err != nil {
@@ -156,26 +167,24 @@ func (sm *ProviderConfigurationContextImpl) GetDNSProvider(provID string) (dnsty
 }
 */
 
-func (sm *ProviderConfigurationContextImpl) GetDNSProviderForDomain(domain string, challenge bool) (dnstypes.DNSProvider, error) {
+func (sm *ProviderConfigurationContextImpl) GetDNSProviderForDomain(ctx context.Context, domain string,
+	challenge bool) (dnstypes.DNSProvider, error) {
 
 	rz, err := sm.pinfo.RootZones.GetLowestRZForDomain(domain)
 	if err != nil {
 		return nil, err
 	}
 
-	var prov dnstypes.DNSProvider
-	var exists bool
+	provID := rz.DNSProvAutoDNS
 	if challenge {
-		prov, exists = sm.ctx.GetDNSProvider(rz.DNSProvAcme)
-
-	} else {
-		prov, exists = sm.ctx.GetDNSProvider(rz.DNSProvAutoDNS)
+		provID = rz.DNSProvAcme
 	}
 
+	prov, exists := sm.ctx.GetDNSProvider(provID)
 	if !exists {
 		return nil, fmt.Errorf("DNS provider for domain '%s' not configured", domain)
 	}
 
-	return prov, nil
+	return sm.queue.WrapDNSProvider(ctx, provID, prov), nil
 
 }
@@ -1,62 +1,104 @@
 package ca
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/dns3l/dns3l-core/ca/common"
 	"github.com/dns3l/dns3l-core/ca/types"
 	cmn "github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/events"
+	"github.com/dns3l/dns3l-core/metrics"
 	"github.com/dns3l/dns3l-core/renew"
 	"github.com/dns3l/dns3l-core/util"
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	RenewalCacheTimeout = 10 * time.Second
+	RenewalCacheTimeout   = 10 * time.Second
+	CertStateCacheTimeout = 30 * time.Second
 )
 
+const (
+	CertStateValid    = "valid"    //valid and not expiring within the given duration
+	CertStateExpiring = "expiring" //valid, but expiring within the given duration
+	CertStateExpired  = "expired"
+)
+
+// Number of certificates of a CA in a root zone with the given state
+type CertStateCount struct {
+	CAID     string
+	RootZone string
+	State    string
+	Count    uint
+}
+
 // Provides API-close functions with
 type CAFunctionHandler struct {
 	Config      *Config
 	State       types.CAStateManager
+	Queue       *WorkQueue
+	Events      events.Emitter //optional, receives certificate lifecycle events
 	renewalInfo *util.SingleValCache[*renew.ServerInfoRenewal]
+	expiries    *util.SingleValCache[[]types.CertificateRenewInfo]
 }
 
 func (h *CAFunctionHandler) Init() error {
+	if h.Queue == nil {
+		var qconf *QueueConfig
+		if h.Config != nil {
+			qconf = &h.Config.Queue
+		}
+		h.Queue = NewWorkQueue(qconf)
+	}
 	h.renewalInfo = &util.SingleValCache[*renew.ServerInfoRenewal]{
 		Timeout: RenewalCacheTimeout,
 	}
+	h.expiries = &util.SingleValCache[[]types.CertificateRenewInfo]{
+		Timeout: CertStateCacheTimeout,
+	}
 	return nil
 }
 
 // Returns a function that will eventually claim certificate. Does pre-checks before that.
-func (h *CAFunctionHandler) PrepareClaimCertificate(caID string, cinfo *types.CertificateClaimInfo) (func() error, error) {
+// The claim takes a waiting slot in the CA queue, if the returned function is not going
+// to be called, the returned release function must be called to give it back.
+func (h *CAFunctionHandler) PrepareClaimCertificate(caID string, cinfo *types.CertificateClaimInfo) (func() error, func(), error) {
 	//TODO check exact semantics of name <> san relation and in case validate!
 
 	prov, exists := h.Config.Providers[caID]
 	if !exists {
-		return nil, fmt.Errorf("no CA provider with name '%s' exists", caID)
+		return nil, nil, fmt.Errorf("no CA provider with name '%s' exists", caID)
 	}
 	if !prov.Prov.IsEnabled() {
-		return nil, &cmn.DisabledError{RequestedResource: caID}
+		return nil, nil, &cmn.DisabledError{RequestedResource: caID}
 	}
 
 	for _, san := range cinfo.Domains {
 		if !prov.DomainIsInAllowedRootZone(util.GetDomainFQDNDot(san)) {
-			return nil, fmt.Errorf("subject alt name '%s' is not in the allowed root zones of CA provider '%s'",
+			return nil, nil, fmt.Errorf("subject alt name '%s' is not in the allowed root zones of CA provider '%s'",
 				san, caID)
 		}
 	}
 
-	err := prov.Prov.PrecheckClaimCertificate(cinfo)
+	reservation, err := h.Queue.ReserveCA(caID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	err = prov.Prov.PrecheckClaimCertificate(cinfo)
+	if err != nil {
+		reservation.Release()
+		return nil, nil, err
 	}
 
 	return func() error {
 
-		err := prov.Prov.ClaimCertificate(cinfo)
+		err := reservation.Run(cinfo.Context(), func() error {
+			return prov.Prov.ClaimCertificate(cinfo)
+		})
+		metrics.Claims.WithLabelValues(caID, metrics.Result(err)).Inc()
 		if err != nil {
 			return err
 		}
@@ -64,9 +106,100 @@ func (h *CAFunctionHandler) PrepareClaimCertificate(caID string, cinfo *types.Ce
 		prov.TotalValid.Invalidate()
 		prov.TotalIssued.Invalidate()
 
+		h.EmitCertEvent(events.TypeClaimed, caID, cinfo.Name, nil, nil)
+
 		return nil
 
-	}, nil
+	}, reservation.Release, nil
+
+}
+
+// Runs the checks of PrepareClaimCertificate and the provider-specific ones without touching
+// DNS or the CA and reports the results of all of them instead of stopping at the first failure.
+func (h *CAFunctionHandler) DryRunClaimCertificate(caID string, cinfo *types.CertificateClaimInfo) []types.PrecheckResult {
+
+	prov, exists := h.Config.Providers[caID]
+	if !exists {
+		return []types.PrecheckResult{types.NewPrecheckResult("ca", "",
+			fmt.Errorf("no CA provider with name '%s' exists", caID), "")}
+	}
+	if !prov.Prov.IsEnabled() {
+		return []types.PrecheckResult{types.NewPrecheckResult("ca", "",
+			&cmn.DisabledError{RequestedResource: caID}, "")}
+	}
+
+	res := []types.PrecheckResult{
+		types.NewPrecheckResult("ca", "", nil, fmt.Sprintf("CA provider '%s' exists and is enabled", caID)),
+	}
+
+	//the claim refuses to overwrite an existing certificate
+	existing, err := h.GetCertificateInfo(caID, cinfo.Name)
+	if err == nil && existing != nil {
+		err = &cmn.AlreadyExistsError{RequestedResource: cinfo.Name}
+	}
+	res = append(res, types.NewPrecheckResult("exists", "", err,
+		fmt.Sprintf("certificate '%s' does not exist yet", cinfo.Name)))
+
+	for _, san := range cinfo.Domains {
+		var err error
+		if !prov.DomainIsInAllowedRootZone(util.GetDomainFQDNDot(san)) {
+			err = fmt.Errorf("subject alt name '%s' is not in the allowed root zones of CA provider '%s'",
+				san, caID)
+		}
+		res = append(res, types.NewPrecheckResult("ca-rootzone", san, err, "domain is in an allowed root zone of CA"))
+	}
+
+	return append(res, prov.Prov.DryRunClaimCertificate(cinfo)...)
+
+}
+
+// Returns a function that will eventually re-issue an existing certificate with the domains given in cinfo.
+// Does the same pre-checks and queue reservation as PrepareClaimCertificate before that.
+func (h *CAFunctionHandler) PrepareModifyCertificate(caID string, cinfo *types.CertificateClaimInfo) (func() error, func(), error) {
+
+	prov, exists := h.Config.Providers[caID]
+	if !exists {
+		return nil, nil, fmt.Errorf("no CA provider with name '%s' exists", caID)
+	}
+	if !prov.Prov.IsEnabled() {
+		return nil, nil, &cmn.DisabledError{RequestedResource: caID}
+	}
+
+	for _, san := range cinfo.Domains {
+		if !prov.DomainIsInAllowedRootZone(util.GetDomainFQDNDot(san)) {
+			return nil, nil, fmt.Errorf("subject alt name '%s' is not in the allowed root zones of CA provider '%s'",
+				san, caID)
+		}
+	}
+
+	reservation, err := h.Queue.ReserveCA(caID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = prov.Prov.PrecheckClaimCertificate(cinfo)
+	if err != nil {
+		reservation.Release()
+		return nil, nil, err
+	}
+
+	return func() error {
+
+		err := reservation.Run(cinfo.Context(), func() error {
+			return prov.Prov.ModifyCertificate(cinfo)
+		})
+		if err != nil {
+			return err
+		}
+
+		prov.TotalValid.Invalidate()
+
+		//the certificate has been newly issued with a different set of domains
+		h.EmitCertEvent(events.TypeClaimed, caID, cinfo.Name, nil, nil)
+
+		return nil
+
+	}, reservation.Release, nil
 
 }
 
@@ -80,15 +213,31 @@ func (h *CAFunctionHandler) RenewCertificate(cinfo *types.CertificateRenewInfo)
 		return &cmn.DisabledError{RequestedResource: cinfo.CAID}
 	}
 
-	err := prov.Prov.RenewCertificate(cinfo)
+	//renewals are never rejected, they wait for their turn
+	err := h.Queue.RunCA(cinfo.Context(), cinfo.CAID, func() error {
+		return prov.Prov.RenewCertificate(cinfo)
+	})
+	var norenew *cmn.NoRenewalDueError
+	if errors.As(err, &norenew) {
+		return err
+	}
+	metrics.Renewals.WithLabelValues(cinfo.CAID, metrics.Result(err)).Inc()
 	if err != nil {
+		h.EmitCertEvent(events.TypeRenewalFailed, cinfo.CAID, cinfo.CertKey, nil, err)
 		return err
 	}
 
+	h.EmitCertEvent(events.TypeRenewed, cinfo.CAID, cinfo.CertKey, nil, nil)
+
 	return nil
 
 }
 
+// Returns a QueueFullError if the CA does not accept any more claims at the moment.
+func (h *CAFunctionHandler) ChkClaimCapacity(caID string) error {
+	return h.Queue.ChkCACapacity(caID)
+}
+
 // if caID is "", list for all CAs
 func (h *CAFunctionHandler) DeleteCertificate(caID, keyID string) error {
 
@@ -121,6 +270,7 @@ func (h *CAFunctionHandler) DeleteCertificate(caID, keyID string) error {
 	}
 
 	revokeerr := prov.Prov.RevokeCertificate(keyID, crt)
+	metrics.Revocations.WithLabelValues(caID, metrics.Result(revokeerr)).Inc()
 	if revokeerr != nil {
 		log.WithError(err).WithFields(logrus.Fields{
 			"caID":  caID,
@@ -131,6 +281,7 @@ func (h *CAFunctionHandler) DeleteCertificate(caID, keyID string) error {
 			"caID":  caID,
 			"keyID": keyID},
 		).Debugf("Successfully revoked certificate.")
+		h.EmitCertEvent(events.TypeRevoked, caID, keyID, crt, nil)
 	}
 
 	err = sess.DelCACertByID(keyID, caID)
@@ -138,6 +289,8 @@ func (h *CAFunctionHandler) DeleteCertificate(caID, keyID string) error {
 		return err
 	}
 
+	h.EmitCertEvent(events.TypeDeleted, caID, keyID, crt, nil)
+
 	err = prov.Prov.CleanupAfterDeletion(keyID, crt)
 	if err != nil {
 		log.WithError(err).WithField("caID", caID).Errorf("Problems cleaning up after deletion")
@@ -351,6 +504,19 @@ func (h *CAFunctionHandler) ListExpiring(expiredAt time.Time, limit uint) ([]typ
 
 }
 
+// Lists the certificates of a CA expiring before expiredAt including their domains and owner
+func (h *CAFunctionHandler) ListExpiringCertInfos(caID string, expiredAt time.Time) ([]types.CACertInfo, error) {
+
+	sess, err := h.State.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	return sess.ListExpiredCACerts(caID, expiredAt)
+
+}
+
 func (h *CAFunctionHandler) ListCertsToRenew(limit uint) ([]types.CertificateRenewInfo, error) {
 
 	sess, err := h.State.NewSession()
@@ -409,6 +575,57 @@ func (h *CAFunctionHandler) GetTotalIssued(caID string) (uint, error) {
 	})
 }
 
+// Counts the certificates per CA, root zone and state. Certificates are assigned to the root
+// zone of their name. The result is cached.
+func (h *CAFunctionHandler) GetCertStateCounts(expiringWithin time.Duration) ([]CertStateCount, error) {
+	//the expiries are cached instead of the counts, so that they can be computed for any expiringWithin
+	certs, err := h.expiries.GetCached(func() ([]types.CertificateRenewInfo, error) {
+		sess, err := h.State.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		defer util.LogDefer(log, sess.Close)
+
+		return sess.ListAllExpiries()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	counts := make(map[CertStateCount]uint)
+	//report zero for all allowed root zones so that the series do not vanish
+	for caID, prov := range h.Config.Providers {
+		for _, rz := range prov.RootZones {
+			for _, state := range []string{CertStateValid, CertStateExpiring, CertStateExpired} {
+				counts[CertStateCount{CAID: caID, RootZone: rz.Root, State: state}] = 0
+			}
+		}
+	}
+	for _, cert := range certs {
+		key := CertStateCount{CAID: cert.CAID, State: CertStateValid}
+		if prov, exists := h.Config.Providers[cert.CAID]; exists {
+			rz, err := prov.RootZones.GetLowestRZForDomain(util.GetDomainFQDNDot(cert.CertKey))
+			if err == nil {
+				key.RootZone = rz.Root
+			}
+		}
+		if !cert.ExpiresAt.After(now) {
+			key.State = CertStateExpired
+		} else if cert.ExpiresAt.Before(now.Add(expiringWithin)) {
+			key.State = CertStateExpiring
+		}
+		counts[key]++
+	}
+
+	res := make([]CertStateCount, 0, len(counts))
+	for key, count := range counts {
+		key.Count = count
+		res = append(res, key)
+	}
+	return res, nil
+}
+
 func (h *CAFunctionHandler) PutLastRenewSummary(renewal *renew.ServerInfoRenewal) error {
 	sess, err := h.State.NewSession()
 	if err != nil {
@@ -428,3 +645,37 @@ func (h *CAFunctionHandler) GetLastRenewSummary() (*renew.ServerInfoRenewal, err
 		return sess.GetLastRenewSummary()
 	})
 }
+
+// Emits a lifecycle event for the certificate if an event receiver is configured. The details
+// of the event are taken from crt or, if nil, looked up in the state.
+func (h *CAFunctionHandler) EmitCertEvent(typ events.Type, caID, keyID string, crt *types.CACertInfo, evErr error) {
+	if h.Events == nil {
+		return
+	}
+
+	ev := events.NewEvent(typ, caID, keyID)
+	if evErr != nil {
+		ev.Error = evErr.Error()
+	}
+
+	if crt == nil {
+		var err error
+		crt, err = h.GetCertificateInfo(caID, keyID)
+		if err != nil {
+			log.WithError(err).WithFields(logrus.Fields{"caID": caID, "keyID": keyID}).Warn(
+				"Could not get certificate details for event")
+		}
+	}
+	if crt != nil {
+		ev.Domains = crt.Domains
+		if crt.IssuedBy != nil {
+			ev.User = crt.IssuedBy.Email
+		}
+		if !crt.ValidEndTime.IsZero() {
+			expiresAt := crt.ValidEndTime.UTC()
+			ev.ExpiresAt = &expiresAt
+		}
+	}
+
+	h.Events.Emit(ev)
+}
@@ -1,11 +1,21 @@
 package ca
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
 	"time"
 
 	"testing"
 
 	"github.com/dns3l/dns3l-core/ca/types"
+	cmn "github.com/dns3l/dns3l-core/common"
 	"github.com/dns3l/dns3l-core/renew"
 	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
 	"github.com/dns3l/dns3l-core/util"
@@ -21,26 +31,48 @@ func (p *fakeCAProvider) IsEnabled() bool                               { return
 func (p *fakeCAProvider) PrecheckClaimCertificate(*types.CertificateClaimInfo) error {
 	return nil
 }
-func (p *fakeCAProvider) ClaimCertificate(*types.CertificateClaimInfo) error { return nil }
-func (p *fakeCAProvider) RenewCertificate(*types.CertificateRenewInfo) error { return nil }
-func (p *fakeCAProvider) RevokeCertificate(string, *types.CACertInfo) error  { return nil }
+func (p *fakeCAProvider) DryRunClaimCertificate(*types.CertificateClaimInfo) []types.PrecheckResult {
+	return nil
+}
+func (p *fakeCAProvider) ClaimCertificate(*types.CertificateClaimInfo) error  { return nil }
+func (p *fakeCAProvider) RenewCertificate(*types.CertificateRenewInfo) error  { return nil }
+func (p *fakeCAProvider) ModifyCertificate(*types.CertificateClaimInfo) error { return nil }
+func (p *fakeCAProvider) RevokeCertificate(string, *types.CACertInfo) error   { return nil }
 func (p *fakeCAProvider) CleanupAfterDeletion(string, *types.CACertInfo) error {
 	return nil
 }
 
 // fakeStateManager / fakeSession provide a state backend in which the requested
 // certificate exists and is deleted without error.
-type fakeStateManager struct{}
+type fakeStateManager struct {
+	sess *fakeSession
+}
 
 func (m *fakeStateManager) NewSession() (types.CAStateManagerSession, error) {
+	if m.sess != nil {
+		return m.sess, nil
+	}
 	return &fakeSession{}, nil
 }
 
-type fakeSession struct{}
+func (m *fakeStateManager) NewSessionContext(context.Context) (types.CAStateManagerSession, error) {
+	return m.NewSession()
+}
+
+type fakeSession struct {
+	versions   map[uint]*types.CertVersionInfo
+	rolledBack uint
+	expiries   []types.CertificateRenewInfo
+	domains    []string
+	noCert     bool
+}
 
 func (s *fakeSession) Close() error { return nil }
 
 func (s *fakeSession) GetCACertByID(keyID string, caID string) (*types.CACertInfo, error) {
+	if s.noCert {
+		return nil, nil
+	}
 	return &types.CACertInfo{Name: keyID}, nil
 }
 
@@ -54,7 +86,7 @@ func (s *fakeSession) PutCACertData(string, string, *types.CACertInfo, string, s
 	panic("not used in this test")
 }
 func (s *fakeSession) UpdateCACertData(string, string, time.Time, time.Time, time.Time,
-	time.Time, string, string) error {
+	time.Time, string, string, []string) error {
 	panic("not used in this test")
 }
 func (s *fakeSession) GetResource(string, string, bool, string) (string, error) {
@@ -66,15 +98,24 @@ func (s *fakeSession) GetResources(string, string, bool, ...string) ([]string, e
 func (s *fakeSession) GetNumberOfCerts(string, bool, time.Time) (uint, error) {
 	panic("not used in this test")
 }
+func (s *fakeSession) GetNumberOfCertsIssuedSince(string, string, time.Time) (uint, error) {
+	panic("not used in this test")
+}
 func (s *fakeSession) DeleteCertAllCA(string) error { panic("not used in this test") }
 func (s *fakeSession) ListExpired(time.Time, uint) ([]types.CertificateRenewInfo, error) {
 	panic("not used in this test")
 }
+func (s *fakeSession) ListAllExpiries() ([]types.CertificateRenewInfo, error) {
+	return s.expiries, nil
+}
+func (s *fakeSession) ListExpiredCACerts(string, time.Time) ([]types.CACertInfo, error) {
+	panic("not used in this test")
+}
 func (s *fakeSession) ListToRenew(time.Time, uint) ([]types.CertificateRenewInfo, error) {
 	panic("not used in this test")
 }
 func (s *fakeSession) GetDomains(string, string) ([]string, error) {
-	panic("not used in this test")
+	return s.domains, nil
 }
 func (s *fakeSession) UserHasCerts(*authtypes.UserInfo, string) (bool, error) {
 	panic("not used in this test")
@@ -85,6 +126,16 @@ func (s *fakeSession) GetLastRenewSummary() (*renew.ServerInfoRenewal, error) {
 func (s *fakeSession) PutLastRenewSummary(*renew.ServerInfoRenewal) error {
 	panic("not used in this test")
 }
+func (s *fakeSession) ListCertVersions(string, string) ([]types.CertVersionInfo, error) {
+	panic("not used in this test")
+}
+func (s *fakeSession) GetCertVersion(_, _ string, version uint) (*types.CertVersionInfo, error) {
+	return s.versions[version], nil
+}
+func (s *fakeSession) RollbackCertVersion(_, _ string, version uint) error {
+	s.rolledBack = version
+	return nil
+}
 
 // TestDeleteCertificatesAllCASucceeds is a regression test for issue #97:
 // a successful deletion must return a nil error. Previously the loop fell into
@@ -106,3 +157,120 @@ func TestDeleteCertificatesAllCASucceeds(t *testing.T) {
 		t.Fatalf("expected nil error on successful deletion, got: %v", err)
 	}
 }
+
+func TestDryRunClaimReportsExistingCertificate(t *testing.T) {
+	sess := &fakeSession{}
+	h := &CAFunctionHandler{
+		Config: &Config{Providers: map[string]*ProviderInfo{
+			"test-ca": {Type: "fake", Prov: &fakeCAProvider{}},
+		}},
+		State: &fakeStateManager{sess: sess},
+	}
+	cinfo := &types.CertificateClaimInfo{Name: "test.example.com."}
+
+	existsCheck := func() types.PrecheckResult {
+		for _, res := range h.DryRunClaimCertificate("test-ca", cinfo) {
+			if res.Check == "exists" {
+				return res
+			}
+		}
+		t.Fatal("expected an exists check")
+		return types.PrecheckResult{}
+	}
+
+	if res := existsCheck(); res.Status != types.PrecheckFailed {
+		t.Errorf("expected the check to fail for an existing certificate, got %+v", res)
+	}
+	sess.noCert = true
+	if res := existsCheck(); res.Status != types.PrecheckOK {
+		t.Errorf("expected the check to pass for a new certificate, got %+v", res)
+	}
+}
+
+func TestRollbackCertificateOnlyToValidVersions(t *testing.T) {
+	now := time.Now()
+	sess := &fakeSession{
+		versions: map[uint]*types.CertVersionInfo{
+			1: {Version: 1, ValidStartTime: now.Add(-90 * 24 * time.Hour), ValidEndTime: now.Add(-time.Hour),
+				CertPEM: testCertPEM(t, "test.example.com")},
+			2: {Version: 2, ValidStartTime: now.Add(-30 * 24 * time.Hour), ValidEndTime: now.Add(60 * 24 * time.Hour),
+				CertPEM: testCertPEM(t, "test.example.com")},
+			3: {Version: 3, ValidStartTime: now.Add(-20 * 24 * time.Hour), ValidEndTime: now.Add(70 * 24 * time.Hour),
+				CertPEM: testCertPEM(t, "test.example.com", "old.example.com")},
+			4: {Version: 4, ValidStartTime: now.Add(-time.Hour), ValidEndTime: now.Add(90 * 24 * time.Hour), Current: true,
+				CertPEM: testCertPEM(t, "test.example.com")},
+		},
+		domains: []string{"test.example.com."},
+	}
+	h := &CAFunctionHandler{State: &fakeStateManager{sess: sess}}
+
+	var invErr *cmn.InvalidInputError
+	if err := h.RollbackCertificate("test.example.com.", "test-ca", 1); !errors.As(err, &invErr) {
+		t.Fatalf("expected expired version to be rejected, got: %v", err)
+	}
+	if err := h.RollbackCertificate("test.example.com.", "test-ca", 3); !errors.As(err, &invErr) {
+		t.Fatalf("expected version with other domains to be rejected, got: %v", err)
+	}
+	var nfErr *cmn.NotFoundError
+	if err := h.RollbackCertificate("test.example.com.", "test-ca", 5); !errors.As(err, &nfErr) {
+		t.Fatalf("expected unknown version to be not found, got: %v", err)
+	}
+	if err := h.RollbackCertificate("test.example.com.", "test-ca", 2); err != nil {
+		t.Fatal(err)
+	}
+	if sess.rolledBack != 2 {
+		t.Fatalf("expected rollback to version 2, got %d", sess.rolledBack)
+	}
+}
+
+func testCertPEM(t *testing.T, dnsNames ...string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestCertStateCountsHonorExpiringWithin(t *testing.T) {
+	sess := &fakeSession{expiries: []types.CertificateRenewInfo{
+		{CAID: "test-ca", CertKey: "test.example.com.", ExpiresAt: time.Now().Add(10 * 24 * time.Hour)},
+	}}
+	h := &CAFunctionHandler{
+		Config: &Config{Providers: map[string]*ProviderInfo{
+			"test-ca": {Type: "fake", Prov: &fakeCAProvider{}},
+		}},
+		State: &fakeStateManager{sess: sess},
+	}
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	//the second call is served from the cache, but must still use its own expiringWithin
+	for _, tc := range []struct {
+		within time.Duration
+		state  string
+	}{
+		{7 * 24 * time.Hour, CertStateValid},
+		{30 * 24 * time.Hour, CertStateExpiring},
+	} {
+		counts, err := h.GetCertStateCounts(tc.within)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(counts) != 1 || counts[0].State != tc.state || counts[0].Count != 1 {
+			t.Fatalf("expiring within %s: expected 1 cert in state %s, got %+v", tc.within, tc.state, counts)
+		}
+	}
+}
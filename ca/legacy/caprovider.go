@@ -42,6 +42,12 @@ func (p *CAProvider) PrecheckClaimCertificate(cinfo *types.CertificateClaimInfo)
 	return nil
 }
 
+func (p *CAProvider) DryRunClaimCertificate(cinfo *types.CertificateClaimInfo) []types.PrecheckResult {
+	return []types.PrecheckResult{
+		types.NewPrecheckResult("ca-claim", "", errors.New("ClaimCertificate(..) not yet implemented"), ""),
+	}
+}
+
 func (p *CAProvider) ClaimCertificate(cinfo *types.CertificateClaimInfo) error {
 
 	return errors.New("ClaimCertificate(..) not yet implemented")
@@ -60,6 +66,12 @@ func (p *CAProvider) RenewCertificate(cinfo *types.CertificateRenewInfo) error {
 
 }
 
+func (p *CAProvider) ModifyCertificate(cinfo *types.CertificateClaimInfo) error {
+
+	return errors.New("ModifyCertificate(..) not yet implemented")
+
+}
+
 func (p *CAProvider) RevokeCertificate(keyID string, crt *types.CACertInfo) error {
 
 	return errors.New("RevokeCertificate(..) not yet implemented")
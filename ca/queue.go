@@ -0,0 +1,294 @@
+package ca
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	cmn "github.com/dns3l/dns3l-core/common"
+	dnstypes "github.com/dns3l/dns3l-core/dns/types"
+)
+
+const (
+	QueueKindCA          = "ca"
+	QueueKindDNSProvider = "dns"
+
+	DefaultQueueRetryAfter    = 30 * time.Second
+	DefaultQueueMaxConcurrent = 4
+	DefaultQueueMaxWaiting    = 50
+)
+
+// Limits the work done concurrently against the CAs and DNS providers. A limit or
+// MaxWaiting of 0 means unlimited, if they are not set the defaults apply.
+type QueueConfig struct {
+	MaxConcurrentPerCA          *uint           `yaml:"maxConcurrentPerCA"`
+	MaxConcurrentPerDNSProvider *uint           `yaml:"maxConcurrentPerDNSProvider"`
+	MaxWaiting                  *uint           `yaml:"maxWaiting"` //max. claims waiting per CA before new ones are rejected
+	RetryAfter                  time.Duration   `yaml:"retryAfter" default:"30s"`
+	CALimits                    map[string]uint `yaml:"caLimits"`          //overrides MaxConcurrentPerCA for single CAs
+	DNSProviderLimits           map[string]uint `yaml:"dnsProviderLimits"` //overrides MaxConcurrentPerDNSProvider for single DNS providers
+}
+
+func valueOrDefault(v *uint, def uint) uint {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+type QueueStat struct {
+	Kind    string
+	ID      string
+	Limit   uint
+	Running uint
+	Waiting uint
+}
+
+// WorkQueue runs claims and renewals with a bounded concurrency per CA provider
+// and DNS record writes with a bounded concurrency per DNS provider.
+type WorkQueue struct {
+	conf   *QueueConfig
+	mtx    sync.Mutex
+	queues map[string]*boundedQueue
+}
+
+type boundedQueue struct {
+	kind    string
+	id      string
+	limit   uint
+	sem     chan struct{} //nil if unlimited
+	running uint
+	waiting uint
+}
+
+func NewWorkQueue(conf *QueueConfig) *WorkQueue {
+	if conf == nil {
+		conf = &QueueConfig{}
+	}
+	return &WorkQueue{
+		conf:   conf,
+		queues: make(map[string]*boundedQueue),
+	}
+}
+
+func (q *WorkQueue) getQueue(kind, id string) *boundedQueue {
+	key := kind + "/" + id
+	bq, exists := q.queues[key]
+	if exists {
+		return bq
+	}
+
+	limit := valueOrDefault(q.conf.MaxConcurrentPerCA, DefaultQueueMaxConcurrent)
+	overrides := q.conf.CALimits
+	if kind == QueueKindDNSProvider {
+		limit = valueOrDefault(q.conf.MaxConcurrentPerDNSProvider, DefaultQueueMaxConcurrent)
+		overrides = q.conf.DNSProviderLimits
+	}
+	if l, exists := overrides[id]; exists {
+		limit = l
+	}
+
+	bq = &boundedQueue{kind: kind, id: id, limit: limit}
+	if limit > 0 {
+		bq.sem = make(chan struct{}, limit)
+	}
+	q.queues[key] = bq
+	return bq
+}
+
+func (q *WorkQueue) run(ctx context.Context, kind, id string, f func() error) error {
+
+	q.mtx.Lock()
+	bq := q.getQueue(kind, id)
+	bq.waiting++
+	q.mtx.Unlock()
+
+	return q.runWaiting(ctx, bq, f)
+
+}
+
+// Runs f on a queue where the caller has already been counted as waiting. If ctx is done
+// before a slot is free, the caller stops waiting and the error of ctx is returned.
+func (q *WorkQueue) runWaiting(ctx context.Context, bq *boundedQueue, f func() error) error {
+
+	if bq.sem != nil {
+		select {
+		case bq.sem <- struct{}{}:
+		case <-ctx.Done():
+			q.mtx.Lock()
+			bq.waiting--
+			q.mtx.Unlock()
+			return ctx.Err()
+		}
+	}
+
+	q.mtx.Lock()
+	bq.waiting--
+	bq.running++
+	q.mtx.Unlock()
+
+	defer func() {
+		q.mtx.Lock()
+		bq.running--
+		q.mtx.Unlock()
+		if bq.sem != nil {
+			<-bq.sem
+		}
+	}()
+
+	return f()
+
+}
+
+// Runs f as soon as the CA has a free slot, waits until then or until ctx is done.
+func (q *WorkQueue) RunCA(ctx context.Context, caID string, f func() error) error {
+	return q.run(ctx, QueueKindCA, caID, f)
+}
+
+// Runs f as soon as the DNS provider has a free slot, waits until then or until ctx is done.
+func (q *WorkQueue) RunDNSProvider(ctx context.Context, provID string, f func() error) error {
+	return q.run(ctx, QueueKindDNSProvider, provID, f)
+}
+
+func (q *WorkQueue) isFull(bq *boundedQueue) bool {
+	maxWaiting := valueOrDefault(q.conf.MaxWaiting, DefaultQueueMaxWaiting)
+	if maxWaiting <= 0 || bq.limit <= 0 {
+		return false
+	}
+	return bq.running+bq.waiting >= bq.limit+maxWaiting
+}
+
+func (q *WorkQueue) queueFullError(caID string) error {
+	retryAfter := q.conf.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = DefaultQueueRetryAfter
+	}
+	return &cmn.QueueFullError{Queue: caID, RetryAfter: retryAfter}
+}
+
+// Returns a QueueFullError if no more claims shall be accepted for the CA.
+func (q *WorkQueue) ChkCACapacity(caID string) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.isFull(q.getQueue(QueueKindCA, caID)) {
+		return q.queueFullError(caID)
+	}
+	return nil
+}
+
+// Like ChkCACapacity, but if the CA has capacity the caller is counted as waiting right
+// away, so that concurrent callers cannot all pass the check. The reservation must
+// either be run or released.
+func (q *WorkQueue) ReserveCA(caID string) (*QueueReservation, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	bq := q.getQueue(QueueKindCA, caID)
+	if q.isFull(bq) {
+		return nil, q.queueFullError(caID)
+	}
+	bq.waiting++
+	return &QueueReservation{queue: q, bq: bq}, nil
+}
+
+// A waiting slot of a CA queue obtained with ReserveCA.
+type QueueReservation struct {
+	queue *WorkQueue
+	bq    *boundedQueue
+	used  bool
+}
+
+func (r *QueueReservation) take() bool {
+	r.queue.mtx.Lock()
+	defer r.queue.mtx.Unlock()
+	if r.used {
+		return false
+	}
+	r.used = true
+	return true
+}
+
+// Runs f as soon as the CA has a free slot, waits until then or until ctx is done. A
+// reservation can only be run once.
+func (r *QueueReservation) Run(ctx context.Context, f func() error) error {
+	if !r.take() {
+		return errors.New("queue reservation has already been used or released")
+	}
+	return r.queue.runWaiting(ctx, r.bq, f)
+}
+
+// Gives the waiting slot back if the reservation has not been run, does nothing otherwise.
+func (r *QueueReservation) Release() {
+	if !r.take() {
+		return
+	}
+	r.queue.mtx.Lock()
+	r.bq.waiting--
+	r.queue.mtx.Unlock()
+}
+
+// Returns the state of all queues which have been used so far, sorted by kind and ID.
+func (q *WorkQueue) GetStats() []QueueStat {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	res := make([]QueueStat, 0, len(q.queues))
+	for _, bq := range q.queues {
+		res = append(res, QueueStat{
+			Kind:    bq.kind,
+			ID:      bq.id,
+			Limit:   bq.limit,
+			Running: bq.running,
+			Waiting: bq.waiting,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Kind != res[j].Kind {
+			return res[i].Kind < res[j].Kind
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// Wraps the record-changing functions of a DNS provider so that they go through the queue.
+// Setting records stops waiting when ctx is done, deleting them does not, since it rolls
+// back what has been set.
+func (q *WorkQueue) WrapDNSProvider(ctx context.Context, provID string, prov dnstypes.DNSProvider) dnstypes.DNSProvider {
+	return &queuedDNSProvider{DNSProvider: prov, id: provID, queue: q, ctx: ctx}
+}
+
+type queuedDNSProvider struct {
+	dnstypes.DNSProvider
+	id    string
+	queue *WorkQueue
+	ctx   context.Context
+}
+
+func (p *queuedDNSProvider) SetRecordAcmeChallenge(domainName string, challenge string) error {
+	return p.queue.RunDNSProvider(p.ctx, p.id, func() error {
+		return p.DNSProvider.SetRecordAcmeChallenge(domainName, challenge)
+	})
+}
+
+func (p *queuedDNSProvider) SetRecordA(domainName string, ttl uint32, addr net.IP) error {
+	return p.queue.RunDNSProvider(p.ctx, p.id, func() error {
+		return p.DNSProvider.SetRecordA(domainName, ttl, addr)
+	})
+}
+
+func (p *queuedDNSProvider) DeleteRecordAcmeChallenge(domainName string) error {
+	return p.queue.RunDNSProvider(context.Background(), p.id, func() error {
+		return p.DNSProvider.DeleteRecordAcmeChallenge(domainName)
+	})
+}
+
+func (p *queuedDNSProvider) DeleteRecordA(domainName string) error {
+	return p.queue.RunDNSProvider(context.Background(), p.id, func() error {
+		return p.DNSProvider.DeleteRecordA(domainName)
+	})
+}
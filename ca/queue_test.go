@@ -0,0 +1,225 @@
+package ca
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	cmn "github.com/dns3l/dns3l-core/common"
+)
+
+func TestWorkQueueLimitsConcurrency(t *testing.T) {
+	q := NewWorkQueue(&QueueConfig{
+		MaxConcurrentPerCA: uintPtr(4),
+		CALimits:           map[string]uint{"le": 2},
+	})
+
+	var mtx sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := q.RunCA(context.Background(), "le", func() error {
+				mtx.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mtx.Unlock()
+				<-release
+				mtx.Lock()
+				running--
+				mtx.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 2, Running: 2, Waiting: 3})
+	close(release)
+	wg.Wait()
+
+	if maxRunning != 2 {
+		t.Fatalf("expected at most 2 concurrent runs, got %d", maxRunning)
+	}
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 2})
+}
+
+func TestWorkQueueChkCACapacity(t *testing.T) {
+	q := NewWorkQueue(&QueueConfig{
+		MaxConcurrentPerCA: uintPtr(1),
+		MaxWaiting:         uintPtr(1),
+		RetryAfter:         10 * time.Second,
+	})
+
+	if err := q.ChkCACapacity("le"); err != nil {
+		t.Fatalf("expected capacity on idle queue, got %v", err)
+	}
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = q.RunCA(context.Background(), "le", func() error {
+				<-release
+				return nil
+			})
+		}()
+	}
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 1, Running: 1, Waiting: 1})
+
+	err := q.ChkCACapacity("le")
+	var qfe *cmn.QueueFullError
+	if !errors.As(err, &qfe) {
+		t.Fatalf("expected QueueFullError, got %v", err)
+	}
+	if qfe.RetryAfter != 10*time.Second {
+		t.Fatalf("unexpected retry after %s", qfe.RetryAfter)
+	}
+	if err := q.ChkCACapacity("other"); err != nil {
+		t.Fatalf("queues of other CAs must not be affected, got %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+}
+
+func TestWorkQueueReserveCA(t *testing.T) {
+	q := NewWorkQueue(&QueueConfig{
+		MaxConcurrentPerCA: uintPtr(1),
+		MaxWaiting:         uintPtr(1),
+	})
+
+	r1, err := q.ReserveCA("le")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := q.ReserveCA("le")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 1, Waiting: 2})
+
+	//both slots are reserved although nothing is running yet
+	var qfe *cmn.QueueFullError
+	if _, err := q.ReserveCA("le"); !errors.As(err, &qfe) {
+		t.Fatalf("expected QueueFullError, got %v", err)
+	}
+	if err := q.ChkCACapacity("le"); !errors.As(err, &qfe) {
+		t.Fatalf("expected QueueFullError, got %v", err)
+	}
+
+	r2.Release()
+	r2.Release()
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 1, Waiting: 1})
+
+	ran := false
+	err = r1.Run(context.Background(), func() error {
+		ran = true
+		return nil
+	})
+	if err != nil || !ran {
+		t.Fatalf("expected reservation to run, got %v", err)
+	}
+	r1.Release()
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 1})
+
+	if err := r1.Run(context.Background(), func() error { return nil }); err == nil {
+		t.Fatal("expected error when running a reservation twice")
+	}
+}
+
+func TestWorkQueueZeroMeansUnlimited(t *testing.T) {
+	q := NewWorkQueue(&QueueConfig{
+		MaxConcurrentPerCA: uintPtr(0),
+		MaxWaiting:         uintPtr(0),
+	})
+	for i := 0; i < DefaultQueueMaxConcurrent+DefaultQueueMaxWaiting+1; i++ {
+		if _, err := q.ReserveCA("le"); err != nil {
+			t.Fatalf("expected no limit, got %v", err)
+		}
+	}
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 0,
+		Waiting: DefaultQueueMaxConcurrent + DefaultQueueMaxWaiting + 1})
+
+	q = NewWorkQueue(&QueueConfig{})
+	if err := q.RunCA(context.Background(), "le", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: DefaultQueueMaxConcurrent})
+}
+
+func TestWorkQueueWaitCanceled(t *testing.T) {
+	q := NewWorkQueue(&QueueConfig{
+		MaxConcurrentPerCA: uintPtr(1),
+		MaxWaiting:         uintPtr(1),
+	})
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = q.RunCA(context.Background(), "le", func() error {
+			<-release
+			return nil
+		})
+	}()
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 1, Running: 1})
+
+	r, err := q.ReserveCA("le")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	res := make(chan error, 1)
+	go func() {
+		res <- r.Run(ctx, func() error {
+			t.Error("expected the canceled claim not to run")
+			return nil
+		})
+	}()
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 1, Running: 1, Waiting: 1})
+
+	cancel()
+	if err := <-res; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	//the waiting slot is free again
+	waitForQueueStat(t, q, QueueStat{Kind: QueueKindCA, ID: "le", Limit: 1, Running: 1})
+	if err := q.ChkCACapacity("le"); err != nil {
+		t.Fatalf("expected capacity after the claim stopped waiting, got %v", err)
+	}
+
+	close(release)
+	<-done
+}
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+func waitForQueueStat(t *testing.T, q *WorkQueue, expected QueueStat) {
+	t.Helper()
+	var stats []QueueStat
+	for i := 0; i < 200; i++ {
+		stats = q.GetStats()
+		for _, st := range stats {
+			if st == expected {
+				return
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("queue stat %+v not reached, have %+v", expected, stats)
+}
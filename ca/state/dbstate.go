@@ -1,6 +1,7 @@
 package state
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -13,7 +14,10 @@ import (
 	"github.com/dns3l/dns3l-core/renew"
 	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
 	"github.com/dns3l/dns3l-core/state"
+	"github.com/dns3l/dns3l-core/tracing"
 	"github.com/dns3l/dns3l-core/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type CAStateManagerSQL struct {
@@ -23,14 +27,24 @@ type CAStateManagerSQL struct {
 type CAStateManagerSQLSession struct {
 	prov *CAStateManagerSQL
 	db   *sql.DB
+	ctx  context.Context
 }
 
 func (m *CAStateManagerSQL) NewSession() (types.CAStateManagerSession, error) {
+	return m.NewSessionContext(context.Background())
+}
+
+func (m *CAStateManagerSQL) NewSessionContext(ctx context.Context) (types.CAStateManagerSession, error) {
 	db, err := m.Prov.GetDBConn()
 	if err != nil {
 		return nil, err
 	}
-	return &CAStateManagerSQLSession{db: db, prov: m}, nil
+	return &CAStateManagerSQLSession{db: db, prov: m, ctx: ctx}, nil
+}
+
+func (s *CAStateManagerSQLSession) startSpan(op string) trace.Span {
+	_, span := tracing.Start(s.ctx, "castate."+op, attribute.String("db.operation.name", op))
+	return span
 }
 
 func (s *CAStateManagerSQLSession) Close() error {
@@ -57,6 +71,8 @@ var caCertsQueryColumns = []string{
 }
 
 func (s *CAStateManagerSQLSession) GetCACertByID(keyname string, caid string) (*types.CACertInfo, error) {
+	span := s.startSpan("GetCACertByID")
+	defer span.End()
 
 	rows, err := s.db.Query(`SELECT `+strings.Join(caCertsQueryColumns, ",")+`
 	FROM `+s.prov.Prov.DBName("keycerts")+` 
@@ -188,6 +204,8 @@ func keycertsDistinctQueryStr(dbn func(name string) string) string {
 
 func (s *CAStateManagerSQLSession) ListCACerts(keyName string, caid string, authzFilter []string,
 	queryFilter string, pginfo *util.PaginationInfo) ([]types.CACertInfo, error) {
+	span := s.startSpan("ListCACerts")
+	defer span.End()
 
 	q, params := constructListCACertsQuery(s.prov.Prov.DBName, keyName, caid,
 		authzFilter, queryFilter, pginfo)
@@ -249,6 +267,8 @@ func (s *CAStateManagerSQLSession) rowToCACertInfo(rows *sql.Rows, info *types.C
 }
 
 func (s *CAStateManagerSQLSession) DelCACertByID(keyID string, caID string) error {
+	span := s.startSpan("DelCACertByID")
+	defer span.End()
 
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -274,6 +294,11 @@ func (s *CAStateManagerSQLSession) DelCACertByID(keyID string, caID string) erro
 		return err
 	}
 
+	err = s.delVersions(tx, keyID, caID)
+	if err != nil {
+		return err
+	}
+
 	if affected1 <= 0 && affected2 <= 0 {
 		return &common.NotFoundError{RequestedResource: keyID}
 	}
@@ -292,11 +317,19 @@ func (s *CAStateManagerSQLSession) DelCACertByID(keyID string, caID string) erro
 }
 
 func (s *CAStateManagerSQLSession) UpdateCACertData(keyname string, caid string, renewedTime, nextRenewalTime,
-	validStartTime, validEndTime time.Time, certStr, issuerCertStr string) error {
+	validStartTime, validEndTime time.Time, certStr, issuerCertStr string, domains []string) error {
+	span := s.startSpan("UpdateCACertData")
+	defer span.End()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer util.RollbackIfNotCommitted(log, tx)
 
 	log.Debugf("Updating certificate data for key '%s' in database",
 		keyname)
-	_, err := s.db.Exec(`UPDATE `+s.prov.Prov.DBName("keycerts")+` SET cert=?, issuer_cert=?, `+
+	_, err = tx.Exec(`UPDATE `+s.prov.Prov.DBName("keycerts")+` SET cert=?, issuer_cert=?, `+
 		`renewed_time=?, next_renewal_time=?, valid_start_time=?,
 				valid_end_time=?, renew_count = renew_count + 1 WHERE key_name=? AND ca_id=?;`,
 		certStr, issuerCertStr, renewedTime, nextRenewalTime, validStartTime, validEndTime, keyname, caid)
@@ -304,11 +337,33 @@ func (s *CAStateManagerSQLSession) UpdateCACertData(keyname string, caid string,
 		return fmt.Errorf("problem while storing new cert for existing key in database: %w",
 			err)
 	}
-	return nil
+
+	if domains != nil {
+		//domains have changed, replace them within the same transaction as the cert
+		log.Debugf("Replacing domains of key '%s' in database", keyname)
+		_, err = tx.Exec(`DELETE FROM `+s.prov.Prov.DBName("domains")+` WHERE key_name=? AND ca_id=?;`,
+			keyname, caid)
+		if err != nil {
+			return fmt.Errorf("problem while removing old domains for existing key in database: %w", err)
+		}
+		err = putDomains(tx, s.prov.Prov.DBName("domains"), keyname, caid, domains)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.putCurrentAsVersion(tx, keyname, caid)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (s *CAStateManagerSQLSession) PutCACertData(keyname string, caid string, info *types.CACertInfo,
 	certStr, issuerCertStr string) error {
+	span := s.startSpan("PutCACertData")
+	defer span.End()
 
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -331,21 +386,36 @@ func (s *CAStateManagerSQLSession) PutCACertData(keyname string, caid string, in
 		return fmt.Errorf("problem while storing new key and cert in database: %w", err)
 	}
 
-	for i, domain := range info.Domains {
-		_, err := tx.Exec(`INSERT INTO `+s.prov.Prov.DBName("domains")+` (dom_name_rev, key_name, ca_id, is_first_domain) `+
+	err = putDomains(tx, s.prov.Prov.DBName("domains"), keyname, caid, info.Domains)
+	if err != nil {
+		return err
+	}
+
+	err = s.putCurrentAsVersion(tx, keyname, caid)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+
+}
+
+func putDomains(tx *sql.Tx, table string, keyname string, caid string, domains []string) error {
+	for i, domain := range domains {
+		_, err := tx.Exec(`INSERT INTO `+table+` (dom_name_rev, key_name, ca_id, is_first_domain) `+
 			`VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE key_name=key_name;`,
 			util.StringReverse(util.GetDomainFQDNDot(domain)), keyname, caid, i == 0)
 		if err != nil {
 			return err
 		}
 	}
-
-	return tx.Commit()
-
+	return nil
 }
 
 // Needed for authz
 func (s *CAStateManagerSQLSession) GetDomains(keyName, caid string) ([]string, error) {
+	span := s.startSpan("GetDomains")
+	defer span.End()
 
 	rows, err := s.db.Query(`SELECT dom_name_rev FROM `+s.prov.Prov.DBName("domains")+` 
 	WHERE key_name=? AND ca_id=? ORDER BY is_first_domain DESC;`, keyName, caid)
@@ -380,6 +450,8 @@ func (s *CAStateManagerSQLSession) GetDomains(keyName, caid string) ([]string, e
 }
 
 func (s *CAStateManagerSQLSession) GetResource(keyName, caid string, increaseCtr bool, resourceName string) (string, error) {
+	span := s.startSpan("GetResource")
+	defer span.End()
 
 	returns, err := s.GetResources(keyName, caid, increaseCtr, resourceName)
 	if err != nil {
@@ -392,6 +464,8 @@ func (s *CAStateManagerSQLSession) GetResource(keyName, caid string, increaseCtr
 }
 
 func (s *CAStateManagerSQLSession) GetResources(keyName, caid string, increaseCtr bool, resourceNames ...string) ([]string, error) {
+	span := s.startSpan("GetResources")
+	defer span.End()
 
 	returns := make([]string, len(resourceNames))
 	returnsPtr := make([]interface{}, len(resourceNames))
@@ -426,6 +500,8 @@ func (s *CAStateManagerSQLSession) GetResources(keyName, caid string, increaseCt
 }
 
 func (s *CAStateManagerSQLSession) DeleteCertAllCA(keyID string) error {
+	span := s.startSpan("DeleteCertAllCA")
+	defer span.End()
 
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -451,6 +527,11 @@ func (s *CAStateManagerSQLSession) DeleteCertAllCA(keyID string) error {
 		return err
 	}
 
+	err = s.delVersions(tx, keyID, "")
+	if err != nil {
+		return err
+	}
+
 	if affected1 <= 0 && affected2 <= 0 {
 		return &common.NotFoundError{RequestedResource: keyID}
 	}
@@ -470,6 +551,9 @@ func (s *CAStateManagerSQLSession) DeleteCertAllCA(keyID string) error {
 
 func (s *CAStateManagerSQLSession) GetNumberOfCerts(caID string,
 	validonly bool, currentTime time.Time) (uint, error) {
+	span := s.startSpan("GetNumberOfCerts")
+	defer span.End()
+
 	q := squirrel.Select("count(*)").From(s.prov.Prov.DBName("keycerts"))
 	if caID != "" {
 		q = q.Where(squirrel.Eq{"ca_id": caID})
@@ -490,13 +574,39 @@ func (s *CAStateManagerSQLSession) GetNumberOfCerts(caID string,
 	return numrows, nil
 }
 
+func (s *CAStateManagerSQLSession) GetNumberOfCertsIssuedSince(caID string, rootZone string,
+	since time.Time) (uint, error) {
+	span := s.startSpan("GetNumberOfCertsIssuedSince")
+	defer span.End()
+
+	_, rzFilter := domainToReverseQueryForm(rootZone)
+
+	row := s.db.QueryRow(`SELECT COUNT(DISTINCT k.key_name) FROM `+s.prov.Prov.DBName("keycerts")+` k
+		JOIN `+s.prov.Prov.DBName("domains")+` d ON k.key_name = d.key_name AND k.ca_id = d.ca_id
+		WHERE k.ca_id = ? AND k.renewed_time >= ? AND d.dom_name_rev LIKE ?;`, caID, since, rzFilter)
+
+	var numrows uint
+	err := row.Scan(&numrows)
+	if err != nil {
+		return 0, err
+	}
+
+	return numrows, nil
+}
+
 func (s *CAStateManagerSQLSession) ListExpired(atTime time.Time,
 	limit uint) ([]types.CertificateRenewInfo, error) {
+	span := s.startSpan("ListExpired")
+	defer span.End()
+
 	return s.listTimeExpired(atTime, limit, "valid_end_time")
 }
 
 func (s *CAStateManagerSQLSession) ListToRenew(atTime time.Time,
 	limit uint) ([]types.CertificateRenewInfo, error) {
+	span := s.startSpan("ListToRenew")
+	defer span.End()
+
 	return s.listTimeExpired(atTime, limit, "next_renewal_time")
 }
 
@@ -505,6 +615,58 @@ func (s *CAStateManagerSQLSession) listTimeExpired(atTime time.Time, _ uint,
 	q := squirrel.Select("key_name", "ca_id", "valid_end_time", "next_renewal_time", "ttl_seconds").From(
 		s.prov.Prov.DBName("keycerts")).Where(squirrel.Lt{field: atTime}).OrderBy("valid_end_time")
 
+	return s.queryRenewInfos(q)
+}
+
+// ListAllExpiries implements types.CAStateManagerSession.
+func (s *CAStateManagerSQLSession) ListAllExpiries() ([]types.CertificateRenewInfo, error) {
+	span := s.startSpan("ListAllExpiries")
+	defer span.End()
+
+	q := squirrel.Select("key_name", "ca_id", "valid_end_time", "next_renewal_time", "ttl_seconds").From(
+		s.prov.Prov.DBName("keycerts")).Where(squirrel.NotEq{"valid_end_time": nil}).OrderBy("valid_end_time")
+
+	return s.queryRenewInfos(q)
+}
+
+// ListExpiredCACerts implements types.CAStateManagerSession.
+func (s *CAStateManagerSQLSession) ListExpiredCACerts(caid string, atTime time.Time) ([]types.CACertInfo, error) {
+	span := s.startSpan("ListExpiredCACerts")
+	defer span.End()
+
+	dbn := s.prov.Prov.DBName
+	rows, err := s.db.Query(`SELECT
+		`+keycertsDistinctQueryStr(dbn)+`
+		GROUP_CONCAT(`+dbn("domains")+`.dom_name_rev),COUNT(*) OVER () AS total_count
+		FROM `+dbn("domains")+` JOIN `+dbn("keycerts")+` USING (key_name, ca_id) WHERE
+		`+dbn("keycerts")+`.ca_id = ? AND `+dbn("keycerts")+`.valid_end_time < ?
+		GROUP BY key_name, ca_id
+		ORDER BY `+dbn("keycerts")+`.valid_end_time;`, caid, atTime)
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]types.CACertInfo, 0, 100)
+
+	var totalCount uint64
+	for rows.Next() {
+		res = append(res, types.CACertInfo{})
+		err = s.rowToCACertInfo(rows, &res[len(res)-1], &totalCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *CAStateManagerSQLSession) queryRenewInfos(q squirrel.SelectBuilder) ([]types.CertificateRenewInfo, error) {
+
 	rows, err := q.RunWith(s.db).Query()
 	if err != nil {
 		return nil, err
@@ -535,6 +697,8 @@ func (s *CAStateManagerSQLSession) listTimeExpired(atTime time.Time, _ uint,
 }
 
 func (s *CAStateManagerSQLSession) UserHasCerts(user *authtypes.UserInfo, caid string) (bool, error) {
+	span := s.startSpan("UserHasCerts")
+	defer span.End()
 
 	row := s.db.QueryRow(`SELECT COUNT(*) FROM `+s.prov.Prov.DBName("keycerts")+
 		` WHERE issued_by=? AND issued_by_email=? AND ca_id=? LIMIT 1;`, user.Name, user.Email, caid)
@@ -554,6 +718,9 @@ func (s *CAStateManagerSQLSession) UserHasCerts(user *authtypes.UserInfo, caid s
 
 // PutLastRenewSummary implements types.CAStateManagerSession.
 func (s *CAStateManagerSQLSession) PutLastRenewSummary(info *renew.ServerInfoRenewal) error {
+	span := s.startSpan("PutLastRenewSummary")
+	defer span.End()
+
 	infoBytes, err := json.Marshal(info)
 	if err != nil {
 		return fmt.Errorf("error while marshaling renew info: %w", err)
@@ -564,6 +731,8 @@ func (s *CAStateManagerSQLSession) PutLastRenewSummary(info *renew.ServerInfoRen
 
 // GetLastRenewSummary implements types.CAStateManagerSession.
 func (s *CAStateManagerSQLSession) GetLastRenewSummary() (*renew.ServerInfoRenewal, error) {
+	span := s.startSpan("GetLastRenewSummary")
+	defer span.End()
 
 	var resultBytes string
 	row := s.db.QueryRow(`SELECT renew_info FROM ` + s.prov.Prov.DBName("renew_info") + `;`)
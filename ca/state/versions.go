@@ -0,0 +1,161 @@
+package state
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dns3l/dns3l-core/ca/types"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+// Copies the current certificate of keycerts into the version history as its newest version.
+// The private key is stored once per certificate and referenced by its hash from the versions,
+// since renewals keep the key. The keys are deleted along with the certificate's versions.
+func (s *CAStateManagerSQLSession) putCurrentAsVersion(tx *sql.Tx, keyname, caid string) error {
+	versionsTable := s.prov.Prov.DBName("cert_versions")
+	keycertsTable := s.prov.Prov.DBName("keycerts")
+
+	_, err := tx.Exec(`UPDATE `+versionsTable+` SET is_current=FALSE WHERE key_name=? AND ca_id=?;`,
+		keyname, caid)
+	if err != nil {
+		return fmt.Errorf("problem while updating certificate versions: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT IGNORE INTO `+s.prov.Prov.DBName("cert_version_keys")+` (ca_id, key_name,
+	key_hash, priv_key) SELECT k.ca_id, k.key_name, SHA2(k.priv_key, 256), k.priv_key
+	FROM `+keycertsTable+` k WHERE k.key_name=? AND k.ca_id=?;`,
+		keyname, caid)
+	if err != nil {
+		return fmt.Errorf("problem while storing certificate version key: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO `+versionsTable+` (ca_id, key_name, version, key_hash, cert, issuer_cert,
+	issued_time, valid_start_time, valid_end_time, is_current)
+	SELECT k.ca_id, k.key_name, (SELECT COALESCE(MAX(v.version), 0) + 1 FROM `+versionsTable+` v
+	WHERE v.key_name=k.key_name AND v.ca_id=k.ca_id), SHA2(k.priv_key, 256), k.cert, k.issuer_cert,
+	k.renewed_time, k.valid_start_time, k.valid_end_time, TRUE
+	FROM `+keycertsTable+` k WHERE k.key_name=? AND k.ca_id=?;`,
+		keyname, caid)
+	if err != nil {
+		return fmt.Errorf("problem while storing certificate version: %w", err)
+	}
+
+	return nil
+}
+
+// Deletes the versions of a certificate along with their keys, of all CAs if caid is empty
+func (s *CAStateManagerSQLSession) delVersions(tx *sql.Tx, keyname, caid string) error {
+	for _, table := range []string{"cert_versions", "cert_version_keys"} {
+		query := `DELETE FROM ` + s.prov.Prov.DBName(table) + ` WHERE key_name=?`
+		args := []interface{}{keyname}
+		if caid != "" {
+			query += ` AND ca_id=?`
+			args = append(args, caid)
+		}
+		_, err := tx.Exec(query+`;`, args...)
+		if err != nil {
+			return fmt.Errorf("problem while deleting certificate versions: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *CAStateManagerSQLSession) ListCertVersions(keyName, caid string) ([]types.CertVersionInfo, error) {
+	span := s.startSpan("ListCertVersions")
+	defer span.End()
+
+	rows, err := s.db.Query(`SELECT version, cert, issuer_cert, issued_time, valid_start_time,
+	valid_end_time, is_current FROM `+s.prov.Prov.DBName("cert_versions")+`
+	WHERE key_name=? AND ca_id=? ORDER BY version DESC;`, keyName, caid)
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]types.CertVersionInfo, 0, 10)
+	for rows.Next() {
+		info := types.CertVersionInfo{}
+		var valid_start_time, valid_end_time *time.Time
+		err := rows.Scan(&info.Version, &info.CertPEM, &info.IssuerCertPEM, &info.IssuedTime,
+			&valid_start_time, &valid_end_time, &info.Current)
+		if err != nil {
+			return nil, err
+		}
+		info.ValidStartTime = NilToZeroTime(valid_start_time)
+		info.ValidEndTime = NilToZeroTime(valid_end_time)
+		res = append(res, info)
+	}
+
+	return res, rows.Err()
+}
+
+func (s *CAStateManagerSQLSession) GetCertVersion(keyName, caid string, version uint) (*types.CertVersionInfo, error) {
+	span := s.startSpan("GetCertVersion")
+	defer span.End()
+
+	info := &types.CertVersionInfo{}
+	var valid_start_time, valid_end_time *time.Time
+	err := s.db.QueryRow(`SELECT v.version, vk.priv_key, v.cert, v.issuer_cert, v.issued_time, v.valid_start_time,
+	v.valid_end_time, v.is_current FROM `+s.prov.Prov.DBName("cert_versions")+` v
+	JOIN `+s.prov.Prov.DBName("cert_version_keys")+` vk
+	ON vk.ca_id=v.ca_id AND vk.key_name=v.key_name AND vk.key_hash=v.key_hash
+	WHERE v.key_name=? AND v.ca_id=? AND v.version=? LIMIT 1;`, keyName, caid, version).Scan(
+		&info.Version, &info.PrivKey, &info.CertPEM, &info.IssuerCertPEM, &info.IssuedTime,
+		&valid_start_time, &valid_end_time, &info.Current)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	info.ValidStartTime = NilToZeroTime(valid_start_time)
+	info.ValidEndTime = NilToZeroTime(valid_end_time)
+
+	return info, nil
+}
+
+func (s *CAStateManagerSQLSession) RollbackCertVersion(keyName, caid string, version uint) error {
+	span := s.startSpan("RollbackCertVersion")
+	defer span.End()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer util.RollbackIfNotCommitted(log, tx)
+
+	versionsTable := s.prov.Prov.DBName("cert_versions")
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+versionsTable+` v JOIN `+s.prov.Prov.DBName("keycerts")+` k
+	ON v.key_name=k.key_name AND v.ca_id=k.ca_id WHERE v.key_name=? AND v.ca_id=? AND v.version=?);`,
+		keyName, caid, version).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return &common.NotFoundError{RequestedResource: fmt.Sprintf("%s version %d", keyName, version)}
+	}
+
+	//The renewal must not wait longer than the end of the older certificate's validity
+	_, err = tx.Exec(`UPDATE `+s.prov.Prov.DBName("keycerts")+` k JOIN `+versionsTable+` v
+	ON v.key_name=k.key_name AND v.ca_id=k.ca_id AND v.version=?
+	JOIN `+s.prov.Prov.DBName("cert_version_keys")+` vk
+	ON vk.ca_id=v.ca_id AND vk.key_name=v.key_name AND vk.key_hash=v.key_hash
+	SET k.priv_key=vk.priv_key, k.cert=v.cert, k.issuer_cert=v.issuer_cert,
+	k.valid_start_time=v.valid_start_time, k.valid_end_time=v.valid_end_time,
+	k.next_renewal_time=LEAST(COALESCE(k.next_renewal_time, v.valid_end_time), v.valid_end_time)
+	WHERE k.key_name=? AND k.ca_id=?;`, version, keyName, caid)
+	if err != nil {
+		return fmt.Errorf("problem while rolling back certificate: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE `+versionsTable+` SET is_current=(version=?) WHERE key_name=? AND ca_id=?;`,
+		version, keyName, caid)
+	if err != nil {
+		return fmt.Errorf("problem while updating certificate versions: %w", err)
+	}
+
+	return tx.Commit()
+}
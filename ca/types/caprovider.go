@@ -1,6 +1,10 @@
 package types
 
-import dnstypes "github.com/dns3l/dns3l-core/dns/types"
+import (
+	"context"
+
+	dnstypes "github.com/dns3l/dns3l-core/dns/types"
+)
 
 type CAProviderInfo struct {
 	Name        string
@@ -21,19 +25,38 @@ type CAProvider interface {
 
 	PrecheckClaimCertificate(cinfo *CertificateClaimInfo) error
 
+	//Runs all provider-specific checks of a claim without touching DNS or the CA and reports their results
+	DryRunClaimCertificate(cinfo *CertificateClaimInfo) []PrecheckResult
+
 	ClaimCertificate(cinfo *CertificateClaimInfo) error
 
 	RenewCertificate(cinfo *CertificateRenewInfo) error
 
+	//Re-issues an existing certificate under the same key name with the domains given in cinfo
+	ModifyCertificate(cinfo *CertificateClaimInfo) error
+
 	RevokeCertificate(keyID string, crt *CACertInfo) error
 
 	//May be called even if CAProvider does not manage key, should return nil then
 	CleanupAfterDeletion(keyID string, crt *CACertInfo) error
 }
 
+// Optionally implemented by CA providers with settings the validate tags cannot check
+type ConfigChecker interface {
+	//Checks the provider config without contacting the CA
+	CheckConfig() error
+}
+
+// Optionally implemented by CA providers which depend on a remote CA
+type ReachabilityChecker interface {
+	//Checks if the CA can be reached, without changing anything
+	CheckReachability() error
+}
+
 type ProviderConfigurationContext interface {
 	GetCAID() string
 	GetStateMgr() CAStateManager
 	//GetDNSProvider(provID string) (dnstypes.DNSProvider, bool)
-	GetDNSProviderForDomain(domain string, challenge bool) (dnstypes.DNSProvider, error)
+	//Setting records with the returned provider stops waiting for the DNS provider's queue when ctx is done
+	GetDNSProviderForDomain(ctx context.Context, domain string, challenge bool) (dnstypes.DNSProvider, error)
 }
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -17,12 +18,32 @@ type CertificateResources struct {
 	FullChain   string
 }
 
+const (
+	ClaimStepDNSSet     = "dns-set"    // the DNS01 challenge records have been set
+	ClaimStepValidating = "validating" // the CA is validating the DNS01 challenges
+)
+
 type CertificateClaimInfo struct {
 	Name        string
 	NameRZ      string
 	Domains     []string
 	IssuedBy    *authtypes.UserInfo
 	TTLSelected time.Duration
+	Progress    func(step string) // optional, called by CA providers when the claim reaches a ClaimStep
+	Ctx         context.Context   // optional, carries the trace of the claim
+}
+
+func (c *CertificateClaimInfo) Context() context.Context {
+	if c.Ctx == nil {
+		return context.Background()
+	}
+	return c.Ctx
+}
+
+func (c *CertificateClaimInfo) ReportProgress(step string) {
+	if c.Progress != nil {
+		c.Progress(step)
+	}
 }
 
 type CertificateRenewInfo struct {
@@ -31,12 +52,46 @@ type CertificateRenewInfo struct {
 	ExpiresAt   time.Time
 	NextRenewal time.Time
 	TTLSelected time.Duration
+	Force       bool            // renew even if no renewal is due yet
+	JobID       uint64          // ID of the persisted renewal job, 0 if it has not been enqueued
+	Ctx         context.Context // optional, canceled if the renewal has to be aborted
+}
+
+func (c *CertificateRenewInfo) Context() context.Context {
+	if c.Ctx == nil {
+		return context.Background()
+	}
+	return c.Ctx
 }
 
 func (c *CertificateRenewInfo) String() string {
 	return fmt.Sprintf("%s, %s, exp=%s rnw=%s", c.CAID, c.CertKey, c.ExpiresAt.Format(time.RFC3339), c.NextRenewal.Format(time.RFC3339))
 }
 
+type PrecheckStatus string
+
+const (
+	PrecheckOK      PrecheckStatus = "ok"
+	PrecheckFailed  PrecheckStatus = "failed"
+	PrecheckSkipped PrecheckStatus = "skipped"
+)
+
+// Result of a single check done for a claim dry run. Domain is empty if the check
+// does not refer to a specific domain.
+type PrecheckResult struct {
+	Check   string
+	Domain  string
+	Status  PrecheckStatus
+	Message string
+}
+
+func NewPrecheckResult(check, domain string, err error, okMsg string) PrecheckResult {
+	if err != nil {
+		return PrecheckResult{Check: check, Domain: domain, Status: PrecheckFailed, Message: err.Error()}
+	}
+	return PrecheckResult{Check: check, Domain: domain, Status: PrecheckOK, Message: okMsg}
+}
+
 type CAConfigurationContext interface {
 	GetStateProvider() state.StateProvider
 	GetDNSProvider(provID string) (dnstypes.DNSProvider, bool)
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"time"
 
 	"github.com/dns3l/dns3l-core/renew"
@@ -10,6 +11,8 @@ import (
 
 type CAStateManager interface {
 	NewSession() (CAStateManagerSession, error)
+	//Like NewSession, but the database calls of the session are traced as child spans of ctx
+	NewSessionContext(ctx context.Context) (CAStateManagerSession, error)
 }
 
 type CAStateManagerSession interface {
@@ -24,8 +27,9 @@ type CAStateManagerSession interface {
 
 	PutCACertData(keyname string, caid string, info *CACertInfo, certStr, issuerCertStr string) error
 
+	//If domains is nil, the domains of the certificate are left untouched
 	UpdateCACertData(keyname string, caid string, renewedTime, nextRenewalTime,
-		validStartTime, validEndTime time.Time, certStr, issuerCertStr string) error
+		validStartTime, validEndTime time.Time, certStr, issuerCertStr string, domains []string) error
 
 	GetResource(keyID string, caid string, increaseCtr bool, resourceName string) (string, error)
 
@@ -33,12 +37,21 @@ type CAStateManagerSession interface {
 
 	GetNumberOfCerts(caID string, validonly bool, currentTime time.Time) (uint, error)
 
+	//Counts the certificates of a CA with a domain in rootZone that have been issued or renewed since the given time
+	GetNumberOfCertsIssuedSince(caID string, rootZone string, since time.Time) (uint, error)
+
 	DeleteCertAllCA(keyID string) error
 
 	ListExpired(atTime time.Time, limit uint) ([]CertificateRenewInfo, error)
 
 	ListToRenew(atTime time.Time, limit uint) ([]CertificateRenewInfo, error)
 
+	//Lists all certificates with a known expiry date
+	ListAllExpiries() ([]CertificateRenewInfo, error)
+
+	//Lists the certificates of a CA which expire before atTime including their domains, ordered by expiry
+	ListExpiredCACerts(caid string, atTime time.Time) ([]CACertInfo, error)
+
 	GetDomains(keyName, caid string) ([]string, error)
 
 	UserHasCerts(user *authtypes.UserInfo, caid string) (bool, error)
@@ -46,6 +59,15 @@ type CAStateManagerSession interface {
 	GetLastRenewSummary() (*renew.ServerInfoRenewal, error)
 
 	PutLastRenewSummary(*renew.ServerInfoRenewal) error
+
+	//Lists all issued versions of a certificate, newest first. The private keys are not returned.
+	ListCertVersions(keyName, caid string) ([]CertVersionInfo, error)
+
+	//Returns nil if the version does not exist
+	GetCertVersion(keyName, caid string, version uint) (*CertVersionInfo, error)
+
+	//Makes the given version the current certificate again
+	RollbackCertVersion(keyName, caid string, version uint) error
 }
 
 type CACertInfo struct {
@@ -65,3 +87,14 @@ type CACertInfo struct {
 	AccessCount     uint
 	TTLSelected     time.Duration
 }
+
+type CertVersionInfo struct {
+	Version        uint
+	PrivKey        string
+	CertPEM        string
+	IssuerCertPEM  string
+	IssuedTime     time.Time
+	ValidStartTime time.Time
+	ValidEndTime   time.Time
+	Current        bool
+}
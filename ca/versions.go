@@ -0,0 +1,189 @@
+package ca
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/dns3l/dns3l-core/ca/common"
+	"github.com/dns3l/dns3l-core/ca/types"
+	cmn "github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
+)
+
+// Returns all issued versions of a certificate, newest first, and the domains of the certificate
+func (h *CAFunctionHandler) GetCertificateVersions(keyID, caID string) ([]types.CertVersionInfo, []string, error) {
+
+	err := common.ValidateKeyName(keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sess, err := h.State.NewSession()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	domains, err := sess.GetDomains(keyID, caID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	versions, err := sess.ListCertVersions(keyID, caID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return versions, domains, nil
+
+}
+
+// Like GetCertificateResource, but returns the resource of an earlier issued version
+func (h *CAFunctionHandler) GetCertificateVersionResource(keyID, caID string, version uint,
+	objectType string) (*common.PEMResource, error) {
+
+	log.WithFields(logrus.Fields{
+		"keyID":      keyID,
+		"caID":       caID,
+		"version":    version,
+		"objectType": objectType},
+	).Debug("Request for certificate version resource")
+
+	err := common.ValidateKeyName(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := h.State.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	domains, err := sess.GetDomains(keyID, caID)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := sess.GetCertVersion(keyID, caID, version)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, &cmn.NotFoundError{RequestedResource: fmt.Sprintf("%s version %d", keyID, version)}
+	}
+
+	res := &common.PEMResource{
+		ContentType: "application/x-pem-file",
+		Domains:     domains,
+		CanBePublic: true,
+	}
+
+	switch objectType {
+	case "key":
+		res.PEMData = v.PrivKey
+		res.CanBePublic = false
+	case "crt":
+		res.PEMData = v.CertPEM
+	case "rootchain": //chain with root cert
+		res.PEMData = v.IssuerCertPEM
+	case "root":
+		res.PEMData, _, err = util.SplitOffRootCertPEM(v.IssuerCertPEM)
+	case "chain": //chain without root
+		_, res.PEMData, err = util.SplitOffRootCertPEM(v.IssuerCertPEM)
+	case "fullchain":
+		res.PEMData = v.CertPEM + "\n" + v.IssuerCertPEM
+	default:
+		return nil, &cmn.NotFoundError{RequestedResource: objectType}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+
+}
+
+// Makes an earlier issued version the current certificate again. Only versions which are
+// still valid and have been issued for the current domains can be rolled back to.
+func (h *CAFunctionHandler) RollbackCertificate(keyID, caID string, version uint) error {
+
+	err := common.ValidateKeyName(keyID)
+	if err != nil {
+		return err
+	}
+
+	sess, err := h.State.NewSession()
+	if err != nil {
+		return err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	v, err := sess.GetCertVersion(keyID, caID, version)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return &cmn.NotFoundError{RequestedResource: fmt.Sprintf("%s version %d", keyID, version)}
+	}
+
+	now := time.Now()
+	if now.Before(v.ValidStartTime) || !now.Before(v.ValidEndTime) {
+		return &cmn.InvalidInputError{Msg: fmt.Sprintf(
+			"version %d of certificate '%s' is not valid at the moment and cannot be rolled back to", version, keyID)}
+	}
+	if v.Current {
+		return nil
+	}
+
+	//the domains are not versioned, authorization relies on them matching the certificate
+	domains, err := sess.GetDomains(keyID, caID)
+	if err != nil {
+		return err
+	}
+	same, err := certHasDomains(v.CertPEM, domains)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return &cmn.InvalidInputError{Msg: fmt.Sprintf(
+			"version %d of certificate '%s' has been issued for other domains and cannot be rolled back to",
+			version, keyID)}
+	}
+
+	err = sess.RollbackCertVersion(keyID, caID, version)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(logrus.Fields{"keyID": keyID, "caID": caID, "version": version}).Info(
+		"Rolled back certificate to earlier version")
+
+	return nil
+
+}
+
+// Returns whether the certificate has been issued for exactly the given domains
+func certHasDomains(certPEM string, domains []string) (bool, error) {
+	certs, err := util.ParseCertificatePEM([]byte(certPEM))
+	if err != nil {
+		return false, err
+	}
+	if len(certs) <= 0 {
+		return false, errors.New("certificate version contains no certificate")
+	}
+
+	sans := make(map[string]bool, len(certs[0].DNSNames))
+	for _, san := range certs[0].DNSNames {
+		sans[util.GetDomainFQDNDot(strings.ToLower(san))] = true
+	}
+	expected := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		expected[util.GetDomainFQDNDot(strings.ToLower(domain))] = true
+	}
+	return maps.Equal(sans, expected), nil
+}
@@ -1,12 +1,14 @@
 package cli
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -85,6 +87,10 @@ func PrintInfo(out io.Writer, info apiv1.ServerInfo, color bool) error {
 		rows = append(rows, []string{"renewal successful", fmt.Sprint(info.Renewal.Successful)})
 		rows = append(rows, []string{"renewal failed", fmt.Sprint(info.Renewal.Failed)})
 	}
+	for _, q := range info.Queue {
+		rows = append(rows, []string{"queue " + q.Kind + "/" + q.ID,
+			fmt.Sprintf("%d running, %d waiting (limit %d)", q.Running, q.Waiting, q.Limit)})
+	}
 	return printKeyValues(out, rows, color)
 }
 
@@ -154,7 +160,7 @@ func PrintCerts(out io.Writer, footerStr string, certs []apiv1.CertInfo, color b
 }
 
 func PrintCert(out io.Writer, cert apiv1.CertInfo, color bool) error {
-	return printKeyValues(out, [][]string{
+	kv := [][]string{
 		{"name", cert.Name},
 		{"valid", boolText(cert.Valid, color)},
 		{"valid to", cert.ValidTo},
@@ -168,6 +174,143 @@ func PrintCert(out io.Writer, cert apiv1.CertInfo, color bool) error {
 		{"renew count", fmt.Sprint(cert.RenewCount)},
 		{"last access", cert.LastAccess},
 		{"access count", fmt.Sprint(cert.AccessCount)},
+	}
+	if cert.RenewFailures > 0 {
+		kv = append(kv, []string{"renew failures", fmt.Sprint(cert.RenewFailures)},
+			[]string{"last renew error", cert.LastRenewError})
+	}
+	return printKeyValues(out, kv, color)
+}
+
+func PrintExpiryReport(out io.Writer, report apiv1.ExpiryReport, _ bool) error {
+	tbl := newOutputTable(out, "CA", "ROOTZONE", "NAME", "DAYS_LEFT", "VALID_TO", "NEXT_RENEWAL", "OWNER", "LAST_RENEW_ERROR")
+	num := 0
+	for _, g := range report.Groups {
+		for _, c := range g.Certs {
+			tbl.AddRow(g.CAID, g.RootZone, c.Name, c.DaysLeft, c.ValidTo, c.NextRenewal,
+				ownerText(c), c.LastRenewError)
+			num++
+		}
+	}
+	tbl.Print()
+	_, err := fmt.Fprintf(out, "[%d certificates expiring until %s]\n", num, report.Until)
+	return err
+}
+
+func WriteExpiryReportCSV(out io.Writer, report apiv1.ExpiryReport) error {
+	w := csv.NewWriter(out)
+	err := w.Write([]string{"ca", "rtzn", "name", "days_left", "valid_to", "next_renewal",
+		"owner_name", "owner_email", "last_renew_error"})
+	if err != nil {
+		return err
+	}
+	for _, g := range report.Groups {
+		for _, c := range g.Certs {
+			err := w.Write([]string{g.CAID, g.RootZone, c.Name, strconv.Itoa(c.DaysLeft), c.ValidTo,
+				c.NextRenewal, c.Owner.Name, c.Owner.EMail, c.LastRenewError})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func ownerText(c apiv1.ExpiringCertInfo) string {
+	owner := strings.TrimSpace(c.Owner.Name)
+	if c.Owner.EMail != "" {
+		owner = strings.TrimSpace(owner + " <" + c.Owner.EMail + ">")
+	}
+	return owner
+}
+
+func PrintClaimPrecheckReport(out io.Writer, report apiv1.ClaimPrecheckReport, color bool) error {
+	tbl := newOutputTable(out, "CHECK", "DOMAIN", "STATUS", "MESSAGE")
+	for _, c := range report.Checks {
+		tbl.AddRow(c.Check, c.Domain, precheckStatusText(c.Status, color), c.Message)
+	}
+	tbl.Print()
+	_, err := fmt.Fprintf(out, "[passed: %s]\n", boolText(report.Passed, color))
+	return err
+}
+
+func PrintJob(out io.Writer, job apiv1.JobInfo, color bool) error {
+	err := printKeyValues(out, [][]string{
+		{"id", job.ID},
+		{"ca", job.CAID},
+		{"name", job.Name},
+		{"status", job.Status},
+		{"error", job.Error},
+		{"created", job.Created},
+		{"updated", job.Updated},
+	}, color)
+	if err != nil || len(job.Steps) <= 0 {
+		return err
+	}
+	if _, err := fmt.Fprintln(out); err != nil {
+		return err
+	}
+	tbl := newOutputTable(out, "STEP", "TIME", "ERROR")
+	for _, s := range job.Steps {
+		tbl.AddRow(s.Status, s.Time, s.Error)
+	}
+	tbl.Print()
+	return nil
+}
+
+func PrintTokenCreateResult(out io.Writer, res apiv1.TokenCreateResult, color bool) error {
+	err := printKeyValues(out, [][]string{
+		{"id", res.ID},
+		{"name", res.Name},
+		{"domains", strings.Join(res.Domains, ", ")},
+		{"write", boolText(res.Write, color)},
+		{"admin", boolText(res.Admin, color)},
+		{"scopes", strings.Join(res.Scopes, ", ")},
+		{"cas", strings.Join(res.CAs, ", ")},
+		{"source cidrs", strings.Join(res.SourceCIDRs, ", ")},
+		{"not before", res.NotBefore},
+		{"expires", res.Expires},
+		{"token", res.Token},
+	}, color)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, "[the token is only shown once, keep it secret]")
+	return err
+}
+
+func PrintTokens(out io.Writer, tokens []apiv1.TokenInfo, withOwner bool, color bool) error {
+	headers := []string{"ID", "NAME", "DOMAINS", "WRITE", "ADMIN", "SCOPES", "CAS", "EXPIRES", "EXPIRED",
+		"LAST_USED"}
+	if withOwner {
+		headers = append(headers, "OWNER")
+	}
+	tbl := newOutputTable(out, headers...)
+	for _, tkn := range tokens {
+		row := []any{tkn.ID, tkn.Name, strings.Join(tkn.Domains, ", "), boolText(tkn.Write, color),
+			boolText(tkn.Admin, color), strings.Join(tkn.Scopes, ", "), strings.Join(tkn.CAs, ", "),
+			tkn.Expires, fmt.Sprint(tkn.Expired), tkn.LastUsed}
+		if withOwner {
+			owner := strings.TrimSpace(tkn.Owner)
+			if tkn.OwnerEmail != "" {
+				owner = strings.TrimSpace(owner + " <" + tkn.OwnerEmail + ">")
+			}
+			row = append(row, owner)
+		}
+		tbl.AddRow(row...)
+	}
+	tbl.Print()
+	return nil
+}
+
+func PrintCertRenewResult(out io.Writer, res apiv1.CertRenewResult, color bool) error {
+	return printKeyValues(out, [][]string{
+		{"name", res.Name},
+		{"valid from", res.ValidFrom},
+		{"valid to", res.ValidTo},
+		{"next renewal", res.NextRenewal},
+		{"renew count", fmt.Sprint(res.RenewCount)},
 	}, color)
 }
 
@@ -369,6 +512,20 @@ func boolText(value bool, color bool) string {
 	return "\033[" + code + "m" + text + "\033[0m"
 }
 
+func precheckStatusText(status string, color bool) string {
+	code := ""
+	switch status {
+	case "ok":
+		code = "32"
+	case "failed":
+		code = "31"
+	}
+	if !color || code == "" {
+		return status
+	}
+	return "\033[" + code + "m" + status + "\033[0m"
+}
+
 func SupportsColor(file *os.File) bool {
 	stat, err := file.Stat()
 	if err != nil {
@@ -96,6 +96,8 @@ func (f *CommandFactory) newRootCommand() *cobra.Command {
 	root.AddCommand(f.newDNSCommand())
 	root.AddCommand(f.newCACommand())
 	root.AddCommand(f.newCRTCommand())
+	root.AddCommand(f.newReportCommand())
+	root.AddCommand(f.newTokenCommand())
 	root.AddCommand(f.newVersionCommand())
 	return root
 }
@@ -250,6 +252,7 @@ func (f *CommandFactory) newCRTCommand() *cobra.Command {
 	crtCmd.AddCommand(f.newCRTListCommand())
 	crtCmd.AddCommand(f.newCRTGetCommand())
 	crtCmd.AddCommand(f.newCRTClaimCommand())
+	crtCmd.AddCommand(f.newCRTRenewCommand())
 	crtCmd.AddCommand(f.newCRTDeleteCommand())
 	crtCmd.AddCommand(f.newCRTPemCommand())
 	return crtCmd
@@ -404,6 +407,10 @@ func (f *CommandFactory) newCRTClaimCommand() *cobra.Command {
 	claim := apiv1.CertClaimInfo{}
 	var san []string
 	var autodnsIPv4 string
+	var dryRun bool
+	var async bool
+	var wait bool
+	var pollInterval time.Duration
 	cmd := &cobra.Command{
 		Use:   "claim <ca-id> <name>",
 		Short: "Claim a certificate from an ACME CA",
@@ -419,16 +426,225 @@ func (f *CommandFactory) newCRTClaimCommand() *cobra.Command {
 				claim.AutoDNS = &apiv1.AutoDNSInfo{IPv4: autodnsIPv4}
 			}
 			path := "/ca/" + pathEscape(args[0]) + "/crt"
-			return f.runSlowCommand(cmd, cfg, http.MethodPost, path, nil, claim)
+			if dryRun {
+				query := url.Values{"dryRun": []string{"true"}}
+				return f.runJSONCommand(cmd, cfg, http.MethodPost, path, query, claim, func(resp *Response) error {
+					report, err := DecodeJSON[apiv1.ClaimPrecheckReport](resp.Body)
+					if err != nil {
+						return err
+					}
+					return PrintClaimPrecheckReport(f.Out, report, SupportsColor(os.Stdout))
+				})
+			}
+			if async || wait {
+				query := url.Values{"async": []string{"true"}}
+				if !wait {
+					return f.runJSONCommand(cmd, cfg, http.MethodPost, path, query, claim, func(resp *Response) error {
+						job, err := DecodeJSON[apiv1.JobInfo](resp.Body)
+						if err != nil {
+							return err
+						}
+						_, err = fmt.Fprintf(f.Out, "claim job %s %s\n", job.ID, job.Status)
+						return err
+					})
+				}
+				resp, err := f.Client(cfg).Do(cmd.Context(), http.MethodPost, path, query, claim)
+				if err != nil {
+					return err
+				}
+				return f.waitForJob(cmd, cfg, resp, pollInterval)
+			}
+			return f.runSlowCommand(cmd, cfg, http.MethodPost, path, nil, claim, func(*Response) error {
+				_, err := fmt.Fprintln(f.Out, "certificate claim completed")
+				return err
+			})
 		},
 	}
 	cmd.Flags().BoolVar(&claim.Wildcard, "wildcard", false, "claim wildcard certificate")
 	cmd.Flags().StringArrayVar(&san, "san", nil, "subject alternative name; repeatable")
 	cmd.Flags().StringVar(&autodnsIPv4, "autodns-ipv4", "", "AutoDNS IPv4 address")
 	cmd.Flags().Uint16Var(&claim.Hints.TTL, "ttl", 0, "certificate TTL hint in days")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only run the prechecks of the claim and print a report")
+	cmd.Flags().BoolVar(&async, "async", false, "return immediately with the ID of the claim job")
+	cmd.Flags().BoolVar(&wait, "wait", false, "claim asynchronously and poll the job until it is finished")
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", 5*time.Second, "interval for polling the claim job with --wait")
+	return cmd
+}
+
+func (f *CommandFactory) newCRTRenewCommand() *cobra.Command {
+	renew := apiv1.CertRenewInfo{}
+	cmd := &cobra.Command{
+		Use:   "renew <ca-id> <crt-name>",
+		Short: "Renew a certificate now",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.runtimeConfig(cmd, true)
+			if err != nil {
+				return err
+			}
+			path := "/ca/" + pathEscape(args[0]) + "/crt/" + pathEscape(args[1]) + "/renew"
+			return f.runSlowCommand(cmd, cfg, http.MethodPost, path, nil, renew, func(resp *Response) error {
+				res, err := DecodeJSON[apiv1.CertRenewResult](resp.Body)
+				if err != nil {
+					return err
+				}
+				return PrintCertRenewResult(f.Out, res, SupportsColor(os.Stdout))
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&renew.Force, "force", false, "renew even if the certificate is not yet due for renewal")
+	return cmd
+}
+
+func (f *CommandFactory) newReportCommand() *cobra.Command {
+	reportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "Show certificate reports",
+	}
+	reportCmd.AddCommand(f.newReportExpiringCommand())
+	return reportCmd
+}
+
+func (f *CommandFactory) newReportExpiringCommand() *cobra.Command {
+	var within, caID, rootZone, format string
+	cmd := &cobra.Command{
+		Use:   "expiring",
+		Short: "List certificates expiring soon, grouped by CA and root zone",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "csv" {
+				return fmt.Errorf("unknown format '%s', expected table or csv", format)
+			}
+			cfg, err := f.runtimeConfig(cmd, false)
+			if err != nil {
+				return err
+			}
+			query := url.Values{}
+			query.Add("within", within)
+			if caID != "" {
+				query.Add("ca", caID)
+			}
+			if rootZone != "" {
+				query.Add("rtzn", rootZone)
+			}
+			return f.runJSONCommand(cmd, cfg, http.MethodGet, "/reports/expiring", query, nil, func(resp *Response) error {
+				report, err := DecodeJSON[apiv1.ExpiryReport](resp.Body)
+				if err != nil {
+					return err
+				}
+				if format == "csv" {
+					return WriteExpiryReportCSV(f.Out, report)
+				}
+				return PrintExpiryReport(f.Out, report, SupportsColor(os.Stdout))
+			})
+		},
+	}
+	cmd.Flags().StringVar(&within, "within", "30d", "period to report expiring certificates for, e.g. 30d or 36h")
+	cmd.Flags().StringVar(&caID, "ca", "", "limit to a CA ID")
+	cmd.Flags().StringVar(&rootZone, "rtzn", "", "limit to a root zone")
+	cmd.Flags().StringVar(&format, "format", "table", "output format, table or csv")
 	return cmd
 }
 
+func (f *CommandFactory) newTokenCommand() *cobra.Command {
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage your API tokens",
+	}
+	tokenCmd.AddCommand(f.newTokenCreateCommand())
+	tokenCmd.AddCommand(f.newTokenListCommand())
+	tokenCmd.AddCommand(f.newTokenRevokeCommand())
+	return tokenCmd
+}
+
+func (f *CommandFactory) newTokenCreateCommand() *cobra.Command {
+	tinfo := apiv1.TokenCreateInfo{}
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create an API token limited to some of your domains and permissions",
+		Long: "Create an API token limited to some of your domains and permissions. The token is\n" +
+			"only shown once, pass it to dns3ld in the X-DNS3L-API-Key header.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.runtimeConfig(cmd, true)
+			if err != nil {
+				return err
+			}
+			tinfo.Name = args[0]
+			return f.runJSONCommand(cmd, cfg, http.MethodPost, "/tokens", nil, tinfo, func(resp *Response) error {
+				res, err := DecodeJSON[apiv1.TokenCreateResult](resp.Body)
+				if err != nil {
+					return err
+				}
+				return PrintTokenCreateResult(f.Out, res, SupportsColor(os.Stdout))
+			})
+		},
+	}
+	cmd.Flags().StringArrayVar(&tinfo.Domains, "domain", nil, "domain the token may access, including subdomains; repeatable")
+	cmd.Flags().BoolVar(&tinfo.Write, "write", false, "allow the token to claim and delete certificates")
+	cmd.Flags().BoolVar(&tinfo.Admin, "admin", false, "allow the token administrative operations")
+	cmd.Flags().StringVar(&tinfo.ValidFor, "valid-for", "30d", "validity of the token, e.g. 90d or 36h")
+	cmd.Flags().StringArrayVar(&tinfo.Scopes, "scope", nil,
+		"certificate operation the token may do, e.g. cert:read-key; repeatable, all of yours by default")
+	cmd.Flags().StringArrayVar(&tinfo.CAs, "ca", nil, "CA the token may use; repeatable, all of yours by default")
+	cmd.Flags().StringArrayVar(&tinfo.SourceCIDRs, "source-cidr", nil,
+		"network the token may only be used from, e.g. 10.0.0.0/8; repeatable")
+	cmd.Flags().StringVar(&tinfo.NotBefore, "not-before", "", "RFC 3339 time the token becomes valid")
+	_ = cmd.MarkFlagRequired("domain")
+	return cmd
+}
+
+func (f *CommandFactory) newTokenListCommand() *cobra.Command {
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List your API tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.runtimeConfig(cmd, true)
+			if err != nil {
+				return err
+			}
+			var query url.Values
+			if all {
+				query = url.Values{"all": []string{"true"}}
+			}
+			return f.runJSONCommand(cmd, cfg, http.MethodGet, "/tokens", query, nil, func(resp *Response) error {
+				tokens, err := DecodeJSON[[]apiv1.TokenInfo](resp.Body)
+				if err != nil {
+					return err
+				}
+				return PrintTokens(f.Out, tokens, all, SupportsColor(os.Stdout))
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "list the tokens of all users (admin only)")
+	return cmd
+}
+
+func (f *CommandFactory) newTokenRevokeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <token-id>",
+		Short: "Revoke an API token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := f.runtimeConfig(cmd, true)
+			if err != nil {
+				return err
+			}
+			path := "/tokens/" + pathEscape(args[0])
+			return f.runJSONCommand(cmd, cfg, http.MethodDelete, path, nil, nil, func(resp *Response) error {
+				tkn, err := DecodeJSON[apiv1.TokenInfo](resp.Body)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(f.Out, "revoked token %s (%s)\n", tkn.Name, tkn.ID)
+				return err
+			})
+		},
+	}
+}
+
 func (f *CommandFactory) newCRTDeleteCommand() *cobra.Command {
 	var caID string
 	cmd := &cobra.Command{
@@ -550,7 +766,8 @@ func (f *CommandFactory) runJSONCommand(cmd *cobra.Command, cfg *RuntimeConfig,
 	return print(resp)
 }
 
-func (f *CommandFactory) runSlowCommand(cmd *cobra.Command, cfg *RuntimeConfig, method, path string, query url.Values, body any) error {
+func (f *CommandFactory) runSlowCommand(cmd *cobra.Command, cfg *RuntimeConfig, method, path string, query url.Values, body any,
+	print func(*Response) error) error {
 	cfg.Timeout = cfg.TimeoutClaim
 	done := make(chan struct{})
 	var once sync.Once
@@ -569,8 +786,55 @@ func (f *CommandFactory) runSlowCommand(cmd *cobra.Command, cfg *RuntimeConfig,
 	if cfg.JSON {
 		return WriteJSON(f.Out, resp.Body)
 	}
-	_, err = fmt.Fprintln(f.Out, "certificate claim completed")
-	return err
+	return print(resp)
+}
+
+// waitForJob polls a job until it has reached a final status or the claim timeout has passed
+func (f *CommandFactory) waitForJob(cmd *cobra.Command, cfg *RuntimeConfig, resp *Response,
+	pollInterval time.Duration) error {
+	if pollInterval <= 0 {
+		pollInterval = 5 * time.Second
+	}
+	deadline := time.Now().Add(cfg.TimeoutClaim)
+	lastStatus := ""
+	for {
+		job, err := DecodeJSON[apiv1.JobInfo](resp.Body)
+		if err != nil {
+			return err
+		}
+		if job.Status != lastStatus {
+			_, _ = fmt.Fprintf(f.ErrOut, "job %s: %s\n", job.ID, job.Status)
+			lastStatus = job.Status
+		}
+		switch job.Status {
+		case "issued", "failed":
+			if cfg.JSON {
+				if err := WriteJSON(f.Out, resp.Body); err != nil {
+					return err
+				}
+			}
+			if job.Status == "failed" {
+				return fmt.Errorf("certificate claim failed: %s", job.Error)
+			}
+			if cfg.JSON {
+				return nil
+			}
+			_, err := fmt.Fprintln(f.Out, "certificate claim completed")
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("job %s did not finish within %s, last status %s", job.ID, cfg.TimeoutClaim, job.Status)
+		}
+		select {
+		case <-cmd.Context().Done():
+			return cmd.Context().Err()
+		case <-time.After(pollInterval):
+		}
+		resp, err = f.Client(cfg).Do(cmd.Context(), http.MethodGet, "/jobs/"+pathEscape(job.ID), nil, nil)
+		if err != nil {
+			return err
+		}
+	}
 }
 
 func (f *CommandFactory) runPEMSingle(cmd *cobra.Command, path string, output string, check bool, cfg *RuntimeConfig) error {
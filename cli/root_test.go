@@ -653,3 +653,203 @@ func testRootCommandWithFactory(out, errOut io.Writer, clientFactory func(*Runti
 	f.Client = clientFactory
 	return f.newRootCommand()
 }
+
+func TestRootCommandRenewForce(t *testing.T) {
+	var renew apiv1.CertRenewInfo
+	httpClient := testHTTPClient(func(r *http.Request) (*http.Response, error) {
+		switch r.URL.Path {
+		case "/auth/token":
+			return testResponse(http.StatusOK, `{"id_token":"oidc-token"}`), nil
+		case "/api/v1/ca/les/crt/test.example.com/renew":
+			if r.Method != http.MethodPost {
+				t.Fatalf("unexpected method %s", r.Method)
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(body, &renew); err != nil {
+				t.Fatal(err)
+			}
+			return testResponse(http.StatusOK, `{"name":"test.example.com.","validFrom":"2026-01-01T00:00:00Z",`+
+				`"validTo":"2026-04-01T00:00:00Z","nextRenewal":"2026-03-01T00:00:00Z","renewCount":2}`), nil
+		default:
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+		return testResponse(http.StatusNotFound, ""), nil
+	})
+
+	var out bytes.Buffer
+	var errOut bytes.Buffer
+	cmd := testRootCommand(&out, &errOut, httpClient)
+	cmd.SetArgs([]string{
+		"--server", "https://example.com/api/v1",
+		"--ad-user", "alice",
+		"--ad-password", "pw",
+		"--oidc-client-id", "dns3l-api",
+		"--oidc-client-secret", "secret",
+		"crt", "renew", "les", "test.example.com",
+		"--force",
+	})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !renew.Force {
+		t.Fatalf("unexpected renew body: %#v", renew)
+	}
+	if !strings.Contains(out.String(), "2026-04-01T00:00:00Z") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+}
+
+func TestRootCommandClaimDryRun(t *testing.T) {
+	httpClient := testHTTPClient(func(r *http.Request) (*http.Response, error) {
+		switch r.URL.Path {
+		case "/auth/token":
+			return testResponse(http.StatusOK, `{"id_token":"oidc-token"}`), nil
+		case "/api/v1/ca/les/crt":
+			if r.URL.Query().Get("dryRun") != "true" {
+				t.Fatalf("dry run not requested: %s", r.URL.RawQuery)
+			}
+			return testResponse(http.StatusOK, `{"passed":false,"checks":[`+
+				`{"check":"authz","domain":"test.example.com.","status":"ok","message":"user is authorized for domain"},`+
+				`{"check":"caa","domain":"test.example.com.","status":"failed","message":"CAA records do not permit issuance"}]}`), nil
+		default:
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+		return testResponse(http.StatusNotFound, ""), nil
+	})
+
+	var out bytes.Buffer
+	var errOut bytes.Buffer
+	cmd := testRootCommand(&out, &errOut, httpClient)
+	cmd.SetArgs([]string{
+		"--server", "https://example.com/api/v1",
+		"--ad-user", "alice",
+		"--ad-password", "pw",
+		"--oidc-client-id", "dns3l-api",
+		"--oidc-client-secret", "secret",
+		"crt", "claim", "les", "test.example.com",
+		"--dry-run",
+	})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "CAA records do not permit issuance") || !strings.Contains(out.String(), "[passed: false]") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+}
+
+func TestRootCommandClaimAsyncWait(t *testing.T) {
+	polls := 0
+	httpClient := testHTTPClient(func(r *http.Request) (*http.Response, error) {
+		switch r.URL.Path {
+		case "/auth/token":
+			return testResponse(http.StatusOK, `{"id_token":"oidc-token"}`), nil
+		case "/api/v1/ca/les/crt":
+			if r.URL.Query().Get("async") != "true" {
+				t.Fatalf("async claim not requested: %s", r.URL.RawQuery)
+			}
+			return testResponse(http.StatusAccepted, `{"id":"abc123","caID":"les","name":"test.example.com.","status":"queued"}`), nil
+		case "/api/v1/jobs/abc123":
+			polls++
+			if polls < 2 {
+				return testResponse(http.StatusOK, `{"id":"abc123","status":"validating"}`), nil
+			}
+			return testResponse(http.StatusOK, `{"id":"abc123","status":"issued"}`), nil
+		default:
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+		return testResponse(http.StatusNotFound, ""), nil
+	})
+
+	var out bytes.Buffer
+	var errOut bytes.Buffer
+	cmd := testRootCommand(&out, &errOut, httpClient)
+	cmd.SetArgs([]string{
+		"--server", "https://example.com/api/v1",
+		"--ad-user", "alice",
+		"--ad-password", "pw",
+		"--oidc-client-id", "dns3l-api",
+		"--oidc-client-secret", "secret",
+		"crt", "claim", "les", "test.example.com",
+		"--wait", "--poll-interval", "1ms",
+	})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 2 {
+		t.Fatalf("unexpected number of polls: %d", polls)
+	}
+	if !strings.Contains(out.String(), "certificate claim completed") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "job abc123: validating") {
+		t.Fatalf("unexpected progress output: %q", errOut.String())
+	}
+}
+
+func TestRootCommandReportExpiringCSV(t *testing.T) {
+	httpClient := testHTTPClient(func(r *http.Request) (*http.Response, error) {
+		if r.URL.Path != "/api/v1/reports/expiring" {
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+		if q := r.URL.Query(); q.Get("within") != "14d" || q.Get("ca") != "les" || q.Has("rtzn") {
+			t.Fatalf("unexpected query %s", r.URL.RawQuery)
+		}
+		return testResponse(http.StatusOK, `{"until":"2026-02-15T00:00:00Z","groups":[{"caID":"les",`+
+			`"rtzn":"example.com.","certs":[{"name":"a.example.com.","validTo":"2026-02-01T00:00:00Z",`+
+			`"daysLeft":-3,"owner":{"name":"Alice","email":"alice@example.com"},`+
+			`"nextRenewal":"2026-01-01T00:00:00Z","lastRenewError":"dns, unreachable"}]}]}`), nil
+	})
+
+	var out bytes.Buffer
+	var errOut bytes.Buffer
+	cmd := testRootCommand(&out, &errOut, httpClient)
+	cmd.SetArgs([]string{"--server", "https://example.com/api/v1", "--no-auth",
+		"report", "expiring", "--within", "14d", "--ca", "les", "--format", "csv"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "ca,rtzn,name,days_left,valid_to,next_renewal,owner_name,owner_email,last_renew_error\n" +
+		"les,example.com.,a.example.com.,-3,2026-02-01T00:00:00Z,2026-01-01T00:00:00Z,Alice,alice@example.com,\"dns, unreachable\"\n"
+	if out.String() != expected {
+		t.Fatalf("unexpected output:\nwant %q\ngot  %q", expected, out.String())
+	}
+}
+
+func TestRootCommandTokenCreate(t *testing.T) {
+	var tinfo apiv1.TokenCreateInfo
+	httpClient := testHTTPClient(func(r *http.Request) (*http.Response, error) {
+		if r.URL.Path != "/api/v1/tokens" || r.Method != http.MethodPost {
+			t.Fatalf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(body, &tinfo); err != nil {
+			t.Fatal(err)
+		}
+		return testResponse(http.StatusCreated, `{"id":"0a1b","name":"ci-pipeline","owner":"alice",`+
+			`"domains":["ci.example.com."],"write":true,"admin":false,"created":"2026-01-01T00:00:00Z",`+
+			`"expires":"2026-04-01T00:00:00Z","expired":false,"token":"c2VjcmV0"}`), nil
+	})
+
+	var out bytes.Buffer
+	var errOut bytes.Buffer
+	cmd := testRootCommand(&out, &errOut, httpClient)
+	cmd.SetArgs([]string{"--server", "https://example.com/api/v1", "--token", "oidc-token",
+		"token", "create", "ci-pipeline", "--domain", "ci.example.com", "--write", "--valid-for", "90d",
+		"--scope", "cert:read-key", "--scope", "cert:renew", "--ca", "les"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if tinfo.Name != "ci-pipeline" || len(tinfo.Domains) != 1 || !tinfo.Write || tinfo.ValidFor != "90d" ||
+		len(tinfo.Scopes) != 2 || len(tinfo.CAs) != 1 || tinfo.CAs[0] != "les" {
+		t.Fatalf("unexpected token body: %#v", tinfo)
+	}
+	if !strings.Contains(out.String(), "c2VjcmV0") || !strings.Contains(out.String(), "only shown once") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+}
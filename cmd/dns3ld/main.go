@@ -1,7 +1,13 @@
 package main
 
 import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/dns3l/dns3l-core/context"
 	"github.com/dns3l/dns3l-core/service"
@@ -52,7 +58,17 @@ var rootCmd = &cobra.Command{
 			panic(err)
 		}
 		svc := service.Service{Config: &conf, Socket: socket, NoRenew: !renew, NoBootstrapCert: !bootstrapcert}
-		err = svc.Run()
+		ctx, stop := signal.NotifyContext(gocontext.Background(), syscall.SIGTERM, os.Interrupt)
+		defer stop()
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				//logs the changes or why the old config is kept
+				_ = svc.Reload(confPath)
+			}
+		}()
+		err = svc.RunContext(ctx)
 		if err != nil {
 			panic(err)
 		}
@@ -94,20 +110,166 @@ var dbCreateCmd = &cobra.Command{
 	},
 }
 
+var renewNowCmd = &cobra.Command{
+	Use:   "renew-now",
+	Short: "Run the certificate renewal right away",
+	Long: `Renews the certificates which are due for renewal right away instead of waiting
+	for the daily renewal run, optionally restricted to a CA or root zone. Prints a JSON
+	report of the certificates which were (or with --dry-run would be) renewed. Exits
+	non-zero if a renewal failed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		confPath, err := cmd.Parent().PersistentFlags().GetString("config")
+		if err != nil {
+			panic(err)
+		}
+
+		opts := &service.RenewalRunOptions{}
+		opts.CAID, err = cmd.PersistentFlags().GetString("ca")
+		if err != nil {
+			panic(err)
+		}
+		opts.RootZone, err = cmd.PersistentFlags().GetString("rtzn")
+		if err != nil {
+			panic(err)
+		}
+		expiringBefore, err := cmd.PersistentFlags().GetString("expiring-before")
+		if err != nil {
+			panic(err)
+		}
+		if expiringBefore != "" {
+			opts.ExpiringBefore, err = time.Parse(time.RFC3339, expiringBefore)
+			if err != nil {
+				panic(err)
+			}
+		}
+		opts.MaxDuration, err = cmd.PersistentFlags().GetDuration("max-duration")
+		if err != nil {
+			panic(err)
+		}
+		opts.DryRun, err = cmd.PersistentFlags().GetBool("dry-run")
+		if err != nil {
+			panic(err)
+		}
+
+		conf := service.Config{}
+		err = conf.FromFile(confPath)
+		if err != nil {
+			panic(err)
+		}
+		err = conf.Initialize()
+		if err != nil {
+			panic(err)
+		}
+		err = conf.DB.Init()
+		if err != nil {
+			panic(err)
+		}
+
+		svc := service.Service{Config: &conf}
+		report, err := svc.RunRenewals(opts)
+		if err != nil {
+			panic(err)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+		if err != nil {
+			panic(err)
+		}
+		if report.Failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configuration tools",
+}
+
+var configCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validate the configuration without starting the daemon",
+	Long: `Performs the validation done on startup, and additionally checks the references of
+	the root zones, the TTL bounds and the static tokens. Neither the DB nor the providers
+	are contacted unless --connect is given. Prints every problem with the YAML path of
+	the setting and exits non-zero if there are any.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		confPath, err := cmd.Root().PersistentFlags().GetString("config")
+		if err != nil {
+			panic(err)
+		}
+		connect, err := cmd.PersistentFlags().GetBool("connect")
+		if err != nil {
+			panic(err)
+		}
+
+		//only the problems shall be printed
+		log.SetLevel(log.ErrorLevel)
+
+		conf := service.Config{}
+		err = conf.FromFile(confPath)
+		if err != nil {
+			fmt.Printf("%s: %s\n", confPath, err)
+			os.Exit(1)
+		}
+
+		problems := conf.Check()
+		if len(problems) == 0 && connect {
+			err = conf.DB.Init()
+			if err != nil {
+				panic(err)
+			}
+			svc := service.Service{Config: &conf}
+			problems = svc.CheckConnections()
+		}
+
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "%d problem(s) found in %s\n", len(problems), confPath)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "%s is valid\n", confPath)
+	},
+}
+
 func Execute() error {
 	rootCmd.PersistentFlags().StringP("config", "c", "config.yaml",
 		`YAML-formatted configuration for dns3ld.`)
 	rootCmd.PersistentFlags().StringP("socket", "s", ":80",
 		`L4 socket on which the service should listen.`)
 	rootCmd.PersistentFlags().BoolP("renew", "r", true,
-		`Whether automatic cert renewal jobs should run. Useful if multiple instances run on the
-		same DB and you want to disable renewal for the replicas, which is not yet thread-safe.`)
+		`Whether automatic cert renewal jobs should run. If multiple instances run on the
+		same DB, only the elected leader renews.`)
 	rootCmd.PersistentFlags().BoolP("bootstrapcert", "b", true,
-		`Whether initial bootstrapping of certs should run on this instance. Useful if multiple
-		instances run on the same DB and you want to disable bootstrapping for the replicas.`)
+		`Whether initial bootstrapping of certs should run on this instance. If multiple
+		instances run on the same DB, they bootstrap one after another.`)
 	dbCreateCmd.PersistentFlags().BoolP("tablesonly", "t", false,
 		`Do not try to attempt creating the DB, only create the tables`)
 
+	renewNowCmd.PersistentFlags().String("ca", "",
+		`Only renew certificates of this CA`)
+	renewNowCmd.PersistentFlags().String("rtzn", "",
+		`Only renew certificates in this root zone`)
+	renewNowCmd.PersistentFlags().String("expiring-before", "",
+		`Also renew certificates expiring before this RFC 3339 timestamp, even if not yet due`)
+	renewNowCmd.PersistentFlags().Duration("max-duration", 0,
+		`Spread the renewals over this duration, by default all are started at once`)
+	renewNowCmd.PersistentFlags().Bool("dry-run", false,
+		`Only report which certificates would be renewed`)
+
+	configCheckCmd.PersistentFlags().Bool("connect", false,
+		`Also check that the DB, the CAs, the DNS providers and the OIDC issuers can be reached
+		with the configured credentials`)
+
+	configCmd.AddCommand(configCheckCmd)
+	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(dbCreateCmd)
+	rootCmd.AddCommand(renewNowCmd)
 	return rootCmd.Execute()
 }
@@ -1,6 +1,9 @@
 package common
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // A NotFoundError is thrown if the requested resource was not found or is not supposed
 // to exist at all
@@ -71,6 +74,16 @@ func (e *AlreadyExistsError) Error() string {
 
 }
 
+// A NoRenewalDueError is thrown if the certificate is not yet outdated enough to be renewed.
+// The service refuses to renew it in order not to hit rate limits on the CA.
+type NoRenewalDueError struct {
+	RenewalDate time.Time
+}
+
+func (e *NoRenewalDueError) Error() string {
+	return fmt.Sprintf("No renewal is due yet, earliest on %s", e.RenewalDate)
+}
+
 type Warning struct {
 	SubErr error
 }
@@ -79,3 +92,23 @@ func (e *Warning) Error() string {
 	return e.SubErr.Error()
 
 }
+
+// A QueueFullError is thrown if a work queue does not accept any more work at the moment
+type QueueFullError struct {
+	Queue      string
+	RetryAfter time.Duration
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("too many requests waiting for '%s', retry after %s", e.Queue, e.RetryAfter)
+}
+
+// A ConfigError describes a problem with the setting at the given YAML path of the config
+type ConfigError struct {
+	Path string
+	Msg  string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Msg)
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/miekg/dns"
+)
+
+const DefaultCAALookupTimeout = 5 * time.Second
+
+// LookupCAA returns the relevant CAA record set for the given domain name as described in
+// RFC 8659, climbing up the DNS tree until a CAA record set is found. The name on which the
+// record set has been found is also returned. If no CAA records exist at all, an empty set
+// is returned. If no DNS servers are given, the ones from /etc/resolv.conf are used.
+func LookupCAA(domainName string, dnsServers []string, timeout time.Duration) ([]*dns.CAA, string, error) {
+
+	domainName = util.GetDomainFQDNDot(strings.TrimPrefix(domainName, "*."))
+
+	err := ValidateDomainName(domainName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(dnsServers) <= 0 {
+		conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, "", fmt.Errorf("no DNS servers given and none could be read from resolv.conf: %w", err)
+		}
+		for _, srv := range conf.Servers {
+			dnsServers = append(dnsServers, net.JoinHostPort(srv, conf.Port))
+		}
+		if len(dnsServers) <= 0 {
+			return nil, "", errors.New("no DNS servers given and none configured in resolv.conf")
+		}
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultCAALookupTimeout
+	}
+	c := dns.Client{Timeout: timeout}
+
+	labels := dns.SplitDomainName(domainName)
+	for i := range labels {
+		name := dns.Fqdn(strings.Join(labels[i:], "."))
+
+		m := dns.Msg{}
+		m.SetQuestion(name, dns.TypeCAA)
+
+		var r *dns.Msg
+		for try := 0; try < len(dnsServers); try++ {
+			r, _, err = c.Exchange(&m, getDNSSocketForTry(try, dnsServers))
+			if err == nil {
+				break
+			}
+			log.WithError(err).WithField("name", name).Warn("Error when querying CAA records, trying next server")
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("could not query CAA records for %s: %w", name, err)
+		}
+		if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+			return nil, "", fmt.Errorf("could not query CAA records for %s: %s", name, dns.RcodeToString[r.Rcode])
+		}
+
+		res := make([]*dns.CAA, 0, len(r.Answer))
+		for _, rr := range r.Answer {
+			if caa, ok := rr.(*dns.CAA); ok {
+				res = append(res, caa)
+			}
+		}
+		if len(res) > 0 {
+			return res, name, nil
+		}
+	}
+
+	return []*dns.CAA{}, "", nil
+
+}
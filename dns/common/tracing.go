@@ -0,0 +1,59 @@
+package common
+
+import (
+	"context"
+	"net"
+
+	"github.com/dns3l/dns3l-core/dns/types"
+	"github.com/dns3l/dns3l-core/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TraceDNSProvider wraps the calls to the DNS backend of a DNS provider so that every
+// call is traced as a child span of ctx.
+func TraceDNSProvider(ctx context.Context, provID string, prov types.DNSProvider) types.DNSProvider {
+	return &tracedDNSProvider{DNSProvider: prov, ctx: ctx, id: provID}
+}
+
+type tracedDNSProvider struct {
+	types.DNSProvider
+	ctx context.Context
+	id  string
+}
+
+func (p *tracedDNSProvider) trace(op, domainName string, f func() error) error {
+	_, span := tracing.Start(p.ctx, "dns."+op,
+		attribute.String("dns.provider", p.id),
+		attribute.String("dns.domain", domainName))
+	err := f()
+	tracing.End(span, err)
+	return err
+}
+
+func (p *tracedDNSProvider) SetRecordAcmeChallenge(domainName string, challenge string) error {
+	return p.trace("SetRecordAcmeChallenge", domainName, func() error {
+		return p.DNSProvider.SetRecordAcmeChallenge(domainName, challenge)
+	})
+}
+
+func (p *tracedDNSProvider) SetRecordA(domainName string, ttl uint32, addr net.IP) error {
+	return p.trace("SetRecordA", domainName, func() error {
+		return p.DNSProvider.SetRecordA(domainName, ttl, addr)
+	})
+}
+
+func (p *tracedDNSProvider) DeleteRecordAcmeChallenge(domainName string) error {
+	return p.trace("DeleteRecordAcmeChallenge", domainName, func() error {
+		return p.DNSProvider.DeleteRecordAcmeChallenge(domainName)
+	})
+}
+
+func (p *tracedDNSProvider) DeleteRecordA(domainName string) error {
+	return p.trace("DeleteRecordA", domainName, func() error {
+		return p.DNSProvider.DeleteRecordA(domainName)
+	})
+}
+
+func (p *tracedDNSProvider) CheckReachability() error {
+	return p.trace("CheckReachability", "", p.DNSProvider.CheckReachability)
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -10,6 +11,9 @@ import (
 	"github.com/miekg/dns"
 
 	"github.com/dns3l/dns3l-core/dns/types"
+	"github.com/dns3l/dns3l-core/metrics"
+	"github.com/dns3l/dns3l-core/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // The ResolveTester can be used to test if a set DNS01 acme challenge has been actually
@@ -24,8 +28,8 @@ type ResolveTester struct {
 // WaitForAActive checks for the A record for being placed. If it is not
 // yet placed, it waits until a timeout for a valid A record,
 // as the placement could be delayed.
-func (re *ResolveTester) WaitForAActive(name string, ipv4 net.IP) error {
-	return re.waitForActive(name, dns.TypeA, func(dname string, rr []dns.RR) (bool, error) {
+func (re *ResolveTester) WaitForAActive(ctx context.Context, name string, ipv4 net.IP) error {
+	return re.waitForActive(ctx, name, dns.TypeA, func(dname string, rr []dns.RR) (bool, error) {
 		result := rr[0].(*dns.A).A
 		if result.Equal(ipv4) {
 			return true, nil
@@ -38,14 +42,14 @@ func (re *ResolveTester) WaitForAActive(name string, ipv4 net.IP) error {
 // WaitForTXTActive checks for the DNS01 challenge for being placed. If it is not
 // yet placed, it waits until a timeout for a valid DNS01 challenge,
 // as the placement could be delayed.
-func (re *ResolveTester) WaitForChallengeActive(name, expectedChallenge string) error {
+func (re *ResolveTester) WaitForChallengeActive(ctx context.Context, name, expectedChallenge string) error {
 
 	dName, err := EnsureAcmeChallengeFormat(name)
 	if err != nil {
 		return err
 	}
 
-	return re.waitForActive(dName, dns.TypeTXT, func(ddname string, rr []dns.RR) (bool, error) {
+	return re.waitForActive(ctx, dName, dns.TypeTXT, func(ddname string, rr []dns.RR) (bool, error) {
 		result := rr[0].(*dns.TXT).Txt[0]
 		if result == expectedChallenge {
 			return true, nil
@@ -55,7 +59,22 @@ func (re *ResolveTester) WaitForChallengeActive(name, expectedChallenge string)
 	})
 }
 
-func (re *ResolveTester) waitForActive(dName string, dnstype uint16,
+func (re *ResolveTester) waitForActive(ctx context.Context, dName string, dnstype uint16,
+	ah func(dName string, rr []dns.RR) (bool, error)) error {
+
+	_, span := tracing.Start(ctx, "dns.waitForActive",
+		attribute.String("dns.domain", dName),
+		attribute.String("dns.type", dns.TypeToString[dnstype]))
+	startTime := time.Now()
+	err := re.waitForActiveRaw(dName, dnstype, ah)
+	tracing.End(span, err)
+	metrics.ObserveSince(metrics.DNSPropagationWait.WithLabelValues(dns.TypeToString[dnstype],
+		metrics.Result(err)), startTime)
+	return err
+
+}
+
+func (re *ResolveTester) waitForActiveRaw(dName string, dnstype uint16,
 	ah func(dName string, rr []dns.RR) (bool, error)) error {
 
 	err := ValidateDomainName(dName)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/dns3l/dns3l-core/dns/types"
+	"github.com/dns3l/dns3l-core/secrets"
 	"gopkg.in/yaml.v2"
 )
 
@@ -35,6 +36,10 @@ func (f *ProviderInfo) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err != nil {
 		return err
 	}
+	err = secrets.ResolveAll(builder)
+	if err != nil {
+		return err
+	}
 	f.Type = t.Type
 	f.Prov, err = builder.NewInstance()
 	if err != nil {
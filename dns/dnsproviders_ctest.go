@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"context"
 	"crypto/rand"
 	"net"
 
@@ -77,7 +78,7 @@ func TestAllProvidersFromConfig() {
 
 		rt.DNSCheckServers = testableZones.Checkservers
 		if len(rt.DNSCheckServers) > 0 {
-			err := rt.WaitForAActive(domainName, ipAddr)
+			err := rt.WaitForAActive(context.Background(), domainName, ipAddr)
 			if err != nil {
 				panic(err)
 			}
@@ -109,7 +110,7 @@ func TestAllProvidersFromConfig() {
 
 		rt.DNSCheckServers = testableZones.Checkservers
 		if len(rt.DNSCheckServers) > 0 {
-			err = rt.WaitForChallengeActive(domainName, acmeChallenge)
+			err = rt.WaitForChallengeActive(context.Background(), domainName, acmeChallenge)
 			if err != nil {
 				panic(err)
 			}
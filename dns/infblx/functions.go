@@ -209,3 +209,22 @@ func (p *DNSProvider) getHighestPrefixZoneFor(c ibclient.IBConnector, dnsView,
 	return longestZone, nil
 
 }
+
+func (p *DNSProvider) CheckReachability() error {
+
+	c, err := p.getIBConnector()
+	if err != nil {
+		return err
+	}
+	defer util.LogDefer(log, c.Logout)
+
+	var res []ibclient.ZoneAuth
+	obj := ibclient.NewZoneAuth(ibclient.ZoneAuth{})
+	err = c.GetObject(obj, "", ibclient.NewQueryParams(false, map[string]string{"view": p.C.DNSView}), &res)
+	if err != nil {
+		return fmt.Errorf("error while listing zones: %w", err)
+	}
+
+	return nil
+
+}
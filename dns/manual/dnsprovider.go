@@ -61,3 +61,10 @@ func (s *DNSProvider) DeleteRecordA(domainName string) error {
 	return nil
 
 }
+
+func (s *DNSProvider) CheckReachability() error {
+
+	//nothing to reach, manual provider has no backend
+	return nil
+
+}
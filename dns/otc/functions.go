@@ -309,3 +309,24 @@ func deleteRecordInZone(sc *golangsdk.ServiceClient, zoneID string, domainName s
 	return nil
 
 }
+
+func (s *DNSProvider) CheckReachability() error {
+
+	provider, err := s.Auth()
+	if err != nil {
+		return err
+	}
+
+	client, err := openstack.NewDNSV2(provider, golangsdk.EndpointOpts{Region: s.C.OSRegion})
+	if err != nil {
+		return fmt.Errorf("error while getting DNS API endpoint: %v", err)
+	}
+
+	_, err = zones.List(client, zones.ListOpts{}).AllPages()
+	if err != nil {
+		return fmt.Errorf("error while listing zones: %v", err)
+	}
+
+	return nil
+
+}
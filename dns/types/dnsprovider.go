@@ -22,4 +22,6 @@ type DNSProvider interface {
 	SetRecordA(domainName string, ttl uint32, addr net.IP) error
 	DeleteRecordAcmeChallenge(domainName string) error
 	DeleteRecordA(domainName string) error
+	//Checks if the DNS backend can be reached with the configured credentials, without changing anything
+	CheckReachability() error
 }
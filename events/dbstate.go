@@ -0,0 +1,133 @@
+package events
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dns3l/dns3l-core/state"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+type OutboxStateManagerSQL struct {
+	Prov state.SQLDBProvider
+}
+
+type OutboxStateManagerSQLSession struct {
+	prov *OutboxStateManagerSQL
+	db   *sql.DB
+}
+
+func (m *OutboxStateManagerSQL) NewSession() (OutboxStateManagerSession, error) {
+	db, err := m.Prov.GetDBConn()
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxStateManagerSQLSession{db: db, prov: m}, nil
+}
+
+func (s *OutboxStateManagerSQLSession) Close() error {
+	//Nothing to do
+	return nil
+}
+
+func (s *OutboxStateManagerSQLSession) PutOutboxEntry(entry *OutboxEntry) error {
+
+	_, err := s.db.Exec(`INSERT INTO `+s.prov.Prov.DBName("event_outbox")+` (webhook_id, event_id, event_type, `+
+		`payload, status, attempts, next_attempt, last_error, created_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		entry.Webhook, entry.EventID, entry.EventType, entry.Payload, OutboxPending, entry.Attempts,
+		entry.NextAttempt.UTC(), entry.LastError, entry.CreatedTime.UTC())
+	if err != nil {
+		return fmt.Errorf("problem while storing event in outbox: %w", err)
+	}
+	return nil
+
+}
+
+func (s *OutboxStateManagerSQLSession) ClaimDueOutboxEntries(now, claimUntil time.Time,
+	limit uint) ([]OutboxEntry, error) {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer util.RollbackIfNotCommitted(log, tx)
+
+	//entries locked by a concurrent claim are skipped instead of being delivered twice
+	rows, err := tx.Query(`SELECT id, webhook_id, event_id, event_type, payload, status, attempts, `+
+		`next_attempt, last_error, created_time FROM `+s.prov.Prov.DBName("event_outbox")+
+		` WHERE status IN (?, ?) AND next_attempt <= ? ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED;`,
+		OutboxPending, OutboxDelivering, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	res, err := scanOutboxEntries(rows, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range res {
+		_, err := tx.Exec(`UPDATE `+s.prov.Prov.DBName("event_outbox")+` SET status = ?, next_attempt = ? `+
+			`WHERE id = ?;`, OutboxDelivering, claimUntil.UTC(), res[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("problem while claiming event in outbox: %w", err)
+		}
+		res[i].Status = OutboxDelivering
+		res[i].NextAttempt = claimUntil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+
+}
+
+func scanOutboxEntries(rows *sql.Rows, limit uint) ([]OutboxEntry, error) {
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]OutboxEntry, 0, limit)
+	for rows.Next() {
+		var e OutboxEntry
+		err := rows.Scan(&e.ID, &e.Webhook, &e.EventID, &e.EventType, &e.Payload, &e.Status, &e.Attempts,
+			&e.NextAttempt, &e.LastError, &e.CreatedTime)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *OutboxStateManagerSQLSession) DelOutboxEntry(id uint64) error {
+
+	_, err := s.db.Exec(`DELETE FROM `+s.prov.Prov.DBName("event_outbox")+` WHERE id = ?;`, id)
+	if err != nil {
+		return fmt.Errorf("problem while deleting event from outbox: %w", err)
+	}
+	return nil
+
+}
+
+func (s *OutboxStateManagerSQLSession) UpdOutboxEntryFailed(id uint64, attempts uint, nextAttempt time.Time,
+	lastError string, final bool) error {
+
+	status := OutboxPending
+	if final {
+		status = OutboxFailed
+	}
+
+	_, err := s.db.Exec(`UPDATE `+s.prov.Prov.DBName("event_outbox")+` SET status = ?, attempts = ?, `+
+		`next_attempt = ?, last_error = ? WHERE id = ?;`, status, attempts, nextAttempt.UTC(), lastError, id)
+	if err != nil {
+		return fmt.Errorf("problem while updating event in outbox: %w", err)
+	}
+	return nil
+
+}
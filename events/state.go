@@ -0,0 +1,46 @@
+package events
+
+import "time"
+
+type OutboxStatus string
+
+const (
+	OutboxPending    OutboxStatus = "pending"
+	OutboxDelivering OutboxStatus = "delivering" //claimed by an instance until its next attempt
+	OutboxFailed     OutboxStatus = "failed"     //given up after the max. number of attempts
+)
+
+// A webhook delivery of an event which has not succeeded yet
+type OutboxEntry struct {
+	ID          uint64
+	Webhook     string
+	EventID     string
+	EventType   Type
+	Payload     string
+	Status      OutboxStatus
+	Attempts    uint
+	NextAttempt time.Time
+	LastError   string
+	CreatedTime time.Time
+}
+
+type OutboxStateManager interface {
+	NewSession() (OutboxStateManagerSession, error)
+}
+
+type OutboxStateManagerSession interface {
+	Close() error
+
+	PutOutboxEntry(entry *OutboxEntry) error
+
+	//Returns pending entries whose next attempt is due at the given time, oldest first, and
+	//claims them until claimUntil so that other instances do not deliver them concurrently.
+	//If the claiming instance dies, the entries are due again at claimUntil.
+	ClaimDueOutboxEntries(now, claimUntil time.Time, limit uint) ([]OutboxEntry, error)
+
+	//Removes a successfully delivered entry from the outbox
+	DelOutboxEntry(id uint64) error
+
+	//Records a failed attempt. If final is true, the entry will not be retried anymore.
+	UpdOutboxEntryFailed(id uint64, attempts uint, nextAttempt time.Time, lastError string, final bool) error
+}
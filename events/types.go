@@ -0,0 +1,61 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+type Type string
+
+const (
+	TypeClaimed       Type = "claimed"
+	TypeRenewed       Type = "renewed"
+	TypeRenewalFailed Type = "renewal_failed"
+	TypeExpiringSoon  Type = "expiring_soon"
+	TypeRevoked       Type = "revoked"
+	TypeDeleted       Type = "deleted"
+)
+
+// Event is a certificate lifecycle event, its JSON form is the payload of webhook deliveries.
+type Event struct {
+	ID        string     `json:"id"`
+	Type      Type       `json:"type"`
+	Time      time.Time  `json:"time"`
+	CAID      string     `json:"caID"`
+	Name      string     `json:"name"`
+	Domains   []string   `json:"domains,omitempty"`
+	User      string     `json:"user,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Emitter receives events. Implementations must not block the caller for long.
+type Emitter interface {
+	Emit(ev *Event)
+}
+
+func NewEvent(typ Type, caID, name string) *Event {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		//crypto/rand does not fail on supported platforms
+		log.WithError(err).Error("Could not generate event ID")
+	}
+	return &Event{
+		ID:   hex.EncodeToString(b),
+		Type: typ,
+		Time: time.Now().UTC(),
+		CAID: caID,
+		Name: name,
+	}
+}
+
+// Multi passes events on to all of its emitters
+type Multi []Emitter
+
+func (m Multi) Emit(ev *Event) {
+	for _, e := range m {
+		e.Emit(ev)
+	}
+}
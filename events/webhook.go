@@ -0,0 +1,269 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	HeaderEvent     = "X-DNS3L-Event"
+	HeaderDelivery  = "X-DNS3L-Delivery"
+	HeaderSignature = "X-DNS3L-Signature"
+
+	DefaultWebhookTimeout = 10 * time.Second
+	maxRetryInterval      = 6 * time.Hour
+	deliveryBatchSize     = 50
+)
+
+type Config struct {
+	Webhooks      map[string]*WebhookConfig `yaml:"webhooks" validate:"dive"` //webhooks mapped with their ID
+	MaxAttempts   uint                      `yaml:"maxAttempts" default:"10"`
+	RetryInterval time.Duration             `yaml:"retryInterval" default:"1m"` //doubled after every failed attempt
+	PollInterval  time.Duration             `yaml:"pollInterval" default:"30s"` //how often the outbox is checked for due retries
+}
+
+type WebhookConfig struct {
+	URL     string        `yaml:"url" validate:"required,url"`
+	Secret  string        `yaml:"secret" validate:"required"` //key of the HMAC-SHA256 signature
+	Events  []Type        `yaml:"events"`                     //all events if empty
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c *WebhookConfig) wants(typ Type) bool {
+	return len(c.Events) <= 0 || slices.Contains(c.Events, typ)
+}
+
+// Sign returns the value of the signature header for the given request body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher stores emitted events in the outbox and delivers them to the configured
+// webhooks in the background. Failed deliveries are retried with exponential backoff, also
+// after a restart.
+type WebhookDispatcher struct {
+	Config *Config
+	State  OutboxStateManager
+	Client *http.Client
+	//Optional, if it returns false the outbox is not delivered by this instance (e.g. if another
+	//instance is the leader)
+	ShouldRunFunc func() bool
+
+	kick     chan struct{}
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func (d *WebhookDispatcher) Init() error {
+	if d.Client == nil {
+		d.Client = &http.Client{}
+	}
+	d.kick = make(chan struct{}, 1)
+	d.stop = make(chan struct{})
+	return nil
+}
+
+func (d *WebhookDispatcher) Emit(ev *Event) {
+
+	l := log.WithFields(logrus.Fields{"event": ev.Type, "caID": ev.CAID, "name": ev.Name})
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		l.WithError(err).Error("Could not encode event")
+		return
+	}
+
+	sess, err := d.State.NewSession()
+	if err != nil {
+		l.WithError(err).Error("Could not store event in outbox")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	queued := false
+	for id, hook := range d.Config.Webhooks {
+		if !hook.wants(ev.Type) {
+			continue
+		}
+		err := sess.PutOutboxEntry(&OutboxEntry{
+			Webhook:     id,
+			EventID:     ev.ID,
+			EventType:   ev.Type,
+			Payload:     string(payload),
+			NextAttempt: ev.Time,
+			CreatedTime: ev.Time,
+		})
+		if err != nil {
+			l.WithError(err).WithField("webhook", id).Error("Could not store event in outbox")
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case d.kick <- struct{}{}:
+		default:
+		}
+	}
+
+}
+
+// Starts the background delivery. Pending entries from the outbox are delivered immediately.
+func (d *WebhookDispatcher) Start() {
+	pollInterval := d.Config.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = 30 * time.Second
+	}
+
+	d.stopped.Add(1)
+	go func() {
+		defer d.stopped.Done()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			d.DeliverDue(time.Now())
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			case <-d.kick:
+			}
+		}
+	}()
+}
+
+// Stops the background delivery and waits until the current batch has been processed.
+func (d *WebhookDispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+	d.stopped.Wait()
+}
+
+// DeliverDue tries to deliver all outbox entries which are due at the given time.
+func (d *WebhookDispatcher) DeliverDue(now time.Time) {
+
+	if d.ShouldRunFunc != nil && !d.ShouldRunFunc() {
+		return
+	}
+
+	sess, err := d.State.NewSession()
+	if err != nil {
+		log.WithError(err).Error("Could not open outbox")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	entries, err := sess.ClaimDueOutboxEntries(now, now.Add(d.claimDuration()), deliveryBatchSize)
+	if err != nil {
+		log.WithError(err).Error("Could not list due events in outbox")
+		return
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		l := log.WithFields(logrus.Fields{"webhook": entry.Webhook, "event": entry.EventType,
+			"eventID": entry.EventID})
+
+		err := d.deliver(entry)
+		if err == nil {
+			l.Debug("Delivered event to webhook")
+			err = sess.DelOutboxEntry(entry.ID)
+			if err != nil {
+				l.WithError(err).Error("Could not remove delivered event from outbox")
+			}
+			continue
+		}
+
+		attempts := entry.Attempts + 1
+		final := d.Config.MaxAttempts > 0 && attempts >= d.Config.MaxAttempts
+		if final {
+			l.WithError(err).Errorf("Giving up delivering event to webhook after %d attempts", attempts)
+		} else {
+			l.WithError(err).Warn("Could not deliver event to webhook, will retry")
+		}
+		err = sess.UpdOutboxEntryFailed(entry.ID, attempts, now.Add(d.retryInterval(attempts)), err.Error(), final)
+		if err != nil {
+			l.WithError(err).Error("Could not update event in outbox")
+		}
+	}
+
+}
+
+// Returns how long claimed entries are kept from other instances, long enough to deliver
+// a whole batch even if every webhook times out.
+func (d *WebhookDispatcher) claimDuration() time.Duration {
+	timeout := DefaultWebhookTimeout
+	for _, hook := range d.Config.Webhooks {
+		timeout = max(timeout, hook.Timeout)
+	}
+	return deliveryBatchSize*timeout + time.Minute
+}
+
+func (d *WebhookDispatcher) retryInterval(attempts uint) time.Duration {
+	interval := d.Config.RetryInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	for i := uint(1); i < attempts && interval < maxRetryInterval; i++ {
+		interval *= 2
+	}
+	return min(interval, maxRetryInterval)
+}
+
+func (d *WebhookDispatcher) deliver(entry *OutboxEntry) error {
+
+	hook, exists := d.Config.Webhooks[entry.Webhook]
+	if !exists {
+		return fmt.Errorf("webhook '%s' is not configured anymore", entry.Webhook)
+	}
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+
+	body := []byte(entry.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(entry.EventType))
+	req.Header.Set(HeaderDelivery, entry.EventID)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, body))
+
+	client := *d.Client
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("webhook responded with " + resp.Status)
+	}
+	return nil
+
+}
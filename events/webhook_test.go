@@ -0,0 +1,271 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memOutbox is an in-memory OutboxStateManager for testing
+type memOutbox struct {
+	mtx     sync.Mutex
+	nextID  uint64
+	entries map[uint64]*OutboxEntry
+}
+
+func (m *memOutbox) NewSession() (OutboxStateManagerSession, error) {
+	return m, nil
+}
+
+func (m *memOutbox) Close() error {
+	return nil
+}
+
+func (m *memOutbox) PutOutboxEntry(entry *OutboxEntry) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.nextID++
+	e := *entry
+	e.ID = m.nextID
+	e.Status = OutboxPending
+	m.entries[e.ID] = &e
+	return nil
+}
+
+func (m *memOutbox) ClaimDueOutboxEntries(now, claimUntil time.Time, limit uint) ([]OutboxEntry, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	res := make([]OutboxEntry, 0)
+	for id := uint64(1); id <= m.nextID && uint(len(res)) < limit; id++ {
+		e, exists := m.entries[id]
+		if exists && (e.Status == OutboxPending || e.Status == OutboxDelivering) && !e.NextAttempt.After(now) {
+			e.Status = OutboxDelivering
+			e.NextAttempt = claimUntil
+			res = append(res, *e)
+		}
+	}
+	return res, nil
+}
+
+func (m *memOutbox) DelOutboxEntry(id uint64) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.entries, id)
+	return nil
+}
+
+func (m *memOutbox) UpdOutboxEntryFailed(id uint64, attempts uint, nextAttempt time.Time,
+	lastError string, final bool) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	e := m.entries[id]
+	e.Attempts = attempts
+	e.NextAttempt = nextAttempt
+	e.LastError = lastError
+	e.Status = OutboxPending
+	if final {
+		e.Status = OutboxFailed
+	}
+	return nil
+}
+
+func TestWebhookDeliveryWithRetry(t *testing.T) {
+
+	var mtx sync.Mutex
+	calls := 0
+	var received Event
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		calls++
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if sig := r.Header.Get(HeaderSignature); sig != Sign("s3cr3t", body) {
+			t.Errorf("invalid signature %q", sig)
+		}
+		if ev := r.Header.Get(HeaderEvent); ev != string(TypeRenewed) {
+			t.Errorf("unexpected event header %q", ev)
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	outbox := &memOutbox{entries: make(map[uint64]*OutboxEntry)}
+	d := &WebhookDispatcher{
+		Config: &Config{
+			Webhooks: map[string]*WebhookConfig{
+				"deploy": {URL: srv.URL, Secret: "s3cr3t", Events: []Type{TypeRenewed}},
+				"other":  {URL: srv.URL, Secret: "other", Events: []Type{TypeDeleted}},
+			},
+			MaxAttempts:   3,
+			RetryInterval: time.Minute,
+		},
+		State: outbox,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := NewEvent(TypeRenewed, "le", "test.example.com.")
+	d.Emit(ev)
+	if len(outbox.entries) != 1 {
+		t.Fatalf("expected 1 outbox entry, got %d", len(outbox.entries))
+	}
+
+	now := time.Now()
+	d.DeliverDue(now)
+	if calls != 1 || len(outbox.entries) != 1 || outbox.entries[1].Attempts != 1 {
+		t.Fatalf("expected failed first attempt to stay in outbox, calls=%d", calls)
+	}
+
+	//not due yet
+	d.DeliverDue(now.Add(30 * time.Second))
+	if calls != 1 {
+		t.Fatalf("retry must wait for the retry interval, calls=%d", calls)
+	}
+
+	d.DeliverDue(now.Add(2 * time.Minute))
+	if calls != 2 || len(outbox.entries) != 0 {
+		t.Fatalf("expected successful retry, calls=%d entries=%d", calls, len(outbox.entries))
+	}
+	if received.ID != ev.ID || received.CAID != "le" || received.Name != "test.example.com." {
+		t.Fatalf("unexpected payload %+v", received)
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	outbox := &memOutbox{entries: make(map[uint64]*OutboxEntry)}
+	d := &WebhookDispatcher{
+		Config: &Config{
+			Webhooks:      map[string]*WebhookConfig{"deploy": {URL: srv.URL, Secret: "s3cr3t"}},
+			MaxAttempts:   2,
+			RetryInterval: time.Second,
+		},
+		State: outbox,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Emit(NewEvent(TypeDeleted, "le", "test.example.com."))
+	now := time.Now()
+	d.DeliverDue(now)
+	d.DeliverDue(now.Add(time.Minute))
+
+	e := outbox.entries[1]
+	if e.Status != OutboxFailed || e.Attempts != 2 || e.LastError == "" {
+		t.Fatalf("unexpected outbox entry %+v", e)
+	}
+}
+
+func TestWebhookDeliveryOnlyOnLeader(t *testing.T) {
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer srv.Close()
+
+	leader := false
+	outbox := &memOutbox{entries: make(map[uint64]*OutboxEntry)}
+	d := &WebhookDispatcher{
+		Config: &Config{
+			Webhooks:      map[string]*WebhookConfig{"deploy": {URL: srv.URL, Secret: "s3cr3t"}},
+			MaxAttempts:   2,
+			RetryInterval: time.Second,
+		},
+		State:         outbox,
+		ShouldRunFunc: func() bool { return leader },
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Emit(NewEvent(TypeDeleted, "le", "test.example.com."))
+	now := time.Now()
+	d.DeliverDue(now)
+	if calls != 0 || outbox.entries[1].Status != OutboxPending {
+		t.Fatalf("events must not be delivered by other instances than the leader, got %d calls", calls)
+	}
+
+	leader = true
+	d.DeliverDue(now)
+	if calls != 1 {
+		t.Fatalf("expected the leader to deliver the event, got %d calls", calls)
+	}
+}
+
+func TestWebhookDeliverySkipsClaimedEntries(t *testing.T) {
+
+	var mtx sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		calls++
+	}))
+	defer srv.Close()
+
+	outbox := &memOutbox{entries: make(map[uint64]*OutboxEntry)}
+	d := &WebhookDispatcher{
+		Config: &Config{
+			Webhooks: map[string]*WebhookConfig{"deploy": {URL: srv.URL, Secret: "s3cr3t"}},
+		},
+		State: outbox,
+	}
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	d.Emit(NewEvent(TypeRenewed, "le", "test.example.com."))
+
+	//another instance claims the entry and dies before delivering it
+	now := time.Now()
+	claimUntil := now.Add(d.claimDuration())
+	claimed, err := outbox.ClaimDueOutboxEntries(now, claimUntil, deliveryBatchSize)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("expected to claim 1 entry, got %d (%v)", len(claimed), err)
+	}
+
+	d.DeliverDue(now.Add(time.Minute))
+	if calls != 0 {
+		t.Fatalf("entry claimed by another instance must not be delivered, calls=%d", calls)
+	}
+
+	d.DeliverDue(claimUntil)
+	if calls != 1 || len(outbox.entries) != 0 {
+		t.Fatalf("expected delivery after the claim expired, calls=%d entries=%d", calls, len(outbox.entries))
+	}
+}
+
+func TestRetryInterval(t *testing.T) {
+	d := &WebhookDispatcher{Config: &Config{RetryInterval: time.Minute}}
+	for attempts, expected := range map[uint]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		20: maxRetryInterval,
+	} {
+		if got := d.retryInterval(attempts); got != expected {
+			t.Errorf("attempts=%d: expected %s, got %s", attempts, expected, got)
+		}
+	}
+}
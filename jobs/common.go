@@ -0,0 +1,5 @@
+package jobs
+
+import "github.com/sirupsen/logrus"
+
+var log = logrus.WithField("module", "jobs")
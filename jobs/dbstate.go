@@ -0,0 +1,231 @@
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/state"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+type JobStateManagerSQL struct {
+	Prov state.SQLDBProvider
+}
+
+type JobStateManagerSQLSession struct {
+	prov *JobStateManagerSQL
+	db   *sql.DB
+}
+
+func (m *JobStateManagerSQL) NewSession() (JobStateManagerSession, error) {
+	db, err := m.Prov.GetDBConn()
+	if err != nil {
+		return nil, err
+	}
+	return &JobStateManagerSQLSession{db: db, prov: m}, nil
+}
+
+func (s *JobStateManagerSQLSession) Close() error {
+	//Nothing to do
+	return nil
+}
+
+func (s *JobStateManagerSQLSession) PutJob(job *Job) error {
+
+	steps, err := json.Marshal([]StepInfo{{Status: job.Status, Time: job.CreatedTime.UTC(), Error: job.Error}})
+	if err != nil {
+		return err
+	}
+	authz := ""
+	if job.Authz != nil {
+		b, err := json.Marshal(job.Authz)
+		if err != nil {
+			return err
+		}
+		authz = string(b)
+	}
+
+	_, err = s.db.Exec(`INSERT INTO `+s.prov.Prov.DBName("jobs")+` (job_id, job_type, ca_id, key_name, `+
+		`created_by, created_by_email, authz, status, steps, error, request, result, owner, created_time, `+
+		`updated_time, heartbeat_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		job.ID, job.Type, job.CAID, job.Name, job.CreatedBy.Name, job.CreatedBy.Email, authz,
+		job.Status, string(steps), job.Error, job.Request, job.Result, job.Owner, job.CreatedTime.UTC(),
+		job.CreatedTime.UTC(), job.CreatedTime.UTC())
+	if err != nil {
+		return fmt.Errorf("problem while storing job in database: %w", err)
+	}
+	return nil
+
+}
+
+const jobColumns = `job_id, job_type, ca_id, key_name, created_by, created_by_email, authz, status, steps, ` +
+	`error, request, result, owner, created_time, updated_time, heartbeat_time`
+
+func rowToJob(row interface{ Scan(dest ...any) error }, job *Job) error {
+
+	var steps, authz string
+	job.CreatedBy = &authtypes.UserInfo{}
+	err := row.Scan(&job.ID, &job.Type, &job.CAID, &job.Name, &job.CreatedBy.Name, &job.CreatedBy.Email, &authz,
+		&job.Status, &steps, &job.Error, &job.Request, &job.Result, &job.Owner, &job.CreatedTime, &job.UpdatedTime,
+		&job.HeartbeatTime)
+	if err != nil {
+		return err
+	}
+
+	if authz != "" {
+		job.Authz = &Authorization{}
+		err = json.Unmarshal([]byte(authz), job.Authz)
+		if err != nil {
+			return err
+		}
+	}
+
+	return json.Unmarshal([]byte(steps), &job.Steps)
+
+}
+
+func (s *JobStateManagerSQLSession) GetJob(id string) (*Job, error) {
+
+	row := s.db.QueryRow(`SELECT `+jobColumns+` FROM `+s.prov.Prov.DBName("jobs")+
+		` WHERE job_id = ? LIMIT 1;`, id)
+
+	job := &Job{}
+	err := rowToJob(row, job)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+
+}
+
+func (s *JobStateManagerSQLSession) AddJobStep(id string, step StepInfo) error {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer util.RollbackIfNotCommitted(log, tx)
+
+	row := tx.QueryRow(`SELECT `+jobColumns+` FROM `+s.prov.Prov.DBName("jobs")+
+		` WHERE job_id = ? LIMIT 1 FOR UPDATE;`, id)
+
+	job := &Job{}
+	err = rowToJob(row, job)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("job '%s' does not exist", id)
+	} else if err != nil {
+		return err
+	}
+
+	if job.Status.IsFinal() {
+		log.WithField("jobID", id).WithField("status", step.Status).Warn("Job is already finished, ignoring step")
+		return nil
+	}
+	for _, st := range job.Steps {
+		if st.Status == step.Status {
+			return nil
+		}
+	}
+
+	step.Time = step.Time.UTC()
+	job.Steps = append(job.Steps, step)
+	steps, err := json.Marshal(job.Steps)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE `+s.prov.Prov.DBName("jobs")+` SET status = ?, steps = ?, error = ?, `+
+		`updated_time = ? WHERE job_id = ?;`, step.Status, string(steps), step.Error, step.Time, id)
+	if err != nil {
+		return fmt.Errorf("problem while updating job in database: %w", err)
+	}
+
+	return tx.Commit()
+
+}
+
+func (s *JobStateManagerSQLSession) UpdJobResult(id string, result string, now time.Time) error {
+
+	_, err := s.db.Exec(`UPDATE `+s.prov.Prov.DBName("jobs")+` SET result = ?, updated_time = ? WHERE job_id = ?;`,
+		result, now.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("problem while updating job result in database: %w", err)
+	}
+	return nil
+
+}
+
+// Statuses of unfinished jobs
+var unfinished = []string{string(StatusQueued), string(StatusDNSSet), string(StatusValidating),
+	string(StatusRunning)}
+
+func (s *JobStateManagerSQLSession) TouchJobs(owner string, now time.Time) error {
+
+	q, args, err := squirrel.Update(s.prov.Prov.DBName("jobs")).Set("heartbeat_time", now.UTC()).
+		Where(squirrel.Eq{"owner": owner, "status": unfinished}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(q, args...)
+	if err != nil {
+		return fmt.Errorf("problem while refreshing heartbeat of jobs: %w", err)
+	}
+	return nil
+
+}
+
+func (s *JobStateManagerSQLSession) ListOrphanedJobs(staleBefore time.Time) ([]Job, error) {
+
+	rows, err := squirrel.Select(jobColumns).From(s.prov.Prov.DBName("jobs")).
+		Where(squirrel.Eq{"status": unfinished}).Where(squirrel.Lt{"heartbeat_time": staleBefore.UTC()}).
+		OrderBy("created_time").RunWith(s.db).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]Job, 0, 16)
+	for rows.Next() {
+		res = append(res, Job{})
+		err := rowToJob(rows, &res[len(res)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+
+}
+
+func (s *JobStateManagerSQLSession) TakeOverJob(id, oldOwner, newOwner string, staleBefore,
+	now time.Time) (bool, error) {
+
+	q, args, err := squirrel.Update(s.prov.Prov.DBName("jobs")).
+		Set("owner", newOwner).Set("heartbeat_time", now.UTC()).
+		Where(squirrel.Eq{"job_id": id, "owner": oldOwner, "status": unfinished}).
+		Where(squirrel.Lt{"heartbeat_time": staleBefore.UTC()}).ToSql()
+	if err != nil {
+		return false, err
+	}
+	res, err := s.db.Exec(q, args...)
+	if err != nil {
+		return false, fmt.Errorf("problem while taking over job: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+
+}
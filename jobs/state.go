@@ -0,0 +1,34 @@
+package jobs
+
+import "time"
+
+type JobStateManager interface {
+	NewSession() (JobStateManagerSession, error)
+}
+
+type JobStateManagerSession interface {
+	Close() error
+
+	//Stores a new job, its current status is added as first step
+	PutJob(job *Job) error
+
+	//Returns nil if the job does not exist
+	GetJob(id string) (*Job, error)
+
+	//Appends the step to the job and makes its status the current one of the job.
+	//Steps with a status the job already had are ignored, as are steps of final jobs.
+	AddJobStep(id string, step StepInfo) error
+
+	//Replaces the result of the job, e.g. while it progresses
+	UpdJobResult(id string, result string, now time.Time) error
+
+	//Refreshes the heartbeat of the unfinished jobs of the owner
+	TouchJobs(owner string, now time.Time) error
+
+	//Returns the unfinished jobs whose heartbeat is older than staleBefore, oldest first
+	ListOrphanedJobs(staleBefore time.Time) ([]Job, error)
+
+	//Makes newOwner the owner of the job if it is still owned by oldOwner and its heartbeat
+	//is older than staleBefore. Returns false if another instance was faster.
+	TakeOverJob(id, oldOwner, newOwner string, staleBefore, now time.Time) (bool, error)
+}
@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+)
+
+type Status string
+
+const (
+	StatusQueued     Status = "queued"
+	StatusDNSSet     Status = "dns-set"
+	StatusValidating Status = "validating"
+	StatusIssued     Status = "issued"
+	StatusRunning    Status = "running"   //jobs other than claims
+	StatusSucceeded  Status = "succeeded" //jobs other than claims
+	StatusFailed     Status = "failed"
+)
+
+const (
+	TypeClaim      = "claim"
+	TypeRenewalRun = "renewal-run"
+)
+
+// IsFinal returns true if a job with this status will not change anymore
+func (s Status) IsFinal() bool {
+	return s == StatusIssued || s == StatusSucceeded || s == StatusFailed
+}
+
+type StepInfo struct {
+	Status Status    `json:"status"`
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type Job struct {
+	ID          string
+	Type        string
+	CAID        string
+	Name        string
+	CreatedBy   *authtypes.UserInfo
+	Authz       *Authorization //nil if the job has been stored without it
+	Status      Status
+	Steps       []StepInfo
+	Error       string
+	Request     string //JSON-encoded request, required to resume queued jobs after a restart
+	Result      string //JSON-encoded result, e.g. the report of a renewal run, empty for claims
+	Owner       string //ID of the instance running the job
+	CreatedTime time.Time
+	UpdatedTime time.Time
+
+	//Refreshed by the owner while it is alive, jobs with an outdated heartbeat are taken
+	//over by another instance
+	HeartbeatTime time.Time
+}
+
+// Restrictions of the client which created a job. The job has been authorized against them
+// when it was created, an instance resuming the job checks them again.
+type Authorization struct {
+	Delegated  bool              `json:"delegated,omitempty"` //created with a token or client certificate
+	TokenID    string            `json:"tokenID,omitempty"`   //set if created with a token from the DB
+	NotBefore  time.Time         `json:"notBefore"`
+	Expiry     time.Time         `json:"expiry"`
+	Scopes     []authtypes.Scope `json:"scopes,omitempty"`     //all if empty
+	CAsAllowed []string          `json:"casAllowed,omitempty"` //all if empty
+}
+
+func NewJobID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
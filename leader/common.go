@@ -0,0 +1,5 @@
+package leader
+
+import "github.com/sirupsen/logrus"
+
+var log = logrus.WithField("module", "leader")
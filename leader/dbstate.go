@@ -0,0 +1,101 @@
+package leader
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dns3l/dns3l-core/state"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+type LeaseStateManagerSQL struct {
+	Prov state.SQLDBProvider
+}
+
+type LeaseStateManagerSQLSession struct {
+	prov *LeaseStateManagerSQL
+	db   *sql.DB
+}
+
+func (m *LeaseStateManagerSQL) NewSession() (LeaseStateManagerSession, error) {
+	db, err := m.Prov.GetDBConn()
+	if err != nil {
+		return nil, err
+	}
+	return &LeaseStateManagerSQLSession{db: db, prov: m}, nil
+}
+
+func (s *LeaseStateManagerSQLSession) Close() error {
+	//Nothing to do
+	return nil
+}
+
+func (s *LeaseStateManagerSQLSession) TryAcquireLease(name, holder string, now time.Time,
+	duration time.Duration) (bool, error) {
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer util.RollbackIfNotCommitted(log, tx)
+
+	table := s.prov.Prov.DBName("leases")
+	expires := now.Add(duration).UTC()
+
+	var curHolder string
+	var curExpires time.Time
+	err = tx.QueryRow(`SELECT holder, expires_time FROM `+table+` WHERE name=? FOR UPDATE;`, name).Scan(
+		&curHolder, &curExpires)
+	if err == sql.ErrNoRows {
+		//if another instance inserts concurrently, it gets the lease
+		res, err := tx.Exec(`INSERT IGNORE INTO `+table+` (name, holder, expires_time) VALUES (?, ?, ?);`,
+			name, holder, expires)
+		if err != nil {
+			return false, fmt.Errorf("problem while acquiring lease '%s': %w", name, err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		return affected > 0, tx.Commit()
+	} else if err != nil {
+		return false, err
+	}
+
+	if curHolder != holder && curExpires.After(now) {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`UPDATE `+table+` SET holder=?, expires_time=? WHERE name=?;`, holder, expires, name)
+	if err != nil {
+		return false, fmt.Errorf("problem while acquiring lease '%s': %w", name, err)
+	}
+
+	return true, tx.Commit()
+
+}
+
+func (s *LeaseStateManagerSQLSession) GetLeaseHolder(name string, now time.Time) (string, error) {
+
+	var holder string
+	err := s.db.QueryRow(`SELECT holder FROM `+s.prov.Prov.DBName("leases")+` WHERE name=? AND expires_time > ?;`,
+		name, now.UTC()).Scan(&holder)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("problem while getting lease '%s': %w", name, err)
+	}
+	return holder, nil
+
+}
+
+func (s *LeaseStateManagerSQLSession) ReleaseLease(name, holder string) error {
+
+	_, err := s.db.Exec(`DELETE FROM `+s.prov.Prov.DBName("leases")+` WHERE name=? AND holder=?;`, name, holder)
+	if err != nil {
+		return fmt.Errorf("problem while releasing lease '%s': %w", name, err)
+	}
+	return nil
+
+}
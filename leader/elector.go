@@ -0,0 +1,217 @@
+package leader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	LeaseLeader    = "leader"    //held by the instance which runs the renewals
+	LeaseBootstrap = "bootstrap" //held while bootstrap certificates are claimed
+	LeaseNotify    = "notify"    //held while notification digests are sent
+	LeaseRenewRun  = "renew-run" //held while a manually triggered renewal run is executed
+)
+
+// LeaseRenewCert is held while the certificate is renewed
+func LeaseRenewCert(caID, certKey string) string {
+	return "renew-cert/" + caID + "/" + certKey
+}
+
+type Config struct {
+	LeaseDuration time.Duration `yaml:"leaseDuration" default:"30s"` //another instance takes over after this if the holder dies
+	RenewInterval time.Duration `yaml:"renewInterval" default:"10s"` //must be well below leaseDuration
+}
+
+// Elector lets instances running on the same DB agree on one leader via a lease in the
+// DB. The leader keeps extending its lease, if it dies another instance takes over after
+// the lease expired. The clocks of the instances are expected to be synchronized.
+type Elector struct {
+	Config *Config
+	State  LeaseStateManager
+	ID     string //identifies this instance as lease holder, generated if empty
+
+	leader atomic.Bool
+
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func (e *Elector) Init() error {
+	if e.ID == "" {
+		b := make([]byte, 8)
+		_, err := rand.Read(b)
+		if err != nil {
+			return err
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+		}
+		e.ID = hostname + "-" + hex.EncodeToString(b)
+	}
+	e.stop = make(chan struct{})
+	return nil
+}
+
+// IsLeader returns whether this instance currently holds the leader lease.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Starts competing for the leader lease every RenewInterval.
+func (e *Elector) Start() {
+	e.stopped.Add(1)
+	go func() {
+		defer e.stopped.Done()
+		ticker := time.NewTicker(e.Config.RenewInterval)
+		defer ticker.Stop()
+		for {
+			e.Campaign(time.Now())
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stops competing and hands the leader lease over to the other instances.
+func (e *Elector) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+	e.stopped.Wait()
+
+	if e.leader.Swap(false) {
+		e.release(LeaseLeader)
+		log.WithField("id", e.ID).Info("Resigned as leader")
+	}
+}
+
+// Campaign acquires or extends the leader lease at the given time.
+func (e *Elector) Campaign(now time.Time) {
+	l := log.WithField("id", e.ID)
+
+	acquired, err := e.tryAcquire(LeaseLeader, now)
+	if err != nil {
+		//the lease might expire meanwhile, so do not act as leader anymore
+		l.WithError(err).Error("Could not acquire or extend leader lease")
+		acquired = false
+	}
+
+	if e.leader.Swap(acquired) != acquired {
+		if acquired {
+			l.Info("Became leader")
+		} else {
+			l.Warn("Lost leadership")
+		}
+	}
+}
+
+// RunExclusive runs f while holding the given lease, so that no other instance runs it
+// at the same time. Waits until the lease is free.
+func (e *Elector) RunExclusive(name string, f func() error) error {
+	l := log.WithFields(logrus.Fields{"id": e.ID, "lease": name})
+
+	for waiting := false; ; waiting = true {
+		acquired, err := e.tryAcquire(name, time.Now())
+		if err != nil {
+			return err
+		}
+		if acquired {
+			break
+		}
+		if !waiting {
+			l.Info("Lease is held by another instance, waiting...")
+		}
+		time.Sleep(e.Config.RenewInterval)
+	}
+	return e.runHolding(name, f)
+}
+
+// TryRunExclusive runs f while holding the given lease like RunExclusive, but returns
+// false without running f if another instance holds the lease.
+func (e *Elector) TryRunExclusive(name string, f func() error) (bool, error) {
+	acquired, err := e.tryAcquire(name, time.Now())
+	if err != nil || !acquired {
+		return false, err
+	}
+	return true, e.runHolding(name, f)
+}
+
+// Holder returns the instance which currently holds the given lease, empty if it is free.
+func (e *Elector) Holder(name string) (string, error) {
+	sess, err := e.State.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	return sess.GetLeaseHolder(name, time.Now())
+}
+
+// runHolding runs f, keeps extending the already acquired lease meanwhile and releases it
+// afterwards.
+func (e *Elector) runHolding(name string, f func() error) error {
+	l := log.WithFields(logrus.Fields{"id": e.ID, "lease": name})
+
+	defer e.release(name)
+
+	//keep the lease while f is running
+	done := make(chan struct{})
+	var extending sync.WaitGroup
+	extending.Add(1)
+	go func() {
+		defer extending.Done()
+		ticker := time.NewTicker(e.Config.RenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				acquired, err := e.tryAcquire(name, time.Now())
+				if err != nil || !acquired {
+					l.WithError(err).Error("Could not extend lease")
+				}
+			}
+		}
+	}()
+	defer extending.Wait()
+	defer close(done)
+
+	return f()
+}
+
+func (e *Elector) tryAcquire(name string, now time.Time) (bool, error) {
+	sess, err := e.State.NewSession()
+	if err != nil {
+		return false, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	return sess.TryAcquireLease(name, e.ID, now, e.Config.LeaseDuration)
+}
+
+func (e *Elector) release(name string) {
+	sess, err := e.State.NewSession()
+	if err != nil {
+		log.WithError(err).WithField("lease", name).Error("Could not release lease")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	err = sess.ReleaseLease(name, e.ID)
+	if err != nil {
+		log.WithError(err).WithField("lease", name).Error("Could not release lease")
+	}
+}
@@ -0,0 +1,169 @@
+package leader
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type memLease struct {
+	holder  string
+	expires time.Time
+}
+
+// memLeaseState is an in-memory LeaseStateManager for testing
+type memLeaseState struct {
+	mtx    sync.Mutex
+	leases map[string]*memLease
+}
+
+func (m *memLeaseState) NewSession() (LeaseStateManagerSession, error) {
+	return m, nil
+}
+
+func (m *memLeaseState) Close() error {
+	return nil
+}
+
+func (m *memLeaseState) TryAcquireLease(name, holder string, now time.Time, duration time.Duration) (bool, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	l, exists := m.leases[name]
+	if exists && l.holder != holder && l.expires.After(now) {
+		return false, nil
+	}
+	m.leases[name] = &memLease{holder: holder, expires: now.Add(duration)}
+	return true, nil
+}
+
+func (m *memLeaseState) ReleaseLease(name, holder string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if l, exists := m.leases[name]; exists && l.holder == holder {
+		delete(m.leases, name)
+	}
+	return nil
+}
+
+func (m *memLeaseState) GetLeaseHolder(name string, now time.Time) (string, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if l, exists := m.leases[name]; exists && l.expires.After(now) {
+		return l.holder, nil
+	}
+	return "", nil
+}
+
+func newTestElector(t *testing.T, id string, state *memLeaseState) *Elector {
+	e := &Elector{
+		Config: &Config{LeaseDuration: 30 * time.Second, RenewInterval: 10 * time.Millisecond},
+		State:  state,
+		ID:     id,
+	}
+	if err := e.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestElectorSingleLeaderAndTakeover(t *testing.T) {
+	state := &memLeaseState{leases: make(map[string]*memLease)}
+	a := newTestElector(t, "a", state)
+	b := newTestElector(t, "b", state)
+
+	now := time.Now()
+	a.Campaign(now)
+	b.Campaign(now)
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("expected a to be the only leader, a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+
+	//a keeps extending its lease
+	a.Campaign(now.Add(20 * time.Second))
+	b.Campaign(now.Add(40 * time.Second))
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("expected a to stay leader, a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+
+	//a died, b takes over after the lease expired
+	b.Campaign(now.Add(51 * time.Second))
+	a.Campaign(now.Add(52 * time.Second))
+	if a.IsLeader() || !b.IsLeader() {
+		t.Fatalf("expected b to take over, a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+
+	b.Stop()
+	a.Campaign(now.Add(53 * time.Second))
+	if !a.IsLeader() {
+		t.Fatal("expected a to become leader after b resigned")
+	}
+}
+
+func TestElectorRunExclusive(t *testing.T) {
+	state := &memLeaseState{leases: make(map[string]*memLease)}
+
+	var mtx sync.Mutex
+	running, maxRunning, runs := 0, 0, 0
+	var wg sync.WaitGroup
+	for _, id := range []string{"a", "b", "c"} {
+		e := newTestElector(t, id, state)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := e.RunExclusive(LeaseBootstrap, func() error {
+				mtx.Lock()
+				running++
+				runs++
+				maxRunning = max(maxRunning, running)
+				mtx.Unlock()
+				time.Sleep(30 * time.Millisecond)
+				mtx.Lock()
+				running--
+				mtx.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if runs != 3 || maxRunning != 1 {
+		t.Fatalf("expected 3 exclusive runs, got runs=%d maxRunning=%d", runs, maxRunning)
+	}
+	if len(state.leases) != 0 {
+		t.Fatalf("expected lease to be released, have %+v", state.leases)
+	}
+}
+
+func TestElectorTryRunExclusive(t *testing.T) {
+	state := &memLeaseState{leases: make(map[string]*memLease)}
+	a := newTestElector(t, "a", state)
+	b := newTestElector(t, "b", state)
+
+	ran, err := a.TryRunExclusive(LeaseRenewRun, func() error {
+		ranB, err := b.TryRunExclusive(LeaseRenewRun, func() error {
+			t.Error("b must not run while a holds the lease")
+			return nil
+		})
+		if err != nil || ranB {
+			t.Errorf("expected b to be rejected, ran=%v err=%v", ranB, err)
+		}
+		return nil
+	})
+	if err != nil || !ran {
+		t.Fatalf("expected a to run, ran=%v err=%v", ran, err)
+	}
+
+	ran, err = b.TryRunExclusive(LeaseRenewRun, func() error {
+		holder, err := a.Holder(LeaseRenewRun)
+		if err != nil || holder != "b" {
+			t.Errorf("expected b to be the holder, have %q, err=%v", holder, err)
+		}
+		return nil
+	})
+	if err != nil || !ran {
+		t.Fatalf("expected b to run after a released the lease, ran=%v err=%v", ran, err)
+	}
+}
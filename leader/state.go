@@ -0,0 +1,22 @@
+package leader
+
+import "time"
+
+type LeaseStateManager interface {
+	NewSession() (LeaseStateManagerSession, error)
+}
+
+// A lease is held by at most one holder until it expires or is released.
+type LeaseStateManagerSession interface {
+	Close() error
+
+	//Acquires the lease if it is free or expired at now, or extends it if it is already held
+	//by holder. Returns false if another holder has the lease.
+	TryAcquireLease(name, holder string, now time.Time, duration time.Duration) (bool, error)
+
+	//Does nothing if holder does not have the lease
+	ReleaseLease(name, holder string) error
+
+	//Returns the holder of the lease, empty if it is free or expired at now
+	GetLeaseHolder(name string, now time.Time) (string, error)
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHTTPMiddlewareUsesRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/ca/{caID}/crt/{crtID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Use(HTTPMiddleware)
+
+	for _, crt := range []string{"a.example.com", "b.example.com"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ca/le/crt/"+crt, nil))
+	}
+
+	cnt := testutil.ToFloat64(HTTPRequests.WithLabelValues("/ca/{caID}/crt/{crtID}", http.MethodGet, "404"))
+	if cnt != 2 {
+		t.Fatalf("expected 2 requests for route template, got %v", cnt)
+	}
+}
+
+func TestHandlerExposesMetrics(t *testing.T) {
+	Claims.WithLabelValues("le", Result(nil)).Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `dns3l_claims_total{ca="le",result="success"} 1`) {
+		t.Fatalf("claims counter not exposed:\n%s", rec.Body.String())
+	}
+}
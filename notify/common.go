@@ -0,0 +1,5 @@
+package notify
+
+import "github.com/sirupsen/logrus"
+
+var log = logrus.WithField("module", "notify")
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dns3l/dns3l-core/events"
+	"github.com/dns3l/dns3l-core/state"
+)
+
+type NotificationStateManagerSQL struct {
+	Prov state.SQLDBProvider
+}
+
+type NotificationStateManagerSQLSession struct {
+	prov *NotificationStateManagerSQL
+	db   *sql.DB
+}
+
+func (m *NotificationStateManagerSQL) NewSession() (NotificationStateManagerSession, error) {
+	db, err := m.Prov.GetDBConn()
+	if err != nil {
+		return nil, err
+	}
+	return &NotificationStateManagerSQLSession{db: db, prov: m}, nil
+}
+
+func (s *NotificationStateManagerSQLSession) Close() error {
+	//Nothing to do
+	return nil
+}
+
+func (s *NotificationStateManagerSQLSession) GetLastNotified(caID, keyName string, typ events.Type) (time.Time, error) {
+
+	var last time.Time
+	row := s.db.QueryRow(`SELECT last_sent FROM `+s.prov.Prov.DBName("notifications")+
+		` WHERE ca_id = ? AND key_name = ? AND event_type = ? LIMIT 1;`, caID, keyName, typ)
+	err := row.Scan(&last)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return last, nil
+
+}
+
+func (s *NotificationStateManagerSQLSession) PutLastNotified(caID, keyName string, typ events.Type, at time.Time) error {
+
+	_, err := s.db.Exec(`INSERT INTO `+s.prov.Prov.DBName("notifications")+
+		` (ca_id, key_name, event_type, last_sent) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE last_sent = ?;`,
+		caID, keyName, typ, at.UTC(), at.UTC())
+	if err != nil {
+		return fmt.Errorf("problem while storing notification time: %w", err)
+	}
+	return nil
+
+}
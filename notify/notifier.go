@@ -0,0 +1,341 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/dns3l/dns3l-core/events"
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultSubjectTemplate = `[dns3l] {{len .Items}} certificate notification(s) for {{.Owner}}`
+
+	DefaultBodyTemplate = `Hello {{.Owner}},
+
+the following certificates managed by dns3l need your attention.
+{{if .Expiring}}
+Certificates expiring soon:
+{{range .Expiring}}  - {{.Name}} (CA {{.CAID}}){{if .ExpiresAt}}, expires {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}{{end}}
+{{end}}{{end}}{{if .RenewalFailed}}
+Failed renewals:
+{{range .RenewalFailed}}  - {{.Name}} (CA {{.CAID}}): {{.Error}}
+{{end}}{{end}}{{if .Revoked}}
+Revoked certificates:
+{{range .Revoked}}  - {{.Name}} (CA {{.CAID}})
+{{end}}{{end}}
+{{if .URL}}Manage your certificates at {{.URL}}
+{{end}}`
+)
+
+type Config struct {
+	SMTP            SMTPConfig    `yaml:"smtp" validate:"required"`
+	Period          time.Duration `yaml:"period" default:"24h"`       //each cert is notified at most once per period (minus a quarter) and event type
+	FlushInterval   time.Duration `yaml:"flushInterval" default:"5m"` //how often collected notifications are sent as digests
+	SubjectTemplate string        `yaml:"subjectTemplate"`            //text/template, see DigestData
+	BodyTemplate    string        `yaml:"bodyTemplate"`               //text/template, see DigestData
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" validate:"required"`
+	Port     uint16 `yaml:"port" default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from" validate:"required,email"`
+}
+
+// An entry of a digest mail
+type DigestItem struct {
+	Type      events.Type
+	CAID      string
+	Name      string
+	Domains   []string
+	ExpiresAt *time.Time
+	Error     string
+}
+
+// The data the subject and body templates are executed with
+type DigestData struct {
+	Owner         string
+	URL           string
+	Items         []DigestItem
+	Expiring      []DigestItem
+	RenewalFailed []DigestItem
+	Revoked       []DigestItem
+}
+
+// Notifier collects expiry warnings, failed renewals and revocations and mails them as
+// one digest per certificate owner. The admin e-mail addresses are CC'd.
+type Notifier struct {
+	Config *Config
+	State  NotificationStateManager
+	CC     []string
+	URL    string //URL of the dns3l service, passed to the templates
+	//Optional, runs the sending so that no other instance sends digests at the same time, which
+	//would not see each other's notification times and notify twice
+	RunExclusiveFunc func(f func() error) error
+
+	subject *template.Template
+	body    *template.Template
+
+	mtx     sync.Mutex
+	pending map[string][]DigestItem //by owner e-mail address
+
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func (n *Notifier) Init() error {
+	subjectTmpl := n.Config.SubjectTemplate
+	if subjectTmpl == "" {
+		subjectTmpl = DefaultSubjectTemplate
+	}
+	bodyTmpl := n.Config.BodyTemplate
+	if bodyTmpl == "" {
+		bodyTmpl = DefaultBodyTemplate
+	}
+
+	var err error
+	n.subject, err = template.New("subject").Parse(subjectTmpl)
+	if err != nil {
+		return fmt.Errorf("invalid notification subject template: %w", err)
+	}
+	n.body, err = template.New("body").Parse(bodyTmpl)
+	if err != nil {
+		return fmt.Errorf("invalid notification body template: %w", err)
+	}
+
+	n.pending = make(map[string][]DigestItem)
+	n.stop = make(chan struct{})
+	return nil
+}
+
+// Emit collects the events owners shall be notified about until the next Flush.
+func (n *Notifier) Emit(ev *events.Event) {
+	switch ev.Type {
+	case events.TypeExpiringSoon, events.TypeRenewalFailed, events.TypeRevoked:
+	default:
+		return
+	}
+
+	if strings.TrimSpace(ev.User) == "" {
+		log.WithFields(logrus.Fields{"event": ev.Type, "caID": ev.CAID, "name": ev.Name}).Warn(
+			"Certificate has no owner e-mail address, not notifying")
+		return
+	}
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.pending[ev.User] = append(n.pending[ev.User], DigestItem{
+		Type:      ev.Type,
+		CAID:      ev.CAID,
+		Name:      ev.Name,
+		Domains:   ev.Domains,
+		ExpiresAt: ev.ExpiresAt,
+		Error:     ev.Error,
+	})
+}
+
+// Starts sending the collected notifications every FlushInterval.
+func (n *Notifier) Start() {
+	flushInterval := n.Config.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = 5 * time.Minute
+	}
+
+	n.stopped.Add(1)
+	go func() {
+		defer n.stopped.Done()
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-n.stop:
+				n.Flush(time.Now())
+				return
+			case <-ticker.C:
+				n.Flush(time.Now())
+			}
+		}
+	}()
+}
+
+// Stops the background sending, collected notifications are sent before.
+func (n *Notifier) Stop() {
+	n.stopOnce.Do(func() {
+		close(n.stop)
+	})
+	n.stopped.Wait()
+}
+
+// Flush sends one digest to every owner with collected notifications. Certificates the
+// owner has already been notified about within the period are left out.
+func (n *Notifier) Flush(now time.Time) {
+
+	n.mtx.Lock()
+	pending := n.pending
+	n.pending = make(map[string][]DigestItem)
+	n.mtx.Unlock()
+
+	if len(pending) <= 0 {
+		return
+	}
+
+	send := func() error {
+		return n.send(pending, now)
+	}
+	var err error
+	if n.RunExclusiveFunc != nil {
+		err = n.RunExclusiveFunc(send)
+	} else {
+		err = send()
+	}
+	if err != nil {
+		log.WithError(err).Error("Could not send notifications, dropping them")
+	}
+
+}
+
+func (n *Notifier) send(pending map[string][]DigestItem, now time.Time) error {
+
+	sess, err := n.State.NewSession()
+	if err != nil {
+		return err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	owners := make([]string, 0, len(pending))
+	for owner := range pending {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	for _, owner := range owners {
+		l := log.WithField("owner", owner)
+
+		items := n.filterDue(sess, pending[owner], now)
+		if len(items) <= 0 {
+			continue
+		}
+
+		err := n.sendDigest(owner, items)
+		if err != nil {
+			l.WithError(err).Error("Could not send notification digest")
+			continue
+		}
+		l.WithField("numItems", len(items)).Info("Sent notification digest")
+
+		for _, item := range items {
+			err := sess.PutLastNotified(item.CAID, item.Name, item.Type, now)
+			if err != nil {
+				l.WithError(err).Error("Could not store notification time")
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// Removes duplicates and the items which have already been notified within the period.
+// Events like expiry warnings are emitted once per renewal run, which does not reach a
+// certificate at exactly the same time every day, so a quarter of the period is tolerated.
+// Otherwise a run reaching it a bit earlier than the day before would skip a whole day.
+func (n *Notifier) filterDue(sess NotificationStateManagerSession, items []DigestItem, now time.Time) []DigestItem {
+	minInterval := n.Config.Period - n.Config.Period/4
+	res := make([]DigestItem, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		key := string(item.Type) + "/" + item.CAID + "/" + item.Name
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		last, err := sess.GetLastNotified(item.CAID, item.Name, item.Type)
+		if err != nil {
+			log.WithError(err).Error("Could not get last notification time, notifying nevertheless")
+		} else if !last.IsZero() && now.Sub(last) < minInterval {
+			continue
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
+func (n *Notifier) sendDigest(owner string, items []DigestItem) error {
+
+	data := &DigestData{
+		Owner: owner,
+		URL:   n.URL,
+		Items: items,
+	}
+	for _, item := range items {
+		switch item.Type {
+		case events.TypeExpiringSoon:
+			data.Expiring = append(data.Expiring, item)
+		case events.TypeRenewalFailed:
+			data.RenewalFailed = append(data.RenewalFailed, item)
+		case events.TypeRevoked:
+			data.Revoked = append(data.Revoked, item)
+		}
+	}
+
+	var subject, body bytes.Buffer
+	err := n.subject.Execute(&subject, data)
+	if err != nil {
+		return err
+	}
+	err = n.body.Execute(&body, data)
+	if err != nil {
+		return err
+	}
+
+	msg, err := n.buildMessage(owner, strings.TrimSpace(subject.String()), body.String())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if n.Config.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", n.Config.SMTP.Username, n.Config.SMTP.Password, n.Config.SMTP.Host)
+	}
+
+	addr := net.JoinHostPort(n.Config.SMTP.Host, strconv.Itoa(int(n.Config.SMTP.Port)))
+	return smtp.SendMail(addr, auth, n.Config.SMTP.From, append([]string{owner}, n.CC...), msg)
+
+}
+
+func (n *Notifier) buildMessage(to, subject, body string) ([]byte, error) {
+	for _, v := range append([]string{to, subject, n.Config.SMTP.From}, n.CC...) {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, errors.New("line breaks are not allowed in mail headers")
+		}
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.Config.SMTP.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	if len(n.CC) > 0 {
+		fmt.Fprintf(&msg, "Cc: %s\r\n", strings.Join(n.CC, ", "))
+	}
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,240 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dns3l/dns3l-core/events"
+)
+
+type testMail struct {
+	from string
+	rcpt []string
+	data string
+}
+
+// testSMTPServer is a minimal local SMTP stand-in which accepts every mail
+type testSMTPServer struct {
+	l     net.Listener
+	mtx   sync.Mutex
+	mails []testMail
+}
+
+func newTestSMTPServer(t *testing.T) *testSMTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSMTPServer{l: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+
+	mail := testMail{}
+	reply("220 localhost test SMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			mail.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			mail.rcpt = append(mail.rcpt, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				dl, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dl == ".\r\n" {
+					break
+				}
+				data.WriteString(dl)
+			}
+			mail.data = data.String()
+			s.mtx.Lock()
+			s.mails = append(s.mails, mail)
+			s.mtx.Unlock()
+			mail = testMail{}
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *testSMTPServer) getMails() []testMail {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]testMail{}, s.mails...)
+}
+
+type memNotificationState struct {
+	last map[string]time.Time
+}
+
+func (m *memNotificationState) NewSession() (NotificationStateManagerSession, error) {
+	return m, nil
+}
+
+func (m *memNotificationState) Close() error {
+	return nil
+}
+
+func (m *memNotificationState) GetLastNotified(caID, keyName string, typ events.Type) (time.Time, error) {
+	return m.last[caID+"/"+keyName+"/"+string(typ)], nil
+}
+
+func (m *memNotificationState) PutLastNotified(caID, keyName string, typ events.Type, at time.Time) error {
+	m.last[caID+"/"+keyName+"/"+string(typ)] = at
+	return nil
+}
+
+func newTestNotifier(t *testing.T, srv *testSMTPServer) *Notifier {
+	host, port, err := net.SplitHostPort(srv.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &Notifier{
+		Config: &Config{
+			SMTP:   SMTPConfig{Host: host, Port: uint16(portNum), From: "dns3l@example.com"},
+			Period: 24 * time.Hour,
+		},
+		State: &memNotificationState{last: make(map[string]time.Time)},
+		CC:    []string{"admin@example.com"},
+		URL:   "https://dns3l.example.com",
+	}
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestNotifierSendsDigestPerOwner(t *testing.T) {
+	srv := newTestSMTPServer(t)
+	defer srv.l.Close()
+	n := newTestNotifier(t, srv)
+
+	expiresAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	alice1 := events.NewEvent(events.TypeExpiringSoon, "le", "a.example.com.")
+	alice1.User = "alice@example.com"
+	alice1.ExpiresAt = &expiresAt
+	alice2 := events.NewEvent(events.TypeRenewalFailed, "le", "b.example.com.")
+	alice2.User = "alice@example.com"
+	alice2.Error = "acme: rate limited"
+	bob := events.NewEvent(events.TypeRevoked, "step", "c.example.com.")
+	bob.User = "bob@example.com"
+	ignored := events.NewEvent(events.TypeClaimed, "le", "d.example.com.")
+	ignored.User = "bob@example.com"
+
+	for _, ev := range []*events.Event{alice1, alice2, alice1, bob, ignored} {
+		n.Emit(ev)
+	}
+	n.Flush(time.Now())
+
+	mails := srv.getMails()
+	if len(mails) != 2 {
+		t.Fatalf("expected 2 digests, got %d", len(mails))
+	}
+
+	alice := mails[0]
+	if strings.Join(alice.rcpt, ",") != "alice@example.com,admin@example.com" {
+		t.Fatalf("unexpected recipients %v", alice.rcpt)
+	}
+	for _, expected := range []string{"Cc: admin@example.com", "a.example.com.", "2026-05-01 12:00 UTC",
+		"b.example.com. (CA le): acme: rate limited", "https://dns3l.example.com"} {
+		if !strings.Contains(alice.data, expected) {
+			t.Errorf("digest for alice does not contain %q:\n%s", expected, alice.data)
+		}
+	}
+	if strings.Count(alice.data, "a.example.com.") != 1 {
+		t.Errorf("duplicate events must be notified once:\n%s", alice.data)
+	}
+	if !strings.Contains(mails[1].data, "Revoked certificates") || strings.Contains(mails[1].data, "d.example.com.") {
+		t.Errorf("unexpected digest for bob:\n%s", mails[1].data)
+	}
+}
+
+func TestNotifierOncePerPeriod(t *testing.T) {
+	srv := newTestSMTPServer(t)
+	defer srv.l.Close()
+	n := newTestNotifier(t, srv)
+
+	ev := events.NewEvent(events.TypeExpiringSoon, "le", "a.example.com.")
+	ev.User = "alice@example.com"
+
+	now := time.Now()
+	n.Emit(ev)
+	n.Flush(now)
+	n.Emit(ev)
+	n.Flush(now.Add(time.Hour))
+	if len(srv.getMails()) != 1 {
+		t.Fatalf("cert must be notified at most once per period, got %d mails", len(srv.getMails()))
+	}
+
+	//the next daily run reaches the cert a bit earlier than the day before
+	n.Emit(ev)
+	n.Flush(now.Add(23*time.Hour + 50*time.Minute))
+	if len(srv.getMails()) != 2 {
+		t.Fatalf("cert must be notified again in the next period, got %d mails", len(srv.getMails()))
+	}
+}
+
+func TestNotifierCustomTemplate(t *testing.T) {
+	srv := newTestSMTPServer(t)
+	defer srv.l.Close()
+	n := newTestNotifier(t, srv)
+	n.Config.SubjectTemplate = "Expiring: {{len .Expiring}}"
+	n.Config.BodyTemplate = "{{range .Items}}{{.Type}} {{.Name}}\n{{end}}"
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := events.NewEvent(events.TypeExpiringSoon, "le", "a.example.com.")
+	ev.User = "alice@example.com"
+	n.Emit(ev)
+	n.Flush(time.Now())
+
+	mails := srv.getMails()
+	if len(mails) != 1 || !strings.Contains(mails[0].data, "Subject: Expiring: 1") ||
+		!strings.Contains(mails[0].data, "expiring_soon a.example.com.") {
+		t.Fatalf("unexpected mails %+v", mails)
+	}
+}
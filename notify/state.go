@@ -0,0 +1,20 @@
+package notify
+
+import (
+	"time"
+
+	"github.com/dns3l/dns3l-core/events"
+)
+
+type NotificationStateManager interface {
+	NewSession() (NotificationStateManagerSession, error)
+}
+
+type NotificationStateManagerSession interface {
+	Close() error
+
+	//Returns the zero time if the owner of the cert has never been notified about the event type
+	GetLastNotified(caID, keyName string, typ events.Type) (time.Time, error)
+
+	PutLastNotified(caID, keyName string, typ events.Type, at time.Time) error
+}
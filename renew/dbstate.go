@@ -0,0 +1,333 @@
+package renew
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/dns3l/dns3l-core/state"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+type RetryStateManagerSQL struct {
+	Prov state.SQLDBProvider
+}
+
+type RetryStateManagerSQLSession struct {
+	prov *RetryStateManagerSQL
+	db   *sql.DB
+}
+
+func (m *RetryStateManagerSQL) NewSession() (RetryStateManagerSession, error) {
+	db, err := m.Prov.GetDBConn()
+	if err != nil {
+		return nil, err
+	}
+	return &RetryStateManagerSQLSession{db: db, prov: m}, nil
+}
+
+func (s *RetryStateManagerSQLSession) Close() error {
+	//Nothing to do
+	return nil
+}
+
+func (s *RetryStateManagerSQLSession) GetRenewRetry(caID, certKey string) (*RetryInfo, error) {
+
+	info := &RetryInfo{CAID: caID, CertKey: certKey}
+	var nextRetry *time.Time
+	err := s.db.QueryRow(`SELECT failures, last_error, last_failure_time, next_retry_time FROM `+
+		s.prov.Prov.DBName("renew_retries")+` WHERE ca_id=? AND key_name=? LIMIT 1;`, caID, certKey).Scan(
+		&info.Failures, &info.LastError, &info.LastFailureTime, &nextRetry)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if nextRetry != nil {
+		info.NextRetryTime = *nextRetry
+	}
+	return info, nil
+
+}
+
+func (s *RetryStateManagerSQLSession) PutRenewRetry(info *RetryInfo) error {
+
+	_, err := s.db.Exec(`INSERT INTO `+s.prov.Prov.DBName("renew_retries")+` (ca_id, key_name, failures, `+
+		`last_error, last_failure_time, next_retry_time) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE `+
+		`failures=VALUES(failures), last_error=VALUES(last_error), last_failure_time=VALUES(last_failure_time), `+
+		`next_retry_time=VALUES(next_retry_time);`,
+		info.CAID, info.CertKey, info.Failures, info.LastError, info.LastFailureTime.UTC(), zeroToNilTime(info.NextRetryTime))
+	if err != nil {
+		return fmt.Errorf("problem while storing renewal retry: %w", err)
+	}
+	return nil
+
+}
+
+func (s *RetryStateManagerSQLSession) DelRenewRetry(caID, certKey string) error {
+
+	_, err := s.db.Exec(`DELETE FROM `+s.prov.Prov.DBName("renew_retries")+` WHERE ca_id=? AND key_name=?;`,
+		caID, certKey)
+	if err != nil {
+		return fmt.Errorf("problem while removing renewal retry: %w", err)
+	}
+	return nil
+
+}
+
+func (s *RetryStateManagerSQLSession) ListDueRenewRetries(now time.Time, limit uint) ([]RetryInfo, error) {
+
+	rows, err := s.db.Query(`SELECT ca_id, key_name, failures, last_error, last_failure_time, next_retry_time FROM `+
+		s.prov.Prov.DBName("renew_retries")+` WHERE next_retry_time <= ? ORDER BY next_retry_time LIMIT ?;`,
+		now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]RetryInfo, 0, limit)
+	for rows.Next() {
+		var info RetryInfo
+		err := rows.Scan(&info.CAID, &info.CertKey, &info.Failures, &info.LastError, &info.LastFailureTime,
+			&info.NextRetryTime)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, info)
+	}
+
+	return res, rows.Err()
+
+}
+
+func (s *RetryStateManagerSQLSession) ListRenewRetries(caID string) ([]RetryInfo, error) {
+
+	rows, err := s.db.Query(`SELECT ca_id, key_name, failures, last_error, last_failure_time, next_retry_time FROM `+
+		s.prov.Prov.DBName("renew_retries")+` WHERE ca_id=?;`, caID)
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]RetryInfo, 0, 16)
+	for rows.Next() {
+		var info RetryInfo
+		var nextRetry *time.Time
+		err := rows.Scan(&info.CAID, &info.CertKey, &info.Failures, &info.LastError, &info.LastFailureTime,
+			&nextRetry)
+		if err != nil {
+			return nil, err
+		}
+		if nextRetry != nil {
+			info.NextRetryTime = *nextRetry
+		}
+		res = append(res, info)
+	}
+
+	return res, rows.Err()
+
+}
+
+type JobStateManagerSQL struct {
+	Prov state.SQLDBProvider
+}
+
+type JobStateManagerSQLSession struct {
+	prov *JobStateManagerSQL
+	db   *sql.DB
+}
+
+func (m *JobStateManagerSQL) NewSession() (JobStateManagerSession, error) {
+	db, err := m.Prov.GetDBConn()
+	if err != nil {
+		return nil, err
+	}
+	return &JobStateManagerSQLSession{db: db, prov: m}, nil
+}
+
+func (s *JobStateManagerSQLSession) Close() error {
+	//Nothing to do
+	return nil
+}
+
+func (s *JobStateManagerSQLSession) PutRenewalJob(job *Job) error {
+
+	res, err := s.db.Exec(`INSERT INTO `+s.prov.Prov.DBName("renewal_jobs")+` (ca_id, key_name, status, `+
+		`job_trigger, owner, attempt, created_time, start_time, end_time, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		job.CAID, job.CertKey, job.Status, job.Trigger, job.Owner, job.Attempt, job.CreatedTime.UTC(),
+		zeroToNilTime(job.StartTime), zeroToNilTime(job.EndTime), job.Error)
+	if err != nil {
+		return fmt.Errorf("problem while storing renewal job: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	job.ID = uint64(id)
+	return nil
+
+}
+
+func (s *JobStateManagerSQLSession) UpdRenewalJob(job *Job) error {
+
+	_, err := s.db.Exec(`UPDATE `+s.prov.Prov.DBName("renewal_jobs")+` SET status=?, attempt=?, start_time=?, `+
+		`end_time=?, error=? WHERE id=?;`,
+		job.Status, job.Attempt, zeroToNilTime(job.StartTime), zeroToNilTime(job.EndTime), job.Error, job.ID)
+	if err != nil {
+		return fmt.Errorf("problem while updating renewal job: %w", err)
+	}
+	return nil
+
+}
+
+func (s *JobStateManagerSQLSession) ListRenewalJobs(filter *JobFilter, pginfo *util.PaginationInfo) ([]Job, error) {
+
+	q := squirrel.Select("id", "ca_id", "key_name", "status", "job_trigger", "owner", "attempt", "created_time",
+		"start_time", "end_time", "error", "COUNT(*) OVER () AS total_count").
+		From(s.prov.Prov.DBName("renewal_jobs")).OrderBy("id DESC")
+
+	if filter != nil {
+		if filter.CAID != "" {
+			q = q.Where(squirrel.Eq{"ca_id": filter.CAID})
+		}
+		if filter.CertKey != "" {
+			q = q.Where(squirrel.Eq{"key_name": filter.CertKey})
+		}
+		if filter.Status != "" {
+			q = q.Where(squirrel.Eq{"status": filter.Status})
+		}
+		if !filter.Since.IsZero() {
+			q = q.Where(squirrel.GtOrEq{"created_time": filter.Since.UTC()})
+		}
+	}
+
+	if pginfo != nil && pginfo.Limit > 0 {
+		q = q.Limit(pginfo.Limit).Offset(pginfo.Offset)
+	}
+
+	qStr, qArgs, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(qStr, qArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]Job, 0, 100)
+	var totalCount uint64
+	for rows.Next() {
+		var j Job
+		var startTime, endTime *time.Time
+		var owner *string
+		err := rows.Scan(&j.ID, &j.CAID, &j.CertKey, &j.Status, &j.Trigger, &owner, &j.Attempt, &j.CreatedTime,
+			&startTime, &endTime, &j.Error, &totalCount)
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil {
+			j.Owner = *owner
+		}
+		if startTime != nil {
+			j.StartTime = *startTime
+		}
+		if endTime != nil {
+			j.EndTime = *endTime
+		}
+		res = append(res, j)
+	}
+
+	if pginfo != nil {
+		pginfo.TotalCount = totalCount
+	}
+
+	return res, rows.Err()
+
+}
+
+func (s *JobStateManagerSQLSession) HasUnfinishedRenewalJob(caID, certKey string) (bool, error) {
+
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+s.prov.Prov.DBName("renewal_jobs")+
+		` WHERE ca_id=? AND key_name=? AND status IN (?, ?));`, caID, certKey, JobPending, JobRunning).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("problem while checking unfinished renewal jobs: %w", err)
+	}
+	return exists, nil
+
+}
+
+func (s *JobStateManagerSQLSession) ListOrphanedRenewalJobs(liveOwners []string, limit uint) ([]Job, error) {
+
+	q := squirrel.Select("id", "ca_id", "key_name", "status", "job_trigger", "owner", "attempt", "created_time").
+		From(s.prov.Prov.DBName("renewal_jobs")).
+		Where(squirrel.Eq{"status": []JobStatus{JobPending, JobRunning}}).
+		OrderBy("id").Limit(uint64(limit))
+	if len(liveOwners) > 0 {
+		q = q.Where(squirrel.Or{squirrel.Eq{"owner": nil}, squirrel.NotEq{"owner": liveOwners}})
+	}
+
+	qStr, qArgs, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(qStr, qArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("problem while listing orphaned renewal jobs: %w", err)
+	}
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]Job, 0, limit)
+	for rows.Next() {
+		var j Job
+		var owner *string
+		err := rows.Scan(&j.ID, &j.CAID, &j.CertKey, &j.Status, &j.Trigger, &owner, &j.Attempt, &j.CreatedTime)
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil {
+			j.Owner = *owner
+		}
+		res = append(res, j)
+	}
+
+	return res, rows.Err()
+
+}
+
+func (s *JobStateManagerSQLSession) TakeOverRenewalJob(id uint64, oldOwner, newOwner string) (bool, error) {
+
+	res, err := s.db.Exec(`UPDATE `+s.prov.Prov.DBName("renewal_jobs")+` SET owner=? WHERE id=? AND `+
+		`status IN (?, ?) AND COALESCE(owner, '')=?;`, newOwner, id, JobPending, JobRunning, oldOwner)
+	if err != nil {
+		return false, fmt.Errorf("problem while taking over renewal job: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+
+}
+
+func (s *JobStateManagerSQLSession) DelRenewalJobsBefore(t time.Time) (int64, error) {
+
+	res, err := s.db.Exec(`DELETE FROM `+s.prov.Prov.DBName("renewal_jobs")+` WHERE created_time < ?;`, t.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("problem while deleting renewal jobs: %w", err)
+	}
+	return res.RowsAffected()
+
+}
+
+func zeroToNilTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,79 @@
+package renew
+
+import (
+	"time"
+
+	"github.com/dns3l/dns3l-core/util"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// What started a renewal job
+type JobTrigger string
+
+const (
+	TriggerScheduled JobTrigger = "scheduled" //daily renewal run
+	TriggerRetry     JobTrigger = "retry"     //retry of a failed renewal
+	TriggerManual    JobTrigger = "manual"    //renewal run triggered by an admin
+)
+
+// A renewal of one certificate
+type Job struct {
+	ID          uint64
+	CAID        string
+	CertKey     string
+	Status      JobStatus
+	Trigger     JobTrigger
+	Owner       string //the instance running the job
+	Attempt     uint   //1 for the first attempt since the last successful renewal
+	CreatedTime time.Time
+	StartTime   time.Time //zero if not yet started
+	EndTime     time.Time //zero if not yet finished
+	Error       string
+}
+
+// Filter for listing renewal jobs, empty fields do not filter
+type JobFilter struct {
+	CAID    string
+	CertKey string
+	Status  JobStatus
+	Since   time.Time //created at or after
+}
+
+type JobStateManager interface {
+	NewSession() (JobStateManagerSession, error)
+}
+
+type JobStateManagerSession interface {
+	Close() error
+
+	//Sets the ID of the job
+	PutRenewalJob(job *Job) error
+
+	//Updates status, attempt, start and end time and error of the job
+	UpdRenewalJob(job *Job) error
+
+	//Newest jobs first. pginfo is optional, its TotalCount is set.
+	ListRenewalJobs(filter *JobFilter, pginfo *util.PaginationInfo) ([]Job, error)
+
+	//Whether the certificate has a pending or running job
+	HasUnfinishedRenewalJob(caID, certKey string) (bool, error)
+
+	//Pending or running jobs whose owner is not one of liveOwners, e.g. because the instance
+	//running them died. Oldest jobs first.
+	ListOrphanedRenewalJobs(liveOwners []string, limit uint) ([]Job, error)
+
+	//Sets the owner of the pending or running job to newOwner if it is still owned by
+	//oldOwner. Returns false if another instance was faster.
+	TakeOverRenewalJob(id uint64, oldOwner, newOwner string) (bool, error)
+
+	//Returns the number of deleted jobs
+	DelRenewalJobsBefore(t time.Time) (int64, error)
+}
@@ -0,0 +1,59 @@
+package renew
+
+import (
+	"time"
+)
+
+const maxRetryInterval = 6 * time.Hour
+
+type RetryConfig struct {
+	MaxAttempts  uint          `yaml:"maxAttempts" default:"5"`   //failed attempts after which the renewal is escalated
+	Interval     time.Duration `yaml:"interval" default:"15m"`    //doubled after every failed attempt
+	PollInterval time.Duration `yaml:"pollInterval" default:"1m"` //how often due retries are checked
+}
+
+// Failed renewals of a certificate since its last successful renewal
+type RetryInfo struct {
+	CAID            string
+	CertKey         string
+	Failures        uint
+	LastError       string
+	LastFailureTime time.Time
+	NextRetryTime   time.Time //zero if no more retries are done, the daily renewal still tries
+}
+
+type RetryStateManager interface {
+	NewSession() (RetryStateManagerSession, error)
+}
+
+type RetryStateManagerSession interface {
+	Close() error
+
+	//Returns nil if the certificate has no failed renewals
+	GetRenewRetry(caID, certKey string) (*RetryInfo, error)
+
+	PutRenewRetry(info *RetryInfo) error
+
+	DelRenewRetry(caID, certKey string) error
+
+	ListDueRenewRetries(now time.Time, limit uint) ([]RetryInfo, error)
+
+	//Lists the failed renewals of all certificates of a CA
+	ListRenewRetries(caID string) ([]RetryInfo, error)
+}
+
+// NextRetry returns when the renewal shall be retried after the given number of
+// failures, or false if the maximum number of attempts is reached.
+func (c *RetryConfig) NextRetry(failures uint, now time.Time) (time.Time, bool) {
+	if c.MaxAttempts > 0 && failures >= c.MaxAttempts {
+		return time.Time{}, false
+	}
+	interval := c.Interval
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	for i := uint(1); i < failures && interval < maxRetryInterval; i++ {
+		interval *= 2
+	}
+	return now.Add(min(interval, maxRetryInterval)), true
+}
@@ -0,0 +1,32 @@
+package renew
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryConfigNextRetry(t *testing.T) {
+	c := &RetryConfig{MaxAttempts: 5, Interval: 15 * time.Minute}
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for failures, expected := range map[uint]time.Duration{
+		1: 15 * time.Minute,
+		2: 30 * time.Minute,
+		4: 2 * time.Hour,
+	} {
+		next, retry := c.NextRetry(failures, now)
+		if !retry || next.Sub(now) != expected {
+			t.Errorf("failures=%d: expected retry after %s, got %s (retry=%v)", failures, expected, next.Sub(now), retry)
+		}
+	}
+
+	if _, retry := c.NextRetry(5, now); retry {
+		t.Error("expected no retry after max attempts")
+	}
+
+	c.MaxAttempts = 0
+	next, retry := c.NextRetry(20, now)
+	if !retry || next.Sub(now) != maxRetryInterval {
+		t.Errorf("expected capped retry interval, got %s (retry=%v)", next.Sub(now), retry)
+	}
+}
@@ -1,6 +1,7 @@
 package renew
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"runtime/debug"
@@ -17,16 +18,21 @@ type Scheduler[T any, PT interface {
 	*T
 }] struct {
 	sched        gocron.Scheduler
+	ctx          context.Context
+	cancel       context.CancelFunc
 	JobStartTime string
 	MaxDuration  time.Duration
 	GetJobsFunc  func() ([]T, error)
 	JobExecFunc  func(job PT) error
 	ReportFunc   func(start, end time.Time, success, fail uint)
+	//Optional, if it returns false the renewal run is skipped (e.g. if another instance is the leader)
+	ShouldRunFunc func() bool
 }
 
 func (s *Scheduler[T, PT]) StartAsync() error {
 
 	var err error
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 	hours, minutes, err := ParseTimeAtDay(s.JobStartTime)
 	if err != nil {
 		return fmt.Errorf("error parsing time at day: %w", err)
@@ -53,6 +59,19 @@ func (s *Scheduler[T, PT]) StartAsync() error {
 
 }
 
+// Stops scheduling, a running renewal run does not start further jobs. Waits for the running
+// jobs up to the stop timeout of the scheduler.
+func (s *Scheduler[T, PT]) Stop() {
+	if s.sched == nil {
+		return
+	}
+	s.cancel()
+	err := s.sched.Shutdown()
+	if err != nil {
+		log.WithError(err).Warn("Renewal scheduler did not shut down cleanly")
+	}
+}
+
 func ParseTimeAtDay(timeStr string) (uint, uint, error) {
 	parts := strings.Split(timeStr, ":")
 	if len(parts) != 2 {
@@ -74,6 +93,11 @@ func ParseTimeAtDay(timeStr string) (uint, uint, error) {
 
 func (s *Scheduler[T, PT]) scheduleRenewJobs() {
 
+	if s.ShouldRunFunc != nil && !s.ShouldRunFunc() {
+		log.Info("Skipping renewal jobs on this instance.")
+		return
+	}
+
 	start := time.Now()
 
 	jobs, err := s.GetJobsFunc()
@@ -91,20 +115,14 @@ func (s *Scheduler[T, PT]) scheduleRenewJobs() {
 
 	log.WithField("jobcount", len(jobs)).Info("Triggering renewal jobs...")
 
-	interval := time.Duration(s.MaxDuration.Nanoseconds() / int64(len(jobs)))
-	jobresults := make(chan error, len(jobs))
-	for i := range jobs {
-		job := &jobs[i]
-		go s.execRenewJob(job, jobresults)
-		if i != len(jobs)-1 {
-			time.Sleep(interval)
-		}
-	}
-
 	success := uint(0)
 	failed := uint(0)
-	for range jobs {
-		err := <-jobresults
+	ctx := s.ctx
+	if ctx == nil {
+		//not started by the scheduler
+		ctx = context.Background()
+	}
+	for _, err := range RunJobs(ctx, jobs, s.MaxDuration, s.JobExecFunc) {
 		if err == nil {
 			success++
 		} else {
@@ -118,21 +136,64 @@ func (s *Scheduler[T, PT]) scheduleRenewJobs() {
 
 }
 
-func (s *Scheduler[T, PT]) execRenewJob(job PT, resultchan chan error) {
-	var err error
+// RunJobs executes the jobs concurrently, started evenly spread over maxDuration, and waits
+// until all of them have finished. The returned errors are in the order of the jobs. Once ctx
+// is canceled no further jobs are started, they fail with the error of ctx.
+func RunJobs[T any, PT interface {
+	String() string
+	*T
+}](ctx context.Context, jobs []T, maxDuration time.Duration, execFunc func(job PT) error) []error {
+
+	type result struct {
+		idx int
+		err error
+	}
+
+	var interval time.Duration
+	if len(jobs) > 0 {
+		interval = time.Duration(maxDuration.Nanoseconds() / int64(len(jobs)))
+	}
+	errs := make([]error, len(jobs))
+	jobresults := make(chan result, len(jobs))
+	started := 0
+	for i := range jobs {
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+		go func(i int) {
+			jobresults <- result{idx: i, err: execRenewJob(PT(&jobs[i]), execFunc)}
+		}(i)
+		started++
+		if i != len(jobs)-1 && interval > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+	}
+
+	for range started {
+		res := <-jobresults
+		errs[res.idx] = res.err
+	}
+	return errs
+
+}
+
+func execRenewJob[PT interface{ String() string }](job PT, execFunc func(job PT) error) (err error) {
 	defer func() {
 		if pan := recover(); pan != nil {
 			log.WithFields(logrus.Fields{"cause": pan, "stack": string(debug.Stack())}).Error("Job panicked.")
-			resultchan <- fmt.Errorf("job panicked: %v", pan)
-			return
+			err = fmt.Errorf("job panicked: %v", pan)
 		}
-		resultchan <- err
 	}()
 	log.WithField("job", job.String()).Info("Job execution started")
-	err = s.JobExecFunc(job)
+	err = execFunc(job)
 	if err != nil {
 		log.WithError(err).WithField("job", job.String()).Error("Job execution failed")
-		return
+		return err
 	}
 	log.WithField("job", job.String()).Info("Job execution successfully finished")
+	return nil
 }
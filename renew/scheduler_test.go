@@ -1,6 +1,7 @@
 package renew
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -70,3 +71,21 @@ func TestSchedulers(T *testing.T) {
 func dopanic() {
 	panic("panic occured")
 }
+
+func TestRunJobsStopsStartingWhenCanceled(T *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := []SchedulerJob{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	executed := make(chan string, len(jobs))
+
+	errs := RunJobs(ctx, jobs, time.Hour, func(job *SchedulerJob) error {
+		executed <- job.Name
+		cancel() //e.g. on shutdown while waiting for the next job
+		return nil
+	})
+
+	assert.Equal(T, 1, len(executed))
+	assert.Equal(T, nil, errs[0])
+	assert.Equal(T, context.Canceled, errs[1])
+	assert.Equal(T, context.Canceled, errs[2])
+}
@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A Backend looks up the secret a reference points to. The reference is the part between
+// the scheme and the closing brace, e.g. DB_PASS of ${env:DB_PASS}.
+type Backend interface {
+	Lookup(ref string) (string, error)
+}
+
+type BackendFunc func(ref string) (string, error)
+
+func (f BackendFunc) Lookup(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	backendsMtx sync.RWMutex
+	backends    = map[string]Backend{
+		"env":   BackendFunc(lookupEnv),
+		"file":  BackendFunc(lookupFile),
+		"vault": &VaultKV{},
+	}
+)
+
+// Register makes a backend available for references with the given scheme, e.g. "vault"
+// for ${vault:...}. An already registered backend of the scheme is replaced.
+func Register(scheme string, b Backend) {
+	backendsMtx.Lock()
+	defer backendsMtx.Unlock()
+	backends[scheme] = b
+}
+
+func getBackend(scheme string) (Backend, error) {
+	backendsMtx.RLock()
+	defer backendsMtx.RUnlock()
+	b, exists := backends[scheme]
+	if !exists {
+		return nil, fmt.Errorf("unknown secret backend '%s'", scheme)
+	}
+	return b, nil
+}
+
+func lookupEnv(name string) (string, error) {
+	val, exists := os.LookupEnv(name)
+	if !exists {
+		return "", fmt.Errorf("environment variable '%s' is not set", name)
+	}
+	return val, nil
+}
+
+// Trailing line breaks are removed, since most editors and echo add one
+func lookupFile(path string) (string, error) {
+	val, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(val), "\r\n"), nil
+}
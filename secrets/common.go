@@ -0,0 +1,5 @@
+package secrets
+
+import "github.com/sirupsen/logrus"
+
+var log = logrus.WithField("module", "secrets")
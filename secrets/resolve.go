@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ${scheme:ref}, a leading $ escapes it
+var refRegex = regexp.MustCompile(`\$?\$\{([a-z0-9]+):([^}]*)\}`)
+
+// Resolve replaces the secret references in s, e.g. ${env:DB_PASS}, ${file:/run/secrets/pass}
+// or ${vault:secret/dns3l#pass}, with the secrets they point to. A reference may be a part
+// of s, e.g. of a DSN. $${...} is kept literally as ${...}.
+func Resolve(s string) (string, error) {
+
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var err error
+	res := refRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		m := refRegex.FindStringSubmatch(ref)
+		var b Backend
+		b, err = getBackend(m[1])
+		if err != nil {
+			return ""
+		}
+		var val string
+		val, err = b.Lookup(m[2])
+		if err != nil {
+			err = fmt.Errorf("could not resolve ${%s:%s}: %w", m[1], m[2], err)
+		}
+		return val
+	})
+	if err != nil {
+		return "", err
+	}
+	return res, nil
+
+}
+
+// ResolveAll resolves the secret references in all exported string fields of the struct v
+// points to, also in nested structs, slices and maps. The top-level fields with the given
+// YAML keys are skipped, e.g. because they resolve their references themselves.
+func ResolveAll(v interface{}, skip ...string) error {
+
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Pointer || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("secrets can only be resolved in a struct pointer, got %T", v)
+	}
+	val = val.Elem()
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		name := yamlName(field)
+		if !field.IsExported() || name == "-" || slices.Contains(skip, name) {
+			continue
+		}
+		err := resolveValue(val.Field(i), name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+
+}
+
+func resolveValue(v reflect.Value, path string) error {
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return resolveValue(v.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := yamlName(field)
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			err := resolveValue(v.Field(i), path+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			err := resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			//map values cannot be set, so a copy is resolved and put back
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			err := resolveValue(elem, fmt.Sprintf("%s.%v", path, iter.Key()))
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		res, err := Resolve(v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(res)
+	}
+	return nil
+
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
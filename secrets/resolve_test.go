@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("DNS3L_TEST_PASS", "s3cret")
+	file := filepath.Join(t.TempDir(), "token")
+	err := os.WriteFile(file, []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"plain":                  "plain",
+		"${env:DNS3L_TEST_PASS}": "s3cret",
+		"user:${env:DNS3L_TEST_PASS}@tcp(db)/dns3ld":    "user:s3cret@tcp(db)/dns3ld",
+		"${file:" + file + "}":                          "from-file",
+		"$${env:DNS3L_TEST_PASS}":                       "${env:DNS3L_TEST_PASS}",
+		"${env:DNS3L_TEST_PASS}-${env:DNS3L_TEST_PASS}": "s3cret-s3cret",
+	}
+	for in, expected := range cases {
+		res, err := Resolve(in)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if res != expected {
+			t.Errorf("%s: expected '%s', got '%s'", in, expected, res)
+		}
+	}
+
+	for _, in := range []string{"${env:DNS3L_TEST_UNSET}", "${nope:foo}", "${file:/nonexistent}"} {
+		_, err := Resolve(in)
+		if err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+}
+
+type testAuth struct {
+	User string `yaml:"user"`
+	Pass string `yaml:"pass"`
+}
+
+type testConfig struct {
+	Auth    *testAuth         `yaml:"auth"`
+	Headers map[string]string `yaml:"headers"`
+	Tokens  []testAuth        `yaml:"tokens"`
+	Skipped string            `yaml:"skipped"`
+	Prov    interface{}
+	secret  string
+}
+
+func TestResolveAll(t *testing.T) {
+	t.Setenv("DNS3L_TEST_PASS", "s3cret")
+	ref := "${env:DNS3L_TEST_PASS}"
+
+	conf := &testConfig{
+		Auth:    &testAuth{User: "user", Pass: ref},
+		Headers: map[string]string{"Authorization": "Bearer " + ref},
+		Tokens:  []testAuth{{Pass: ref}},
+		Skipped: ref,
+		Prov:    &testAuth{Pass: ref},
+		secret:  ref,
+	}
+	err := ResolveAll(conf, "skipped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Auth.Pass != "s3cret" || conf.Headers["Authorization"] != "Bearer s3cret" ||
+		conf.Tokens[0].Pass != "s3cret" || conf.Prov.(*testAuth).Pass != "s3cret" {
+		t.Errorf("expected references to be resolved, got %+v", conf)
+	}
+	if conf.Skipped != ref || conf.secret != ref {
+		t.Error("expected skipped and unexported fields to be left alone")
+	}
+
+	conf.Tokens[0].Pass = "${env:DNS3L_TEST_UNSET}"
+	err = ResolveAll(conf)
+	if err == nil || !strings.HasPrefix(err.Error(), "tokens[0].pass:") {
+		t.Errorf("expected error with YAML path, got %v", err)
+	}
+}
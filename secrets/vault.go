@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dns3l/dns3l-core/util"
+)
+
+const vaultTimeout = 10 * time.Second
+
+// VaultKV reads secrets from a KV version 2 secrets engine of HashiCorp Vault or OpenBao.
+// References have the form <mount>/<path>#<key>, e.g. ${vault:secret/dns3l/otc#sk}.
+// If Addr or Token are empty, VAULT_ADDR and VAULT_TOKEN from the environment are used.
+type VaultKV struct {
+	Addr   string
+	Token  string
+	Client *http.Client
+}
+
+func (v *VaultKV) Lookup(ref string) (string, error) {
+
+	path, key, found := strings.Cut(ref, "#")
+	if !found || key == "" {
+		return "", errors.New("vault reference must have the form <mount>/<path>#<key>")
+	}
+	mount, secretPath, found := strings.Cut(path, "/")
+	if !found || mount == "" || secretPath == "" {
+		return "", errors.New("vault reference must have the form <mount>/<path>#<key>")
+	}
+
+	addr := v.Addr
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return "", errors.New("vault address not given, set VAULT_ADDR")
+	}
+	token := v.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: vaultTimeout}
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v1/%s/data/%s",
+		strings.TrimSuffix(addr, "/"), mount, secretPath), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer util.LogDefer(log, resp.Body.Close)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d for %s", resp.StatusCode, path)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", err
+	}
+	val, exists := body.Data.Data[key]
+	if !exists {
+		return "", fmt.Errorf("key '%s' not found in %s", key, path)
+	}
+	s, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("key '%s' in %s is not a string", key, path)
+	}
+	return s, nil
+
+}
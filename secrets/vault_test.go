@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Serves secret/data/dns3l/otc of a KV version 2 engine like a Vault dev server
+func newVaultDevServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/dns3l/otc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"data":{"ak":"access","sk":"s3cret"},"metadata":{"version":1}}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVaultKV(t *testing.T) {
+	srv := newVaultDevServer(t)
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	res, err := Resolve("${vault:secret/dns3l/otc#sk}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "s3cret" {
+		t.Errorf("expected s3cret, got %s", res)
+	}
+
+	for _, ref := range []string{"secret/dns3l/otc#missing", "secret/dns3l/other#sk", "secret/dns3l/otc", "secret#sk"} {
+		_, err := (&VaultKV{}).Lookup(ref)
+		if err == nil {
+			t.Errorf("%s: expected error", ref)
+		}
+	}
+
+	_, err = (&VaultKV{Addr: srv.URL, Token: "wrong"}).Lookup("secret/dns3l/otc#sk")
+	if err == nil {
+		t.Error("expected error for wrong token")
+	}
+}
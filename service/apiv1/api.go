@@ -1,7 +1,12 @@
 package apiv1
 
 import (
+	"context"
+	"time"
+
 	api "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/audit"
+	"github.com/dns3l/dns3l-core/renew"
 	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
 	"github.com/dns3l/dns3l-core/util"
 )
@@ -12,11 +17,29 @@ type ServiceV1 interface {
 	GetDNSRootzones() []api.DNSRootzoneInfo
 	GetCAs() ([]*api.CAInfo, error)
 	GetCA(caID string) (*api.CAInfo, error)
-	ClaimCertificate(caID string, cinfo *api.CertClaimInfo, authz authtypes.AuthorizationInfo) error
+	ClaimCertificate(ctx context.Context, caID string, cinfo *api.CertClaimInfo, authz authtypes.AuthorizationInfo) error
+	ClaimCertificateAsync(ctx context.Context, caID string, cinfo *api.CertClaimInfo, authz authtypes.AuthorizationInfo) (*api.JobInfo, error)
+	GetJob(jobID string, authz authtypes.AuthorizationInfo) (*api.JobInfo, error)
+	DryRunClaimCertificate(caID string, cinfo *api.CertClaimInfo, authz authtypes.AuthorizationInfo) (*api.ClaimPrecheckReport, error)
 	DeleteCertificate(caID, crtID string, authz authtypes.AuthorizationInfo) error
+	RenewCertificate(caID, crtID string, rinfo *api.CertRenewInfo, authz authtypes.AuthorizationInfo) (*api.CertRenewResult, error)
+	ModifyCertificate(ctx context.Context, caID, crtID string, minfo *api.CertModifyInfo, authz authtypes.AuthorizationInfo) error
 	GetCertificateResource(caID, crtID, obj string, authz authtypes.AuthorizationInfo) (string, string, error)
 	GetAllCertResources(caID, crtID string, authz authtypes.AuthorizationInfo) (*api.CertResources, error)
 	GetCertificateInfos(caID string, crtID string, authz authtypes.AuthorizationInfo, pginfo *util.PaginationInfo) ([]api.CertInfo, error)
 	GetCertificateInfo(caID string, crtID string, authz authtypes.AuthorizationInfo) (*api.CertInfo, error)
 	DeleteCertificatesAllCA(crtID string, authz authtypes.AuthorizationInfo) error
+	GetCertificateVersions(caID, crtID string, authz authtypes.AuthorizationInfo) ([]api.CertVersionInfo, error)
+	GetCertificateVersionResource(caID, crtID string, version uint, obj string, authz authtypes.AuthorizationInfo) (string, string, error)
+	RollbackCertificate(caID, crtID string, version uint, authz authtypes.AuthorizationInfo) error
+	GetRenewalJobs(filter *renew.JobFilter, authz authtypes.AuthorizationInfo, pginfo *util.PaginationInfo) ([]api.RenewalJobInfo, error)
+	GetCertRenewalJobs(caID, crtID string, authz authtypes.AuthorizationInfo, pginfo *util.PaginationInfo) ([]api.RenewalJobInfo, error)
+	GetExpiryReport(within time.Duration, caID, rootZone string, authz authtypes.AuthorizationInfo) (*api.ExpiryReport, error)
+	RunRenewals(req *api.RenewalRunRequest, authz authtypes.AuthorizationInfo) (*api.RenewalRunReport, error)
+	StartRenewalRun(req *api.RenewalRunRequest, authz authtypes.AuthorizationInfo) (*api.JobInfo, error)
+	RecordAudit(authz authtypes.AuthorizationInfo, sourceIP string, action audit.Action, caID, crtID string, opErr error)
+	GetAuditEntries(filter *audit.Filter, authz authtypes.AuthorizationInfo, pginfo *util.PaginationInfo) ([]api.AuditEntry, error)
+	CreateToken(tinfo *api.TokenCreateInfo, authz authtypes.AuthorizationInfo) (*api.TokenCreateResult, error)
+	GetTokens(all bool, authz authtypes.AuthorizationInfo) ([]api.TokenInfo, error)
+	RevokeToken(id string, authz authtypes.AuthorizationInfo) (*api.TokenInfo, error)
 }
@@ -2,11 +2,20 @@ package apiv1
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	api "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/audit"
 	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/renew"
 	"github.com/dns3l/dns3l-core/service/auth"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
 	"github.com/dns3l/dns3l-core/util"
 	"github.com/gorilla/mux"
 )
@@ -19,11 +28,15 @@ type RestV1Handler struct {
 
 	//Must be inited externally PRIOR to Rest API execution
 	Auth auth.RESTAPIAuthProvider
+
+	//Reverse proxies whose X-Forwarded-For header is used as source IP in the audit log
+	TrustedProxies []*net.IPNet
 }
 
 func (hdlr *RestV1Handler) RegisterHandle(r *mux.Router) {
 
 	r.NotFoundHandler = http.HandlerFunc(hdlr.NotFound)
+	r.Use(hdlr.resolveClientIP)
 	r.HandleFunc("/info", hdlr.GetServerInfo)
 	r.HandleFunc("/dns", hdlr.GetDNSInfo)
 	r.HandleFunc("/dns/rtzn", hdlr.GetDNSRootzones)
@@ -31,9 +44,23 @@ func (hdlr *RestV1Handler) RegisterHandle(r *mux.Router) {
 	r.HandleFunc("/ca/{id:[A-Za-z0-9_-]+}", hdlr.GetCA)
 	r.HandleFunc("/ca/{id:[A-Za-z0-9_-]+}/crt", hdlr.HandleCAAnonCert)
 	r.HandleFunc("/ca/{caID:[A-Za-z0-9_-]+}/crt/{crtID:\\*?[A-Za-z0-9\\._-]+}", hdlr.HandleCANamedCert)
+	r.HandleFunc("/ca/{caID:[A-Za-z0-9_-]+}/crt/{crtID:\\*?[A-Za-z0-9\\._-]+}/renew", hdlr.HandleCertRenew)
 	r.HandleFunc("/ca/{caID:[A-Za-z0-9_-]+}/crt/{crtID:\\*?[A-Za-z0-9\\._-]+}/pem", hdlr.HandleCertObjs)
 	r.HandleFunc("/ca/{caID:[A-Za-z0-9_-]+}/crt/{crtID:\\*?[A-Za-z0-9\\._-]+}/pem/{obj:[a-z_-]+}",
 		hdlr.HandleNamedCertObj)
+	r.HandleFunc("/ca/{caID:[A-Za-z0-9_-]+}/crt/{crtID:\\*?[A-Za-z0-9\\._-]+}/versions", hdlr.HandleCertVersions)
+	r.HandleFunc("/ca/{caID:[A-Za-z0-9_-]+}/crt/{crtID:\\*?[A-Za-z0-9\\._-]+}/versions/{version:[0-9]+}/pem/{obj:[a-z_-]+}",
+		hdlr.HandleCertVersionObj)
+	r.HandleFunc("/ca/{caID:[A-Za-z0-9_-]+}/crt/{crtID:\\*?[A-Za-z0-9\\._-]+}/versions/{version:[0-9]+}/rollback",
+		hdlr.HandleCertVersionRollback)
+	r.HandleFunc("/jobs/{jobID:[a-f0-9]+}", hdlr.HandleJob)
+	r.HandleFunc("/ca/{caID:[A-Za-z0-9_-]+}/crt/{crtID:\\*?[A-Za-z0-9\\._-]+}/renewals", hdlr.HandleCertRenewals)
+	r.HandleFunc("/renewals", hdlr.HandleRenewals)
+	r.HandleFunc("/admin/renewals/run", hdlr.HandleRenewalRun)
+	r.HandleFunc("/reports/expiring", hdlr.HandleExpiryReport)
+	r.HandleFunc("/audit", hdlr.HandleAudit)
+	r.HandleFunc("/tokens", hdlr.HandleTokens)
+	r.HandleFunc("/tokens/{tokenID:[a-f0-9]+}", hdlr.HandleToken)
 	r.HandleFunc("/crt", hdlr.HandleAnonCert)
 	r.HandleFunc("/crt/{crtID:\\*?[A-Za-z0-9\\._-]+}", hdlr.HandleNamedCert)
 }
@@ -106,9 +133,12 @@ func (hdlr *RestV1Handler) HandleCAAnonCert(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
-	if err != nil {
-		httpErrorFromErr(w, r, err)
+	var action audit.Action
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); r.Method == http.MethodPost && !dryRun {
+		action = audit.ActionClaim
+	}
+	authz, ok := hdlr.authenticate(w, r, action, caID, "")
+	if !ok {
 		return
 	}
 
@@ -143,7 +173,33 @@ func (hdlr *RestV1Handler) HandleCAAnonCert(w http.ResponseWriter, r *http.Reque
 			return
 		}
 
-		err = hdlr.Service.ClaimCertificate(caID, cinfo, authz)
+		if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dryRun {
+			report, err := hdlr.Service.DryRunClaimCertificate(caID, cinfo, authz)
+			if err != nil {
+				httpErrorFromErr(w, r, err)
+				return
+			}
+			w.WriteHeader(200)
+			util.LogIfError(log, json.NewEncoder(w).Encode(report))
+			success(w, r)
+			return
+		}
+
+		if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+			job, err := hdlr.Service.ClaimCertificateAsync(r.Context(), caID, cinfo, authz)
+			hdlr.audit(r, authz, audit.ActionClaim, caID, cinfo.Name, err)
+			if err != nil {
+				httpErrorFromErr(w, r, err)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			util.LogIfError(log, json.NewEncoder(w).Encode(job))
+			success(w, r)
+			return
+		}
+
+		err = hdlr.Service.ClaimCertificate(r.Context(), caID, cinfo, authz)
+		hdlr.audit(r, authz, audit.ActionClaim, caID, cinfo.Name, err)
 		if err != nil {
 			httpErrorFromErr(w, r, err)
 			return
@@ -172,9 +228,12 @@ func (hdlr *RestV1Handler) HandleCANamedCert(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
-	if err != nil {
-		httpErrorFromErr(w, r, err)
+	action := map[string]audit.Action{
+		http.MethodDelete: audit.ActionDelete,
+		http.MethodPatch:  audit.ActionModify,
+	}[r.Method]
+	authz, ok := hdlr.authenticate(w, r, action, caID, crtID)
+	if !ok {
 		return
 	}
 
@@ -183,6 +242,7 @@ func (hdlr *RestV1Handler) HandleCANamedCert(w http.ResponseWriter, r *http.Requ
 		//Delete cert
 
 		err := hdlr.Service.DeleteCertificate(caID, crtID, authz)
+		hdlr.audit(r, authz, audit.ActionDelete, caID, crtID, err)
 		if err != nil {
 			httpErrorFromErr(w, r, err)
 			return
@@ -201,6 +261,30 @@ func (hdlr *RestV1Handler) HandleCANamedCert(w http.ResponseWriter, r *http.Requ
 		util.LogIfError(log, json.NewEncoder(w).Encode(certInfo))
 		success(w, r)
 		return
+	case http.MethodPatch:
+		//Modify SANs of cert
+		minfo := &api.CertModifyInfo{}
+		err := json.NewDecoder(r.Body).Decode(&minfo)
+		if err != nil {
+			httpError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err = hdlr.Validator.ValidateAPIStruct(minfo)
+		if err != nil {
+			httpError(w, r, 400, err.Error())
+			return
+		}
+
+		err = hdlr.Service.ModifyCertificate(r.Context(), caID, crtID, minfo, authz)
+		hdlr.audit(r, authz, audit.ActionModify, caID, crtID, err)
+		if err != nil {
+			httpErrorFromErr(w, r, err)
+			return
+		}
+		w.WriteHeader(200)
+		success(w, r)
+		return
 	default:
 		httpError(w, r, 400, "Wrong method")
 		return
@@ -208,7 +292,7 @@ func (hdlr *RestV1Handler) HandleCANamedCert(w http.ResponseWriter, r *http.Requ
 
 }
 
-func (hdlr *RestV1Handler) HandleCertObjs(w http.ResponseWriter, r *http.Request) {
+func (hdlr *RestV1Handler) HandleCertRenew(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 	vars := mux.Vars(r)
 	caID, idSet := vars["caID"]
@@ -222,16 +306,64 @@ func (hdlr *RestV1Handler) HandleCertObjs(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
+	if r.Method != http.MethodPost {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	authz, ok := hdlr.authenticate(w, r, audit.ActionRenew, caID, crtID)
+	if !ok {
+		return
+	}
+
+	//an empty body is a renewal without force
+	rinfo := &api.CertRenewInfo{}
+	err := json.NewDecoder(r.Body).Decode(&rinfo)
+	if err != nil && !errors.Is(err, io.EOF) {
+		httpError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := hdlr.Service.RenewCertificate(caID, crtID, rinfo, authz)
+	hdlr.audit(r, authz, audit.ActionRenew, caID, crtID, err)
 	if err != nil {
 		httpErrorFromErr(w, r, err)
 		return
 	}
+	w.WriteHeader(200)
+	util.LogIfError(log, json.NewEncoder(w).Encode(res))
+	success(w, r)
+
+}
+
+func (hdlr *RestV1Handler) HandleCertObjs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	caID, idSet := vars["caID"]
+	if !idSet {
+		httpError(w, r, 400, "'caID' not set")
+		return
+	}
+	crtID, idSet := vars["crtID"]
+	if !idSet {
+		httpError(w, r, 400, "'crtID' not set")
+		return
+	}
+
+	var action audit.Action
+	if r.Method == http.MethodGet {
+		action = audit.ActionReadKey
+	}
+	authz, ok := hdlr.authenticate(w, r, action, caID, crtID)
+	if !ok {
+		return
+	}
 
 	if r.Method == http.MethodGet {
 		//Get all cert PEM infos
 
 		obj, err := hdlr.Service.GetAllCertResources(caID, crtID, authz)
+		hdlr.audit(r, authz, audit.ActionReadKey, caID, crtID, err)
 		if err != nil {
 			httpErrorFromErr(w, r, err)
 			return
@@ -274,30 +406,154 @@ func (hdlr *RestV1Handler) HandleNamedCertObj(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if r.Method != http.MethodGet {
+		w.Header().Add("Content-Type", "application/json")
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	action := audit.ActionReadPEM
+	if obj == "key" {
+		action = audit.ActionReadKey
+	}
+	authz, ok := hdlr.authenticate(w, r, action, caID, crtID)
+	if !ok {
+		return
+	}
+
+	res, ctype, err := hdlr.Service.GetCertificateResource(caID, crtID, obj, authz)
+	hdlr.audit(r, authz, action, caID, crtID, err)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		httpErrorFromErr(w, r, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", ctype)
+	w.WriteHeader(200)
+	_, err = w.Write([]byte(res))
+	util.LogIfError(log, err)
+	success(w, r)
+
+}
+
+func (hdlr *RestV1Handler) HandleCertVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	caID, idSet := vars["caID"]
+	if !idSet {
+		httpError(w, r, 400, "'caID' not set")
+		return
+	}
+	crtID, idSet := vars["crtID"]
+	if !idSet {
+		httpError(w, r, 400, "'crtID' not set")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
 	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
 	if err != nil {
 		httpErrorFromErr(w, r, err)
 		return
 	}
 
-	if r.Method == http.MethodGet {
+	versions, err := hdlr.Service.GetCertificateVersions(caID, crtID, authz)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+	w.WriteHeader(200)
+	util.LogIfError(log, json.NewEncoder(w).Encode(versions))
+	success(w, r)
 
-		res, ctype, err := hdlr.Service.GetCertificateResource(caID, crtID, obj, authz)
-		if err != nil {
-			w.Header().Add("Content-Type", "application/json")
-			httpErrorFromErr(w, r, err)
-			return
-		}
+}
 
-		w.Header().Add("Content-Type", ctype)
-		w.WriteHeader(200)
-		_, err = w.Write([]byte(res))
-		util.LogIfError(log, err)
-		success(w, r)
+func getVersionVar(vars map[string]string) (uint, error) {
+	version, err := strconv.ParseUint(vars["version"], 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid version: " + err.Error())
+	}
+	return uint(version), nil
+}
+
+func (hdlr *RestV1Handler) HandleCertVersionObj(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	caID := vars["caID"]
+	crtID := vars["crtID"]
+	obj := vars["obj"]
+	version, err := getVersionVar(vars)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		httpError(w, r, 400, err.Error())
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Add("Content-Type", "application/json")
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	action := audit.ActionReadPEM
+	if obj == "key" {
+		action = audit.ActionReadKey
+	}
+	authz, ok := hdlr.authenticate(w, r, action, caID, crtID)
+	if !ok {
+		return
+	}
+
+	res, ctype, err := hdlr.Service.GetCertificateVersionResource(caID, crtID, version, obj, authz)
+	hdlr.audit(r, authz, action, caID, crtID, err)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		httpErrorFromErr(w, r, err)
 		return
 	}
+
+	w.Header().Add("Content-Type", ctype)
+	w.WriteHeader(200)
+	_, err = w.Write([]byte(res))
+	util.LogIfError(log, err)
+	success(w, r)
+
+}
+
+func (hdlr *RestV1Handler) HandleCertVersionRollback(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
-	httpError(w, r, 400, "Wrong method")
+	vars := mux.Vars(r)
+	caID := vars["caID"]
+	crtID := vars["crtID"]
+	version, err := getVersionVar(vars)
+	if err != nil {
+		httpError(w, r, 400, err.Error())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	authz, ok := hdlr.authenticate(w, r, audit.ActionRollback, caID, crtID)
+	if !ok {
+		return
+	}
+
+	err = hdlr.Service.RollbackCertificate(caID, crtID, version, authz)
+	hdlr.audit(r, authz, audit.ActionRollback, caID, crtID, err)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+	w.WriteHeader(200)
+	success(w, r)
 
 }
 
@@ -340,9 +596,12 @@ func (hdlr *RestV1Handler) HandleNamedCert(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
-	if err != nil {
-		httpErrorFromErr(w, r, err)
+	var action audit.Action
+	if r.Method == http.MethodDelete {
+		action = audit.ActionDelete
+	}
+	authz, ok := hdlr.authenticate(w, r, action, "", crtID)
+	if !ok {
 		return
 	}
 
@@ -365,6 +624,7 @@ func (hdlr *RestV1Handler) HandleNamedCert(w http.ResponseWriter, r *http.Reques
 	case http.MethodDelete:
 		//Delete info of specific cert
 		err := hdlr.Service.DeleteCertificatesAllCA(crtID, authz)
+		hdlr.audit(r, authz, audit.ActionDelete, "", crtID, err)
 		if err != nil {
 			httpErrorFromErr(w, r, err)
 			return
@@ -394,6 +654,9 @@ func httpErrorFromErr(w http.ResponseWriter, r *http.Request, e error) {
 		httpError(w, r, http.StatusConflict, e.Error())
 	case *common.Warning:
 		httpError(w, r, http.StatusOK, e.Error())
+	case *common.QueueFullError:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.(*common.QueueFullError).RetryAfter.Seconds()))))
+		httpError(w, r, http.StatusTooManyRequests, e.Error())
 	default:
 		httpError(w, r, 500, e.Error())
 	}
@@ -416,3 +679,355 @@ func success(w http.ResponseWriter, r *http.Request) {
 	log.WithField("path", r.URL.Path).
 		WithField("rAddr", r.RemoteAddr).Debug("HTTP request succeeded.")
 }
+
+func (hdlr *RestV1Handler) HandleJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	jobID, idSet := vars["jobID"]
+	if !idSet {
+		httpError(w, r, 400, "'jobID' not set")
+		return
+	}
+
+	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	job, err := hdlr.Service.GetJob(jobID, authz)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+	w.WriteHeader(200)
+	util.LogIfError(log, json.NewEncoder(w).Encode(job))
+	success(w, r)
+}
+
+// Authenticates the request and sends the error if that fails. Failed authentications are
+// recorded in the audit log with the given action, which is empty for operations which are
+// not audited.
+func (hdlr *RestV1Handler) authenticate(w http.ResponseWriter, r *http.Request, action audit.Action,
+	caID, crtID string) (authtypes.AuthorizationInfo, bool) {
+
+	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
+	if err == nil {
+		return authz, true
+	}
+
+	if action != "" {
+		auditErr := err
+		var notAuthned *common.NotAuthnedError
+		if !errors.As(err, &notAuthned) {
+			//e.g. an invalid bearer token
+			auditErr = &common.NotAuthnedError{Msg: err.Error()}
+		}
+		hdlr.audit(r, nil, action, caID, crtID, auditErr)
+	}
+	httpErrorFromErr(w, r, err)
+	return nil, false
+
+}
+
+// Records the operation in the audit log, err is the result of the operation
+func (hdlr *RestV1Handler) audit(r *http.Request, authz authtypes.AuthorizationInfo, action audit.Action,
+	caID, crtID string, err error) {
+	hdlr.Service.RecordAudit(authz, util.ClientIP(r, hdlr.TrustedProxies), action, caID, crtID, err)
+}
+
+// Attaches the client IP to the request, so that the auth providers see the client instead
+// of a trusted proxy
+func (hdlr *RestV1Handler) resolveClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, util.WithClientIP(r, hdlr.TrustedProxies))
+	})
+}
+
+func (hdlr *RestV1Handler) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := &audit.Filter{
+		User:     q.Get("user"),
+		Action:   audit.Action(q.Get("action")),
+		CAID:     q.Get("ca"),
+		CertName: q.Get("crt"),
+		Result:   audit.Result(q.Get("result")),
+	}
+	for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := q.Get(param); v != "" {
+			*t, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				httpError(w, r, http.StatusBadRequest, "'"+param+"' must be an RFC 3339 timestamp")
+				return
+			}
+		}
+	}
+
+	pginfo := util.PaginationInfoFromRequest(r)
+	entries, err := hdlr.Service.GetAuditEntries(filter, authz, pginfo)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+	if pginfo != nil {
+		pginfo.SetHTTPHeaders(w)
+	}
+	w.WriteHeader(200)
+	util.LogIfError(log, json.NewEncoder(w).Encode(entries))
+	success(w, r)
+}
+
+func (hdlr *RestV1Handler) HandleRenewals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := &renew.JobFilter{
+		CAID:    q.Get("ca"),
+		CertKey: q.Get("crt"),
+		Status:  renew.JobStatus(q.Get("status")),
+	}
+	if v := q.Get("since"); v != "" {
+		filter.Since, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, r, http.StatusBadRequest, "'since' must be an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	pginfo := util.PaginationInfoFromRequest(r)
+	jobs, err := hdlr.Service.GetRenewalJobs(filter, authz, pginfo)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+	if pginfo != nil {
+		pginfo.SetHTTPHeaders(w)
+	}
+	w.WriteHeader(200)
+	util.LogIfError(log, json.NewEncoder(w).Encode(jobs))
+	success(w, r)
+}
+
+func (hdlr *RestV1Handler) HandleRenewalRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	authz, ok := hdlr.authenticate(w, r, audit.ActionRenewRun, "", "")
+	if !ok {
+		return
+	}
+
+	//an empty body runs all due renewals
+	req := &api.RenewalRunRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		httpError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.DryRun {
+		report, err := hdlr.Service.RunRenewals(req, authz)
+		if err != nil {
+			httpErrorFromErr(w, r, err)
+			return
+		}
+		w.WriteHeader(200)
+		util.LogIfError(log, json.NewEncoder(w).Encode(report))
+		success(w, r)
+		return
+	}
+
+	//the run takes a while, its report is polled via the job like for asynchronous claims
+	job, err := hdlr.Service.StartRenewalRun(req, authz)
+	hdlr.audit(r, authz, audit.ActionRenewRun, req.CAID, "", err)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	util.LogIfError(log, json.NewEncoder(w).Encode(job))
+	success(w, r)
+}
+
+func (hdlr *RestV1Handler) HandleExpiryReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	q := r.URL.Query()
+	within := 30 * 24 * time.Hour
+	if v := q.Get("within"); v != "" {
+		within, err = util.ParseDurationDays(v)
+		if err != nil || within < 0 {
+			httpError(w, r, http.StatusBadRequest, "'within' must be a duration like 30d or 36h")
+			return
+		}
+	}
+
+	report, err := hdlr.Service.GetExpiryReport(within, q.Get("ca"), q.Get("rtzn"), authz)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+	w.WriteHeader(200)
+	util.LogIfError(log, json.NewEncoder(w).Encode(report))
+	success(w, r)
+}
+
+func (hdlr *RestV1Handler) HandleCertRenewals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	caID := vars["caID"]
+	crtID := vars["crtID"]
+
+	authz, err := hdlr.Auth.AuthnGetAuthzInfo(r)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	pginfo := util.PaginationInfoFromRequest(r)
+	jobs, err := hdlr.Service.GetCertRenewalJobs(caID, crtID, authz, pginfo)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+	if pginfo != nil {
+		pginfo.SetHTTPHeaders(w)
+	}
+	w.WriteHeader(200)
+	util.LogIfError(log, json.NewEncoder(w).Encode(jobs))
+	success(w, r)
+}
+
+func (hdlr *RestV1Handler) HandleTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	var action audit.Action
+	if r.Method == http.MethodPost {
+		action = audit.ActionTokenCreate
+	}
+	authz, ok := hdlr.authenticate(w, r, action, "", "")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+		tokens, err := hdlr.Service.GetTokens(all, authz)
+		if err != nil {
+			httpErrorFromErr(w, r, err)
+			return
+		}
+		w.WriteHeader(200)
+		util.LogIfError(log, json.NewEncoder(w).Encode(tokens))
+		success(w, r)
+		return
+	case http.MethodPost:
+		tinfo := &api.TokenCreateInfo{}
+		err := json.NewDecoder(r.Body).Decode(&tinfo)
+		if err != nil {
+			httpError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err = hdlr.Validator.ValidateAPIStruct(tinfo)
+		if err != nil {
+			httpError(w, r, 400, err.Error())
+			return
+		}
+
+		res, err := hdlr.Service.CreateToken(tinfo, authz)
+		hdlr.audit(r, authz, audit.ActionTokenCreate, "", tinfo.Name, err)
+		if err != nil {
+			httpErrorFromErr(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		util.LogIfError(log, json.NewEncoder(w).Encode(res))
+		success(w, r)
+		return
+	default:
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+}
+
+func (hdlr *RestV1Handler) HandleToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	tokenID := mux.Vars(r)["tokenID"]
+
+	if r.Method != http.MethodDelete {
+		httpError(w, r, 400, "Wrong method")
+		return
+	}
+
+	authz, ok := hdlr.authenticate(w, r, audit.ActionTokenRevoke, "", tokenID)
+	if !ok {
+		return
+	}
+
+	tinfo, err := hdlr.Service.RevokeToken(tokenID, authz)
+	name := tokenID
+	if tinfo != nil {
+		name = tinfo.Name
+	}
+	hdlr.audit(r, authz, audit.ActionTokenRevoke, "", name, err)
+	if err != nil {
+		httpErrorFromErr(w, r, err)
+		return
+	}
+	w.WriteHeader(200)
+	util.LogIfError(log, json.NewEncoder(w).Encode(tinfo))
+	success(w, r)
+
+}
@@ -0,0 +1,56 @@
+package apiv1
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dns3l/dns3l-core/service/auth/token"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+)
+
+func TestTokenSourceCIDRsBehindTrustedProxy(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdlr := &RestV1Handler{TrustedProxies: []*net.IPNet{proxies}}
+
+	plain, err := token.GenerateRandomToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov := &token.TokenAuthProvider{Config: token.TokenAuthConfig{Static: []token.Token{{
+		Name:           "ingress",
+		Plain:          plain,
+		DomainsAllowed: []string{"example.com"},
+		Restrictions:   token.Restrictions{SourceCIDRs: []string{"198.51.100.0/24"}},
+	}}}}
+
+	for _, tc := range []struct {
+		remoteAddr string
+		forwarded  string
+		accepted   bool
+	}{
+		{"10.0.0.1:1234", "198.51.100.7", true},
+		{"10.0.0.1:1234", "203.0.113.9", false},
+		{"10.0.0.1:1234", "", false}, //the proxy itself is not allowed
+		{"192.0.2.1:1234", "198.51.100.7", false},
+	} {
+		var authz authtypes.AuthorizationInfo
+		h := hdlr.resolveClientIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authz, err = prov.AuthnGetAuthzInfo(r)
+		}))
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		r.Header.Set(token.TokenHeaderKey, plain)
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if accepted := err == nil && authz != nil; accepted != tc.accepted {
+			t.Errorf("%s via %s: expected accepted=%v, got %v, %v", tc.forwarded, tc.remoteAddr, tc.accepted, authz, err)
+		}
+	}
+}
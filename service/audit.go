@@ -0,0 +1,51 @@
+package service
+
+import (
+	"time"
+
+	"github.com/creasty/defaults"
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/audit"
+)
+
+func (s *Service) startAuditor() error {
+
+	conf := s.Config.Audit
+	if conf == nil {
+		//the audit log cannot be switched off, only its retention can be configured
+		conf = &audit.Config{}
+		err := defaults.Set(conf)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.auditor = &audit.Auditor{
+		Config:        conf,
+		State:         &audit.AuditStateManagerSQL{Prov: s.Config.DB},
+		ShouldRunFunc: s.isLeader,
+	}
+	err := s.auditor.Init()
+	if err != nil {
+		return err
+	}
+	s.auditor.Start()
+	log.WithField("retention", conf.Retention).Info("Started audit log.")
+	return nil
+
+}
+
+func apiAuditEntryFromEntry(entry *audit.Entry) apiv1.AuditEntry {
+	return apiv1.AuditEntry{
+		ID:        entry.ID,
+		Time:      entry.Time.Format(time.RFC3339),
+		User:      entry.UserName,
+		UserEmail: entry.UserEmail,
+		Action:    string(entry.Action),
+		CAID:      entry.CAID,
+		Name:      entry.CertName,
+		SourceIP:  entry.SourceIP,
+		Result:    string(entry.Result),
+		Error:     entry.Error,
+	}
+}
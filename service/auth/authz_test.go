@@ -33,6 +33,11 @@ func TestAuthRW(t *testing.T) {
 	assert.Error(t, authzinfo1.ChkAuthReadDomainPublic("foo.baz.test.doe.de."))
 	assert.Error(t, authzinfo1.ChkAuthReadDomainsPublic([]string{"foo.baz.test.doe.com.", "baz.test.doe.de.", "baz.test.doe.email."}))
 	assert.False(t, authzinfo1.CanListPublicData())
+	assert.Error(t, authzinfo1.ChkAuthAdmin())
+
+	authzinfo1.AdminAllowed = true
+	assert.NoError(t, authzinfo1.ChkAuthAdmin())
+	assert.Error(t, authzinfo1.ChkAuthWriteDomain("foo.com.")) //admin does not extend the domain ACLs
 
 }
 
@@ -135,6 +140,7 @@ func TestAuthDisabled(t *testing.T) {
 	assert.NoError(t, authzinfo1.ChkAuthReadDomains([]string{"foo.baz.test.doe.com.", "baz.test.doe.email."}))
 	assert.NoError(t, authzinfo1.ChkAuthReadDomainsPublic([]string{"foo.baz.test.doe.com.", "baz.test.doe.email."}))
 	assert.NoError(t, authzinfo1.ChkAuthWriteDomains([]string{"foo.baz.test.doe.com.", "blargh.com", "baz.test.doe.email."}))
+	assert.NoError(t, authzinfo1.ChkAuthAdmin())
 
 	assert.True(t, authzinfo1.CanListPublicData())
 
@@ -0,0 +1,5 @@
+package mtls
+
+import "github.com/sirupsen/logrus"
+
+var log = logrus.WithField("module", "auth-mtls")
@@ -0,0 +1,119 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/dns3l/dns3l-core/common"
+)
+
+type MTLSAuthConfig struct {
+	ClientCAs      string       `yaml:"clientcas"`      //PEM file with the CA certs client certs must chain up to
+	AnyExtKeyUsage bool         `yaml:"anyextkeyusage"` //also accept client certs without the clientAuth extended key usage
+	Proxy          *ProxyConfig `yaml:"proxy"`          //accept client certs forwarded by a TLS-terminating proxy
+	Clients        []Client     `yaml:"clients"`
+}
+
+type ProxyConfig struct {
+	Header  string   `yaml:"header" default:"X-SSL-Client-Cert"`
+	Trusted []string `yaml:"trusted"` //CIDRs of the proxies, the header is ignored for other peers
+}
+
+type Client struct {
+	Name           string   `yaml:"name" validate:"required"`
+	Subject        string   `yaml:"subject"` //regular expression matched against the subject DN, e.g. "^CN=web[0-9]+\.example\.com$"
+	SANs           []string `yaml:"sans"`    //glob patterns matched against the DNS, e-mail and URI SANs, e.g. "*.web.example.com"
+	Email          string   `yaml:"email"`   //required for claiming if the cert has no e-mail SAN
+	Write          bool     `yaml:"write"`
+	Admin          bool     `yaml:"admin"`
+	DomainsAllowed []string `yaml:"domainsallowed"`
+}
+
+func (c *MTLSAuthConfig) Enabled() bool {
+	return len(c.Clients) > 0
+}
+
+// Check returns the problems of the client cert config, with their YAML path below the mtls
+// section. The client CA file is read.
+func (c *MTLSAuthConfig) Check() []*common.ConfigError {
+	_, errs := c.compile()
+	return errs
+}
+
+type compiledConfig struct {
+	roots    *x509.CertPool
+	proxies  []*net.IPNet
+	subjects []*regexp.Regexp //by client, nil if not given
+}
+
+func (c *MTLSAuthConfig) compile() (*compiledConfig, []*common.ConfigError) {
+
+	var res []*common.ConfigError
+	add := func(path, msg string) {
+		res = append(res, &common.ConfigError{Path: path, Msg: msg})
+	}
+
+	if !c.Enabled() {
+		return &compiledConfig{}, nil
+	}
+
+	cc := &compiledConfig{subjects: make([]*regexp.Regexp, len(c.Clients))}
+
+	if c.ClientCAs == "" {
+		add("clientcas", "must be given if clients are configured")
+	} else {
+		pem, err := os.ReadFile(c.ClientCAs)
+		if err != nil {
+			add("clientcas", err.Error())
+		} else {
+			cc.roots = x509.NewCertPool()
+			if !cc.roots.AppendCertsFromPEM(pem) {
+				add("clientcas", "no PEM certificate found in "+c.ClientCAs)
+			}
+		}
+	}
+
+	if c.Proxy != nil {
+		if len(c.Proxy.Trusted) == 0 {
+			add("proxy.trusted", "must be given, otherwise every client could set the header")
+		}
+		for i, cidr := range c.Proxy.Trusted {
+			_, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				add(fmt.Sprintf("proxy.trusted[%d]", i), err.Error())
+				continue
+			}
+			cc.proxies = append(cc.proxies, ipnet)
+		}
+	}
+
+	for i, client := range c.Clients {
+		p := fmt.Sprintf("clients[%d]", i)
+		if client.Name == "" {
+			add(p+".name", "must be given")
+		}
+		if client.Subject == "" && len(client.SANs) == 0 {
+			add(p, "neither subject nor sans is given")
+		}
+		if client.Subject != "" {
+			re, err := regexp.Compile(client.Subject)
+			if err != nil {
+				add(p+".subject", err.Error())
+			}
+			cc.subjects[i] = re
+		}
+		for j, pattern := range client.SANs {
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				add(fmt.Sprintf("%s.sans[%d]", p, j), err.Error())
+			}
+		}
+	}
+
+	return cc, res
+
+}
@@ -0,0 +1,234 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/creasty/defaults"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
+)
+
+// Authenticates clients by a certificate verified against the configured client CAs. The
+// certificate is taken from the TLS connection if dns3ld terminates TLS itself, otherwise from
+// a header set by a trusted proxy.
+type MTLSAuthProvider struct {
+	Config MTLSAuthConfig
+
+	compiled *compiledConfig
+}
+
+func (c *MTLSAuthProvider) Init() error {
+	if c.Config.Proxy != nil {
+		err := defaults.Set(c.Config.Proxy)
+		if err != nil {
+			return err
+		}
+	}
+	compiled, errs := c.Config.compile()
+	if len(errs) > 0 {
+		return &common.ConfigError{Path: "auth.mtls." + errs[0].Path, Msg: errs[0].Msg}
+	}
+	c.compiled = compiled
+	return nil
+}
+
+func (c *MTLSAuthProvider) AuthnGetAuthzInfo(r *http.Request) (types.AuthorizationInfo, error) {
+
+	if c.compiled == nil || !c.Config.Enabled() {
+		return nil, nil
+	}
+
+	chain, err := c.clientCertChain(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		// this is not client cert auth
+		return nil, nil
+	}
+	leaf := chain[0]
+
+	opts := x509.VerifyOptions{
+		Roots:         c.compiled.roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if c.Config.AnyExtKeyUsage {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	for _, cert := range chain[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate '%s' could not be verified: %w", leaf.Subject, err)
+	}
+
+	for i, client := range c.Config.Clients {
+		if !c.matches(i, leaf) {
+			continue
+		}
+
+		domainsAllowed := make([]string, len(client.DomainsAllowed))
+		for i := range client.DomainsAllowed {
+			domainsAllowed[i] = util.GetDomainFQDNDot(client.DomainsAllowed[i])
+		}
+
+		email := client.Email
+		if email == "" && len(leaf.EmailAddresses) > 0 {
+			email = leaf.EmailAddresses[0]
+		}
+
+		authzinfo := &types.DefaultAuthorizationInfo{
+			UserInfo: &types.UserInfo{
+				Name:  certIdentity(leaf),
+				Email: email,
+			},
+			WriteAllowed:   client.Write,
+			ReadAllowed:    true,
+			AdminAllowed:   client.Admin,
+			DomainsAllowed: domainsAllowed,
+			Delegation:     &types.Delegation{NotBefore: leaf.NotBefore, Expiry: leaf.NotAfter},
+		}
+		log.WithFields(logrus.Fields{"client": client.Name, "authzinfo": authzinfo.String()}).Debug(
+			"Client certificate request authorization determined")
+		return authzinfo, nil
+	}
+
+	log.WithField("subject", leaf.Subject.String()).Debug("Client certificate did not match a client.")
+
+	return nil, nil
+
+}
+
+// Returns the client cert with the intermediates sent along, nil if there is none
+func (c *MTLSAuthProvider) clientCertChain(r *http.Request) ([]*x509.Certificate, error) {
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates, nil
+	}
+
+	if c.Config.Proxy == nil {
+		return nil, nil
+	}
+	value := strings.TrimSpace(r.Header.Get(c.Config.Proxy.Header))
+	if value == "" {
+		return nil, nil
+	}
+	if !c.fromTrustedProxy(r) {
+		log.WithField("remoteAddr", r.RemoteAddr).Warn("Client certificate header sent by an untrusted peer, ignoring.")
+		return nil, nil
+	}
+	return parseForwardedCerts(value)
+
+}
+
+func (c *MTLSAuthProvider) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range c.compiled.proxies {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses URL-escaped PEM as sent by nginx ($ssl_client_escaped_cert), or comma-separated
+// base64 DER as sent by Traefik
+func parseForwardedCerts(value string) ([]*x509.Certificate, error) {
+
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate header: %w", err)
+	}
+
+	var ders [][]byte
+	if strings.Contains(unescaped, "-----BEGIN") {
+		rest := []byte(unescaped)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type == "CERTIFICATE" {
+				ders = append(ders, block.Bytes)
+			}
+		}
+	} else {
+		for _, part := range strings.Split(unescaped, ",") {
+			der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("invalid client certificate header: %w", err)
+			}
+			ders = append(ders, der)
+		}
+	}
+	if len(ders) == 0 {
+		return nil, errors.New("invalid client certificate header: no certificate found")
+	}
+
+	res := make([]*x509.Certificate, len(ders))
+	for i, der := range ders {
+		res[i], err = x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate header: %w", err)
+		}
+	}
+	return res, nil
+
+}
+
+func (c *MTLSAuthProvider) matches(i int, leaf *x509.Certificate) bool {
+
+	if re := c.compiled.subjects[i]; re != nil && re.MatchString(leaf.Subject.String()) {
+		return true
+	}
+
+	sans := make([]string, 0, len(leaf.DNSNames)+len(leaf.EmailAddresses)+len(leaf.URIs))
+	for _, name := range leaf.DNSNames {
+		sans = append(sans, strings.ToLower(name))
+	}
+	sans = append(sans, leaf.EmailAddresses...)
+	for _, uri := range leaf.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, pattern := range c.Config.Clients[i].SANs {
+		for _, san := range sans {
+			if ok, _ := path.Match(pattern, san); ok {
+				return true
+			}
+		}
+	}
+	return false
+
+}
+
+// The name the client is logged and audited with
+func certIdentity(leaf *x509.Certificate) string {
+	if leaf.Subject.CommonName != "" {
+		return leaf.Subject.CommonName
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0]
+	}
+	return leaf.Subject.String()
+}
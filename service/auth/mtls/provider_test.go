@@ -0,0 +1,181 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, dnsNames []string, usage x509.ExtKeyUsage) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Example"}},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert
+}
+
+func TestMTLSAuthProvider(t *testing.T) {
+
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "client-ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600)
+	assert.NoError(t, err)
+
+	prov := MTLSAuthProvider{
+		Config: MTLSAuthConfig{
+			ClientCAs: caFile,
+			Proxy:     &ProxyConfig{Trusted: []string{"10.0.0.0/8"}},
+			Clients: []Client{
+				{
+					Name:           "webservers",
+					SANs:           []string{"*.web.example.com"},
+					Email:          "web-team@example.com",
+					Write:          true,
+					DomainsAllowed: []string{"web.example.com"},
+				},
+				{
+					Name:           "monitoring",
+					Subject:        `^CN=monitor[0-9]+,O=Example$`,
+					DomainsAllowed: []string{"example.com"},
+				},
+			},
+		},
+	}
+	assert.NoError(t, prov.Init())
+
+	web := ca.issue(t, "web1", []string{"web1.web.example.com"}, x509.ExtKeyUsageClientAuth)
+	monitor := ca.issue(t, "monitor7", nil, x509.ExtKeyUsageClientAuth)
+	unknown := ca.issue(t, "db1", []string{"db1.example.com"}, x509.ExtKeyUsageClientAuth)
+	serverOnly := ca.issue(t, "web2", []string{"web2.web.example.com"}, x509.ExtKeyUsageServerAuth)
+	foreign := otherCA.issue(t, "web3", []string{"web3.web.example.com"}, x509.ExtKeyUsageClientAuth)
+
+	authz, err := prov.AuthnGetAuthzInfo(&http.Request{Header: make(http.Header)})
+	assert.NoError(t, err)
+	assert.Nil(t, authz)
+
+	authz, err = prov.AuthnGetAuthzInfo(makeTLSReq(web))
+	assert.NoError(t, err)
+	assert.NotNil(t, authz)
+	assert.Equal(t, "web1", authz.GetUserInfo().Name)
+	assert.Equal(t, "web-team@example.com", authz.GetUserInfo().Email)
+	assert.NoError(t, authz.ChkAuthWriteDomains([]string{"web1.web.example.com."}))
+	assert.Error(t, authz.ChkAuthWriteDomains([]string{"example.com."}))
+
+	authz, err = prov.AuthnGetAuthzInfo(makeTLSReq(monitor))
+	assert.NoError(t, err)
+	assert.NotNil(t, authz)
+	assert.NoError(t, authz.ChkAuthReadDomains([]string{"foo.example.com."}))
+	assert.Error(t, authz.ChkAuthWriteDomains([]string{"foo.example.com."}))
+
+	authz, err = prov.AuthnGetAuthzInfo(makeTLSReq(unknown))
+	assert.NoError(t, err)
+	assert.Nil(t, authz)
+
+	_, err = prov.AuthnGetAuthzInfo(makeTLSReq(serverOnly))
+	assert.Error(t, err)
+
+	_, err = prov.AuthnGetAuthzInfo(makeTLSReq(foreign))
+	assert.Error(t, err)
+
+	prov.Config.AnyExtKeyUsage = true
+	authz, err = prov.AuthnGetAuthzInfo(makeTLSReq(serverOnly))
+	assert.NoError(t, err)
+	assert.NotNil(t, authz)
+
+	authz, err = prov.AuthnGetAuthzInfo(makeProxyReq(web, "10.1.2.3:4711"))
+	assert.NoError(t, err)
+	assert.NotNil(t, authz)
+	assert.Equal(t, "web1", authz.GetUserInfo().Name)
+
+	authz, err = prov.AuthnGetAuthzInfo(makeProxyReq(web, "192.0.2.1:4711"))
+	assert.NoError(t, err)
+	assert.Nil(t, authz)
+
+}
+
+func TestMTLSAuthConfigCheck(t *testing.T) {
+
+	conf := MTLSAuthConfig{
+		ClientCAs: "/nonexistent/client-ca.pem",
+		Proxy:     &ProxyConfig{Trusted: []string{"10.0.0.0/33"}},
+		Clients: []Client{
+			{Name: "noPattern"},
+			{Name: "badPatterns", Subject: "(", SANs: []string{"["}},
+		},
+	}
+
+	paths := make([]string, 0)
+	for _, e := range conf.Check() {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"clientcas", "proxy.trusted[0]", "clients[0]", "clients[1].subject",
+		"clients[1].sans[0]"}, paths)
+
+	assert.Empty(t, (&MTLSAuthConfig{}).Check())
+
+}
+
+func makeTLSReq(cert *x509.Certificate) *http.Request {
+	return &http.Request{
+		Header: make(http.Header),
+		TLS:    &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+	}
+}
+
+func makeProxyReq(cert *x509.Certificate, remoteAddr string) *http.Request {
+	req := &http.Request{
+		Header:     make(http.Header),
+		RemoteAddr: remoteAddr,
+	}
+	req.Header.Set("X-SSL-Client-Cert", url.PathEscape(string(pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))))
+	return req
+}
@@ -119,6 +119,26 @@ func (h *OIDCHandler) Init() error {
 
 }
 
+// CheckReadiness discovers the OIDC issuers which have not been discovered yet, e.g. because
+// they were down on startup, and returns the discovery errors by issuer URL.
+func (h *OIDCHandler) CheckReadiness() map[string]error {
+
+	res := make(map[string]error, len(h.OIDCBindings))
+	if h.AuthnDisabled {
+		return res
+	}
+
+	for issuer, binding := range h.OIDCBindings {
+		var err error
+		if binding.provider == nil {
+			err = createNewOIDCBinding(binding, issuer, false)
+		}
+		res[issuer] = err
+	}
+	return res
+
+}
+
 func (h *OIDCHandler) GetServerInfoAuth() ServerInfoAuth {
 
 	delim := h.GroupsDomainDelimiter
@@ -286,6 +306,10 @@ func (h *OIDCHandler) authnGetAuthzInfoRaw(r *http.Request) (types.Authorization
 			authzinfo.ReadAllowed = true
 			continue
 		}
+		if strings.EqualFold(domain, "admin") {
+			authzinfo.AdminAllowed = true
+			continue
+		}
 
 		if domain == "" || domain == "." {
 			log.Warn("Permitting the root domain '.' to users is not allowed, dropping domain prefix for authz.")
@@ -124,3 +124,20 @@ func assertErrorContains(err error, containedStr string) {
 		panic(fmt.Errorf("Error does not contain %s: %w", containedStr, err))
 	}
 }
+
+func TestCheckReadinessRetriesDiscovery(t *testing.T) {
+
+	hut := OIDCHandler{
+		OIDCBindings: map[string]*OIDCBinding{
+			"http://127.0.0.1:1/dex": {ClientID: "dns3l"},
+		},
+	}
+
+	res := hut.CheckReadiness()
+	assert.Equal(t, len(res), 1)
+	assert.NotEqual(t, res["http://127.0.0.1:1/dex"], nil)
+
+	hut.AuthnDisabled = true
+	assert.Equal(t, len(hut.CheckReadiness()), 0)
+
+}
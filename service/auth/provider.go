@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/dns3l/dns3l-core/common"
+
+	"github.com/dns3l/dns3l-core/service/auth/mtls"
 	"github.com/dns3l/dns3l-core/service/auth/token"
 	"github.com/dns3l/dns3l-core/service/auth/types"
 )
@@ -13,9 +17,16 @@ type RESTAPIAuthProvider interface {
 	GetServerInfoAuth() ServerInfoAuth
 }
 
+// Optionally implemented by auth providers depending on external services
+type ReadinessChecker interface {
+	//Returns the errors of the external services by their name, nil for the ready ones
+	CheckReadiness() map[string]error
+}
+
 type AuthConfig struct {
 	Provider RESTAPIAuthProvider
 	Token    token.TokenAuthProvider
+	MTLS     mtls.MTLSAuthProvider
 }
 
 func (c *AuthConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -25,6 +36,7 @@ func (c *AuthConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// maintain config backwards compatibility
 	var t struct {
 		Tokens token.TokenAuthConfig `yaml:"tokens"`
+		MTLS   mtls.MTLSAuthConfig   `yaml:"mtls"`
 	}
 	err := unmarshal(&t)
 	if err != nil {
@@ -33,6 +45,9 @@ func (c *AuthConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	c.Token = token.TokenAuthProvider{
 		Config: t.Tokens,
 	}
+	c.MTLS = mtls.MTLSAuthProvider{
+		Config: t.MTLS,
+	}
 
 	// Since interfaces cannot be unpacked, we need to instantiate the one
 	// and only OIDCHandler here. Need splitting like in dns and ca if this becomes
@@ -44,12 +59,20 @@ func (c *AuthConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 type ServerInfoAuth interface{}
 
 func (c *AuthConfig) Init() error {
+	err := c.MTLS.Init()
+	if err != nil {
+		return err
+	}
 	return c.Provider.Init()
 }
 
 func (c *AuthConfig) AuthnGetAuthzInfo(r *http.Request) (types.AuthorizationInfo, error) {
 	tkninfo, err := c.Token.AuthnGetAuthzInfo(r)
-	if err != nil {
+	var notAuthned *common.NotAuthnedError
+	if errors.As(err, &notAuthned) {
+		// a valid token used outside of its restrictions must not fall back to other auth
+		return nil, err
+	} else if err != nil {
 		// error while doing token auth, falling back to provider's auth
 		log.WithError(err).Error("Error while getting token authorization info.")
 	} else {
@@ -58,10 +81,26 @@ func (c *AuthConfig) AuthnGetAuthzInfo(r *http.Request) (types.AuthorizationInfo
 			return tkninfo, nil
 		}
 	}
-	// no token has been found or error from token auth provider
+	certinfo, err := c.MTLS.AuthnGetAuthzInfo(r)
+	if err != nil {
+		// invalid client cert, falling back to provider's auth
+		log.WithError(err).Error("Error while getting client certificate authorization info.")
+	} else if certinfo != nil {
+		return certinfo, nil
+	}
+	// no token or client cert has been found or error from token auth provider
 	return c.Provider.AuthnGetAuthzInfo(r)
 }
 
+// CheckReadiness returns the readiness of the external services the auth provider depends
+// on, see ReadinessChecker.
+func (c *AuthConfig) CheckReadiness() map[string]error {
+	if rc, ok := c.Provider.(ReadinessChecker); ok {
+		return rc.CheckReadiness()
+	}
+	return nil
+}
+
 func (c *AuthConfig) GetServerInfoAuth() ServerInfoAuth {
 	return c.Provider.GetServerInfoAuth()
 }
@@ -1,7 +1,19 @@
 package token
 
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/service/auth/types"
+)
+
 type TokenAuthConfig struct {
-	Static []Token `yaml:"static"`
+	Static      []Token       `yaml:"static"`
+	MaxValidity time.Duration `yaml:"maxvalidity" default:"8760h"` //of the tokens users create via the API
 }
 
 type Token struct {
@@ -9,5 +21,108 @@ type Token struct {
 	Plain          string   `yaml:"plain"`
 	Sha256         string   `yaml:"sha256"`
 	Write          bool     `yaml:"write"`
+	Admin          bool     `yaml:"admin"`
 	DomainsAllowed []string `yaml:"domainsallowed"`
+	Restrictions   `yaml:",inline"`
+}
+
+// Restrictions of a token on top of its domains and permissions. Empty values do not
+// restrict anything.
+type Restrictions struct {
+	Scopes      []types.Scope `yaml:"scopes"`
+	CAsAllowed  []string      `yaml:"casallowed"`
+	SourceCIDRs []string      `yaml:"sourcecidrs"` //the token is only accepted from these networks
+	NotBefore   time.Time     `yaml:"notbefore"`
+	NotAfter    time.Time     `yaml:"notafter"`
+}
+
+// Returns the problems of the restrictions with their YAML path below the token.
+func (r *Restrictions) Check() []*common.ConfigError {
+
+	var res []*common.ConfigError
+	for i, scope := range r.Scopes {
+		if !scope.Valid() {
+			res = append(res, &common.ConfigError{Path: fmt.Sprintf(".scopes[%d]", i),
+				Msg: fmt.Sprintf("unknown scope '%s', must be one of %s", scope, types.AllScopes)})
+		}
+	}
+	for i, cidr := range r.SourceCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			res = append(res, &common.ConfigError{Path: fmt.Sprintf(".sourcecidrs[%d]", i), Msg: err.Error()})
+		}
+	}
+	if !r.NotBefore.IsZero() && !r.NotAfter.IsZero() && !r.NotAfter.After(r.NotBefore) {
+		res = append(res, &common.ConfigError{Path: ".notafter", Msg: "must be after notbefore"})
+	}
+	return res
+
+}
+
+// Returns an error if the token must not be used by the client with the given IP at the given time.
+func (r *Restrictions) checkUsage(clientIP string, now time.Time) error {
+
+	if !r.NotBefore.IsZero() && now.Before(r.NotBefore) {
+		return &common.NotAuthnedError{Msg: "token is not valid yet"}
+	}
+	if !r.NotAfter.IsZero() && !now.Before(r.NotAfter) {
+		return &common.NotAuthnedError{Msg: "token is not valid anymore"}
+	}
+	if len(r.SourceCIDRs) == 0 {
+		return nil
+	}
+
+	ip := net.ParseIP(clientIP)
+	if ip != nil {
+		for _, cidr := range r.SourceCIDRs {
+			_, ipnet, err := net.ParseCIDR(cidr)
+			if err == nil && ipnet.Contains(ip) {
+				return nil
+			}
+		}
+	}
+	return &common.NotAuthnedError{Msg: fmt.Sprintf("token must not be used from '%s'", clientIP)}
+
+}
+
+// Check returns the problems of the static tokens which would make them ignored or
+// ambiguous, with their YAML path below the tokens section.
+func (c *TokenAuthConfig) Check() []*common.ConfigError {
+
+	var res []*common.ConfigError
+	add := func(i int, field, msg string) {
+		res = append(res, &common.ConfigError{Path: fmt.Sprintf("static[%d]%s", i, field), Msg: msg})
+	}
+
+	names := make(map[string]int, len(c.Static))
+	for i, tkn := range c.Static {
+		if !validName(tkn) {
+			add(i, ".name", "must be at least 3 characters long, the token is ignored")
+		}
+		if j, exists := names[tkn.Name]; exists {
+			add(i, ".name", fmt.Sprintf("'%s' is already used by static[%d]", tkn.Name, j))
+		} else {
+			names[tkn.Name] = i
+		}
+
+		switch {
+		case tkn.Plain == "" && tkn.Sha256 == "":
+			add(i, "", "neither plain nor sha256 is given")
+		case tkn.Sha256 != "":
+			hash, err := base64.StdEncoding.DecodeString(tkn.Sha256)
+			if err != nil || len(hash) != sha256.Size {
+				add(i, ".sha256", "must be the base64-encoded SHA-256 hash of the token")
+			}
+			if tkn.Plain != "" {
+				add(i, ".plain", "is ignored since sha256 is given")
+			}
+		case len(tkn.Plain) < TokenLengthBase64 || !isBase64(tkn.Plain):
+			add(i, ".plain", fmt.Sprintf("must be %d secure-random bytes in base64, the token is ignored",
+				TokenLength))
+		}
+		for _, e := range tkn.Restrictions.Check() {
+			add(i, e.Path, e.Msg)
+		}
+	}
+	return res
+
 }
@@ -0,0 +1,189 @@
+package token
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/state"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+type TokenStateManagerSQL struct {
+	Prov state.SQLDBProvider
+}
+
+type TokenStateManagerSQLSession struct {
+	prov *TokenStateManagerSQL
+	db   *sql.DB
+}
+
+func (m *TokenStateManagerSQL) NewSession() (TokenStateManagerSession, error) {
+	db, err := m.Prov.GetDBConn()
+	if err != nil {
+		return nil, err
+	}
+	return &TokenStateManagerSQLSession{db: db, prov: m}, nil
+}
+
+func (s *TokenStateManagerSQLSession) Close() error {
+	//Nothing to do
+	return nil
+}
+
+func (s *TokenStateManagerSQLSession) PutToken(tkn *DBToken) error {
+
+	domains, err := json.Marshal(tkn.DomainsAllowed)
+	if err != nil {
+		return err
+	}
+	scopes, err := json.Marshal(tkn.Scopes)
+	if err != nil {
+		return err
+	}
+	cas, err := json.Marshal(tkn.CAsAllowed)
+	if err != nil {
+		return err
+	}
+	sourceCIDRs, err := json.Marshal(tkn.SourceCIDRs)
+	if err != nil {
+		return err
+	}
+	var notBefore *time.Time
+	if !tkn.NotBefore.IsZero() {
+		nb := tkn.NotBefore.UTC()
+		notBefore = &nb
+	}
+
+	_, err = s.db.Exec(`INSERT INTO `+s.prov.Prov.DBName("tokens")+` (token_id, token_name, token_hash, `+
+		`owner_name, owner_email, domains, write_allowed, admin_allowed, scopes, cas, source_cidrs, `+
+		`created_time, expiry_time, not_before) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		tkn.ID, tkn.Name, tkn.Hash, tkn.Owner.Name, tkn.Owner.Email, string(domains), tkn.Write, tkn.Admin,
+		string(scopes), string(cas), string(sourceCIDRs), tkn.CreatedTime.UTC(), tkn.ExpiryTime.UTC(), notBefore)
+	if err != nil {
+		return fmt.Errorf("problem while storing token in database: %w", err)
+	}
+	return nil
+
+}
+
+var tokenColumns = []string{"token_id", "token_name", "token_hash", "owner_name", "owner_email", "domains",
+	"write_allowed", "admin_allowed", "scopes", "cas", "source_cidrs", "created_time", "expiry_time",
+	"not_before", "last_used_time"}
+
+func rowToToken(row interface{ Scan(dest ...any) error }, tkn *DBToken) error {
+
+	var domains, scopes, cas, sourceCIDRs string
+	var notBefore, lastUsed *time.Time
+	tkn.Owner = &types.UserInfo{}
+	err := row.Scan(&tkn.ID, &tkn.Name, &tkn.Hash, &tkn.Owner.Name, &tkn.Owner.Email, &domains,
+		&tkn.Write, &tkn.Admin, &scopes, &cas, &sourceCIDRs, &tkn.CreatedTime, &tkn.ExpiryTime,
+		&notBefore, &lastUsed)
+	if err != nil {
+		return err
+	}
+	if notBefore != nil {
+		tkn.NotBefore = *notBefore
+	}
+	tkn.NotAfter = tkn.ExpiryTime
+	if lastUsed != nil {
+		tkn.LastUsedTime = *lastUsed
+	}
+
+	for _, field := range []struct {
+		json string
+		dest any
+	}{{domains, &tkn.DomainsAllowed}, {scopes, &tkn.Scopes}, {cas, &tkn.CAsAllowed},
+		{sourceCIDRs, &tkn.SourceCIDRs}} {
+		err = json.Unmarshal([]byte(field.json), field.dest)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+
+}
+
+func (s *TokenStateManagerSQLSession) getTokenWhere(where squirrel.Eq) (*DBToken, error) {
+
+	qStr, qArgs, err := squirrel.Select(tokenColumns...).From(s.prov.Prov.DBName("tokens")).
+		Where(where).Limit(1).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	tkn := &DBToken{}
+	err = rowToToken(s.db.QueryRow(qStr, qArgs...), tkn)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tkn, nil
+
+}
+
+func (s *TokenStateManagerSQLSession) GetToken(id string) (*DBToken, error) {
+	return s.getTokenWhere(squirrel.Eq{"token_id": id})
+}
+
+func (s *TokenStateManagerSQLSession) GetTokenByHash(hash string) (*DBToken, error) {
+	return s.getTokenWhere(squirrel.Eq{"token_hash": hash})
+}
+
+func (s *TokenStateManagerSQLSession) ListTokens(owner *types.UserInfo) ([]DBToken, error) {
+
+	q := squirrel.Select(tokenColumns...).From(s.prov.Prov.DBName("tokens")).OrderBy("created_time DESC")
+	if owner != nil {
+		q = q.Where(squirrel.Eq{"owner_name": owner.Name, "owner_email": owner.Email})
+	}
+
+	qStr, qArgs, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(qStr, qArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, rows.Close)
+
+	res := make([]DBToken, 0, 10)
+	for rows.Next() {
+		var tkn DBToken
+		err := rowToToken(rows, &tkn)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, tkn)
+	}
+
+	return res, rows.Err()
+
+}
+
+func (s *TokenStateManagerSQLSession) DelToken(id string) error {
+
+	_, err := s.db.Exec(`DELETE FROM `+s.prov.Prov.DBName("tokens")+` WHERE token_id = ?;`, id)
+	if err != nil {
+		return fmt.Errorf("problem while deleting token: %w", err)
+	}
+	return nil
+
+}
+
+func (s *TokenStateManagerSQLSession) TouchToken(id string, t, notBefore time.Time) error {
+
+	_, err := s.db.Exec(`UPDATE `+s.prov.Prov.DBName("tokens")+` SET last_used_time = ? WHERE token_id = ? `+
+		`AND (last_used_time IS NULL OR last_used_time < ?);`, t.UTC(), id, notBefore.UTC())
+	if err != nil {
+		return fmt.Errorf("problem while updating last use of token: %w", err)
+	}
+	return nil
+
+}
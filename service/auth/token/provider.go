@@ -7,9 +7,11 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/dns3l/dns3l-core/service/auth/types"
 	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -20,8 +22,12 @@ const (
 
 // When needed manually, generate tokens with: openssl rand -base64 32
 
+// Tokens are not re-checked in the DB more often than this to update their last use
+const lastUsedResolution = time.Minute
+
 type TokenAuthProvider struct {
 	Config TokenAuthConfig
+	State  TokenStateManager //tokens created via the API, nil if there is no DB
 }
 
 func (c *TokenAuthProvider) AuthnGetAuthzInfo(r *http.Request) (types.AuthorizationInfo, error) {
@@ -49,6 +55,12 @@ func (c *TokenAuthProvider) AuthnGetAuthzInfo(r *http.Request) (types.Authorizat
 		if tokencfg.Sha256 == tokenHashed ||
 			tokencfg.Sha256 == "" && tokencfg.Plain == token {
 
+			err := tokencfg.checkUsage(util.RequestClientIP(r), time.Now())
+			if err != nil {
+				log.WithError(err).WithField("token", tokencfg.Name).Info("Token used outside of its restrictions.")
+				return nil, err
+			}
+
 			domainsAllowed := make([]string, len(tokencfg.DomainsAllowed))
 			for i := range tokencfg.DomainsAllowed {
 				domainsAllowed[i] = util.GetDomainFQDNDot(tokencfg.DomainsAllowed[i])
@@ -60,19 +72,81 @@ func (c *TokenAuthProvider) AuthnGetAuthzInfo(r *http.Request) (types.Authorizat
 				},
 				WriteAllowed:   tokencfg.Write,
 				ReadAllowed:    true,
+				AdminAllowed:   tokencfg.Admin,
 				DomainsAllowed: domainsAllowed,
+				Scopes:         tokencfg.Scopes,
+				CAsAllowed:     tokencfg.CAsAllowed,
+				Delegation: &types.Delegation{NotBefore: tokencfg.NotBefore, Expiry: tokencfg.NotAfter,
+					SourceCIDRs: tokencfg.SourceCIDRs},
 			}
 			log.WithField("authzinfo", authzinfo.String()).Debug("Token request authorization determined")
 			return authzinfo, nil
 		}
 	}
 
+	if c.State != nil {
+		return c.dbTokenAuthzInfo(tokenHashed, util.RequestClientIP(r))
+	}
+
 	log.Debug("Token did not match an authorization.")
 
 	return nil, nil
 
 }
 
+func (c *TokenAuthProvider) dbTokenAuthzInfo(tokenHashed, clientIP string) (types.AuthorizationInfo, error) {
+
+	sess, err := c.State.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	tkn, err := sess.GetTokenByHash(tokenHashed)
+	if err != nil {
+		return nil, err
+	}
+	if tkn == nil {
+		log.Debug("Token did not match an authorization.")
+		return nil, nil
+	}
+	now := time.Now()
+	if tkn.Expired(now) {
+		log.WithFields(logrus.Fields{"token": tkn.Name, "owner": tkn.Owner.GetPreferredName()}).Debug(
+			"Token has expired.")
+		return nil, nil
+	}
+	err = tkn.checkUsage(clientIP, now)
+	if err != nil {
+		log.WithError(err).WithFields(logrus.Fields{"token": tkn.Name, "owner": tkn.Owner.GetPreferredName()}).Info(
+			"Token used outside of its restrictions.")
+		return nil, err
+	}
+
+	err = sess.TouchToken(tkn.ID, now, now.Add(-lastUsedResolution))
+	if err != nil {
+		log.WithError(err).WithField("token", tkn.Name).Warn("Could not update last use of token.")
+	}
+
+	authzinfo := &types.DefaultAuthorizationInfo{
+		UserInfo: &types.UserInfo{
+			Name:  tkn.Name,
+			Email: tkn.Owner.Email, //required for claiming certs
+		},
+		WriteAllowed:   tkn.Write,
+		ReadAllowed:    true,
+		AdminAllowed:   tkn.Admin,
+		DomainsAllowed: tkn.DomainsAllowed,
+		Scopes:         tkn.Scopes,
+		CAsAllowed:     tkn.CAsAllowed,
+		Delegation: &types.Delegation{Owner: tkn.Owner, TokenID: tkn.ID, NotBefore: tkn.NotBefore,
+			Expiry: tkn.ExpiryTime, SourceCIDRs: tkn.SourceCIDRs},
+	}
+	log.WithField("authzinfo", authzinfo.String()).Debug("Token request authorization determined")
+	return authzinfo, nil
+
+}
+
 func validName(tokencfg Token) bool {
 	return len(tokencfg.Name) >= 3
 }
@@ -3,7 +3,10 @@ package token
 import (
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/service/auth/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -78,6 +81,68 @@ func TestTokenAuthProvider(t *testing.T) {
 
 }
 
+func TestTokenRestrictions(t *testing.T) {
+
+	ingresstoken, err := GenerateRandomToken()
+	assert.NoError(t, err)
+
+	latertoken, err := GenerateRandomToken()
+	assert.NoError(t, err)
+
+	prov := TokenAuthProvider{
+		Config: TokenAuthConfig{
+			Static: []Token{
+				{
+					Name:           "ingress",
+					Plain:          ingresstoken,
+					DomainsAllowed: []string{"rick.de"},
+					Restrictions: Restrictions{
+						Scopes:      []types.Scope{types.ScopeReadKey},
+						CAsAllowed:  []string{"le-staging"},
+						SourceCIDRs: []string{"10.0.0.0/8"},
+					},
+				},
+				{
+					Name:           "later",
+					Plain:          latertoken,
+					DomainsAllowed: []string{"rick.de"},
+					Restrictions: Restrictions{
+						NotBefore: time.Now().Add(time.Hour),
+					},
+				},
+			},
+		},
+	}
+
+	req := makereq(ingresstoken)
+	req.RemoteAddr = "10.1.2.3:4711"
+	authz, err := prov.AuthnGetAuthzInfo(req)
+	assert.NoError(t, err)
+	assert.NotNil(t, authz)
+	assert.NoError(t, authz.ChkAuthScope(types.ScopeReadKey))
+	assert.NoError(t, authz.ChkAuthScope(types.ScopeReadPublic))
+	assert.Error(t, authz.ChkAuthScope(types.ScopeDelete))
+	assert.Error(t, authz.ChkAuthScope(types.ScopeClaim))
+	assert.NoError(t, authz.ChkAuthCA("le-staging"))
+	assert.Error(t, authz.ChkAuthCA("sectigo"))
+
+	req.RemoteAddr = "192.0.2.1:4711"
+	_, err = prov.AuthnGetAuthzInfo(req)
+	var notAuthned *common.NotAuthnedError
+	assert.ErrorAs(t, err, &notAuthned)
+
+	_, err = prov.AuthnGetAuthzInfo(makereq(latertoken))
+	assert.ErrorAs(t, err, &notAuthned)
+
+	assert.Len(t, (&Restrictions{
+		Scopes:      []types.Scope{"cert:all"},
+		SourceCIDRs: []string{"10.0.0.1"},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().Add(-time.Hour),
+	}).Check(), 3)
+
+}
+
 func makereq(token string) *http.Request {
 	req := &http.Request{
 		Header: make(map[string][]string),
@@ -0,0 +1,32 @@
+package token
+
+import (
+	"time"
+
+	"github.com/dns3l/dns3l-core/service/auth/types"
+)
+
+type TokenStateManager interface {
+	NewSession() (TokenStateManagerSession, error)
+}
+
+type TokenStateManagerSession interface {
+	Close() error
+
+	PutToken(tkn *DBToken) error
+
+	//Returns nil if the token does not exist
+	GetToken(id string) (*DBToken, error)
+
+	//Returns nil if no token has the hash
+	GetTokenByHash(hash string) (*DBToken, error)
+
+	//Newest tokens first. If owner is nil, the tokens of all users are listed.
+	ListTokens(owner *types.UserInfo) ([]DBToken, error)
+
+	DelToken(id string) error
+
+	//Sets the last-used time of the token to t, unless it has been set after notBefore.
+	//Avoids a DB write for every request made with the token.
+	TouchToken(id string, t, notBefore time.Time) error
+}
@@ -0,0 +1,38 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/dns3l/dns3l-core/service/auth/types"
+)
+
+// A token created by a user via the API. Only the hash of the token is stored, the
+// token itself is shown once on creation.
+type DBToken struct {
+	ID             string
+	Name           string
+	Hash           string //see ConvertPlainToken
+	Owner          *types.UserInfo
+	DomainsAllowed []string
+	Write          bool
+	Admin          bool
+	CreatedTime    time.Time
+	ExpiryTime     time.Time
+	LastUsedTime   time.Time //zero if it has not been used yet
+	Restrictions             //NotAfter always equals ExpiryTime
+}
+
+func (t *DBToken) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiryTime)
+}
+
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
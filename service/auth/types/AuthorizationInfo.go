@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type AuthorizationInfo interface {
 
 	//If the client is allowed to read public PKI material
@@ -14,11 +16,32 @@ type AuthorizationInfo interface {
 	ChkAuthWriteDomain(domain string) error
 	ChkAuthWriteDomains(domains []string) error
 
+	//If the client is allowed to do administrative operations, e.g. reading the audit log
+	ChkAuthAdmin() error
+
+	//If the client is allowed to do the given kind of certificate operation
+	ChkAuthScope(scope Scope) error
+
+	//If the client is allowed to use the given CA
+	ChkAuthCA(caID string) error
+
 	GetDomainsAllowed() []string
 	CanListPublicData() bool
 
 	GetUserInfo() *UserInfo
 	IsAuthzDisabled() bool
 
+	//Returns nil if the client is the user itself, e.g. authenticated via OIDC
+	GetDelegation() *Delegation
+
 	String() string
 }
+
+// The client authenticated with a token or client certificate instead of as a user
+type Delegation struct {
+	Owner       *UserInfo //user who created the token via the API, nil for configured tokens and certificates
+	TokenID     string    //ID of the token created via the API, empty for configured tokens and certificates
+	NotBefore   time.Time //zero if it is valid right away
+	Expiry      time.Time //zero if it does not expire
+	SourceCIDRs []string  //networks the token is accepted from, all if empty
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/dns3l/dns3l-core/common"
@@ -13,14 +14,18 @@ type DefaultAuthorizationInfo struct {
 	DomainsAllowed        []string
 	WriteAllowed          bool
 	ReadAllowed           bool
-	ReadAnyPublicAllowed  bool //If this is set to true, no domain ACL check is done for public data!
-	AuthorizationDisabled bool //everything will be allowed, danger zone!
+	ReadAnyPublicAllowed  bool     //If this is set to true, no domain ACL check is done for public data!
+	AdminAllowed          bool     //administrative operations, independent of the domain ACLs
+	Scopes                []Scope  //certificate operations allowed, all if empty
+	CAsAllowed            []string //all CAs if empty
+	AuthorizationDisabled bool     //everything will be allowed, danger zone!
+	Delegation            *Delegation
 }
 
 func (i *DefaultAuthorizationInfo) String() string {
-	return fmt.Sprintf("userinfo=%s, domains=%s, write=%t, read=%t, readpub=%t, authzdis=%t",
-		i.UserInfo, i.DomainsAllowed, i.WriteAllowed, i.ReadAllowed,
-		i.ReadAnyPublicAllowed, i.AuthorizationDisabled)
+	return fmt.Sprintf("userinfo=%s, domains=%s, write=%t, read=%t, readpub=%t, admin=%t, scopes=%s, "+
+		"cas=%s, authzdis=%t", i.UserInfo, i.DomainsAllowed, i.WriteAllowed, i.ReadAllowed,
+		i.ReadAnyPublicAllowed, i.AdminAllowed, i.Scopes, i.CAsAllowed, i.AuthorizationDisabled)
 }
 
 func (i *DefaultAuthorizationInfo) GetUserInfo() *UserInfo {
@@ -31,6 +36,10 @@ func (i *DefaultAuthorizationInfo) IsAuthzDisabled() bool {
 	return i.AuthorizationDisabled
 }
 
+func (i *DefaultAuthorizationInfo) GetDelegation() *Delegation {
+	return i.Delegation
+}
+
 func (i *DefaultAuthorizationInfo) ChkAuthReadDomainPublic(domain string) error {
 
 	if i.AuthorizationDisabled {
@@ -111,8 +120,45 @@ func (i *DefaultAuthorizationInfo) ChkAuthWriteDomains(domains []string) error {
 
 }
 
+func (i *DefaultAuthorizationInfo) ChkAuthAdmin() error {
+
+	if i.AuthorizationDisabled || i.AdminAllowed {
+		return nil
+	}
+
+	return AdminNotAllowed
+
+}
+
+func (i *DefaultAuthorizationInfo) ChkAuthScope(scope Scope) error {
+
+	if i.AuthorizationDisabled || len(i.Scopes) == 0 {
+		return nil
+	}
+
+	for _, allowed := range i.Scopes {
+		if allowed.implies(scope) {
+			return nil
+		}
+	}
+
+	return &common.UnauthzedError{Msg: fmt.Sprintf("scope '%s' requested but not allowed", scope)}
+
+}
+
+func (i *DefaultAuthorizationInfo) ChkAuthCA(caID string) error {
+
+	if i.AuthorizationDisabled || len(i.CAsAllowed) == 0 || slices.Contains(i.CAsAllowed, caID) {
+		return nil
+	}
+
+	return &common.UnauthzedError{Msg: fmt.Sprintf("user has no permission for CA '%s'", caID)}
+
+}
+
 var ReadNotAllowed error = &common.UnauthzedError{Msg: "read requested but not allowed to read"}
 var WriteNotAllowed error = &common.UnauthzedError{Msg: "write requested but not allowed to write"}
+var AdminNotAllowed error = &common.UnauthzedError{Msg: "administrative operation requested but not allowed"}
 
 func (i *DefaultAuthorizationInfo) checkAllowedToAccessDomains(domains []string) error {
 
@@ -0,0 +1,39 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Restricts which certificate operations a client may do on its domains, on top of the
+// read/write permissions
+type Scope string
+
+const (
+	ScopeReadPublic Scope = "cert:read-public" //certificates and chains
+	ScopeReadKey    Scope = "cert:read-key"    //private keys, implies cert:read-public
+	ScopeClaim      Scope = "cert:claim"
+	ScopeDelete     Scope = "cert:delete"
+	ScopeRenew      Scope = "cert:renew"
+)
+
+var AllScopes = []Scope{ScopeReadPublic, ScopeReadKey, ScopeClaim, ScopeDelete, ScopeRenew}
+
+func (s Scope) Valid() bool {
+	return slices.Contains(AllScopes, s)
+}
+
+func (s Scope) implies(other Scope) bool {
+	return s == other || s == ScopeReadKey && other == ScopeReadPublic
+}
+
+func ParseScopes(scopes []string) ([]Scope, error) {
+	res := make([]Scope, len(scopes))
+	for i := range scopes {
+		res[i] = Scope(scopes[i])
+		if !res[i].Valid() {
+			return nil, fmt.Errorf("unknown scope '%s', must be one of %s", scopes[i], AllScopes)
+		}
+	}
+	return res, nil
+}
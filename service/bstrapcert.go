@@ -24,7 +24,8 @@ type BStrapCertInfo struct {
 
 func DoSafeBootstrapCerts(s *Service) error {
 
-	c := s.Config.Bootstrap
+	conf := s.config()
+	c := conf.Bootstrap
 	if c == nil || len(c.Certs) == 0 {
 		log.Debug("no bootstrap certs configured, continuing...")
 		return nil
@@ -40,7 +41,7 @@ func DoSafeBootstrapCerts(s *Service) error {
 
 		domains := append([]string{name}, cert.OtherDomains...)
 
-		cinfo, err := s.Config.CA.Functions.GetCertificateInfo(cert.CA, name)
+		cinfo, err := conf.CA.Functions.GetCertificateInfo(cert.CA, name)
 
 		nferr := &common.NotFoundError{}
 		if err == nil && cinfo != nil {
@@ -58,7 +59,7 @@ func DoSafeBootstrapCerts(s *Service) error {
 
 		log.WithField("certName", name).Info("Claiming bootstrap certificate.")
 
-		namerz, err := s.Config.RootZones.GetLowestRZForDomain(name)
+		namerz, err := conf.RootZones.GetLowestRZForDomain(name)
 		if err != nil {
 			if cert.Force {
 				return fmt.Errorf("could not get root zone for domain (cert %s): %w", name, err)
@@ -68,7 +69,7 @@ func DoSafeBootstrapCerts(s *Service) error {
 			}
 		}
 
-		claim, err := s.Config.CA.Functions.PrepareClaimCertificate(cert.CA, &types.CertificateClaimInfo{
+		claim, _, err := conf.CA.Functions.PrepareClaimCertificate(cert.CA, &types.CertificateClaimInfo{
 			Name:    name,
 			NameRZ:  namerz.Root,
 			Domains: domains,
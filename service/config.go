@@ -5,10 +5,17 @@ import (
 	"os"
 
 	"github.com/creasty/defaults"
+	"github.com/dns3l/dns3l-core/audit"
 	"github.com/dns3l/dns3l-core/ca"
 	"github.com/dns3l/dns3l-core/dns"
+	"github.com/dns3l/dns3l-core/events"
+	"github.com/dns3l/dns3l-core/leader"
+	"github.com/dns3l/dns3l-core/notify"
+	"github.com/dns3l/dns3l-core/secrets"
 	"github.com/dns3l/dns3l-core/service/auth"
+	"github.com/dns3l/dns3l-core/service/auth/token"
 	"github.com/dns3l/dns3l-core/state"
+	"github.com/dns3l/dns3l-core/tracing"
 	myvalidation "github.com/dns3l/dns3l-core/util/validation"
 	"github.com/go-playground/validator/v10"
 	"gopkg.in/yaml.v2"
@@ -24,11 +31,37 @@ type Config struct {
 	AdminEMail []string                    `yaml:"adminemail" validate:"required,dive,email"`
 	Bootstrap  *BStrapConfig               `yaml:"bootstrap"`
 	Renew      *RenewConfig                `yaml:"renew"`
+	Events     *events.Config              `yaml:"events"`
+	Notify     *notify.Config              `yaml:"notify"`
+	Metrics    *MetricsConfig              `yaml:"metrics"`
+	Tracing    *tracing.Config             `yaml:"tracing"`
+	Audit      *audit.Config               `yaml:"audit"`
+	Leader     *leader.Config              `yaml:"leader"`
+	Shutdown   *ShutdownConfig             `yaml:"shutdown"`
+	Readiness  *ReadinessConfig            `yaml:"readiness"`
+	TLS        *TLSConfig                  `yaml:"tls"`
+
+	TrustedProxies []string `yaml:"trustedProxies" validate:"dive,cidr"` //CIDRs of reverse proxies whose X-Forwarded-For is trusted
+
+	raw []byte //YAML the config has been read from, to log the changes on reload
 
 	//RootZoneAllowedCA map[string] //maybe we need this later...
 	//CAAllowedRootZones map[string][]dns.RootZone
 }
 
+var _ yaml.Unmarshaler = &Config{}
+
+// Resolves the secret references, those of the DNS and CA providers are resolved when
+// the providers are unmarshalled.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Config
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	return secrets.ResolveAll(c, "dns", "ca")
+}
+
 func (c *Config) FromFile(file string) error {
 	filebytes, err := os.ReadFile(file)
 	if err != nil {
@@ -38,6 +71,7 @@ func (c *Config) FromFile(file string) error {
 }
 
 func (c *Config) FromYamlBytes(bytes []byte) error {
+	c.raw = bytes
 	return yaml.Unmarshal(bytes, c)
 }
 
@@ -66,7 +100,7 @@ func (c *Config) Initialize() error {
 	log.Info("Successfully validated config.")
 
 	for _, rtzn := range c.RootZones {
-		if foo := rtzn.CAs[0]; foo == "*" {
+		if len(rtzn.CAs) > 0 && rtzn.CAs[0] == "*" {
 			//all CAs can handle this root zone
 			for _, ca := range c.CA.Providers {
 				ca.AddAllowedRootZone(rtzn)
@@ -82,6 +116,10 @@ func (c *Config) Initialize() error {
 		}
 	}
 
+	if c.DB != nil {
+		c.Auth.Token.State = &token.TokenStateManagerSQL{Prov: c.DB}
+	}
+
 	err = c.CA.Init(&CAConfigurationContextImpl{
 		StateProvider: c.DB,
 		DNSConfig:     c.DNS,
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dns3l/dns3l-core/dns/bogus"
+)
+
+func TestConfigResolvesSecrets(t *testing.T) {
+	t.Setenv("DNS3L_TEST_DB_PASS", "s3cret")
+	t.Setenv("DNS3L_TEST_DNS_NAME", "Resolved DNS")
+
+	conf := &Config{}
+	err := conf.FromYamlBytes([]byte(strings.NewReplacer(
+		"user:password@", "user:${env:DNS3L_TEST_DB_PASS}@",
+		"name: Bogus DNS", "name: ${env:DNS3L_TEST_DNS_NAME}",
+		"sha256: old-hash", "sha256: $${env:LITERAL}",
+	).Replace(reloadTestConfig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(conf.DB.URL, "user:s3cret@") {
+		t.Errorf("expected DB password to be resolved, got %s", conf.DB.URL)
+	}
+	if name := conf.DNS.Providers["bog"].Prov.(*bogus.DNSProvider).C.Name; name != "Resolved DNS" {
+		t.Errorf("expected DNS provider name to be resolved, got %s", name)
+	}
+	if tkn := conf.Auth.Token.Config.Static[0].Sha256; tkn != "${env:LITERAL}" {
+		t.Errorf("expected escaped reference to be kept, got %s", tkn)
+	}
+
+	err = conf.FromYamlBytes([]byte(strings.Replace(reloadTestConfig,
+		"user:password@", "user:${env:DNS3L_TEST_UNSET}@", 1)))
+	if err == nil || !strings.Contains(err.Error(), "db.url") {
+		t.Errorf("expected error for unset variable naming the setting, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/creasty/defaults"
+	catypes "github.com/dns3l/dns3l-core/ca/types"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/util"
+	myvalidation "github.com/dns3l/dns3l-core/util/validation"
+	"github.com/go-playground/validator/v10"
+)
+
+// Keys of the maps by ID, written as providers[id] in the validator namespace
+var yamlMapKeyRegex = regexp.MustCompile(`(providers|oidc_bindings)\[([^\]]+)\]`)
+
+// Check validates the config like Initialize does, and additionally checks the references
+// of the root zones, the TTL bounds, the static tokens and the client cert auth. Neither the
+// DB nor the providers are contacted. All problems found are returned with the YAML path of
+// the setting.
+func (c *Config) Check() []*common.ConfigError {
+
+	var res []*common.ConfigError
+	add := func(path, msg string) {
+		res = append(res, &common.ConfigError{Path: path, Msg: msg})
+	}
+
+	err := defaults.Set(c)
+	if err != nil {
+		return []*common.ConfigError{{Path: "config", Msg: err.Error()}}
+	}
+
+	validate := validator.New()
+	validate.RegisterTagNameFunc(yamlFieldName)
+	err = myvalidation.RegisterDNS3LValidations(validate)
+	if err != nil {
+		return []*common.ConfigError{{Path: "config", Msg: err.Error()}}
+	}
+	err = validate.Struct(c)
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		for _, fe := range verrs {
+			msg := fmt.Sprintf("failed on '%s' validation", fe.Tag())
+			if fe.Param() != "" {
+				msg = fmt.Sprintf("failed on '%s=%s' validation", fe.Tag(), fe.Param())
+			}
+			add(yamlPath(fe.Namespace()), msg)
+		}
+	} else if err != nil {
+		add("config", err.Error())
+	}
+
+	res = append(res, c.checkRootZones()...)
+
+	if c.CA != nil {
+		for id, prov := range c.CA.Providers {
+			if prov == nil {
+				continue
+			}
+			cc, ok := prov.Prov.(catypes.ConfigChecker)
+			if !ok {
+				continue
+			}
+			if err := cc.CheckConfig(); err != nil {
+				for _, msg := range strings.Split(err.Error(), "\n") {
+					add("ca.providers."+id, msg)
+				}
+			}
+		}
+	}
+
+	for _, e := range c.Auth.Token.Config.Check() {
+		add("auth.tokens."+e.Path, e.Msg)
+	}
+	for i, tkn := range c.Auth.Token.Config.Static {
+		for j, caID := range tkn.CAsAllowed {
+			if c.CA == nil || c.CA.Providers[caID] == nil {
+				add(fmt.Sprintf("auth.tokens.static[%d].casallowed[%d]", i, j),
+					fmt.Sprintf("CA '%s' is not configured", caID))
+			}
+		}
+	}
+	for _, e := range c.Auth.MTLS.Config.Check() {
+		add("auth.mtls."+e.Path, e.Msg)
+	}
+
+	if len(res) == 0 {
+		//whatever the providers check on init
+		err = c.Initialize()
+		if err != nil {
+			add("config", err.Error())
+		}
+	}
+
+	slices.SortStableFunc(res, func(a, b *common.ConfigError) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return res
+
+}
+
+// Checks that every root zone is configured once, and that the CAs and DNS providers it
+// references exist.
+func (c *Config) checkRootZones() []*common.ConfigError {
+
+	var res []*common.ConfigError
+	add := func(path, msg string) {
+		res = append(res, &common.ConfigError{Path: path, Msg: msg})
+	}
+
+	roots := make(map[string]int, len(c.RootZones))
+	for i, rz := range c.RootZones {
+		if rz == nil {
+			continue
+		}
+		path := fmt.Sprintf("rtzn[%d]", i)
+
+		root := util.GetDomainFQDNDot(strings.ToLower(rz.Root))
+		if j, exists := roots[root]; exists {
+			add(path+".root", fmt.Sprintf("'%s' is already configured in rtzn[%d]", rz.Root, j))
+		} else {
+			roots[root] = i
+		}
+
+		if len(rz.CAs) == 0 {
+			add(path+".ca", "no CA given")
+		}
+		for k, caID := range rz.CAs {
+			if caID == "*" {
+				if len(rz.CAs) > 1 {
+					add(fmt.Sprintf("%s.ca[%d]", path, k), "'*' must be the only entry")
+				}
+				continue
+			}
+			if c.CA == nil {
+				continue
+			}
+			if _, exists := c.CA.Providers[caID]; !exists {
+				add(fmt.Sprintf("%s.ca[%d]", path, k), fmt.Sprintf("CA '%s' has not been configured", caID))
+			}
+		}
+
+		if c.DNS == nil {
+			continue
+		}
+		for field, provID := range map[string]string{"autodns": rz.DNSProvAutoDNS, "acmedns": rz.DNSProvAcme} {
+			if provID == "" {
+				continue
+			}
+			if _, exists := c.DNS.Providers[provID]; !exists {
+				add(path+"."+field, fmt.Sprintf("DNS provider '%s' has not been configured", provID))
+			}
+		}
+	}
+	return res
+
+}
+
+// CheckConnections checks that the DB, the CAs, the DNS providers and the OIDC issuers can be
+// reached with the configured credentials, the problems are returned with the YAML path of
+// the component's config. The DB must be initialized.
+func (s *Service) CheckConnections() []*common.ConfigError {
+
+	var res []*common.ConfigError
+	for _, comp := range s.CheckReadiness().Components {
+		if comp.Ready {
+			continue
+		}
+		path := comp.Type
+		switch comp.Type {
+		case "ca", "dns":
+			path = comp.Type + ".providers." + comp.Name
+		case "oidc":
+			path = "auth.oidc_bindings." + comp.Name
+		}
+		res = append(res, &common.ConfigError{Path: path, Msg: comp.Error})
+	}
+	return res
+
+}
+
+// Names the fields in validation errors by their YAML key
+func yamlFieldName(fld reflect.StructField) string {
+	return strings.SplitN(fld.Tag.Get("yaml"), ",", 2)[0]
+}
+
+// Converts the namespace of a validation error into the YAML path of the setting
+func yamlPath(namespace string) string {
+	path := yamlMapKeyRegex.ReplaceAllString(strings.TrimPrefix(namespace, "Config."), "$1.$2")
+	segs := strings.Split(path, ".")
+	res := make([]string, 0, len(segs))
+	for _, seg := range segs {
+		switch seg {
+		case "Prov", "C", "Provider", "Config":
+			//fields without YAML key, their fields are inlined in the YAML
+			continue
+		case "Token":
+			seg = "tokens"
+		case "MTLS":
+			seg = "mtls"
+		}
+		res = append(res, seg)
+	}
+	return strings.Join(res, ".")
+}
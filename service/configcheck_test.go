@@ -0,0 +1,50 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConfigCheck(t *testing.T) {
+	conf := &Config{}
+	err := conf.FromYamlBytes([]byte(strings.Replace(reloadTestConfig,
+		"sha256: old-hash", "sha256: 47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := conf.Check(); len(problems) > 0 {
+		t.Fatalf("expected valid config, got %v", problems)
+	}
+
+	broken := strings.NewReplacer(
+		"      name: Bogus DNS\n", "",
+		"    ca: ['*']\n", "    ca: ['*']\n  - root: foo.example.com.\n    autodns: nope\n    acmedns: bog\n    ca: [bog, other]\n",
+		"      logopath:", "      ttl:\n        min: 10\n        max: 5\n      logopath:",
+		"name: deploy", "name: de\n        scopes: [cert:bogus]\n        casallowed: [nope]",
+	).Replace(reloadTestConfig)
+	conf = &Config{}
+	err = conf.FromYamlBytes([]byte(broken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := conf.Check()
+	paths := make([]string, len(problems))
+	for i, p := range problems {
+		paths[i] = p.Path
+	}
+	expected := []string{
+		"auth.tokens.static[0].casallowed[0]",
+		"auth.tokens.static[0].name",
+		"auth.tokens.static[0].scopes[0]",
+		"auth.tokens.static[0].sha256",
+		"ca.providers.bog",
+		"dns.providers.bog.name",
+		"rtzn[1].autodns",
+		"rtzn[1].ca[1]",
+		"rtzn[1].root",
+	}
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("expected problems at %v, got %v", expected, problems)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	catypes "github.com/dns3l/dns3l-core/ca/types"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+const (
+	readinessCheckTimeout = 10 * time.Second
+	readinessCacheTime    = 15 * time.Second //probes must not hammer the DNS provider APIs
+)
+
+type readinessCache = util.SingleValCache[*apiv1.ReadinessReport]
+
+type ReadinessConfig struct {
+	//By default, only the DB is required for readiness, the CAs, DNS providers and OIDC issuers
+	//are reported only. Restarting or unrouting all replicas does not help if those are down.
+	RequireExternal bool `yaml:"requireExternal"`
+}
+
+// The process is alive, no dependencies are checked
+func (s *Service) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write([]byte(`{"status":"ok"}` + "\n"))
+	util.LogIfError(log, err)
+}
+
+// The required components are available, see ReadinessConfig. The status of the others is
+// reported as well. The errors are left out since the endpoint is unauthenticated.
+func (s *Service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report, _ := s.readiness.GetCached(func() (*apiv1.ReadinessReport, error) {
+		return s.CheckReadiness(), nil
+	})
+
+	res := &apiv1.ReadinessReport{Ready: report.Ready, Components: slices.Clone(report.Components)}
+	for i := range res.Components {
+		res.Components[i].Error = ""
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if res.Ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	util.LogIfError(log, json.NewEncoder(w).Encode(res))
+}
+
+// CheckReadiness checks the components the daemon depends on concurrently. The report is
+// only ready if the required components are.
+func (s *Service) CheckReadiness() *apiv1.ReadinessReport {
+
+	type check struct {
+		typ, name string
+		f         func() error
+	}
+	checks := []check{{"db", "db", s.checkDB}}
+
+	conf := s.config()
+	requireExternal := conf.Readiness != nil && conf.Readiness.RequireExternal
+	for id, prov := range conf.CA.Providers {
+		rc, ok := prov.Prov.(catypes.ReachabilityChecker)
+		if ok && prov.Prov.IsEnabled() {
+			checks = append(checks, check{"ca", id, rc.CheckReachability})
+		}
+	}
+	for id, prov := range conf.DNS.Providers {
+		checks = append(checks, check{"dns", id, prov.Prov.CheckReachability})
+	}
+
+	var mtx sync.Mutex
+	report := &apiv1.ReadinessReport{Ready: true, Components: make([]apiv1.ComponentReadiness, 0, len(checks))}
+	add := func(typ, name string, err error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		c := apiv1.ComponentReadiness{Type: typ, Name: name, Ready: err == nil,
+			Required: typ == "db" || requireExternal}
+		if err != nil {
+			c.Error = err.Error()
+			if c.Required {
+				report.Ready = false
+			}
+			log.WithError(err).WithField("component", typ+"/"+name).Warn("Component is not ready")
+		}
+		report.Components = append(report.Components, c)
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			add(c.typ, c.name, runWithTimeout(c.f, readinessCheckTimeout))
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var issuers map[string]error
+		err := runWithTimeout(func() error {
+			issuers = conf.Auth.CheckReadiness()
+			return nil
+		}, readinessCheckTimeout)
+		if err != nil {
+			add("oidc", "", err)
+			return
+		}
+		for issuer, err := range issuers {
+			add("oidc", issuer, err)
+		}
+	}()
+	wg.Wait()
+
+	slices.SortFunc(report.Components, func(a, b apiv1.ComponentReadiness) int {
+		if c := strings.Compare(a.Type, b.Type); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return report
+
+}
+
+func (s *Service) checkDB() error {
+	db, err := s.Config.DB.GetDBConn()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), readinessCheckTimeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// Returns an error if f does not return within the timeout, f keeps running then.
+func runWithTimeout(f func() error, timeout time.Duration) error {
+	res := make(chan error, 1)
+	go func() {
+		res <- util.CatchPanic(f)
+	}()
+	select {
+	case err := <-res:
+		return err
+	case <-time.After(timeout):
+		return errors.New("check timed out after " + timeout.String())
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/ca"
+	"github.com/dns3l/dns3l-core/dns"
+	"github.com/dns3l/dns3l-core/dns/bogus"
+	"github.com/dns3l/dns3l-core/state"
+)
+
+type unreachableDNSProvider struct {
+	bogus.DNSProvider
+}
+
+func (p *unreachableDNSProvider) CheckReachability() error {
+	return errors.New("authentication failed")
+}
+
+func TestReadinessReportsEachComponent(t *testing.T) {
+	s := &Service{Config: &Config{
+		DB: &state.SQLDBProviderDefault{}, //not initialized
+		CA: &ca.Config{Providers: map[string]*ca.ProviderInfo{}},
+		DNS: &dns.Config{Providers: map[string]*dns.ProviderInfo{
+			"ok":     {Type: "bogus", Prov: &bogus.DNSProvider{}},
+			"broken": {Type: "bogus", Prov: &unreachableDNSProvider{}},
+		}},
+	}}
+
+	rec := httptest.NewRecorder()
+	s.handleReadyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+
+	var report apiv1.ReadinessReport
+	err := json.Unmarshal(rec.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Ready {
+		t.Error("expected report not to be ready")
+	}
+	expected := []struct {
+		typ, name       string
+		ready, required bool
+	}{{"db", "db", false, true}, {"dns", "broken", false, false}, {"dns", "ok", true, false}}
+	if len(report.Components) != len(expected) {
+		t.Fatalf("expected %d components, got %+v", len(expected), report.Components)
+	}
+	for i, e := range expected {
+		c := report.Components[i]
+		if c.Type != e.typ || c.Name != e.name || c.Ready != e.ready || c.Required != e.required {
+			t.Errorf("component %d: expected %s/%s ready=%v required=%v, got %+v", i, e.typ, e.name,
+				e.ready, e.required, c)
+		}
+		if c.Error != "" {
+			t.Errorf("component %d: expected the error message not to be exposed, got %s", i, c.Error)
+		}
+	}
+
+	//the errors are kept for the config check
+	s.Config.Readiness = &ReadinessConfig{RequireExternal: true}
+	report = *s.CheckReadiness()
+	for _, c := range report.Components {
+		if !c.Required {
+			t.Errorf("expected %s/%s to be required", c.Type, c.Name)
+		}
+		if !c.Ready && c.Error == "" {
+			t.Errorf("expected an error message for %s/%s", c.Type, c.Name)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleHealthz(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected healthz to be 200 regardless of dependencies, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/jobs"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *Service) getJobState() jobs.JobStateManager {
+	return &jobs.JobStateManagerSQL{Prov: s.Config.DB}
+}
+
+// Runs the claim of a persisted job in the background and records each step it reaches.
+// ctx must not be canceled with the request the job has been created by.
+func (s *Service) runClaimJob(ctx context.Context, jobID string, caID string, cinfo *apiv1.CertClaimInfo, authz authtypes.AuthorizationInfo) {
+
+	s.jobsRunning.Add(1)
+	go func() {
+		defer s.jobsRunning.Done()
+
+		log.WithFields(logrus.Fields{"jobID": jobID, "caID": caID, "name": cinfo.Name}).Info("Running claim job")
+
+		err := s.GetV1().claimCertificate(ctx, caID, cinfo, authz, func(step string) {
+			s.addJobStep(jobID, jobs.Status(step), nil)
+		})
+		if err != nil {
+			log.WithError(err).WithField("jobID", jobID).Error("Claim job failed")
+			s.addJobStep(jobID, jobs.StatusFailed, err)
+			return
+		}
+		s.addJobStep(jobID, jobs.StatusIssued, nil)
+	}()
+
+}
+
+func (s *Service) addJobStep(jobID string, status jobs.Status, stepErr error) {
+
+	step := jobs.StepInfo{Status: status, Time: time.Now()}
+	if stepErr != nil {
+		step.Error = stepErr.Error()
+	}
+
+	sess, err := s.getJobState().NewSession()
+	if err == nil {
+		defer util.LogDefer(log, sess.Close)
+		err = sess.AddJobStep(jobID, step)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(logrus.Fields{"jobID": jobID, "status": status}).Error(
+			"Could not record job step")
+	}
+
+}
+
+// Stores the JSON-encoded result of the job
+func (s *Service) putJobResult(jobID string, result any) {
+	l := log.WithField("jobID", jobID)
+
+	res, err := json.Marshal(result)
+	if err != nil {
+		l.WithError(err).Error("Could not encode job result")
+		return
+	}
+
+	sess, err := s.getJobState().NewSession()
+	if err != nil {
+		l.WithError(err).Error("Could not record job result")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	err = sess.UpdJobResult(jobID, string(res), time.Now())
+	if err != nil {
+		l.WithError(err).Error("Could not record job result")
+	}
+}
+
+// Returns the ID the jobs of this instance are owned by
+func (s *Service) instanceID() string {
+	if s.elector == nil {
+		return ""
+	}
+	return s.elector.ID
+}
+
+// Keeps the heartbeat of the jobs of this instance and, on the leader, takes over the jobs
+// of instances whose heartbeat has stopped, e.g. because they died.
+type jobWatcher struct {
+	Service    *Service
+	Interval   time.Duration //how often heartbeats are refreshed and orphaned jobs are searched
+	StaleAfter time.Duration //jobs without a heartbeat for this long are taken over
+
+	draining atomic.Bool
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func (s *Service) startJobWatcher() {
+	w := &jobWatcher{
+		Service:    s,
+		Interval:   s.elector.Config.RenewInterval,
+		StaleAfter: s.elector.Config.LeaseDuration,
+		stop:       make(chan struct{}),
+	}
+	w.stopped.Add(1)
+	go func() {
+		defer w.stopped.Done()
+		ticker := time.NewTicker(w.Interval)
+		defer ticker.Stop()
+		for {
+			w.check(time.Now())
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	s.jobWatcher = w
+}
+
+// Stops taking over jobs, the heartbeat is kept until Stop so that the running jobs are
+// not taken over while they are drained.
+func (w *jobWatcher) Drain() {
+	w.draining.Store(true)
+}
+
+func (w *jobWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	w.stopped.Wait()
+}
+
+func (w *jobWatcher) check(now time.Time) {
+
+	sess, err := w.Service.getJobState().NewSession()
+	if err != nil {
+		log.WithError(err).Error("Could not open jobs")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	err = sess.TouchJobs(w.Service.instanceID(), now)
+	if err != nil {
+		log.WithError(err).Error("Could not refresh heartbeat of jobs")
+	}
+
+	//only the leader takes over jobs, so that instances do not race for them
+	if w.draining.Load() || !w.Service.isLeader() {
+		return
+	}
+	err = w.Service.resumeOrphanedJobs(sess, now.Add(-w.StaleAfter), now)
+	if err != nil {
+		log.WithError(err).Error("Could not resume orphaned jobs")
+	}
+
+}
+
+// Takes over the jobs of instances whose heartbeat is older than staleBefore. Queued jobs
+// are re-run, jobs which were interrupted in the middle of the ACME flow cannot be resumed
+// and are marked as failed.
+func (s *Service) resumeOrphanedJobs(sess jobs.JobStateManagerSession, staleBefore, now time.Time) error {
+
+	orphaned, err := sess.ListOrphanedJobs(staleBefore)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range orphaned {
+		l := log.WithFields(logrus.Fields{"jobID": job.ID, "owner": job.Owner})
+
+		ok, err := sess.TakeOverJob(job.ID, job.Owner, s.instanceID(), staleBefore, now)
+		if err != nil {
+			l.WithError(err).Error("Could not take over job")
+			continue
+		}
+		if !ok {
+			//another instance was faster or the owner is alive again
+			continue
+		}
+
+		//renewal runs are not resumed as a whole, the leader resumes their renewal jobs
+		if job.Type != jobs.TypeClaim || job.Status != jobs.StatusQueued {
+			l.Warn("Job has been interrupted because its instance stopped, marking as failed")
+			s.addJobStep(job.ID, jobs.StatusFailed, errors.New("job has been interrupted because its instance stopped"))
+			continue
+		}
+
+		cinfo := &apiv1.CertClaimInfo{}
+		err = json.Unmarshal([]byte(job.Request), cinfo)
+		if err != nil {
+			s.addJobStep(job.ID, jobs.StatusFailed, err)
+			continue
+		}
+		authz, err := s.resumedJobAuthzInfo(&job, cinfo, now)
+		if err != nil {
+			l.WithError(err).Warn("Authorization of queued job of a stopped instance does not hold anymore, marking as failed")
+			s.addJobStep(job.ID, jobs.StatusFailed, err)
+			continue
+		}
+		l.Info("Resuming queued job of a stopped instance")
+		s.runClaimJob(context.Background(), job.ID, job.CAID, cinfo, authz)
+	}
+
+	return nil
+
+}
+
+// Checks the restrictions recorded with the job again and returns the authorization to resume
+// it with. The domains have been checked when the job was created, the token it has been
+// created with must still be valid.
+func (s *Service) resumedJobAuthzInfo(job *jobs.Job, cinfo *apiv1.CertClaimInfo, now time.Time) (authtypes.AuthorizationInfo, error) {
+
+	ja := job.Authz
+	if ja == nil {
+		return nil, errors.New("job has been stored without its authorization, cannot check it again")
+	}
+	if ja.Delegated {
+		if !ja.Expiry.IsZero() && !now.Before(ja.Expiry) {
+			return nil, &common.UnauthzedError{Msg: "token or certificate the job has been created with has expired"}
+		}
+		if !ja.NotBefore.IsZero() && now.Before(ja.NotBefore) {
+			return nil, &common.UnauthzedError{Msg: "token or certificate the job has been created with is not valid yet"}
+		}
+	}
+	if ja.TokenID != "" {
+		err := s.chkTokenExists(ja.TokenID, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	authz := &authtypes.DefaultAuthorizationInfo{
+		UserInfo:       job.CreatedBy,
+		DomainsAllowed: claimDomains(cinfo),
+		WriteAllowed:   true,
+		ReadAllowed:    true,
+		Scopes:         ja.Scopes,
+		CAsAllowed:     ja.CAsAllowed,
+	}
+	if ja.Delegated {
+		authz.Delegation = &authtypes.Delegation{TokenID: ja.TokenID, NotBefore: ja.NotBefore, Expiry: ja.Expiry}
+	}
+	err := chkAuthCertOp(authz, authtypes.ScopeClaim, job.CAID)
+	if err != nil {
+		return nil, err
+	}
+	return authz, nil
+
+}
+
+// Returns an error if the token from the DB has been revoked or has expired
+func (s *Service) chkTokenExists(id string, now time.Time) error {
+	state, err := s.getTokenState()
+	if err != nil {
+		return err
+	}
+	sess, err := state.NewSession()
+	if err != nil {
+		return err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	tkn, err := sess.GetToken(id)
+	if err != nil {
+		return err
+	}
+	if tkn == nil || tkn.Expired(now) {
+		return &common.UnauthzedError{Msg: "token the job has been created with has been revoked or has expired"}
+	}
+	return nil
+}
+
+func apiJobInfoFromJob(job *jobs.Job) *apiv1.JobInfo {
+	res := &apiv1.JobInfo{
+		ID:      job.ID,
+		Type:    job.Type,
+		CAID:    job.CAID,
+		Name:    job.Name,
+		Status:  string(job.Status),
+		Error:   job.Error,
+		Created: job.CreatedTime.Format(time.RFC3339),
+		Updated: job.UpdatedTime.Format(time.RFC3339),
+		Steps:   make([]apiv1.JobStep, len(job.Steps)),
+	}
+	for i, step := range job.Steps {
+		res.Steps[i] = apiv1.JobStep{
+			Status: string(step.Status),
+			Time:   step.Time.Format(time.RFC3339),
+			Error:  step.Error,
+		}
+	}
+	if job.Result != "" {
+		res.Result = json.RawMessage(job.Result)
+	}
+	return res
+}
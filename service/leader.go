@@ -0,0 +1,60 @@
+package service
+
+import (
+	"github.com/creasty/defaults"
+	"github.com/dns3l/dns3l-core/leader"
+)
+
+// Instances running on the same DB elect a leader which runs the renewals and the other
+// background work on the shared state, e.g. webhook delivery, so these can be enabled on
+// every replica.
+func (s *Service) startElector() error {
+
+	conf := s.Config.Leader
+	if conf == nil {
+		conf = &leader.Config{}
+		err := defaults.Set(conf)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.elector = &leader.Elector{
+		Config: conf,
+		State:  &leader.LeaseStateManagerSQL{Prov: s.Config.DB},
+	}
+	err := s.elector.Init()
+	if err != nil {
+		return err
+	}
+	s.elector.Start()
+	log.WithField("id", s.elector.ID).Info("Started leader election.")
+	return nil
+
+}
+
+// Whether this instance runs the background work on the shared state
+func (s *Service) isLeader() bool {
+	return s.elector == nil || s.elector.IsLeader()
+}
+
+// Returns the running elector, or one which does not campaign for leadership but can
+// still hold leases, e.g. when running outside of the daemon.
+func (s *Service) getElector() (*leader.Elector, error) {
+	if s.elector != nil {
+		return s.elector, nil
+	}
+	conf := s.Config.Leader
+	if conf == nil {
+		conf = &leader.Config{}
+		err := defaults.Set(conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	e := &leader.Elector{
+		Config: conf,
+		State:  &leader.LeaseStateManagerSQL{Prov: s.Config.DB},
+	}
+	return e, e.Init()
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"time"
+
+	"github.com/dns3l/dns3l-core/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type MetricsConfig struct {
+	//Certificates expiring within this duration are reported with state "expiring"
+	ExpiringWithin time.Duration `yaml:"expiringWithin" default:"168h"`
+}
+
+var (
+	certsDesc = prometheus.NewDesc("dns3l_certificates",
+		"Number of certificates by CA, root zone and state (valid, expiring or expired).",
+		[]string{"ca", "rtzn", "state"}, nil)
+	renewLastRunDesc = prometheus.NewDesc("dns3l_renewal_last_run_timestamp_seconds",
+		"Time when the last renewal run finished.", nil, nil)
+	renewSuccessfulDesc = prometheus.NewDesc("dns3l_renewal_last_run_successful",
+		"Number of successful renewals in the last renewal run.", nil, nil)
+	renewFailedDesc = prometheus.NewDesc("dns3l_renewal_last_run_failed",
+		"Number of failed renewals in the last renewal run.", nil, nil)
+)
+
+// Collects the metrics which are taken from the state on every scrape
+type stateCollector struct {
+	s *Service
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- certsDesc
+	ch <- renewLastRunDesc
+	ch <- renewSuccessfulDesc
+	ch <- renewFailedDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+
+	conf := c.s.config()
+	fu := conf.CA.Functions
+
+	expiringWithin := 7 * 24 * time.Hour
+	if conf.Metrics != nil && conf.Metrics.ExpiringWithin > 0 {
+		expiringWithin = conf.Metrics.ExpiringWithin
+	}
+
+	counts, err := fu.GetCertStateCounts(expiringWithin)
+	if err != nil {
+		log.WithError(err).Error("Could not collect certificate metrics")
+		ch <- prometheus.NewInvalidMetric(certsDesc, err)
+	}
+	for _, cnt := range counts {
+		ch <- prometheus.MustNewConstMetric(certsDesc, prometheus.GaugeValue, float64(cnt.Count),
+			cnt.CAID, cnt.RootZone, cnt.State)
+	}
+
+	renewal, err := fu.GetLastRenewSummary()
+	if err != nil {
+		log.WithError(err).Error("Could not collect renewal metrics")
+		ch <- prometheus.NewInvalidMetric(renewLastRunDesc, err)
+		return
+	}
+	if renewal == nil {
+		return
+	}
+	if renewal.LastRun != nil {
+		ch <- prometheus.MustNewConstMetric(renewLastRunDesc, prometheus.GaugeValue,
+			float64(renewal.LastRun.Unix()))
+	}
+	ch <- prometheus.MustNewConstMetric(renewSuccessfulDesc, prometheus.GaugeValue, float64(renewal.Successful))
+	ch <- prometheus.MustNewConstMetric(renewFailedDesc, prometheus.GaugeValue, float64(renewal.Failed))
+
+}
+
+func (s *Service) registerStateMetrics() {
+	if s.stateCollector != nil {
+		metrics.Registry.Unregister(s.stateCollector)
+	}
+	s.stateCollector = &stateCollector{s: s}
+	err := metrics.Registry.Register(s.stateCollector)
+	if err != nil {
+		log.WithError(err).Error("Could not register state metrics")
+	}
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/dns3l/dns3l-core/ca"
+	"github.com/dns3l/dns3l-core/service/auth"
+	"github.com/dns3l/dns3l-core/service/auth/types"
+	"gopkg.in/yaml.v2"
+)
+
+// Sections of the config which are swapped on reload, changes to all others need a restart
+var reloadableSections = []string{"dns", "ca.providers", "rtzn", "auth"}
+
+// Returns the active config. Since it is swapped on reload, requests and renewals should
+// get it once and keep it until they are done.
+func (s *Service) config() *Config {
+	if c := s.current.Load(); c != nil {
+		return c
+	}
+	return s.Config
+}
+
+// Reload reads the config file again and swaps the CA providers, DNS providers, root zones,
+// tokens and OIDC bindings. Requests and renewals already running keep the config they
+// started with. If the new config is invalid, the old one stays active.
+func (s *Service) Reload(file string) error {
+
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+
+	old := s.config()
+	conf := &Config{}
+	err := conf.FromFile(file)
+	if conf.raw == nil {
+		log.WithError(err).Error("Could not read config file, keeping the old config")
+		return err
+	}
+
+	l := log.WithField("file", file)
+	changes, diffErr := diffConfig(old.raw, conf.raw)
+	if diffErr == nil {
+		l = l.WithField("changes", strings.Join(changes, ", "))
+	}
+
+	if err == nil {
+		err = s.applyConfig(old, conf)
+	}
+	if err != nil {
+		l.WithError(err).Error("Config reload failed, keeping the old config")
+		return err
+	}
+
+	if len(changes) == 0 {
+		l.Info("Config reloaded without changes")
+	} else {
+		l.Info("Config reloaded")
+	}
+	return nil
+
+}
+
+// Initializes conf and makes it the active config. The sections which cannot be reloaded
+// are taken over from old, as are the CA work queue and event emitters.
+func (s *Service) applyConfig(old, conf *Config) error {
+
+	conf.DB = old.DB
+	conf.URL = old.URL
+	conf.AdminEMail = old.AdminEMail
+	conf.Bootstrap = old.Bootstrap
+	conf.Renew = old.Renew
+	conf.Events = old.Events
+	conf.Notify = old.Notify
+	conf.Metrics = old.Metrics
+	conf.Tracing = old.Tracing
+	conf.Audit = old.Audit
+	conf.Leader = old.Leader
+	conf.Shutdown = old.Shutdown
+	conf.TLS = old.TLS
+	if conf.CA != nil && old.CA != nil {
+		conf.CA.Queue = old.CA.Queue
+		if old.CA.Functions != nil {
+			conf.CA.Functions = &ca.CAFunctionHandler{
+				Queue:  old.CA.Functions.Queue,
+				Events: old.CA.Functions.Events,
+			}
+		}
+	}
+
+	err := conf.Initialize()
+	if err != nil {
+		return err
+	}
+	err = conf.Auth.Init()
+	if err != nil {
+		return err
+	}
+
+	s.current.Store(conf)
+	s.readiness.Invalidate()
+	return nil
+
+}
+
+// Returns the paths which differ between two YAML configs, e.g. "rtzn[foo.example.com.]: added".
+// Values are left out since they might be secrets.
+func diffConfig(oldRaw, newRaw []byte) ([]string, error) {
+
+	var o, n interface{}
+	err := yaml.Unmarshal(oldRaw, &o)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(newRaw, &n)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]string, 0)
+	diffYAML("", o, n, func(path, change string) {
+		if path == "" {
+			path = "config"
+		}
+		if !isReloadable(path) {
+			change += " (needs restart)"
+		}
+		changes = append(changes, path+": "+change)
+	})
+	return changes, nil
+
+}
+
+func diffYAML(path string, o, n interface{}, report func(path, change string)) {
+
+	switch {
+	case o == nil && n == nil:
+		return
+	case o == nil:
+		report(path, "added")
+		return
+	case n == nil:
+		report(path, "removed")
+		return
+	}
+
+	om, oIsMap := yamlChildren(o)
+	nm, nIsMap := yamlChildren(n)
+	if !oIsMap || !nIsMap {
+		if !reflect.DeepEqual(o, n) {
+			report(path, "changed")
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(om)+len(nm))
+	for k := range om {
+		keys = append(keys, k)
+	}
+	for k := range nm {
+		if _, exists := om[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		diffYAML(strings.TrimPrefix(path+k, "."), om[k], nm[k], report)
+	}
+
+}
+
+// Returns the children of a YAML map by ".key", and of a list of root zones or tokens
+// by "[root]" or "[name]", so that entries can be added and removed without affecting
+// the others.
+func yamlChildren(v interface{}) (map[string]interface{}, bool) {
+
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			res[fmt.Sprintf(".%v", k)] = val
+		}
+		return res, true
+	case []interface{}:
+		res := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			m, ok := elem.(map[interface{}]interface{})
+			if !ok {
+				return nil, false
+			}
+			key, ok := m["root"]
+			if !ok {
+				key, ok = m["name"]
+			}
+			if !ok {
+				return nil, false
+			}
+			res[fmt.Sprintf("[%v]", key)] = elem
+		}
+		return res, len(res) == len(v)
+	}
+	return nil, false
+
+}
+
+func isReloadable(path string) bool {
+	for _, sect := range reloadableSections {
+		if path == sect || strings.HasPrefix(path, sect+".") || strings.HasPrefix(path, sect+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticates with the auth config active at the time of the request
+type reloadableAuth struct {
+	s *Service
+}
+
+var _ auth.RESTAPIAuthProvider = &reloadableAuth{}
+
+func (a *reloadableAuth) Init() error {
+	return a.s.config().Auth.Init()
+}
+
+func (a *reloadableAuth) AuthnGetAuthzInfo(r *http.Request) (types.AuthorizationInfo, error) {
+	return a.s.config().Auth.AuthnGetAuthzInfo(r)
+}
+
+func (a *reloadableAuth) GetServerInfoAuth() auth.ServerInfoAuth {
+	return a.s.config().Auth.GetServerInfoAuth()
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const reloadTestConfig = `
+url: https://dns3l.example.com
+adminemail: [admin@example.com]
+dns:
+  providers:
+    bog:
+      type: bogus
+      name: Bogus DNS
+ca:
+  providers:
+    bog:
+      type: bogus
+      name: Bogus CA
+      catype: private
+      url: https://ca.example.com
+      logopath: https://ca.example.com/logo.png
+rtzn:
+  - root: foo.example.com.
+    autodns: bog
+    acmedns: bog
+    ca: ['*']
+db:
+  type: mysql
+  url: user:password@tcp(127.0.0.1)/dns3ld?parseTime=true
+auth:
+  authn_disabled: true
+  authn_disabled_email: foo@example.com
+  tokens:
+    static:
+      - name: deploy
+        sha256: old-hash
+`
+
+func TestDiffConfig(t *testing.T) {
+	changed := strings.NewReplacer(
+		"old-hash", "new-hash",
+		"    ca: ['*']\n", "    ca: ['*']\n  - root: bar.example.com.\n    autodns: bog\n    acmedns: bog\n    ca: [bog]\n",
+		"127.0.0.1", "10.0.0.1",
+	).Replace(reloadTestConfig)
+
+	changes, err := diffConfig([]byte(reloadTestConfig), []byte(changed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"auth.tokens.static[deploy].sha256: changed",
+		"db.url: changed (needs restart)",
+		"rtzn[bar.example.com.]: added",
+	}
+	if !slices.Equal(changes, expected) {
+		t.Fatalf("expected %v, got %v", expected, changes)
+	}
+}
+
+func TestReloadSwapsOrKeepsConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConf := func(conf string) {
+		err := os.WriteFile(file, []byte(conf), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConf(reloadTestConfig)
+	s := &Service{Config: &Config{}}
+	err := s.Config.FromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Config.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := s.config()
+	inFlight := initial.RootZones
+
+	writeConf(strings.Replace(reloadTestConfig, "foo.example.com.", "bar.example.com.", 1))
+	err = s.Reload(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := s.config()
+	if reloaded == initial || reloaded.RootZones[0].Root != "bar.example.com." {
+		t.Fatalf("expected new root zone to be active, got %s", reloaded.RootZones[0].Root)
+	}
+	if inFlight[0].Root != "foo.example.com." {
+		t.Error("expected the old config to stay intact for running requests")
+	}
+	if reloaded.DB != initial.DB || reloaded.CA.Functions.Queue != initial.CA.Functions.Queue {
+		t.Error("expected DB and work queue to be taken over")
+	}
+
+	//unknown CA in root zone
+	writeConf(strings.Replace(reloadTestConfig, "ca: ['*']", "ca: [nonexistent]", 1))
+	err = s.Reload(file)
+	if err == nil {
+		t.Fatal("expected reload of invalid config to fail")
+	}
+	if s.config() != reloaded {
+		t.Error("expected the old config to stay active after failed reload")
+	}
+}
@@ -1,36 +1,59 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/creasty/defaults"
 	catypes "github.com/dns3l/dns3l-core/ca/types"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/events"
+	"github.com/dns3l/dns3l-core/leader"
 	"github.com/dns3l/dns3l-core/renew"
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
 )
 
+const retryBatchSize = 100
+
 type RenewConfig struct {
-	JobStartTime         string        `yaml:"jobStartTime" validate:"required"`
-	MaxDuration          time.Duration `yaml:"maxDuration"`
-	LimitPerDay          uint          `yaml:"limitPerDay"`
-	DaysWarnBeforeExpiry uint          `yaml:"daysWarnBeforeExpiry"`
+	JobStartTime         string             `yaml:"jobStartTime" validate:"required"`
+	MaxDuration          time.Duration      `yaml:"maxDuration"`
+	LimitPerDay          uint               `yaml:"limitPerDay"`
+	DaysWarnBeforeExpiry uint               `yaml:"daysWarnBeforeExpiry"`
+	Retry                *renew.RetryConfig `yaml:"retry"`
+	JobRetention         time.Duration      `yaml:"jobRetention" default:"720h"` //renewal jobs older than this are deleted
 }
 
 type Renewer struct {
 	Service *Service
 	Config  *RenewConfig
 	sched   *renew.Scheduler[catypes.CertificateRenewInfo, *catypes.CertificateRenewInfo]
+
+	retry   *renew.RetryConfig
+	retries renew.RetryStateManager
+	jobs    renew.JobStateManager
+
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	stopOnce sync.Once
 }
 
 func (r *Renewer) WarnForExpiringCerts() {
 	warnAt := time.Now().Add(
 		time.Duration(r.Config.DaysWarnBeforeExpiry*24) * time.Hour)
 
-	warnCerts, err := r.Service.Config.CA.Functions.ListExpiring(warnAt, r.Config.LimitPerDay)
+	conf := r.Service.config()
+	warnCerts, err := conf.CA.Functions.ListExpiring(warnAt, r.Config.LimitPerDay)
 	if err != nil {
 		log.WithError(err).Error("Could not collect expiring certs to warn about expiry.")
 		return
 	}
 	for _, cert := range warnCerts {
 		log.WithField("cert", cert).Warn("Certificate is about to expire soon")
+		conf.CA.Functions.EmitCertEvent(events.TypeExpiringSoon, cert.CAID, cert.CertKey, nil, nil)
 	}
 	if len(warnCerts) <= 0 {
 		return
@@ -47,6 +70,18 @@ func (r *Renewer) WarnForExpiringCerts() {
 
 func (r *Renewer) Init() error {
 
+	r.retry = r.Config.Retry
+	if r.retry == nil {
+		r.retry = &renew.RetryConfig{}
+		err := defaults.Set(r.retry)
+		if err != nil {
+			return err
+		}
+	}
+	r.retries = &renew.RetryStateManagerSQL{Prov: r.Service.Config.DB}
+	r.jobs = &renew.JobStateManagerSQL{Prov: r.Service.Config.DB}
+	r.stop = make(chan struct{})
+
 	r.sched = &renew.Scheduler[catypes.CertificateRenewInfo, *catypes.CertificateRenewInfo]{
 		JobStartTime: r.Config.JobStartTime,
 		MaxDuration:  r.Config.MaxDuration,
@@ -54,15 +89,23 @@ func (r *Renewer) Init() error {
 
 			r.WarnForExpiringCerts()
 
-			return r.Service.Config.CA.Functions.ListCertsToRenew(r.Config.LimitPerDay)
+			certs, err := r.Service.config().CA.Functions.ListCertsToRenew(r.Config.LimitPerDay)
+			if err != nil {
+				return nil, err
+			}
+			r.enqueueJobs(certs, renew.TriggerScheduled, r.Service.instanceID(), time.Now())
+			return certs, nil
 		},
 		JobExecFunc: func(job *catypes.CertificateRenewInfo) error {
-
-			return r.Service.Config.CA.Functions.RenewCertificate(job)
-
+			if !r.isLeader() {
+				//the new leader resumes the job
+				return errors.New("instance is not the leader anymore")
+			}
+			return r.renewTracked(job, renew.TriggerScheduled, r.Service.instanceID())
 		},
+		ShouldRunFunc: r.isLeader,
 		ReportFunc: func(_, end time.Time, success, fail uint) {
-			err := r.Service.Config.CA.Functions.PutLastRenewSummary(
+			err := r.Service.config().CA.Functions.PutLastRenewSummary(
 				&renew.ServerInfoRenewal{
 					LastRun:    &end,
 					Successful: success,
@@ -71,6 +114,10 @@ func (r *Renewer) Init() error {
 			if err != nil {
 				log.WithError(err).Error("Error occurred putting last renew summary to store.")
 			}
+			if r.Service.notifier != nil {
+				//send expiry warnings and failed renewals right away instead of waiting for the next flush
+				r.Service.notifier.Flush(time.Now())
+			}
 		},
 	}
 
@@ -78,5 +125,469 @@ func (r *Renewer) Init() error {
 }
 
 func (r *Renewer) StartAsync() error {
-	return r.sched.StartAsync()
+	err := r.sched.StartAsync()
+	if err != nil {
+		return err
+	}
+
+	pollInterval := r.retry.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = time.Minute
+	}
+
+	r.stopped.Add(1)
+	go func() {
+		defer r.stopped.Done()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.ResumeOrphanedJobs()
+				r.RetryDue(time.Now())
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stops scheduling renewals and retrying failed ones, renewals which are already running
+// are not awaited.
+func (r *Renewer) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	r.sched.Stop()
+}
+
+// Waits until the retries have stopped.
+func (r *Renewer) Wait() {
+	r.stopped.Wait()
+}
+
+func (r *Renewer) isLeader() bool {
+	//every instance runs the renewer, but only the leader renews
+	return r.Service.isLeader()
+}
+
+// Persists a pending renewal job owned by the given instance for each certificate and sets
+// its JobID. If the instance dies, the leader resumes the unfinished jobs.
+func (r *Renewer) enqueueJobs(certs []catypes.CertificateRenewInfo, trigger renew.JobTrigger, owner string,
+	now time.Time) {
+
+	sess, err := r.jobs.NewSession()
+	if err != nil {
+		log.WithError(err).Error("Could not open renewal jobs, renewing without tracking")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	if trigger == renew.TriggerScheduled {
+		r.cleanupJobs(sess, now)
+	}
+
+	for i := range certs {
+		job := &renew.Job{
+			CAID:        certs[i].CAID,
+			CertKey:     certs[i].CertKey,
+			Status:      renew.JobPending,
+			Trigger:     trigger,
+			Owner:       owner,
+			CreatedTime: now,
+		}
+		err := sess.PutRenewalJob(job)
+		if err != nil {
+			log.WithError(err).WithField("cert", certs[i].String()).Error("Could not store renewal job")
+			continue
+		}
+		certs[i].JobID = job.ID
+	}
+
+}
+
+func (r *Renewer) cleanupJobs(sess renew.JobStateManagerSession, now time.Time) {
+
+	if r.Config.JobRetention > 0 {
+		deleted, err := sess.DelRenewalJobsBefore(now.Add(-r.Config.JobRetention))
+		if err != nil {
+			log.WithError(err).Error("Could not delete old renewal jobs")
+		} else if deleted > 0 {
+			log.WithField("numJobs", deleted).Info("Deleted renewal jobs older than the retention period")
+		}
+	}
+
+}
+
+// Returns the instances which may be running renewal jobs: this one, the leader running the
+// scheduled renewals and retries, and the one running a manually triggered renewal run.
+func (r *Renewer) liveJobOwners() ([]string, error) {
+	elector, err := r.Service.getElector()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := []string{r.Service.instanceID()}
+	for _, lease := range []string{leader.LeaseLeader, leader.LeaseRenewRun} {
+		holder, err := elector.Holder(lease)
+		if err != nil {
+			return nil, err
+		}
+		if holder != "" {
+			owners = append(owners, holder)
+		}
+	}
+	return owners, nil
+}
+
+// Renews the certificate and tracks the renewal job and failed attempts, so that the
+// renewal is retried with backoff instead of waiting for the next day.
+func (r *Renewer) renewTracked(job *catypes.CertificateRenewInfo, trigger renew.JobTrigger, owner string) error {
+	r.Service.jobsRunning.Add(1)
+	defer r.Service.jobsRunning.Done()
+	job.Ctx = r.Service.jobContext()
+
+	rjob := r.startJob(job, trigger, owner)
+
+	var busy *common.AlreadyExistsError
+	err := r.Service.renewExclusive(job.CAID, job.CertKey, func() error {
+		return r.Service.config().CA.Functions.RenewCertificate(job)
+	})
+	if errors.As(err, &busy) {
+		//not a failure of the certificate, the other renewal tracks the result
+		r.finishJob(rjob, errors.New("certificate is being renewed by another job"))
+		return err
+	}
+
+	resultErr := err
+	var norenew *common.NoRenewalDueError
+	if errors.As(err, &norenew) {
+		resultErr = nil
+	}
+	r.trackResult(job.CAID, job.CertKey, resultErr, time.Now())
+	r.finishJob(rjob, resultErr)
+
+	return err
+}
+
+// Runs the renewal f of the certificate while holding a lease for it, so that scheduled,
+// retried and manual renewals on any instance do not renew it at the same time. Returns an
+// AlreadyExistsError if the certificate is being renewed already.
+func (s *Service) renewExclusive(caID, certKey string, f func() error) error {
+	elector, err := s.getElector()
+	if err != nil {
+		return err
+	}
+	ran, err := elector.TryRunExclusive(leader.LeaseRenewCert(caID, certKey), f)
+	if err != nil {
+		return err
+	}
+	if !ran {
+		return &common.AlreadyExistsError{RequestedResource: "renewal of " + certKey}
+	}
+	return nil
+}
+
+// Marks the renewal job as running, creates it if it has not been enqueued before.
+// Returns nil if the job could not be stored.
+func (r *Renewer) startJob(job *catypes.CertificateRenewInfo, trigger renew.JobTrigger, owner string) *renew.Job {
+	l := log.WithField("cert", job.String())
+	now := time.Now()
+
+	rjob := &renew.Job{
+		ID:          job.JobID,
+		CAID:        job.CAID,
+		CertKey:     job.CertKey,
+		Status:      renew.JobRunning,
+		Trigger:     trigger,
+		Owner:       owner,
+		Attempt:     1,
+		CreatedTime: now,
+		StartTime:   now,
+	}
+
+	retrySess, err := r.retries.NewSession()
+	if err != nil {
+		l.WithError(err).Error("Could not open renewal retry state")
+	} else {
+		defer util.LogDefer(log, retrySess.Close)
+		prev, err := retrySess.GetRenewRetry(job.CAID, job.CertKey)
+		if err != nil {
+			l.WithError(err).Error("Could not get failed renewals")
+		} else if prev != nil {
+			rjob.Attempt = prev.Failures + 1
+		}
+	}
+
+	sess, err := r.jobs.NewSession()
+	if err != nil {
+		l.WithError(err).Error("Could not open renewal jobs")
+		return nil
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	if rjob.ID == 0 {
+		err = sess.PutRenewalJob(rjob)
+	} else {
+		err = sess.UpdRenewalJob(rjob)
+	}
+	if err != nil {
+		l.WithError(err).Error("Could not store renewal job")
+		return nil
+	}
+	return rjob
+}
+
+func (r *Renewer) finishJob(rjob *renew.Job, renewErr error) {
+	if rjob == nil {
+		return
+	}
+
+	rjob.EndTime = time.Now()
+	rjob.Status = renew.JobSucceeded
+	if renewErr != nil {
+		rjob.Status = renew.JobFailed
+		rjob.Error = renewErr.Error()
+	}
+
+	sess, err := r.jobs.NewSession()
+	if err != nil {
+		log.WithError(err).Error("Could not open renewal jobs")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	err = sess.UpdRenewalJob(rjob)
+	if err != nil {
+		log.WithError(err).WithField("jobID", rjob.ID).Error("Could not update renewal job")
+	}
+}
+
+func (r *Renewer) trackResult(caID, certKey string, renewErr error, now time.Time) {
+	l := log.WithFields(logrus.Fields{"caID": caID, "certKey": certKey})
+
+	sess, err := r.retries.NewSession()
+	if err != nil {
+		l.WithError(err).Error("Could not open renewal retry state")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	if renewErr == nil {
+		err = sess.DelRenewRetry(caID, certKey)
+		if err != nil {
+			l.WithError(err).Error("Could not reset failed renewals")
+		}
+		return
+	}
+
+	prev, err := sess.GetRenewRetry(caID, certKey)
+	if err != nil {
+		l.WithError(err).Error("Could not get failed renewals")
+		return
+	}
+
+	info := &renew.RetryInfo{
+		CAID:            caID,
+		CertKey:         certKey,
+		Failures:        1,
+		LastError:       renewErr.Error(),
+		LastFailureTime: now,
+	}
+	if prev != nil {
+		info.Failures = prev.Failures + 1
+	}
+
+	next, retry := r.retry.NextRetry(info.Failures, now)
+	if retry {
+		info.NextRetryTime = next
+		l.WithField("failures", info.Failures).WithField("nextRetry", next).Warn("Renewal failed, will retry")
+	} else if info.Failures == r.retry.MaxAttempts {
+		//escalate once, the daily renewal keeps trying
+		l.WithField("failures", info.Failures).Error("Renewal failed too often, giving up retrying")
+		r.Service.config().CA.Functions.EmitCertEvent(events.TypeExpiringSoon, caID, certKey, nil,
+			fmt.Errorf("renewal failed %d times: %w", info.Failures, renewErr))
+	}
+
+	err = sess.PutRenewRetry(info)
+	if err != nil {
+		l.WithError(err).Error("Could not store failed renewal")
+	}
+}
+
+// RetryDue retries the failed renewals which are due at the given time.
+func (r *Renewer) RetryDue(now time.Time) {
+	if !r.isLeader() {
+		return
+	}
+
+	sess, err := r.retries.NewSession()
+	if err != nil {
+		log.WithError(err).Error("Could not open renewal retry state")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	due, err := sess.ListDueRenewRetries(now, retryBatchSize)
+	if err != nil {
+		log.WithError(err).Error("Could not list due renewal retries")
+		return
+	}
+	if len(due) <= 0 {
+		return
+	}
+
+	jobSess, err := r.jobs.NewSession()
+	if err != nil {
+		log.WithError(err).Error("Could not open renewal jobs")
+		return
+	}
+	defer util.LogDefer(log, jobSess.Close)
+
+	for _, retry := range due {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		l := log.WithFields(logrus.Fields{"caID": retry.CAID, "certKey": retry.CertKey, "failures": retry.Failures})
+
+		//e.g. the scheduled run renews it right now or later on
+		unfinished, err := jobSess.HasUnfinishedRenewalJob(retry.CAID, retry.CertKey)
+		if err != nil {
+			l.WithError(err).Error("Could not check renewal jobs of certificate")
+			continue
+		}
+		if unfinished {
+			l.Debug("Certificate has an unfinished renewal job, not retrying")
+			continue
+		}
+
+		cinfo, err := r.Service.config().CA.Functions.GetCertificateInfo(retry.CAID, retry.CertKey)
+		if err != nil {
+			l.WithError(err).Error("Could not get certificate to retry renewal")
+			continue
+		}
+		if cinfo == nil {
+			//certificate has been deleted meanwhile
+			util.LogIfError(log, sess.DelRenewRetry(retry.CAID, retry.CertKey))
+			continue
+		}
+
+		l.Info("Retrying failed renewal")
+		err = r.renewTracked(&catypes.CertificateRenewInfo{
+			CAID:        retry.CAID,
+			CertKey:     retry.CertKey,
+			ExpiresAt:   cinfo.ValidEndTime,
+			NextRenewal: cinfo.NextRenewalTime,
+			TTLSelected: cinfo.TTLSelected,
+		}, renew.TriggerRetry, r.Service.instanceID())
+		if err == nil {
+			l.Info("Retried renewal succeeded")
+		}
+	}
+}
+
+// ResumeOrphanedJobs takes over the unfinished renewal jobs of instances which stopped, e.g.
+// because they died in the middle of a renewal run, and runs them.
+func (r *Renewer) ResumeOrphanedJobs() {
+	if !r.isLeader() {
+		return
+	}
+
+	liveOwners, err := r.liveJobOwners()
+	if err != nil {
+		log.WithError(err).Error("Could not determine the instances running renewals")
+		return
+	}
+
+	sess, err := r.jobs.NewSession()
+	if err != nil {
+		log.WithError(err).Error("Could not open renewal jobs")
+		return
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	orphaned, err := sess.ListOrphanedRenewalJobs(liveOwners, retryBatchSize)
+	if err != nil {
+		log.WithError(err).Error("Could not list orphaned renewal jobs")
+		return
+	}
+
+	owner := r.Service.instanceID()
+	for _, job := range orphaned {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		l := log.WithFields(logrus.Fields{"jobID": job.ID, "caID": job.CAID, "certKey": job.CertKey,
+			"owner": job.Owner})
+
+		ok, err := sess.TakeOverRenewalJob(job.ID, job.Owner, owner)
+		if err != nil {
+			l.WithError(err).Error("Could not take over renewal job")
+			continue
+		}
+		if !ok {
+			//another instance was faster or the job has finished meanwhile
+			continue
+		}
+
+		cinfo, err := r.Service.config().CA.Functions.GetCertificateInfo(job.CAID, job.CertKey)
+		if err != nil {
+			l.WithError(err).Error("Could not get certificate to resume renewal")
+			continue
+		}
+		if cinfo == nil {
+			job.Owner = owner
+			r.finishJob(&job, errors.New("certificate has been deleted"))
+			continue
+		}
+
+		l.Info("Resuming renewal job of a stopped instance")
+		err = r.renewTracked(&catypes.CertificateRenewInfo{
+			CAID:        job.CAID,
+			CertKey:     job.CertKey,
+			ExpiresAt:   cinfo.ValidEndTime,
+			NextRenewal: cinfo.NextRenewalTime,
+			TTLSelected: cinfo.TTLSelected,
+			JobID:       job.ID,
+		}, job.Trigger, owner)
+		if err == nil {
+			l.Info("Resumed renewal job succeeded")
+		}
+	}
+}
+
+// Returns the failed renewals of the certificates of a CA by their key name
+func (s *Service) listRenewRetries(caID string) (map[string]renew.RetryInfo, error) {
+	sess, err := (&renew.RetryStateManagerSQL{Prov: s.Config.DB}).NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	retries, err := sess.ListRenewRetries(caID)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]renew.RetryInfo, len(retries))
+	for _, retry := range retries {
+		res[retry.CertKey] = retry
+	}
+	return res, nil
+}
+
+// Returns nil if the certificate has no failed renewals
+func (s *Service) getRenewRetry(caID, certKey string) (*renew.RetryInfo, error) {
+	sess, err := (&renew.RetryStateManagerSQL{Prov: s.Config.DB}).NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	return sess.GetRenewRetry(caID, certKey)
 }
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/creasty/defaults"
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	catypes "github.com/dns3l/dns3l-core/ca/types"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/dns"
+	"github.com/dns3l/dns3l-core/jobs"
+	"github.com/dns3l/dns3l-core/leader"
+	"github.com/dns3l/dns3l-core/renew"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RenewRunPlanned   = "planned"   //dry run, would be renewed
+	RenewRunSucceeded = "succeeded" //renewed
+	RenewRunSkipped   = "skipped"   //no renewal is due or the cert is being renewed by another job
+	RenewRunFailed    = "failed"
+)
+
+// Selects the certificates of a manually triggered renewal run, empty fields do not filter
+type RenewalRunOptions struct {
+	CAID           string
+	RootZone       string
+	ExpiringBefore time.Time     //additionally renew certs expiring before this, even if not yet due
+	MaxDuration    time.Duration //spread the renewals over this duration, 0 renews all at once
+	DryRun         bool          //only report what would be renewed
+}
+
+// RunRenewals immediately renews the certificates which are due for renewal and match the
+// options, and reports the result. Only one run at a time is allowed across all instances.
+func (s *Service) RunRenewals(opts *RenewalRunOptions) (*apiv1.RenewalRunReport, error) {
+	return s.runRenewals(opts, nil)
+}
+
+// StartRenewalRun runs RunRenewals in the background and returns the job reporting its
+// progress. The report is stored as result of the job whenever a certificate is done.
+func (s *Service) StartRenewalRun(opts *RenewalRunOptions, createdBy *authtypes.UserInfo) (*jobs.Job, error) {
+
+	elector, err := s.getElector()
+	if err != nil {
+		return nil, err
+	}
+	//fail early, the run checks again when it starts
+	holder, err := elector.Holder(leader.LeaseRenewRun)
+	if err != nil {
+		return nil, err
+	}
+	if holder != "" {
+		return nil, &common.AlreadyExistsError{RequestedResource: "renewal run"}
+	}
+
+	id, err := jobs.NewJobID()
+	if err != nil {
+		return nil, err
+	}
+	job := &jobs.Job{
+		ID:          id,
+		Type:        jobs.TypeRenewalRun,
+		CAID:        opts.CAID,
+		CreatedBy:   createdBy,
+		Status:      jobs.StatusRunning,
+		Owner:       s.instanceID(),
+		CreatedTime: time.Now(),
+	}
+	job.Steps = []jobs.StepInfo{{Status: job.Status, Time: job.CreatedTime}}
+	job.UpdatedTime = job.CreatedTime
+
+	sess, err := s.getJobState().NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	err = sess.PutJob(job)
+	if err != nil {
+		return nil, err
+	}
+
+	s.jobsRunning.Add(1)
+	go func() {
+		defer s.jobsRunning.Done()
+
+		_, err := s.runRenewals(opts, func(report *apiv1.RenewalRunReport) {
+			s.putJobResult(job.ID, report)
+		})
+		if err != nil {
+			log.WithError(err).WithField("jobID", job.ID).Error("Renewal run failed")
+			s.addJobStep(job.ID, jobs.StatusFailed, err)
+			return
+		}
+		s.addJobStep(job.ID, jobs.StatusSucceeded, nil)
+	}()
+
+	return job, nil
+
+}
+
+// progress is called with the report whenever it has changed, may be nil
+func (s *Service) runRenewals(opts *RenewalRunOptions, progress func(*apiv1.RenewalRunReport)) (
+	*apiv1.RenewalRunReport, error) {
+
+	r, err := s.getRenewer()
+	if err != nil {
+		return nil, err
+	}
+	elector, err := s.getElector()
+	if err != nil {
+		return nil, err
+	}
+
+	var report *apiv1.RenewalRunReport
+	ran, err := elector.TryRunExclusive(leader.LeaseRenewRun, func() error {
+		var err error
+		report, err = r.runManual(opts, elector.ID, progress)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ran {
+		return nil, &common.AlreadyExistsError{RequestedResource: "renewal run"}
+	}
+	return report, nil
+
+}
+
+func (r *Renewer) runManual(opts *RenewalRunOptions, owner string,
+	progress func(*apiv1.RenewalRunReport)) (*apiv1.RenewalRunReport, error) {
+
+	if progress == nil {
+		progress = func(*apiv1.RenewalRunReport) {}
+	}
+
+	start := time.Now()
+
+	certs, err := r.selectCerts(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &apiv1.RenewalRunReport{
+		DryRun:  opts.DryRun,
+		Started: start.Format(time.RFC3339),
+		Certs:   make([]apiv1.RenewalRunCert, len(certs)),
+	}
+	for i := range certs {
+		report.Certs[i] = apiv1.RenewalRunCert{
+			CAID:        certs[i].CAID,
+			Name:        certs[i].CertKey,
+			ValidTo:     certs[i].ExpiresAt.Format(time.RFC3339),
+			NextRenewal: certs[i].NextRenewal.Format(time.RFC3339),
+			Forced:      certs[i].Force,
+			Status:      RenewRunPlanned,
+		}
+	}
+
+	l := log.WithFields(logrus.Fields{"numCerts": len(certs), "dryRun": opts.DryRun})
+	if opts.DryRun || len(certs) == 0 {
+		l.Info("Manual renewal run planned")
+		report.Finished = time.Now().Format(time.RFC3339)
+		progress(report)
+		return report, nil
+	}
+
+	l.Info("Manual renewal run started")
+	progress(report)
+	r.enqueueJobs(certs, renew.TriggerManual, owner, start)
+
+	idx := make(map[*catypes.CertificateRenewInfo]int, len(certs))
+	for i := range certs {
+		idx[&certs[i]] = i
+	}
+	var mtx sync.Mutex
+	errs := renew.RunJobs(r.Service.jobContext(), certs, opts.MaxDuration, func(job *catypes.CertificateRenewInfo) error {
+		err := r.renewTracked(job, renew.TriggerManual, owner)
+		mtx.Lock()
+		defer mtx.Unlock()
+		setRenewRunResult(report, idx[job], err)
+		progress(report)
+		return err
+	})
+	for i, err := range errs {
+		//not started or panicked
+		if report.Certs[i].Status == RenewRunPlanned {
+			setRenewRunResult(report, i, err)
+		}
+	}
+
+	report.Finished = time.Now().Format(time.RFC3339)
+	progress(report)
+	l.WithFields(logrus.Fields{"successful": report.Successful, "failed": report.Failed}).Info(
+		"Manual renewal run finished")
+	return report, nil
+
+}
+
+func setRenewRunResult(report *apiv1.RenewalRunReport, i int, err error) {
+	var norenew *common.NoRenewalDueError
+	var busy *common.AlreadyExistsError
+	switch {
+	case err == nil:
+		report.Certs[i].Status = RenewRunSucceeded
+		report.Successful++
+	case errors.As(err, &norenew), errors.As(err, &busy):
+		report.Certs[i].Status = RenewRunSkipped
+		report.Certs[i].Error = err.Error()
+	default:
+		report.Certs[i].Status = RenewRunFailed
+		report.Certs[i].Error = err.Error()
+		report.Failed++
+	}
+}
+
+// Returns the certificates due for renewal and, if requested, those expiring before
+// opts.ExpiringBefore, restricted to the CA and root zone of the options.
+func (r *Renewer) selectCerts(opts *RenewalRunOptions) ([]catypes.CertificateRenewInfo, error) {
+
+	conf := r.Service.config()
+	f := conf.CA.Functions
+
+	if opts.CAID != "" {
+		if _, exists := conf.CA.Providers[opts.CAID]; !exists {
+			return nil, &common.NotFoundError{RequestedResource: opts.CAID}
+		}
+	}
+
+	due, err := f.ListCertsToRenew(r.Config.LimitPerDay)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiring []catypes.CertificateRenewInfo
+	if !opts.ExpiringBefore.IsZero() {
+		expiring, err = f.ListExpiring(opts.ExpiringBefore, r.Config.LimitPerDay)
+		if err != nil {
+			return nil, err
+		}
+		for i := range expiring {
+			expiring[i].Force = true
+		}
+	}
+
+	return filterRenewCerts(due, expiring, opts, conf.RootZones), nil
+
+}
+
+// Merges the due and expiring certificates, the due ones first, and drops those not
+// matching the CA and root zone of the options.
+func filterRenewCerts(due, expiring []catypes.CertificateRenewInfo, opts *RenewalRunOptions,
+	rootZones dns.RootZones) []catypes.CertificateRenewInfo {
+
+	rootZone := ""
+	if opts.RootZone != "" {
+		rootZone = util.GetDomainFQDNDot(opts.RootZone)
+	}
+
+	type certID struct{ caID, key string }
+	seen := make(map[certID]bool, len(due)+len(expiring))
+	res := make([]catypes.CertificateRenewInfo, 0, len(due)+len(expiring))
+	for _, cert := range append(due, expiring...) {
+		id := certID{cert.CAID, cert.CertKey}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if opts.CAID != "" && cert.CAID != opts.CAID {
+			continue
+		}
+		if rootZone != "" {
+			rz, err := rootZones.GetLowestRZForDomain(cert.CertKey)
+			if err != nil || util.GetDomainFQDNDot(rz.Root) != rootZone {
+				continue
+			}
+		}
+		res = append(res, cert)
+	}
+	return res
+
+}
+
+// Returns the running renewer, or one for a single run if automatic renewal is disabled.
+func (s *Service) getRenewer() (*Renewer, error) {
+	if s.renewer != nil {
+		return s.renewer, nil
+	}
+	conf := s.Config.Renew
+	if conf == nil {
+		conf = &RenewConfig{}
+		err := defaults.Set(conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r := &Renewer{
+		Service: s,
+		Config:  conf,
+	}
+	return r, r.Init()
+}
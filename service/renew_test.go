@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dns3l/dns3l-core/ca"
+	catypes "github.com/dns3l/dns3l-core/ca/types"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/dns"
+	"github.com/dns3l/dns3l-core/leader"
+	"github.com/dns3l/dns3l-core/renew"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+// memRenewState is an in-memory retry and renewal job state for testing
+type memRenewState struct {
+	retries map[string]*renew.RetryInfo
+	jobs    []renew.Job
+}
+
+func (m *memRenewState) Close() error { return nil }
+
+func (m *memRenewState) GetRenewRetry(caID, certKey string) (*renew.RetryInfo, error) {
+	return m.retries[caID+"/"+certKey], nil
+}
+
+func (m *memRenewState) PutRenewRetry(info *renew.RetryInfo) error {
+	i := *info
+	m.retries[info.CAID+"/"+info.CertKey] = &i
+	return nil
+}
+
+func (m *memRenewState) DelRenewRetry(caID, certKey string) error {
+	delete(m.retries, caID+"/"+certKey)
+	return nil
+}
+
+func (m *memRenewState) ListDueRenewRetries(now time.Time, _ uint) ([]renew.RetryInfo, error) {
+	res := make([]renew.RetryInfo, 0, len(m.retries))
+	for _, info := range m.retries {
+		if !info.NextRetryTime.IsZero() && !info.NextRetryTime.After(now) {
+			res = append(res, *info)
+		}
+	}
+	return res, nil
+}
+
+func (m *memRenewState) ListRenewRetries(caID string) ([]renew.RetryInfo, error) {
+	res := make([]renew.RetryInfo, 0, len(m.retries))
+	for _, info := range m.retries {
+		if info.CAID == caID {
+			res = append(res, *info)
+		}
+	}
+	return res, nil
+}
+
+func (m *memRenewState) PutRenewalJob(job *renew.Job) error {
+	job.ID = uint64(len(m.jobs) + 1)
+	m.jobs = append(m.jobs, *job)
+	return nil
+}
+
+func (m *memRenewState) UpdRenewalJob(job *renew.Job) error {
+	m.jobs[job.ID-1] = *job
+	return nil
+}
+
+func (m *memRenewState) ListRenewalJobs(*renew.JobFilter, *util.PaginationInfo) ([]renew.Job, error) {
+	panic("not used in this test")
+}
+
+func (m *memRenewState) HasUnfinishedRenewalJob(caID, certKey string) (bool, error) {
+	for _, job := range m.jobs {
+		if job.CAID == caID && job.CertKey == certKey &&
+			(job.Status == renew.JobPending || job.Status == renew.JobRunning) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memRenewState) ListOrphanedRenewalJobs(liveOwners []string, _ uint) ([]renew.Job, error) {
+	var res []renew.Job
+	for _, job := range m.jobs {
+		if (job.Status == renew.JobPending || job.Status == renew.JobRunning) && !slices.Contains(liveOwners, job.Owner) {
+			res = append(res, job)
+		}
+	}
+	return res, nil
+}
+
+func (m *memRenewState) TakeOverRenewalJob(id uint64, oldOwner, newOwner string) (bool, error) {
+	if m.jobs[id-1].Owner != oldOwner {
+		return false, nil
+	}
+	m.jobs[id-1].Owner = newOwner
+	return true, nil
+}
+
+func (m *memRenewState) DelRenewalJobsBefore(time.Time) (int64, error) {
+	return 0, nil
+}
+
+type memRetryStateManager struct{ *memRenewState }
+
+func (m memRetryStateManager) NewSession() (renew.RetryStateManagerSession, error) {
+	return m.memRenewState, nil
+}
+
+type memJobStateManager struct{ *memRenewState }
+
+func (m memJobStateManager) NewSession() (renew.JobStateManagerSession, error) {
+	return m.memRenewState, nil
+}
+
+// memLeases is an in-memory lease state for testing, leases do not expire
+type memLeases map[string]string
+
+func (m memLeases) NewSession() (leader.LeaseStateManagerSession, error) { return m, nil }
+
+func (m memLeases) Close() error { return nil }
+
+func (m memLeases) TryAcquireLease(name, holder string, _ time.Time, _ time.Duration) (bool, error) {
+	if cur, exists := m[name]; exists && cur != holder {
+		return false, nil
+	}
+	m[name] = holder
+	return true, nil
+}
+
+func (m memLeases) ReleaseLease(name, holder string) error {
+	if m[name] == holder {
+		delete(m, name)
+	}
+	return nil
+}
+
+func (m memLeases) GetLeaseHolder(name string, _ time.Time) (string, error) {
+	return m[name], nil
+}
+
+func TestRenewerTracksJobsAndFailures(t *testing.T) {
+	state := &memRenewState{retries: make(map[string]*renew.RetryInfo)}
+	r := &Renewer{
+		Service: &Service{Config: &Config{CA: &ca.Config{Functions: &ca.CAFunctionHandler{}}},
+			elector: &leader.Elector{State: memLeases{}}},
+		Config:  &RenewConfig{},
+		retry:   &renew.RetryConfig{MaxAttempts: 2, Interval: time.Minute},
+		retries: memRetryStateManager{state},
+		jobs:    memJobStateManager{state},
+	}
+
+	certs := []catypes.CertificateRenewInfo{{CAID: "le", CertKey: "a.example.com."}}
+	now := time.Now()
+	r.enqueueJobs(certs, renew.TriggerScheduled, "", now)
+	if certs[0].JobID != 1 || state.jobs[0].Status != renew.JobPending {
+		t.Fatalf("expected pending job to be enqueued, have %+v", state.jobs)
+	}
+
+	for attempt := uint(1); attempt <= 2; attempt++ {
+		rjob := r.startJob(&certs[0], renew.TriggerScheduled, "")
+		if rjob.Attempt != attempt || state.jobs[0].Status != renew.JobRunning {
+			t.Fatalf("unexpected running job %+v", state.jobs[0])
+		}
+		renewErr := errors.New("dns provider unreachable")
+		r.trackResult("le", "a.example.com.", renewErr, now)
+		r.finishJob(rjob, renewErr)
+	}
+
+	if state.jobs[0].Status != renew.JobFailed || state.jobs[0].Error != "dns provider unreachable" ||
+		state.jobs[0].EndTime.IsZero() {
+		t.Fatalf("unexpected failed job %+v", state.jobs[0])
+	}
+	retry := state.retries["le/a.example.com."]
+	if retry == nil || retry.Failures != 2 || !retry.NextRetryTime.IsZero() {
+		t.Fatalf("expected retries to be exhausted after max attempts, have %+v", retry)
+	}
+
+	//retries create their own jobs
+	rjob := r.startJob(&catypes.CertificateRenewInfo{CAID: "le", CertKey: "a.example.com."}, renew.TriggerRetry, "")
+	r.trackResult("le", "a.example.com.", nil, now)
+	r.finishJob(rjob, nil)
+	if len(state.jobs) != 2 || state.jobs[1].Attempt != 3 || state.jobs[1].Status != renew.JobSucceeded {
+		t.Fatalf("unexpected retry job %+v", state.jobs)
+	}
+	if _, exists := state.retries["le/a.example.com."]; exists {
+		t.Fatal("failures must be reset after a successful renewal")
+	}
+}
+
+func TestRetryDueSkipsCertsBeingRenewed(t *testing.T) {
+	now := time.Now()
+	state := &memRenewState{retries: map[string]*renew.RetryInfo{
+		"le/a.example.com.": {CAID: "le", CertKey: "a.example.com.", Failures: 1, NextRetryTime: now.Add(-time.Minute)},
+	}}
+	r := &Renewer{
+		Service: &Service{Config: &Config{CA: &ca.Config{Functions: &ca.CAFunctionHandler{}}}},
+		Config:  &RenewConfig{},
+		retry:   &renew.RetryConfig{MaxAttempts: 2, Interval: time.Minute},
+		retries: memRetryStateManager{state},
+		jobs:    memJobStateManager{state},
+		stop:    make(chan struct{}),
+	}
+
+	rjob := r.startJob(&catypes.CertificateRenewInfo{CAID: "le", CertKey: "a.example.com."}, renew.TriggerScheduled, "")
+	r.RetryDue(now)
+	if len(state.jobs) != 1 || state.retries["le/a.example.com."].Failures != 1 {
+		t.Fatalf("certificate with a running renewal must not be retried, have %+v", state.jobs)
+	}
+	r.finishJob(rjob, nil)
+}
+
+// unavailableCAState fails to open sessions, so that renewals stop before reaching the CA
+type unavailableCAState struct{}
+
+func (unavailableCAState) NewSession() (catypes.CAStateManagerSession, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (unavailableCAState) NewSessionContext(context.Context) (catypes.CAStateManagerSession, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestResumeOrphanedJobs(t *testing.T) {
+	state := &memRenewState{retries: make(map[string]*renew.RetryInfo)}
+	leases := memLeases{leader.LeaseLeader: "a", leader.LeaseRenewRun: "b"}
+	r := &Renewer{
+		Service: &Service{Config: &Config{CA: &ca.Config{Functions: &ca.CAFunctionHandler{
+			State: unavailableCAState{}}}}, elector: &leader.Elector{ID: "a", State: leases}},
+		Config:  &RenewConfig{},
+		retries: memRetryStateManager{state},
+		jobs:    memJobStateManager{state},
+		stop:    make(chan struct{}),
+	}
+
+	for _, owner := range []string{"a", "b", "dead"} {
+		r.startJob(&catypes.CertificateRenewInfo{CAID: "le", CertKey: owner + ".example.com."}, renew.TriggerRetry, owner)
+	}
+
+	r.Service.elector.Config = &leader.Config{LeaseDuration: time.Minute}
+	r.Service.elector.Campaign(time.Now())
+	r.ResumeOrphanedJobs()
+	for i, owner := range []string{"a", "b", "a"} {
+		if state.jobs[i].Owner != owner {
+			t.Fatalf("only the jobs of stopped instances must be taken over, have %+v", state.jobs)
+		}
+	}
+}
+
+func TestRenewExclusive(t *testing.T) {
+	leases := memLeases{leader.LeaseRenewCert("le", "a.example.com."): "other"}
+	s := &Service{elector: &leader.Elector{ID: "a", State: leases, Config: &leader.Config{RenewInterval: time.Second}}}
+
+	var busy *common.AlreadyExistsError
+	err := s.renewExclusive("le", "a.example.com.", func() error {
+		t.Error("certificate must not be renewed while another instance renews it")
+		return nil
+	})
+	if !errors.As(err, &busy) {
+		t.Fatalf("expected AlreadyExistsError, got %v", err)
+	}
+
+	renewed := false
+	err = s.renewExclusive("le", "b.example.com.", func() error {
+		renewed = true
+		return nil
+	})
+	if err != nil || !renewed {
+		t.Fatalf("expected certificate to be renewed, err=%v", err)
+	}
+}
+
+func TestFilterRenewCerts(t *testing.T) {
+	rootZones := dns.RootZones{{Root: "example.com."}, {Root: "sub.example.com."}, {Root: "example.org."}}
+	due := []catypes.CertificateRenewInfo{
+		{CAID: "le", CertKey: "a.example.com."},
+		{CAID: "le", CertKey: "b.sub.example.com."},
+		{CAID: "step", CertKey: "c.example.com."},
+	}
+	expiring := []catypes.CertificateRenewInfo{
+		{CAID: "le", CertKey: "a.example.com.", Force: true},
+		{CAID: "le", CertKey: "d.example.com.", Force: true},
+		{CAID: "le", CertKey: "e.example.org.", Force: true},
+	}
+
+	keys := func(certs []catypes.CertificateRenewInfo) []string {
+		res := make([]string, len(certs))
+		for i, c := range certs {
+			res[i] = c.CAID + "/" + c.CertKey
+			if c.Force {
+				res[i] += "!"
+			}
+		}
+		return res
+	}
+
+	tests := []struct {
+		opts     RenewalRunOptions
+		expected []string
+	}{
+		{RenewalRunOptions{}, []string{"le/a.example.com.", "le/b.sub.example.com.", "step/c.example.com.",
+			"le/d.example.com.!", "le/e.example.org.!"}},
+		{RenewalRunOptions{CAID: "step"}, []string{"step/c.example.com."}},
+		{RenewalRunOptions{CAID: "le", RootZone: "example.com"}, []string{"le/a.example.com.", "le/d.example.com.!"}},
+		{RenewalRunOptions{RootZone: "sub.example.com."}, []string{"le/b.sub.example.com."}},
+	}
+	for _, tc := range tests {
+		res := keys(filterRenewCerts(due, expiring, &tc.opts, rootZones))
+		if !slices.Equal(res, tc.expected) {
+			t.Errorf("options %+v: expected %v, have %v", tc.opts, tc.expected, res)
+		}
+	}
+}
@@ -2,9 +2,19 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 
+	"github.com/dns3l/dns3l-core/audit"
+	"github.com/dns3l/dns3l-core/events"
+	"github.com/dns3l/dns3l-core/leader"
+	"github.com/dns3l/dns3l-core/metrics"
+	"github.com/dns3l/dns3l-core/notify"
 	"github.com/dns3l/dns3l-core/service/apiv1"
+	"github.com/dns3l/dns3l-core/tracing"
 	"github.com/gorilla/mux"
 )
 
@@ -14,10 +24,28 @@ type Service struct {
 	NoRenew         bool
 	NoBootstrapCert bool
 
-	server  *http.Server
-	router  *mux.Router
-	running bool
-	runerr  error
+	server      *http.Server
+	tlsServer   *http.Server //nil if TLS is not configured
+	tlsCerts    *tlsCertSource
+	router      *mux.Router
+	running     bool
+	runerr      error
+	jobsRunning sync.WaitGroup //claims and renewals, awaited on shutdown
+	jobCtx      context.Context
+	cancelJobs  context.CancelFunc
+	jobCtxOnce  sync.Once
+	notifier    *notify.Notifier
+	dispatcher  *events.WebhookDispatcher
+	auditor     *audit.Auditor
+	elector     *leader.Elector
+	jobWatcher  *jobWatcher
+	renewer     *Renewer
+	readiness   readinessCache
+	current     atomic.Pointer[Config] //set on reload, see config()
+	reloadMtx   sync.Mutex
+
+	stateCollector  *stateCollector
+	tracingShutdown func(context.Context) error
 }
 
 func (s *Service) GetV1() *V1 {
@@ -58,14 +86,68 @@ func (s *Service) RunAsync() error {
 
 }
 
-func (s *Service) Stop() error {
-	return s.server.Shutdown(context.Background())
+// RunContext runs the service until ctx is canceled, e.g. on SIGTERM, and then shuts it
+// down gracefully.
+func (s *Service) RunContext(ctx context.Context) error {
+
+	err := s.prepare()
+	if err != nil {
+		return err
+	}
+
+	log.Info("Service starting...")
+
+	s.newServers(s.router)
+	servErr := make(chan error, 1)
+	go func() {
+		servErr <- s.serve()
+	}()
+
+	select {
+	case err := <-servErr:
+		return err
+	case <-ctx.Done():
+		return s.Stop()
+	}
 }
 
 func (s *Service) runRaw(r *mux.Router) error {
-	s.running = true
+	s.newServers(r)
+	return s.serve()
+}
+
+func (s *Service) newServers(r http.Handler) {
 	s.server = &http.Server{Addr: s.Socket, Handler: r}
-	err := s.server.ListenAndServe()
+	if s.tlsCerts == nil {
+		return
+	}
+	s.tlsServer = &http.Server{
+		Addr:    s.Config.TLS.Socket,
+		Handler: r,
+		TLSConfig: &tls.Config{
+			GetCertificate:     s.tlsCerts.GetCertificate,
+			GetConfigForClient: s.tlsConfigForClient,
+			MinVersion:         tls.VersionTLS12,
+		},
+	}
+	if s.Config.TLS.RedirectHTTP {
+		s.server.Handler = redirectToHTTPS(s.Config.TLS.Socket, r)
+	}
+}
+
+// Returns when one of the servers stops
+func (s *Service) serve() error {
+	s.running = true
+	servErr := make(chan error, 2)
+	go func() {
+		servErr <- s.server.ListenAndServe()
+	}()
+	if s.tlsServer != nil {
+		go func() {
+			servErr <- s.tlsServer.ListenAndServeTLS("", "")
+		}()
+	}
+	err := <-servErr
 	s.runerr = err
 	s.running = false
 	return err
@@ -73,6 +155,14 @@ func (s *Service) runRaw(r *mux.Router) error {
 
 func (s *Service) prepare() error {
 
+	if s.Config.Tracing != nil {
+		shutdown, err := tracing.Init(s.Config.Tracing)
+		if err != nil {
+			return err
+		}
+		s.tracingShutdown = shutdown
+	}
+
 	db := s.Config.DB
 
 	err := db.Init()
@@ -80,6 +170,16 @@ func (s *Service) prepare() error {
 		return err
 	}
 
+	err = s.startElector()
+	if err != nil {
+		return err
+	}
+
+	err = s.startAuditor()
+	if err != nil {
+		return err
+	}
+
 	if s.NoRenew {
 		log.Info("Disabling automatic cert renewal as per user request.")
 	} else if s.Config.Renew != nil {
@@ -100,20 +200,59 @@ func (s *Service) prepare() error {
 		return err
 	}
 
+	if s.Config.TLS != nil {
+		s.tlsCerts, err = s.newTLSCertSource()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.startEventReceivers()
+	if err != nil {
+		return err
+	}
+
+	s.startJobWatcher()
+
 	if !s.NoBootstrapCert {
-		err = DoSafeBootstrapCerts(s)
+		//only one instance at a time, the others then find the certs already present
+		err = s.elector.RunExclusive(leader.LeaseBootstrap, func() error {
+			return DoSafeBootstrapCerts(s)
+		})
 		if err != nil {
 			return err
 		}
 	}
 
+	if s.tlsCerts != nil {
+		_, err = s.tlsCerts.GetCertificate(nil)
+		if err != nil {
+			log.WithError(err).Error("TLS certificate is not available yet, TLS handshakes will fail until it is")
+		}
+	}
+
 	v1hdlr := &apiv1.RestV1Handler{
 		Service: s.GetV1(),
-		Auth:    &s.Config.Auth,
+		Auth:    &reloadableAuth{s},
+	}
+	for _, cidr := range s.Config.TrustedProxies {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		v1hdlr.TrustedProxies = append(v1hdlr.TrustedProxies, ipnet)
 	}
 	v1hdlr.RegisterHandle(r.PathPrefix("/api/v1").Subrouter())
 	v1hdlr.RegisterHandle(r.PathPrefix("/api").Subrouter())
 
+	s.registerStateMetrics()
+	r.Handle("/metrics", metrics.Handler())
+	s.readiness.Timeout = readinessCacheTime
+	r.HandleFunc("/healthz", s.handleHealthz).Methods("GET")
+	r.HandleFunc("/readyz", s.handleReadyz).Methods("GET")
+	r.Use(tracing.HTTPMiddleware)
+	r.Use(metrics.HTTPMiddleware)
+
 	err = v1hdlr.Init()
 	if err != nil {
 		return err
@@ -137,5 +276,57 @@ func (s *Service) startRenewer() error {
 	if err != nil {
 		return err
 	}
+	s.renewer = r
 	return r.StartAsync()
 }
+
+func (s *Service) startEventReceivers() error {
+	emitters := make(events.Multi, 0, 2)
+
+	if s.Config.Events != nil && len(s.Config.Events.Webhooks) > 0 {
+		s.dispatcher = &events.WebhookDispatcher{
+			Config:        s.Config.Events,
+			State:         &events.OutboxStateManagerSQL{Prov: s.Config.DB},
+			ShouldRunFunc: s.isLeader,
+		}
+		err := s.dispatcher.Init()
+		if err != nil {
+			return err
+		}
+		s.dispatcher.Start()
+		emitters = append(emitters, s.dispatcher)
+		log.Info("Started webhook event delivery.")
+	}
+
+	if s.Config.Notify != nil {
+		s.notifier = &notify.Notifier{
+			Config: s.Config.Notify,
+			State:  &notify.NotificationStateManagerSQL{Prov: s.Config.DB},
+			CC:     s.Config.AdminEMail,
+			URL:    s.Config.URL,
+			RunExclusiveFunc: func(f func() error) error {
+				e, err := s.getElector()
+				if err != nil {
+					return err
+				}
+				return e.RunExclusive(leader.LeaseNotify, f)
+			},
+		}
+		err := s.notifier.Init()
+		if err != nil {
+			return err
+		}
+		s.notifier.Start()
+		emitters = append(emitters, s.notifier)
+		log.Info("Started e-mail notifications.")
+	}
+
+	if s.tlsCerts != nil {
+		emitters = append(emitters, s.tlsCerts)
+	}
+
+	if len(emitters) > 0 {
+		s.Config.CA.Functions.Events = emitters
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+type ShutdownConfig struct {
+	DrainTimeout    time.Duration `yaml:"drainTimeout" default:"60s"`    //in-flight claims and renewals may finish within this
+	RollbackTimeout time.Duration `yaml:"rollbackTimeout" default:"30s"` //afterwards they are canceled and may roll back their DNS changes within this
+}
+
+// Stop shuts the service down gracefully. No new requests and renewals are accepted, and
+// in-flight claims and renewals may finish until the drain timeout. Then they are canceled,
+// which rolls back the DNS changes they have not yet committed, e.g. ACME challenge records.
+func (s *Service) Stop() error {
+
+	conf := s.Config.Shutdown
+	if conf == nil {
+		conf = &ShutdownConfig{}
+		err := defaults.Set(conf)
+		if err != nil {
+			return err
+		}
+	}
+	log.WithField("drainTimeout", conf.DrainTimeout).Info("Shutting down...")
+
+	deadline := time.Now().Add(conf.DrainTimeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	if s.renewer != nil {
+		s.renewer.Stop()
+	}
+	if s.jobWatcher != nil {
+		s.jobWatcher.Drain()
+	}
+
+	var err error
+	for _, srv := range []*http.Server{s.server, s.tlsServer} {
+		if srv == nil {
+			continue
+		}
+		//waits for the running requests until the drain timeout
+		srvErr := srv.Shutdown(ctx)
+		if srvErr != nil && !errors.Is(srvErr, context.DeadlineExceeded) {
+			err = srvErr
+		}
+	}
+
+	if !waitTimeout(&s.jobsRunning, time.Until(deadline)) {
+		log.Warn("Claims and renewals still running after drain timeout, canceling them")
+	}
+	s.jobContext()
+	s.cancelJobs()
+	if !waitTimeout(&s.jobsRunning, conf.RollbackTimeout) {
+		log.Error("Canceled claims and renewals did not finish within rollback timeout, " +
+			"DNS records might be left behind")
+	}
+
+	if s.renewer != nil {
+		s.renewer.Wait()
+	}
+	if s.jobWatcher != nil {
+		s.jobWatcher.Stop()
+	}
+	//the notifier sends its collected digests under the elector's lease
+	if s.notifier != nil {
+		s.notifier.Stop()
+	}
+	if s.dispatcher != nil {
+		s.dispatcher.Stop()
+	}
+	if s.auditor != nil {
+		s.auditor.Stop()
+	}
+	if s.elector != nil {
+		s.elector.Stop()
+	}
+	if s.tracingShutdown != nil {
+		util.LogIfError(log, s.tracingShutdown(context.Background()))
+	}
+	log.Info("Shutdown complete.")
+	return err
+
+}
+
+// Returns the context of claims and renewals, it is canceled on shutdown when they have
+// not finished within the drain timeout.
+func (s *Service) jobContext() context.Context {
+	s.jobCtxOnce.Do(func() {
+		s.jobCtx, s.cancelJobs = context.WithCancel(context.Background())
+	})
+	return s.jobCtx
+}
+
+// Returns a context which is additionally canceled when claims and renewals are canceled
+// on shutdown.
+func (s *Service) withJobContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(s.jobContext(), cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Returns false if wg is still waiting after the timeout.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
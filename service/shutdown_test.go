@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStopDrainsThenCancelsJobs(t *testing.T) {
+	s := &Service{Config: &Config{Shutdown: &ShutdownConfig{
+		DrainTimeout:    50 * time.Millisecond,
+		RollbackTimeout: time.Second,
+	}}}
+
+	//finishes within the drain timeout
+	finished := false
+	s.jobsRunning.Add(1)
+	go func() {
+		defer s.jobsRunning.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished = true
+	}()
+
+	//only ends when canceled, then rolls back
+	rolledBack := false
+	ctx, cancel := s.withJobContext(t.Context())
+	defer cancel()
+	s.jobsRunning.Add(1)
+	go func() {
+		defer s.jobsRunning.Done()
+		<-ctx.Done()
+		rolledBack = true
+	}()
+
+	start := time.Now()
+	err := s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !finished || !rolledBack {
+		t.Fatalf("expected jobs to be drained and canceled, finished=%v rolledBack=%v", finished, rolledBack)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("expected cancellation after the drain timeout, took %s", elapsed)
+	}
+}
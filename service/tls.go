@@ -0,0 +1,133 @@
+package service
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/dns3l/dns3l-core/events"
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/sirupsen/logrus"
+)
+
+type TLSConfig struct {
+	Socket          string        `yaml:"socket" default:":443"`
+	CA              string        `yaml:"ca"`                            //CA of the cert, by default the one of the bootstrap cert
+	Cert            string        `yaml:"cert"`                          //name of the cert, by default the first bootstrap cert
+	RedirectHTTP    bool          `yaml:"redirectHTTP"`                  //answer requests on --socket with a redirect to HTTPS
+	RefreshInterval time.Duration `yaml:"refreshInterval" default:"10m"` //renewals by other instances are picked up after this
+}
+
+// Serves a certificate managed by dns3ld itself from the state DB. The certificate is
+// reloaded when it has been renewed by this instance, or after the refresh interval.
+type tlsCertSource struct {
+	s     *Service
+	caID  string
+	name  string
+	cache util.SingleValCache[*tls.Certificate]
+	last  atomic.Pointer[tls.Certificate] //served if reloading fails
+}
+
+func (s *Service) newTLSCertSource() (*tlsCertSource, error) {
+
+	conf := s.Config.TLS
+	err := defaults.Set(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &tlsCertSource{s: s, caID: conf.CA, name: conf.Cert}
+	src.cache.Timeout = conf.RefreshInterval
+
+	if s.Config.Bootstrap != nil {
+		for _, cert := range s.Config.Bootstrap.Certs {
+			if src.name != "" && util.GetDomainFQDNDot(cert.Name) != util.GetDomainFQDNDot(src.name) {
+				continue
+			}
+			if src.caID != "" && cert.CA != src.caID {
+				continue
+			}
+			src.name, src.caID = cert.Name, cert.CA
+			break
+		}
+	}
+	if src.name == "" || src.caID == "" {
+		return nil, errors.New("tls: cert and ca must be given if the certificate is not a bootstrap cert")
+	}
+	src.name = util.GetDomainFQDNDot(src.name)
+
+	return src, nil
+
+}
+
+func (c *tlsCertSource) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := c.cache.GetCached(c.load)
+	if err != nil {
+		if last := c.last.Load(); last != nil {
+			log.WithError(err).Warn("Could not reload TLS certificate, serving the previous one")
+			return last, nil
+		}
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (c *tlsCertSource) load() (*tls.Certificate, error) {
+	res, err := c.s.config().CA.Functions.GetCertificateResources(c.name, c.caID)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate '%s' of CA '%s': %w", c.name, c.caID, err)
+	}
+	cert, err := tls.X509KeyPair([]byte(res.FullChain), []byte(res.Key))
+	if err != nil {
+		return nil, err
+	}
+	c.last.Store(&cert)
+	log.WithFields(logrus.Fields{"caID": c.caID, "name": c.name, "validTo": cert.Leaf.NotAfter}).Info(
+		"Loaded TLS certificate")
+	return &cert, nil
+}
+
+// Reloads the certificate on its next use after this instance has renewed or re-claimed it
+func (c *tlsCertSource) Emit(ev *events.Event) {
+	if (ev.Type == events.TypeRenewed || ev.Type == events.TypeClaimed) &&
+		ev.CAID == c.caID && util.GetDomainFQDNDot(ev.Name) == c.name {
+		c.cache.Invalidate()
+	}
+}
+
+// Asks for a client certificate if client cert auth is configured. It is verified by the auth
+// provider, so that the client CAs can be swapped on reload.
+func (s *Service) tlsConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	if !s.config().Auth.MTLS.Config.Enabled() {
+		return nil, nil
+	}
+	return &tls.Config{
+		GetCertificate: s.tlsCerts.GetCertificate,
+		ClientAuth:     tls.RequestClientCert,
+		MinVersion:     tls.VersionTLS12,
+	}, nil
+}
+
+// Redirects to the same URL on the TLS socket, the health probes are served as-is.
+func redirectToHTTPS(tlsSocket string, next http.Handler) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsSocket)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
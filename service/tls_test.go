@@ -0,0 +1,95 @@
+package service
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dns3l/dns3l-core/events"
+)
+
+func TestTLSCertSourceFromBootstrap(t *testing.T) {
+	s := &Service{Config: &Config{
+		Bootstrap: &BStrapConfig{Certs: []BStrapCertInfo{
+			{CA: "le", Name: "dns3l.example.com"},
+			{CA: "step", Name: "other.example.com"},
+		}},
+		TLS: &TLSConfig{},
+	}}
+
+	src, err := s.newTLSCertSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.caID != "le" || src.name != "dns3l.example.com." {
+		t.Errorf("expected first bootstrap cert, got %s/%s", src.caID, src.name)
+	}
+	if s.Config.TLS.Socket != ":443" {
+		t.Errorf("expected default socket, got %s", s.Config.TLS.Socket)
+	}
+
+	s.Config.TLS = &TLSConfig{Cert: "other.example.com."}
+	src, err = s.newTLSCertSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.caID != "step" {
+		t.Errorf("expected CA of matching bootstrap cert, got %s", src.caID)
+	}
+
+	s.Config.Bootstrap = nil
+	_, err = s.newTLSCertSource()
+	if err == nil {
+		t.Error("expected error for cert without CA")
+	}
+}
+
+func TestTLSCertSourceReloadsAfterRenewal(t *testing.T) {
+	src := &tlsCertSource{caID: "le", name: "dns3l.example.com."}
+	src.cache.Timeout = time.Hour
+	cert := &tls.Certificate{}
+	_, _ = src.cache.GetCached(func() (*tls.Certificate, error) { return cert, nil })
+
+	failing := func() (*tls.Certificate, error) { return nil, errors.New("reloaded") }
+
+	src.Emit(events.NewEvent(events.TypeRenewed, "le", "other.example.com."))
+	if c, err := src.cache.GetCached(failing); err != nil || c != cert {
+		t.Error("expected renewal of another cert to keep the cached one")
+	}
+
+	src.Emit(events.NewEvent(events.TypeRenewed, "le", "dns3l.example.com."))
+	if _, err := src.cache.GetCached(failing); err == nil {
+		t.Error("expected renewal to invalidate the cached cert")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		socket, url, location string
+	}{
+		{":443", "http://dns3l.example.com/api/info?x=1", "https://dns3l.example.com/api/info?x=1"},
+		{":8443", "http://dns3l.example.com:8080/api/info", "https://dns3l.example.com:8443/api/info"},
+		{":443", "http://dns3l.example.com/healthz", ""},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(c.socket, next).ServeHTTP(rec, httptest.NewRequest("GET", c.url, nil))
+		if c.location == "" {
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s: expected request to be served, got %d", c.url, rec.Code)
+			}
+			continue
+		}
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != c.location {
+			t.Errorf("%s: expected redirect to %s, got %d %s", c.url, c.location, rec.Code,
+				rec.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fmt"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/audit"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+// Records an operation of the REST API in the audit log. authz may be nil if the client
+// could not be authenticated.
+func (s *V1) RecordAudit(authz authtypes.AuthorizationInfo, sourceIP string, action audit.Action,
+	caID, crtID string, opErr error) {
+
+	if s.Service.auditor == nil {
+		return
+	}
+
+	entry := &audit.Entry{
+		Action:   action,
+		CAID:     caID,
+		SourceIP: sourceIP,
+		Result:   audit.ResultFromErr(opErr),
+	}
+	switch {
+	case action == audit.ActionTokenCreate || action == audit.ActionTokenRevoke:
+		entry.CertName = crtID //the token name
+	case crtID != "":
+		entry.CertName = util.GetDomainFQDNDot(crtID)
+	}
+	if authz != nil && authz.GetUserInfo() != nil {
+		entry.UserName = authz.GetUserInfo().Name
+		entry.UserEmail = authz.GetUserInfo().Email
+	}
+	if opErr != nil {
+		entry.Error = opErr.Error()
+	}
+
+	s.Service.auditor.Record(entry)
+
+}
+
+func (s *V1) GetAuditEntries(filter *audit.Filter, authz authtypes.AuthorizationInfo,
+	pginfo *util.PaginationInfo) ([]apiv1.AuditEntry, error) {
+
+	s.logAction(authz, "GetAuditEntries")
+
+	err := authz.ChkAuthAdmin()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Service.auditor == nil {
+		return nil, fmt.Errorf("audit log has not been started")
+	}
+
+	if filter.CertName != "" {
+		filter.CertName = util.GetDomainFQDNDot(filter.CertName)
+	}
+
+	sess, err := s.Service.auditor.State.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	entries, err := sess.ListAuditEntries(filter, pginfo)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]apiv1.AuditEntry, len(entries))
+	for i := range entries {
+		res[i] = apiAuditEntryFromEntry(&entries[i])
+	}
+	return res, nil
+
+}
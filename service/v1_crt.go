@@ -1,133 +1,651 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"strings"
 	"time"
 
 	apiv1 "github.com/dns3l/dns3l-core/api/v1"
 	"github.com/dns3l/dns3l-core/ca/types"
 	"github.com/dns3l/dns3l-core/common"
+	dnscommon "github.com/dns3l/dns3l-core/dns/common"
+	dnstypes "github.com/dns3l/dns3l-core/dns/types"
+	"github.com/dns3l/dns3l-core/jobs"
+	"github.com/dns3l/dns3l-core/tracing"
 	"github.com/dns3l/dns3l-core/util"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 
 	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
 )
 
-func (s *V1) ClaimCertificate(caID string, cinfo *apiv1.CertClaimInfo, authz authtypes.AuthorizationInfo) error {
-	fu := s.Service.Config.CA.Functions
+func (s *V1) ClaimCertificate(ctx context.Context, caID string, cinfo *apiv1.CertClaimInfo, authz authtypes.AuthorizationInfo) error {
 
 	s.logAction(authz, fmt.Sprintf("ClaimCertificate %s", caID))
 
-	//Ensure standard notation
-	cinfo.Name = util.GetDomainFQDNDot(cinfo.Name)
-	for i := range cinfo.SubjectAltNames {
-		cinfo.SubjectAltNames[i] = util.GetDomainFQDNDot(cinfo.SubjectAltNames[i])
-	}
+	return s.claimCertificate(ctx, caID, cinfo, authz, nil)
 
-	var firstDomain string
-	if cinfo.Wildcard {
-		firstDomain = "*." + cinfo.Name
-	} else {
-		firstDomain = cinfo.Name
-	}
+}
 
-	domains := append([]string{firstDomain}, cinfo.SubjectAltNames...)
+// Does the claim, progress is optional and called when the claim reaches a types.ClaimStep.
+// The claim is traced as a child span of ctx.
+func (s *V1) claimCertificate(ctx context.Context, caID string, cinfo *apiv1.CertClaimInfo,
+	authz authtypes.AuthorizationInfo, progress func(step string)) (err error) {
+	conf := s.Service.config()
+	fu := conf.CA.Functions
 
-	err := authz.ChkAuthWriteDomains(domains)
+	//on shutdown, claims may finish until the drain timeout, otherwise they are rolled back
+	s.Service.jobsRunning.Add(1)
+	defer s.Service.jobsRunning.Done()
+	ctx, cancel := s.Service.withJobContext(ctx)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "V1.ClaimCertificate",
+		attribute.String("dns3l.ca", caID),
+		attribute.String("dns3l.name", cinfo.Name))
+	defer func() { tracing.End(span, err) }()
+
+	domains := claimDomains(cinfo)
+
+	err = chkAuthCertOp(authz, authtypes.ScopeClaim, caID)
 	if err != nil {
 		return err
 	}
-
-	namerz, err := s.Service.Config.RootZones.GetLowestRZForDomain(firstDomain)
+	err = authz.ChkAuthWriteDomains(domains)
 	if err != nil {
 		return err
 	}
 
-	var autodnsV4 net.IP
+	namerz, err := conf.RootZones.GetLowestRZForDomain(domains[0])
+	if err != nil {
+		return err
+	}
 
 	trl := make(util.TransactionalJobList, 0, 10)
 
 	var ClaimFunc func() error
+	var releaseClaim func()
 
 	trl = append(trl, &util.TransactionalJobImpl{
 		DoFunc: func() error {
 			var err error
-			ClaimFunc, err = fu.PrepareClaimCertificate(caID, &types.CertificateClaimInfo{
+			ClaimFunc, releaseClaim, err = fu.PrepareClaimCertificate(caID, &types.CertificateClaimInfo{
 				Name:        cinfo.Name,
 				NameRZ:      namerz.Root,
 				Domains:     domains,
 				IssuedBy:    authz.GetUserInfo(),
 				TTLSelected: util.DaysToDuration(cinfo.Hints.TTL),
+				Progress:    progress,
+				Ctx:         ctx,
 			})
 			return err
 		},
+		UndoFunc: func() error {
+			//gives the queue slot back if the claim has not been run
+			releaseClaim()
+			return nil
+		},
+		Name: "prepare-claim",
+	})
+
+	if cinfo.AutoDNS != nil {
+		autodnsJobs, err := s.makeAutoDNSSetJobs(ctx, domains, cinfo.AutoDNS)
+		if err != nil {
+			return err
+		}
+		trl = append(trl, autodnsJobs...)
+	}
+
+	if strings.TrimSpace(authz.GetUserInfo().Email) == "" {
+		return &common.UnauthzedError{Msg: "the user's email address has not been provided by the auth provider, required for claiming certificate"}
+	}
+
+	trl = append(trl, &util.TransactionalJobImpl{
+		DoFunc: func() error {
+			return ClaimFunc()
+		},
 		UndoFunc: nil, //not needed because this is always the last thing that is executed
+		Name:     "claim",
 	})
 
+	return trl.CommitContext(ctx)
+
+}
+
+// Checks authorization, persists a claim job and runs the claim in the background.
+// The returned job can be polled with GetJob.
+func (s *V1) ClaimCertificateAsync(ctx context.Context, caID string, cinfo *apiv1.CertClaimInfo, authz authtypes.AuthorizationInfo) (*apiv1.JobInfo, error) {
+
+	s.logAction(authz, fmt.Sprintf("ClaimCertificateAsync %s", caID))
+
+	//fail early for everything that does not need the claim to run
+	err := chkAuthCertOp(authz, authtypes.ScopeClaim, caID)
+	if err != nil {
+		return nil, err
+	}
+	err = authz.ChkAuthWriteDomains(claimDomains(cinfo))
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(authz.GetUserInfo().Email) == "" {
+		return nil, &common.UnauthzedError{Msg: "the user's email address has not been provided by the auth provider, required for claiming certificate"}
+	}
+	err = s.Service.config().CA.Functions.ChkClaimCapacity(caID)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := json.Marshal(cinfo)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := jobs.NewJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &jobs.Job{
+		ID:          id,
+		Type:        jobs.TypeClaim,
+		CAID:        caID,
+		Name:        cinfo.Name,
+		CreatedBy:   authz.GetUserInfo(),
+		Authz:       jobAuthorization(s.Service.config(), authz),
+		Status:      jobs.StatusQueued,
+		Request:     string(request),
+		Owner:       s.Service.instanceID(),
+		CreatedTime: time.Now(),
+	}
+	job.Steps = []jobs.StepInfo{{Status: job.Status, Time: job.CreatedTime}}
+	job.UpdatedTime = job.CreatedTime
+
+	sess, err := s.Service.getJobState().NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	err = sess.PutJob(job)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Service.runClaimJob(tracing.Detach(ctx), job.ID, caID, cinfo, authz)
+
+	return apiJobInfoFromJob(job), nil
+
+}
+
+// Records the restrictions of the client so that they can be checked again when the job is resumed
+func jobAuthorization(conf *Config, authz authtypes.AuthorizationInfo) *jobs.Authorization {
+	res := &jobs.Authorization{
+		Scopes:     allowedScopes(authz),
+		CAsAllowed: allowedCAs(conf, authz),
+	}
+	if delegation := authz.GetDelegation(); delegation != nil {
+		res.Delegated = true
+		res.TokenID = delegation.TokenID
+		res.NotBefore = delegation.NotBefore
+		res.Expiry = delegation.Expiry
+	}
+	return res
+}
+
+// Normalizes the names of the claim info to standard notation and returns all domains
+// of the certificate to claim, the first domain being the (wildcard) name.
+func claimDomains(cinfo *apiv1.CertClaimInfo) []string {
+
+	cinfo.Name = util.GetDomainFQDNDot(cinfo.Name)
+	for i := range cinfo.SubjectAltNames {
+		cinfo.SubjectAltNames[i] = util.GetDomainFQDNDot(cinfo.SubjectAltNames[i])
+	}
+
+	var firstDomain string
+	if cinfo.Wildcard {
+		firstDomain = "*." + cinfo.Name
+	} else {
+		firstDomain = cinfo.Name
+	}
+
+	return append([]string{firstDomain}, cinfo.SubjectAltNames...)
+}
+
+func (s *V1) DryRunClaimCertificate(caID string, cinfo *apiv1.CertClaimInfo, authz authtypes.AuthorizationInfo) (*apiv1.ClaimPrecheckReport, error) {
+	conf := s.Service.config()
+	fu := conf.CA.Functions
+
+	s.logAction(authz, fmt.Sprintf("DryRunClaimCertificate %s", caID))
+
+	domains := claimDomains(cinfo)
+
+	var emailErr error
+	if strings.TrimSpace(authz.GetUserInfo().Email) == "" {
+		emailErr = &common.UnauthzedError{Msg: "the user's email address has not been provided by the auth provider, required for claiming certificate"}
+	}
+	checks := []types.PrecheckResult{
+		types.NewPrecheckResult("user-email", "", emailErr, "user email address provided"),
+		types.NewPrecheckResult("authz", "", chkAuthCertOp(authz, authtypes.ScopeClaim, caID),
+			fmt.Sprintf("user may claim from CA '%s'", caID)),
+	}
+
+	var autodnsV4 net.IP
 	if cinfo.AutoDNS != nil {
-		autodnsV4 = net.ParseIP(cinfo.AutoDNS.IPv4)
+		autodnsV4 = net.ParseIP(cinfo.AutoDNS.IPv4).To4()
+		var err error
 		if autodnsV4 == nil {
-			return &common.InvalidInputError{Msg: "Net address for AutoDNS not parseable"}
+			err = &common.InvalidInputError{Msg: "Net address for AutoDNS not parseable or not of v4 format"}
 		}
-		autodnsV4 = autodnsV4.To4()
-		if autodnsV4 == nil {
-			return &common.InvalidInputError{Msg: "Net address for AutoDNS not of v4 format"}
+		checks = append(checks, types.NewPrecheckResult("autodns-address", "", err, "AutoDNS address is valid"))
+	}
+
+	dnsProvsChecked := make(map[string]bool)
+	checkDNSProv := func(provID string) {
+		if provID == "" || dnsProvsChecked[provID] {
+			return
 		}
+		dnsProvsChecked[provID] = true
+		var err error
+		prov, exists := conf.DNS.Providers[provID]
+		if !exists {
+			err = fmt.Errorf("DNS provider '%s' not found", provID)
+		} else {
+			err = prov.Prov.CheckReachability()
+		}
+		checks = append(checks, types.NewPrecheckResult("dns-provider", "", err,
+			fmt.Sprintf("DNS provider '%s' is reachable", provID)))
+	}
 
-		for _, domain := range domains {
+	var nameRZ string
+	for i, domain := range domains {
 
-			if util.IsWildcard(domain) {
-				log.WithField("domain", domain).Debug("Ignoring wildcard domain for AutoDNS")
-				continue
-			}
+		checks = append(checks, types.NewPrecheckResult("authz", domain,
+			authz.ChkAuthWriteDomain(domain), "user is authorized for domain"))
 
-			rz, err := s.Service.Config.RootZones.GetLowestRZForDomain(domain)
-			if err != nil {
-				return err
-			}
-			if rz.DNSProvAutoDNS == "" {
-				return &common.InvalidInputError{Msg: fmt.Sprintf(
-					"AutoDNS provider for root zone '%s' not configured", rz.Root)}
+		rz, err := conf.RootZones.GetLowestRZForDomain(domain)
+		if err != nil {
+			checks = append(checks, types.NewPrecheckResult("rootzone", domain, err, ""))
+			continue
+		}
+		checks = append(checks, types.NewPrecheckResult("rootzone", domain, nil,
+			fmt.Sprintf("domain is in root zone %s", rz.Root)))
+		if i == 0 {
+			nameRZ = rz.Root
+		}
+
+		checkDNSProv(rz.DNSProvAcme)
+
+		if cinfo.AutoDNS != nil {
+			entries, err := s.getAutoDNSEntries(context.Background(), []string{domain})
+			if err == nil && len(entries) <= 0 {
+				checks = append(checks, types.PrecheckResult{Check: "autodns", Domain: domain,
+					Status: types.PrecheckSkipped, Message: "wildcard domains are ignored for AutoDNS"})
+				continue
 			}
-			autodnsProv, exists := s.Service.Config.DNS.Providers[rz.DNSProvAutoDNS]
-			if !exists {
-				return &common.InvalidInputError{Msg: fmt.Sprintf(
-					"AutoDNS provider '%s' configured for root zone '%s' not found", rz.DNSProvAutoDNS, rz.Root)}
+			checks = append(checks, types.NewPrecheckResult("autodns", domain, err,
+				fmt.Sprintf("AutoDNS provider '%s' configured", rz.DNSProvAutoDNS)))
+			if err == nil {
+				checkDNSProv(rz.DNSProvAutoDNS)
 			}
+		}
+	}
 
-			domain := domain //bump the scope
-
-			trl = append(trl, &util.TransactionalJobImpl{
-				DoFunc: func() error {
-					log.WithFields(logrus.Fields{"domain": domain, "prov": autodnsProv.Prov, "addr": autodnsV4}).Info(
-						"Setting AutoDNS entry")
-					return autodnsProv.Prov.SetRecordA(domain, autodnsProv.Prov.GetInfo().DefaultAutoDNSTTL, autodnsV4)
-				},
-				UndoFunc: func() error {
-					log.WithFields(logrus.Fields{"domain": domain, "prov": autodnsProv.Prov}).Info(
-						"Rolling back AutoDNS entry")
-					return autodnsProv.Prov.DeleteRecordA(domain)
-				},
-			})
+	checks = append(checks, fu.DryRunClaimCertificate(caID, &types.CertificateClaimInfo{
+		Name:        cinfo.Name,
+		NameRZ:      nameRZ,
+		Domains:     domains,
+		IssuedBy:    authz.GetUserInfo(),
+		TTLSelected: util.DaysToDuration(cinfo.Hints.TTL),
+	})...)
+
+	res := &apiv1.ClaimPrecheckReport{
+		Passed: true,
+		Checks: make([]apiv1.ClaimPrecheck, len(checks)),
+	}
+	for i, c := range checks {
+		if c.Status == types.PrecheckFailed {
+			res.Passed = false
 		}
+		res.Checks[i] = apiv1.ClaimPrecheck{
+			Check:   c.Check,
+			Domain:  c.Domain,
+			Status:  string(c.Status),
+			Message: c.Message,
+		}
+	}
+
+	return res, nil
+
+}
+
+func (s *V1) ModifyCertificate(ctx context.Context, caID, crtID string, minfo *apiv1.CertModifyInfo, authz authtypes.AuthorizationInfo) error {
+
+	s.logAction(authz, fmt.Sprintf("ModifyCertificate %s %s", caID, crtID))
+
+	crtID = util.GetDomainFQDNDot(crtID)
+
+	conf := s.Service.config()
+	fu := conf.CA.Functions
 
+	err := chkAuthCertOp(authz, authtypes.ScopeClaim, caID)
+	if err != nil {
+		return err
+	}
+	err = authz.ChkAuthWriteDomain(crtID)
+	if err != nil {
+		return err
+	}
+
+	cinfo, err := fu.GetCertificateInfo(caID, crtID)
+	if err != nil {
+		return err
+	}
+	if cinfo == nil {
+		return &common.NotFoundError{RequestedResource: crtID}
+	}
+
+	domains, added, removed := modifiedDomains(crtID, cinfo.Domains, minfo)
+	if len(added) <= 0 && len(removed) <= 0 {
+		return &common.InvalidInputError{Msg: "the requested modification does not change the certificate's domains"}
+	}
+
+	//all domains of the resulting certificate and the ones removed need write permission
+	err = authz.ChkAuthWriteDomains(domains)
+	if err != nil {
+		return err
+	}
+	err = authz.ChkAuthWriteDomains(removed)
+	if err != nil {
+		return err
+	}
+
+	namerz, err := conf.RootZones.GetLowestRZForDomain(domains[0])
+	if err != nil {
+		return err
 	}
 
 	if strings.TrimSpace(authz.GetUserInfo().Email) == "" {
-		return &common.UnauthzedError{Msg: "the user's email address has not been provided by the auth provider, required for claiming certificate"}
+		return &common.UnauthzedError{Msg: "the user's email address has not been provided by the auth provider, required for modifying certificate"}
 	}
 
+	trl := make(util.TransactionalJobList, 0, 10)
+
+	var ModifyFunc func() error
+	var releaseModify func()
+
 	trl = append(trl, &util.TransactionalJobImpl{
 		DoFunc: func() error {
-			return ClaimFunc()
+			var err error
+			ModifyFunc, releaseModify, err = fu.PrepareModifyCertificate(caID, &types.CertificateClaimInfo{
+				Name:        crtID,
+				NameRZ:      namerz.Root,
+				Domains:     domains,
+				IssuedBy:    cinfo.IssuedBy, //keep the original issuer so the ACME user does not change
+				TTLSelected: cinfo.TTLSelected,
+				Ctx:         ctx,
+			})
+			return err
+		},
+		UndoFunc: func() error {
+			//gives the queue slot back if the modification has not been run
+			releaseModify()
+			return nil
+		},
+	})
+
+	var autodnsRemovals []*autoDNSEntry
+	if minfo.AutoDNS != nil {
+		autodnsJobs, err := s.makeAutoDNSSetJobs(ctx, added, minfo.AutoDNS)
+		if err != nil {
+			return err
+		}
+		trl = append(trl, autodnsJobs...)
+
+		autodnsRemovals, err = s.getAutoDNSEntries(ctx, removed)
+		if err != nil {
+			return err
+		}
+	}
+
+	trl = append(trl, &util.TransactionalJobImpl{
+		DoFunc: func() error {
+			return ModifyFunc()
 		},
 		UndoFunc: nil, //not needed because this is always the last thing that is executed
 	})
 
-	return trl.Commit()
+	err = trl.CommitContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	//The certificate has been re-issued, so failing to remove obsolete records must not fail the request
+	var rmerr error
+	for _, entry := range autodnsRemovals {
+		log.WithFields(logrus.Fields{"domain": entry.domain, "prov": entry.prov}).Info(
+			"Removing AutoDNS entry of removed domain")
+		err := entry.prov.DeleteRecordA(entry.domain)
+		if err != nil {
+			log.WithError(err).WithField("domain", entry.domain).Error("Could not remove AutoDNS entry of removed domain")
+			rmerr = errors.Join(rmerr, err)
+		}
+	}
+	if rmerr != nil {
+		return &common.Warning{SubErr: fmt.Errorf("certificate modified, but removing AutoDNS entries failed: %w", rmerr)}
+	}
+
+	return nil
+
+}
+
+// Returns the domains of a certificate after applying the modification, along with the
+// domains that have been added and removed by it. The first domain always stays first.
+func modifiedDomains(name string, oldDomains []string, minfo *apiv1.CertModifyInfo) ([]string, []string, []string) {
+
+	firstDomain := oldDomains[0]
+	if minfo.Wildcard != nil {
+		if *minfo.Wildcard {
+			firstDomain = "*." + name
+		} else {
+			firstDomain = name
+		}
+	}
+
+	toRemove := make(map[string]bool, len(minfo.RemoveSubjectAltNames))
+	for _, d := range minfo.RemoveSubjectAltNames {
+		toRemove[util.GetDomainFQDNDot(d)] = true
+	}
+
+	domains := []string{firstDomain}
+	contained := map[string]bool{firstDomain: true}
+	for _, d := range oldDomains[1:] {
+		if toRemove[d] || contained[d] {
+			continue
+		}
+		domains = append(domains, d)
+		contained[d] = true
+	}
+	for _, d := range minfo.AddSubjectAltNames {
+		d = util.GetDomainFQDNDot(d)
+		if contained[d] {
+			continue
+		}
+		domains = append(domains, d)
+		contained[d] = true
+	}
+
+	previous := make(map[string]bool, len(oldDomains))
+	for _, d := range oldDomains {
+		previous[d] = true
+	}
+
+	added := make([]string, 0, len(domains))
+	for _, d := range domains {
+		if !previous[d] {
+			added = append(added, d)
+		}
+	}
+	removed := make([]string, 0, len(oldDomains))
+	for _, d := range oldDomains {
+		if !contained[d] {
+			removed = append(removed, d)
+		}
+	}
+
+	return domains, added, removed
+}
+
+type autoDNSEntry struct {
+	domain string
+	provID string
+	prov   dnstypes.DNSProvider
+}
+
+// Resolves the AutoDNS providers for the given domains, wildcard domains are skipped. Setting
+// records stops waiting for the DNS provider's queue when ctx is done.
+func (s *V1) getAutoDNSEntries(ctx context.Context, domains []string) ([]*autoDNSEntry, error) {
+
+	conf := s.Service.config()
+	res := make([]*autoDNSEntry, 0, len(domains))
+
+	for _, domain := range domains {
+
+		if util.IsWildcard(domain) {
+			log.WithField("domain", domain).Debug("Ignoring wildcard domain for AutoDNS")
+			continue
+		}
+
+		rz, err := conf.RootZones.GetLowestRZForDomain(domain)
+		if err != nil {
+			return nil, err
+		}
+		if rz.DNSProvAutoDNS == "" {
+			return nil, &common.InvalidInputError{Msg: fmt.Sprintf(
+				"AutoDNS provider for root zone '%s' not configured", rz.Root)}
+		}
+		autodnsProv, exists := conf.DNS.Providers[rz.DNSProvAutoDNS]
+		if !exists {
+			return nil, &common.InvalidInputError{Msg: fmt.Sprintf(
+				"AutoDNS provider '%s' configured for root zone '%s' not found", rz.DNSProvAutoDNS, rz.Root)}
+		}
+
+		res = append(res, &autoDNSEntry{
+			domain: domain,
+			provID: rz.DNSProvAutoDNS,
+			prov:   conf.CA.Functions.Queue.WrapDNSProvider(ctx, rz.DNSProvAutoDNS, autodnsProv.Prov),
+		})
+	}
+
+	return res, nil
+}
+
+// Returns transactional jobs setting the AutoDNS A records for the given domains, the DNS
+// provider calls are traced as child spans of ctx
+func (s *V1) makeAutoDNSSetJobs(ctx context.Context, domains []string, autodns *apiv1.AutoDNSInfo) ([]util.TransactionalJob, error) {
+
+	autodnsV4 := net.ParseIP(autodns.IPv4)
+	if autodnsV4 == nil {
+		return nil, &common.InvalidInputError{Msg: "Net address for AutoDNS not parseable"}
+	}
+	autodnsV4 = autodnsV4.To4()
+	if autodnsV4 == nil {
+		return nil, &common.InvalidInputError{Msg: "Net address for AutoDNS not of v4 format"}
+	}
+
+	entries, err := s.getAutoDNSEntries(ctx, domains)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]util.TransactionalJob, 0, len(entries))
+	for _, entry := range entries {
+
+		entry := entry //bump the scope
+		prov := dnscommon.TraceDNSProvider(ctx, entry.provID, entry.prov)
+
+		jobs = append(jobs, &util.TransactionalJobImpl{
+			Name: "autodns " + entry.domain,
+			DoFunc: func() error {
+				log.WithFields(logrus.Fields{"domain": entry.domain, "prov": entry.prov, "addr": autodnsV4}).Info(
+					"Setting AutoDNS entry")
+				return prov.SetRecordA(entry.domain, prov.GetInfo().DefaultAutoDNSTTL, autodnsV4)
+			},
+			UndoFunc: func() error {
+				log.WithFields(logrus.Fields{"domain": entry.domain, "prov": entry.prov}).Info(
+					"Rolling back AutoDNS entry")
+				return prov.DeleteRecordA(entry.domain)
+			},
+		})
+	}
+
+	return jobs, nil
+}
+
+func (s *V1) RenewCertificate(caID, crtID string, rinfo *apiv1.CertRenewInfo, authz authtypes.AuthorizationInfo) (*apiv1.CertRenewResult, error) {
+
+	s.logAction(authz, fmt.Sprintf("RenewCertificate %s %s force=%t", caID, crtID, rinfo.Force))
+
+	crtID = util.GetDomainFQDNDot(crtID)
+
+	fu := s.Service.config().CA.Functions
+
+	err := chkAuthCertOp(authz, authtypes.ScopeRenew, caID)
+	if err != nil {
+		return nil, err
+	}
+	err = authz.ChkAuthWriteDomain(crtID)
+	if err != nil {
+		return nil, err
+	}
+
+	cinfo, err := fu.GetCertificateInfo(caID, crtID)
+	if err != nil {
+		return nil, err
+	}
+	if cinfo == nil {
+		return nil, &common.NotFoundError{RequestedResource: crtID}
+	}
+
+	err = s.Service.renewExclusive(caID, crtID, func() error {
+		return fu.RenewCertificate(&types.CertificateRenewInfo{
+			CAID:        caID,
+			CertKey:     crtID,
+			ExpiresAt:   cinfo.ValidEndTime,
+			NextRenewal: cinfo.NextRenewalTime,
+			TTLSelected: cinfo.TTLSelected,
+			Force:       rinfo.Force,
+		})
+	})
+	if err != nil {
+		var norenew *common.NoRenewalDueError
+		if errors.As(err, &norenew) {
+			return nil, &common.InvalidInputError{Msg: fmt.Sprintf(
+				"no renewal is due yet, earliest on %s, set 'force' to renew anyway",
+				norenew.RenewalDate.Format(time.RFC3339))}
+		}
+		return nil, err
+	}
+
+	cinfo, err = fu.GetCertificateInfo(caID, crtID)
+	if err != nil {
+		return nil, err
+	}
+	if cinfo == nil {
+		return nil, &common.NotFoundError{RequestedResource: crtID}
+	}
+
+	return &apiv1.CertRenewResult{
+		Name:        cinfo.Name,
+		ValidFrom:   cinfo.ValidStartTime.Format(time.RFC3339),
+		ValidTo:     cinfo.ValidEndTime.Format(time.RFC3339),
+		NextRenewal: cinfo.NextRenewalTime.Format(time.RFC3339),
+		RenewCount:  cinfo.RenewCount,
+	}, nil
 
 }
 
@@ -137,10 +655,14 @@ func (s *V1) DeleteCertificate(caID, crtID string, authz authtypes.Authorization
 
 	crtID = util.GetDomainFQDNDot(crtID)
 
-	fu := s.Service.Config.CA.Functions
+	fu := s.Service.config().CA.Functions
 
+	err := chkAuthCertOp(authz, authtypes.ScopeDelete, caID)
+	if err != nil {
+		return err
+	}
 	// SANs are not checked for deletion permission at the moment...
-	err := authz.ChkAuthWriteDomain(crtID)
+	err = authz.ChkAuthWriteDomain(crtID)
 	if err != nil {
 		return err
 	}
@@ -155,18 +677,19 @@ func (s *V1) GetCertificateResource(caID, crtID, obj string, authz authtypes.Aut
 
 	crtID = util.GetDomainFQDNDot(crtID)
 
-	fu := s.Service.Config.CA.Functions
+	err := authz.ChkAuthCA(caID)
+	if err != nil {
+		return "", "", err
+	}
+
+	fu := s.Service.config().CA.Functions
 	res, err := fu.GetCertificateResource(crtID, caID, obj)
 	if err != nil {
 		return "", "", err
 	}
 
 	//GetCertificateResource does not modify anything, so check permissions after request...
-	if res.CanBePublic {
-		err = authz.ChkAuthReadDomainsPublic(res.Domains)
-	} else {
-		err = authz.ChkAuthReadDomains(res.Domains)
-	}
+	err = chkAuthReadResource(authz, res.CanBePublic, res.Domains)
 
 	if err != nil {
 		return "", "", err
@@ -182,7 +705,12 @@ func (s *V1) GetAllCertResources(caID, crtID string, authz authtypes.Authorizati
 
 	crtID = util.GetDomainFQDNDot(crtID)
 
-	fu := s.Service.Config.CA.Functions
+	err := chkAuthCertOp(authz, authtypes.ScopeReadKey, caID)
+	if err != nil {
+		return nil, err
+	}
+
+	fu := s.Service.config().CA.Functions
 
 	r, err := fu.GetCertificateResources(crtID, caID)
 	if err != nil {
@@ -223,7 +751,13 @@ func (s *V1) GetCertificateInfos(caID string, crtID string, authz authtypes.Auth
 
 	//TODO pagination
 
-	fu := s.Service.Config.CA.Functions
+	conf := s.Service.config()
+	fu := conf.CA.Functions
+
+	err := authz.ChkAuthScope(authtypes.ScopeReadPublic)
+	if err != nil {
+		return nil, err
+	}
 
 	doms := authz.GetDomainsAllowed()
 
@@ -238,9 +772,25 @@ func (s *V1) GetCertificateInfos(caID string, crtID string, authz authtypes.Auth
 	// we can interpret a len(doms) <= 0 now as "permit all"
 	// note that this request just lists public info, no secrets
 
-	r, err := fu.GetCertificateInfos(caID, crtID, doms, pginfo)
-	if err != nil {
-		return nil, err
+	var r []types.CACertInfo
+	if caIDs := allowedCAs(conf, authz); caID == "" && caIDs != nil {
+		//the client may only use some CAs, pagination applies to each of them
+		for _, id := range caIDs {
+			infos, err := fu.GetCertificateInfos(id, crtID, doms, pginfo)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, infos...)
+		}
+	} else {
+		err = authz.ChkAuthCA(caID)
+		if err != nil {
+			return nil, err
+		}
+		r, err = fu.GetCertificateInfos(caID, crtID, doms, pginfo)
+		if err != nil {
+			return nil, err
+		}
 	}
 	res := make([]apiv1.CertInfo, len(r))
 	for i, cinfo := range r {
@@ -260,10 +810,14 @@ func (s *V1) GetCertificateInfo(caID string, crtID string, authz authtypes.Autho
 
 	crtID = util.GetDomainFQDNDot(crtID)
 
-	fu := s.Service.Config.CA.Functions
+	fu := s.Service.config().CA.Functions
 
+	err := chkAuthCertOp(authz, authtypes.ScopeReadPublic, caID)
+	if err != nil {
+		return nil, err
+	}
 	// TODO: do we need to implement SAN permissions check?
-	err := authz.ChkAuthReadDomainPublic(crtID)
+	err = authz.ChkAuthReadDomainPublic(crtID)
 	if err != nil {
 		return nil, err
 	}
@@ -283,6 +837,15 @@ func (s *V1) GetCertificateInfo(caID string, crtID string, authz authtypes.Autho
 		return nil, err
 	}
 
+	retry, err := s.Service.getRenewRetry(caID, crtID)
+	if err != nil {
+		return nil, err
+	}
+	if retry != nil {
+		res.RenewFailures = retry.Failures
+		res.LastRenewError = retry.LastError
+	}
+
 	return res, nil
 
 }
@@ -293,17 +856,93 @@ func (s *V1) DeleteCertificatesAllCA(crtID string, authz authtypes.Authorization
 
 	crtID = util.GetDomainFQDNDot(crtID)
 
-	fu := s.Service.Config.CA.Functions
+	conf := s.Service.config()
+	fu := conf.CA.Functions
 
-	err := authz.ChkAuthWriteDomain(crtID)
+	err := authz.ChkAuthScope(authtypes.ScopeDelete)
+	if err != nil {
+		return err
+	}
+	err = authz.ChkAuthWriteDomain(crtID)
 	if err != nil {
 		return err
 	}
 
+	//the certificate must not be deleted in CAs the client may not use
+	for id := range conf.CA.Providers {
+		if authz.ChkAuthCA(id) == nil {
+			continue
+		}
+		cinfo, err := fu.GetCertificateInfo(id, crtID)
+		if err != nil {
+			return err
+		}
+		if cinfo != nil {
+			return authz.ChkAuthCA(id)
+		}
+	}
+
 	return fu.DeleteCertificatesAllCA(crtID)
 
 }
 
+// Checks if the client may do the kind of certificate operation in the CA
+func chkAuthCertOp(authz authtypes.AuthorizationInfo, scope authtypes.Scope, caID string) error {
+	err := authz.ChkAuthScope(scope)
+	if err != nil {
+		return err
+	}
+	return authz.ChkAuthCA(caID)
+}
+
+// Private keys need the read-key scope and private read permission for the domains
+func chkAuthReadResource(authz authtypes.AuthorizationInfo, canBePublic bool, domains []string) error {
+	if canBePublic {
+		err := authz.ChkAuthScope(authtypes.ScopeReadPublic)
+		if err != nil {
+			return err
+		}
+		return authz.ChkAuthReadDomainsPublic(domains)
+	}
+	err := authz.ChkAuthScope(authtypes.ScopeReadKey)
+	if err != nil {
+		return err
+	}
+	return authz.ChkAuthReadDomains(domains)
+}
+
+// Returns the scopes the client may use, nil if it may use all of them
+func allowedScopes(authz authtypes.AuthorizationInfo) []authtypes.Scope {
+	var res []authtypes.Scope
+	for _, scope := range authtypes.AllScopes {
+		if authz.ChkAuthScope(scope) == nil {
+			res = append(res, scope)
+		}
+	}
+	if len(res) == len(authtypes.AllScopes) {
+		return nil
+	}
+	return res
+}
+
+// Returns the sorted IDs of the CAs the client may use, nil if it may use all of them
+func allowedCAs(conf *Config, authz authtypes.AuthorizationInfo) []string {
+	if conf.CA == nil {
+		return nil
+	}
+	res := make([]string, 0, len(conf.CA.Providers))
+	for id := range conf.CA.Providers {
+		if authz.ChkAuthCA(id) == nil {
+			res = append(res, id)
+		}
+	}
+	if len(res) == len(conf.CA.Providers) {
+		return nil
+	}
+	slices.Sort(res)
+	return res
+}
+
 func apiCertInfoFromCACertInfo(source *types.CACertInfo, target *apiv1.CertInfo) error {
 	cbatch, err := util.ParseCertificatePEM([]byte(source.CertPEM))
 	if err != nil {
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+)
+
+func TestModifiedDomains(t *testing.T) {
+
+	yes := true
+	no := false
+
+	tests := []struct {
+		name    string
+		old     []string
+		minfo   *apiv1.CertModifyInfo
+		domains []string
+		added   []string
+		removed []string
+	}{
+		{
+			name: "add and remove SANs",
+			old:  []string{"foo.example.com.", "a.example.com.", "b.example.com."},
+			minfo: &apiv1.CertModifyInfo{
+				AddSubjectAltNames:    []string{"c.example.com", "a.example.com."},
+				RemoveSubjectAltNames: []string{"b.example.com", "x.example.com."},
+			},
+			domains: []string{"foo.example.com.", "a.example.com.", "c.example.com."},
+			added:   []string{"c.example.com."},
+			removed: []string{"b.example.com."},
+		},
+		{
+			name:    "enable wildcard",
+			old:     []string{"foo.example.com.", "a.example.com."},
+			minfo:   &apiv1.CertModifyInfo{Wildcard: &yes},
+			domains: []string{"*.foo.example.com.", "a.example.com."},
+			added:   []string{"*.foo.example.com."},
+			removed: []string{"foo.example.com."},
+		},
+		{
+			name:    "disable wildcard",
+			old:     []string{"*.foo.example.com."},
+			minfo:   &apiv1.CertModifyInfo{Wildcard: &no},
+			domains: []string{"foo.example.com."},
+			added:   []string{"foo.example.com."},
+			removed: []string{"*.foo.example.com."},
+		},
+		{
+			name:    "first domain cannot be removed",
+			old:     []string{"foo.example.com.", "a.example.com."},
+			minfo:   &apiv1.CertModifyInfo{RemoveSubjectAltNames: []string{"foo.example.com."}},
+			domains: []string{"foo.example.com.", "a.example.com."},
+			added:   []string{},
+			removed: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains, added, removed := modifiedDomains("foo.example.com.", tt.old, tt.minfo)
+			if !reflect.DeepEqual(domains, tt.domains) {
+				t.Errorf("domains: got %v, want %v", domains, tt.domains)
+			}
+			if !reflect.DeepEqual(added, tt.added) {
+				t.Errorf("added: got %v, want %v", added, tt.added)
+			}
+			if !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("removed: got %v, want %v", removed, tt.removed)
+			}
+		})
+	}
+
+}
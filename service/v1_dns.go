@@ -13,7 +13,7 @@ func (s *V1) GetDNSHandlers() []apiv1.DNSHandlerInfo {
 	s.logAction(nil, "GetDNSHandlers")
 
 	res := make([]apiv1.DNSHandlerInfo, 0, 10)
-	for id, pinfo := range s.Service.Config.DNS.Providers {
+	for id, pinfo := range s.Service.config().DNS.Providers {
 		info := pinfo.Prov.GetInfo()
 		res = append(res, apiv1.DNSHandlerInfo{
 			ID:          id,
@@ -31,7 +31,7 @@ func (s *V1) GetDNSRootzones() []apiv1.DNSRootzoneInfo {
 	s.logAction(nil, "GetDNSRootzones")
 
 	res := make([]apiv1.DNSRootzoneInfo, 0, 10)
-	for _, rz := range s.Service.Config.RootZones {
+	for _, rz := range s.Service.config().RootZones {
 		res = append(res, apiv1.DNSRootzoneInfo{
 			Root:    rz.Root,
 			AutoDNS: rz.DNSProvAutoDNS,
@@ -77,10 +77,11 @@ func (s *V1) GetCAs() ([]*apiv1.CAInfo, error) {
 
 	s.logAction(nil, "GetCAs")
 
-	fu := s.Service.Config.CA.Functions
+	conf := s.Service.config()
+	fu := conf.CA.Functions
 
 	res := make([]*apiv1.CAInfo, 0, 10)
-	for id, prov := range s.Service.Config.CA.Providers {
+	for id, prov := range conf.CA.Providers {
 		cainfo, err := caInfoFromProvider(fu, id, prov)
 		if err != nil {
 			return nil, err
@@ -95,9 +96,10 @@ func (s *V1) GetCA(id string) (*apiv1.CAInfo, error) {
 
 	s.logAction(nil, fmt.Sprintf("GetCA %s", id))
 
-	fu := s.Service.Config.CA.Functions
+	conf := s.Service.config()
+	fu := conf.CA.Functions
 
-	prov, exists := s.Service.Config.CA.Providers[id]
+	prov, exists := conf.CA.Providers[id]
 	if !exists {
 		return nil, &common.NotFoundError{RequestedResource: id}
 	}
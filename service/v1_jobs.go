@@ -0,0 +1,45 @@
+package service
+
+import (
+	"fmt"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/jobs"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+func (s *V1) GetJob(jobID string, authz authtypes.AuthorizationInfo) (*apiv1.JobInfo, error) {
+
+	s.logAction(authz, fmt.Sprintf("GetJob %s", jobID))
+
+	sess, err := s.Service.getJobState().NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	job, err := sess.GetJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, &common.NotFoundError{RequestedResource: jobID}
+	}
+
+	//the creator of a job may always see it, others need read permission for the cert
+	if !job.CreatedBy.Equal(authz.GetUserInfo()) {
+		if job.Type == jobs.TypeRenewalRun {
+			err = authz.ChkAuthAdmin()
+		} else {
+			err = authz.ChkAuthReadDomain(job.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return apiJobInfoFromJob(job), nil
+
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/renew"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+// Lists the renewal jobs of all certificates, only for admins
+func (s *V1) GetRenewalJobs(filter *renew.JobFilter, authz authtypes.AuthorizationInfo,
+	pginfo *util.PaginationInfo) ([]apiv1.RenewalJobInfo, error) {
+
+	s.logAction(authz, "GetRenewalJobs")
+
+	err := authz.ChkAuthAdmin()
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.CertKey != "" {
+		filter.CertKey = util.GetDomainFQDNDot(filter.CertKey)
+	}
+
+	return s.listRenewalJobs(filter, pginfo)
+
+}
+
+// Lists the renewal jobs of a certificate
+func (s *V1) GetCertRenewalJobs(caID, crtID string, authz authtypes.AuthorizationInfo,
+	pginfo *util.PaginationInfo) ([]apiv1.RenewalJobInfo, error) {
+
+	s.logAction(authz, fmt.Sprintf("GetCertRenewalJobs %s %s", caID, crtID))
+
+	crtID = util.GetDomainFQDNDot(crtID)
+
+	err := chkAuthCertOp(authz, authtypes.ScopeReadPublic, caID)
+	if err != nil {
+		return nil, err
+	}
+	cinfo, err := s.Service.config().CA.Functions.GetCertificateInfo(caID, crtID)
+	if err != nil {
+		return nil, err
+	}
+	if cinfo == nil {
+		return nil, &common.NotFoundError{RequestedResource: crtID}
+	}
+	//the key name alone does not tell which domains the certificate is for
+	err = authz.ChkAuthReadDomainsPublic(cinfo.Domains)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.listRenewalJobs(&renew.JobFilter{CAID: caID, CertKey: crtID}, pginfo)
+
+}
+
+func (s *V1) listRenewalJobs(filter *renew.JobFilter, pginfo *util.PaginationInfo) ([]apiv1.RenewalJobInfo, error) {
+
+	sess, err := (&renew.JobStateManagerSQL{Prov: s.Service.Config.DB}).NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	jobs, err := sess.ListRenewalJobs(filter, pginfo)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]apiv1.RenewalJobInfo, len(jobs))
+	for i := range jobs {
+		res[i] = apiRenewalJobInfoFromJob(&jobs[i])
+	}
+	return res, nil
+
+}
+
+func apiRenewalJobInfoFromJob(job *renew.Job) apiv1.RenewalJobInfo {
+	res := apiv1.RenewalJobInfo{
+		ID:      job.ID,
+		CAID:    job.CAID,
+		Name:    job.CertKey,
+		Status:  string(job.Status),
+		Trigger: string(job.Trigger),
+		Attempt: job.Attempt,
+		Created: job.CreatedTime.Format(time.RFC3339),
+		Error:   job.Error,
+	}
+	if !job.StartTime.IsZero() {
+		res.Started = job.StartTime.Format(time.RFC3339)
+	}
+	if !job.EndTime.IsZero() {
+		res.Finished = job.EndTime.Format(time.RFC3339)
+	}
+	return res
+}
+
+// Runs a renewal run right away and waits for it, only for admins
+func (s *V1) RunRenewals(req *apiv1.RenewalRunRequest, authz authtypes.AuthorizationInfo) (*apiv1.RenewalRunReport, error) {
+
+	s.logAction(authz, "RunRenewals")
+
+	err := authz.ChkAuthAdmin()
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := renewalRunOptions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Service.RunRenewals(opts)
+
+}
+
+// Starts a renewal run right away in the background, only for admins. Returns the job
+// which reports the progress of the run.
+func (s *V1) StartRenewalRun(req *apiv1.RenewalRunRequest, authz authtypes.AuthorizationInfo) (*apiv1.JobInfo, error) {
+
+	s.logAction(authz, "StartRenewalRun")
+
+	err := authz.ChkAuthAdmin()
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := renewalRunOptions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := s.Service.StartRenewalRun(opts, authz.GetUserInfo())
+	if err != nil {
+		return nil, err
+	}
+	return apiJobInfoFromJob(job), nil
+
+}
+
+func renewalRunOptions(req *apiv1.RenewalRunRequest) (*RenewalRunOptions, error) {
+
+	var err error
+	opts := &RenewalRunOptions{
+		CAID:     req.CAID,
+		RootZone: req.RootZone,
+		DryRun:   req.DryRun,
+	}
+	if req.ExpiringBefore != "" {
+		opts.ExpiringBefore, err = time.Parse(time.RFC3339, req.ExpiringBefore)
+		if err != nil {
+			return nil, &common.InvalidInputError{Msg: "'expiringBefore' must be an RFC 3339 timestamp"}
+		}
+	}
+	if req.MaxDuration != "" {
+		opts.MaxDuration, err = time.ParseDuration(req.MaxDuration)
+		if err != nil || opts.MaxDuration < 0 {
+			return nil, &common.InvalidInputError{Msg: "'maxDuration' must be a positive duration, e.g. 10m"}
+		}
+	}
+	return opts, nil
+
+}
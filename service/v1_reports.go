@@ -0,0 +1,108 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/common"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+// Reports the certificates expiring within the given period which the client may read,
+// grouped by CA and root zone. Already expired certificates are included.
+func (s *V1) GetExpiryReport(within time.Duration, caID, rootZone string,
+	authz authtypes.AuthorizationInfo) (*apiv1.ExpiryReport, error) {
+
+	s.logAction(authz, fmt.Sprintf("GetExpiryReport %s %s %s", within, caID, rootZone))
+
+	if len(authz.GetDomainsAllowed()) <= 0 && !authz.CanListPublicData() {
+		return nil, &common.UnauthzedError{Msg: "No authorization for any domains"}
+	}
+	err := authz.ChkAuthScope(authtypes.ScopeReadPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	if rootZone != "" {
+		rootZone = util.GetDomainFQDNDot(rootZone)
+	}
+
+	conf := s.Service.config()
+	fu := conf.CA.Functions
+
+	now := time.Now()
+	until := now.Add(within)
+
+	report := &apiv1.ExpiryReport{
+		Until:  until.Format(time.RFC3339),
+		Groups: make([]apiv1.ExpiryReportGroup, 0),
+	}
+	groupIdx := make(map[[2]string]int)
+
+	for id := range conf.CA.Providers {
+		if caID != "" && id != caID || authz.ChkAuthCA(id) != nil {
+			continue
+		}
+
+		expiring, err := fu.ListExpiringCertInfos(id, until)
+		if err != nil {
+			return nil, err
+		}
+		if len(expiring) <= 0 {
+			continue
+		}
+		retries, err := s.Service.listRenewRetries(id)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cert := range expiring {
+			if authz.ChkAuthReadDomainsPublic(cert.Domains) != nil {
+				continue
+			}
+			rz := ""
+			if zone, err := conf.RootZones.GetLowestRZForDomain(cert.Name); err == nil {
+				rz = util.GetDomainFQDNDot(zone.Root)
+			}
+			if rootZone != "" && rz != rootZone {
+				continue
+			}
+
+			info := apiv1.ExpiringCertInfo{
+				Name:        cert.Name,
+				ValidTo:     cert.ValidEndTime.Format(time.RFC3339),
+				DaysLeft:    int(math.Floor(cert.ValidEndTime.Sub(now).Hours() / 24)),
+				NextRenewal: cert.NextRenewalTime.Format(time.RFC3339),
+			}
+			if cert.IssuedBy != nil {
+				info.Owner.Name = cert.IssuedBy.Name
+				info.Owner.EMail = cert.IssuedBy.Email
+			}
+			if retry, exists := retries[cert.Name]; exists {
+				info.LastRenewError = retry.LastError
+			}
+
+			key := [2]string{id, rz}
+			i, exists := groupIdx[key]
+			if !exists {
+				i = len(report.Groups)
+				groupIdx[key] = i
+				report.Groups = append(report.Groups, apiv1.ExpiryReportGroup{CAID: id, RootZone: rz})
+			}
+			report.Groups[i].Certs = append(report.Groups[i].Certs, info)
+		}
+	}
+
+	//certs within a group stay ordered by expiry
+	slices.SortFunc(report.Groups, func(a, b apiv1.ExpiryReportGroup) int {
+		return cmp.Or(cmp.Compare(a.CAID, b.CAID), cmp.Compare(a.RootZone, b.RootZone))
+	})
+
+	return report, nil
+
+}
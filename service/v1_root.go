@@ -13,7 +13,8 @@ type V1 struct {
 
 func (s *V1) GetServerInfo() *apiv1.ServerInfo {
 
-	renewal, err := s.Service.Config.CA.Functions.GetLastRenewSummary()
+	conf := s.Service.config()
+	renewal, err := conf.CA.Functions.GetLastRenewSummary()
 	if err != nil {
 		log.WithError(err).Error("Could not retrieve last renew summary from database.")
 	}
@@ -26,17 +27,30 @@ func (s *V1) GetServerInfo() *apiv1.ServerInfo {
 		}
 	}
 
+	stats := conf.CA.Functions.Queue.GetStats()
+	apiQueue := make([]apiv1.ServerInfoQueue, len(stats))
+	for i, st := range stats {
+		apiQueue[i] = apiv1.ServerInfoQueue{
+			Kind:    st.Kind,
+			ID:      st.ID,
+			Limit:   st.Limit,
+			Running: st.Running,
+			Waiting: st.Waiting,
+		}
+	}
+
 	return &apiv1.ServerInfo{
 		Version: &apiv1.ServerInfoVersion{
 			Daemon: context.ServiceVersion,
 			API:    srvapiv1.Version,
 		},
 		Contact: &apiv1.ServerInfoContact{
-			URL:   s.Service.Config.URL,
-			EMail: s.Service.Config.AdminEMail,
+			URL:   conf.URL,
+			EMail: conf.AdminEMail,
 		},
-		Auth:    s.Service.Config.Auth.GetServerInfoAuth(),
+		Auth:    conf.Auth.GetServerInfoAuth(),
 		Renewal: apiRenewal,
+		Queue:   apiQueue,
 	}
 }
 
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/service/auth/token"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+// Creates a token for the user, which may only be limited to domains and permissions the
+// user has. A token created via the API may create tokens for its user, which do not
+// outlive it. The plain token is only returned here.
+func (s *V1) CreateToken(tinfo *apiv1.TokenCreateInfo, authz authtypes.AuthorizationInfo) (*apiv1.TokenCreateResult, error) {
+
+	s.logAction(authz, fmt.Sprintf("CreateToken %s", tinfo.Name))
+
+	conf := s.Service.config()
+	owner, err := tokenOwner(authz)
+	if err != nil {
+		return nil, err
+	}
+	delegation := authz.GetDelegation()
+
+	validFor, err := util.ParseDurationDays(tinfo.ValidFor)
+	if err != nil || validFor <= 0 {
+		return nil, &common.InvalidInputError{Msg: "'validFor' must be a duration like 90d or 36h"}
+	}
+	if maxValidity := conf.Auth.Token.Config.MaxValidity; validFor > maxValidity {
+		return nil, &common.InvalidInputError{Msg: fmt.Sprintf("'validFor' must not exceed %s", maxValidity)}
+	}
+
+	domains := make([]string, len(tinfo.Domains))
+	for i := range tinfo.Domains {
+		domains[i] = util.GetDomainFQDNDot(tinfo.Domains[i])
+	}
+
+	//a token cannot do more than its owner
+	err = authz.ChkAuthReadDomains(domains)
+	if err != nil {
+		return nil, err
+	}
+	if tinfo.Write {
+		err = authz.ChkAuthWriteDomains(domains)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tinfo.Admin {
+		err = authz.ChkAuthAdmin()
+		if err != nil {
+			return nil, err
+		}
+	}
+	restrictions, err := tokenRestrictions(tinfo, conf, authz)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	expiry := now.Add(validFor)
+	if delegation != nil && !delegation.Expiry.IsZero() && expiry.After(delegation.Expiry) {
+		expiry = delegation.Expiry
+	}
+	if tinfo.NotBefore != "" {
+		restrictions.NotBefore, err = time.Parse(time.RFC3339, tinfo.NotBefore)
+		if err != nil {
+			return nil, &common.InvalidInputError{Msg: "'notBefore' must be an RFC 3339 timestamp"}
+		}
+	}
+	//the token is not valid before the calling token either
+	if delegation != nil && delegation.NotBefore.After(restrictions.NotBefore) {
+		restrictions.NotBefore = delegation.NotBefore
+	}
+	if !restrictions.NotBefore.IsZero() && !restrictions.NotBefore.Before(expiry) {
+		return nil, &common.InvalidInputError{Msg: "'notBefore' must be before the expiry of the token"}
+	}
+	restrictions.NotAfter = expiry
+
+	state, err := s.Service.getTokenState()
+	if err != nil {
+		return nil, err
+	}
+	sess, err := state.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	existing, err := sess.ListTokens(owner)
+	if err != nil {
+		return nil, err
+	}
+	for _, tkn := range existing {
+		if tkn.Name == tinfo.Name {
+			return nil, &common.AlreadyExistsError{RequestedResource: "token " + tinfo.Name}
+		}
+	}
+
+	plain, err := token.GenerateRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	id, err := token.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	tkn := &token.DBToken{
+		ID:             id,
+		Name:           tinfo.Name,
+		Hash:           token.ConvertPlainToken(plain),
+		Owner:          owner,
+		DomainsAllowed: domains,
+		Write:          tinfo.Write,
+		Admin:          tinfo.Admin,
+		CreatedTime:    now,
+		ExpiryTime:     expiry,
+		Restrictions:   *restrictions,
+	}
+	err = sess.PutToken(tkn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.TokenCreateResult{
+		TokenInfo: apiTokenInfoFromToken(tkn, now),
+		Token:     plain,
+	}, nil
+
+}
+
+// Lists the tokens of the user, or the tokens of all users for admins if all is set.
+func (s *V1) GetTokens(all bool, authz authtypes.AuthorizationInfo) ([]apiv1.TokenInfo, error) {
+
+	s.logAction(authz, "GetTokens")
+
+	var owner *authtypes.UserInfo
+	if all {
+		err := authz.ChkAuthAdmin()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		owner, err = tokenOwner(authz)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := s.Service.getTokenState()
+	if err != nil {
+		return nil, err
+	}
+	sess, err := state.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	tokens, err := sess.ListTokens(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res := make([]apiv1.TokenInfo, len(tokens))
+	for i := range tokens {
+		res[i] = apiTokenInfoFromToken(&tokens[i], now)
+	}
+	return res, nil
+
+}
+
+// Revokes a token of the user, admins may revoke the tokens of all users. Returns the
+// revoked token.
+func (s *V1) RevokeToken(id string, authz authtypes.AuthorizationInfo) (*apiv1.TokenInfo, error) {
+
+	s.logAction(authz, fmt.Sprintf("RevokeToken %s", id))
+
+	state, err := s.Service.getTokenState()
+	if err != nil {
+		return nil, err
+	}
+	sess, err := state.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogDefer(log, sess.Close)
+
+	tkn, err := sess.GetToken(id)
+	if err != nil {
+		return nil, err
+	}
+	if tkn == nil {
+		return nil, &common.NotFoundError{RequestedResource: "token " + id}
+	}
+	if owner, ownerErr := tokenOwner(authz); ownerErr != nil || !tkn.Owner.Equal(owner) {
+		err = authz.ChkAuthAdmin()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = sess.DelToken(id)
+	if err != nil {
+		return nil, err
+	}
+
+	info := apiTokenInfoFromToken(tkn, time.Now())
+	return &info, nil
+
+}
+
+// Returns the user whose tokens the client manages. A token created via the API acts for its
+// user, configured tokens and client certificates have no user who could own tokens.
+func tokenOwner(authz authtypes.AuthorizationInfo) (*authtypes.UserInfo, error) {
+	if delegation := authz.GetDelegation(); delegation != nil {
+		if delegation.Owner == nil {
+			return nil, &common.UnauthzedError{Msg: "tokens can only be managed by users or their tokens"}
+		}
+		return delegation.Owner, nil
+	}
+	owner := authz.GetUserInfo()
+	if owner == nil {
+		return nil, &common.NotAuthnedError{Msg: "tokens can only be managed by authenticated users"}
+	}
+	return owner, owner.Validate()
+}
+
+// Returns the scopes, CAs and source networks of the token, which must be a subset of the
+// user's or the calling token's. If none are requested, the token gets those of the caller.
+func tokenRestrictions(tinfo *apiv1.TokenCreateInfo, conf *Config,
+	authz authtypes.AuthorizationInfo) (*token.Restrictions, error) {
+
+	var callerCIDRs []string
+	if delegation := authz.GetDelegation(); delegation != nil {
+		callerCIDRs = delegation.SourceCIDRs
+	}
+	res := &token.Restrictions{SourceCIDRs: tinfo.SourceCIDRs}
+	for _, cidr := range tinfo.SourceCIDRs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, &common.InvalidInputError{Msg: fmt.Sprintf("invalid source CIDR '%s'", cidr)}
+		}
+		if len(callerCIDRs) > 0 && !cidrWithin(ipnet, callerCIDRs) {
+			return nil, &common.UnauthzedError{
+				Msg: fmt.Sprintf("source CIDR '%s' is not within those of the calling token", cidr)}
+		}
+	}
+	if len(tinfo.SourceCIDRs) == 0 {
+		res.SourceCIDRs = callerCIDRs
+	}
+
+	scopes, err := authtypes.ParseScopes(tinfo.Scopes)
+	if err != nil {
+		return nil, &common.InvalidInputError{Msg: err.Error()}
+	}
+	if len(scopes) > 0 {
+		for _, scope := range scopes {
+			err = authz.ChkAuthScope(scope)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res.Scopes = scopes
+	} else {
+		res.Scopes = allowedScopes(authz)
+	}
+
+	if len(tinfo.CAs) > 0 {
+		for _, caID := range tinfo.CAs {
+			if conf.CA == nil || conf.CA.Providers[caID] == nil {
+				return nil, &common.InvalidInputError{Msg: fmt.Sprintf("CA '%s' does not exist", caID)}
+			}
+			err = authz.ChkAuthCA(caID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res.CAsAllowed = tinfo.CAs
+	} else {
+		res.CAsAllowed = allowedCAs(conf, authz)
+		if res.CAsAllowed != nil && len(res.CAsAllowed) == 0 {
+			return nil, &common.UnauthzedError{Msg: "user has no permission for any CA"}
+		}
+	}
+
+	return res, nil
+
+}
+
+// Whether ipnet is contained in one of the networks
+func cidrWithin(ipnet *net.IPNet, cidrs []string) bool {
+	ones, bits := ipnet.Mask.Size()
+	for _, cidr := range cidrs {
+		_, outer, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		outerOnes, outerBits := outer.Mask.Size()
+		if bits == outerBits && ones >= outerOnes && outer.Contains(ipnet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) getTokenState() (token.TokenStateManager, error) {
+	state := s.config().Auth.Token.State
+	if state == nil {
+		return nil, fmt.Errorf("token store has not been initialized")
+	}
+	return state, nil
+}
+
+func apiTokenInfoFromToken(tkn *token.DBToken, now time.Time) apiv1.TokenInfo {
+	info := apiv1.TokenInfo{
+		ID:          tkn.ID,
+		Name:        tkn.Name,
+		Owner:       tkn.Owner.Name,
+		OwnerEmail:  tkn.Owner.Email,
+		Domains:     tkn.DomainsAllowed,
+		Write:       tkn.Write,
+		Admin:       tkn.Admin,
+		CAs:         tkn.CAsAllowed,
+		SourceCIDRs: tkn.SourceCIDRs,
+		Created:     tkn.CreatedTime.Format(time.RFC3339),
+		Expires:     tkn.ExpiryTime.Format(time.RFC3339),
+		Expired:     tkn.Expired(now),
+	}
+	for _, scope := range tkn.Scopes {
+		info.Scopes = append(info.Scopes, string(scope))
+	}
+	if !tkn.NotBefore.IsZero() {
+		info.NotBefore = tkn.NotBefore.Format(time.RFC3339)
+	}
+	if !tkn.LastUsedTime.IsZero() {
+		info.LastUsed = tkn.LastUsedTime.Format(time.RFC3339)
+	}
+	return info
+}
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/ca"
+	"github.com/dns3l/dns3l-core/common"
+	"github.com/dns3l/dns3l-core/jobs"
+	"github.com/dns3l/dns3l-core/service/auth/token"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+)
+
+type memTokenState struct {
+	l      sync.Mutex
+	tokens map[string]token.DBToken
+}
+
+func (m *memTokenState) NewSession() (token.TokenStateManagerSession, error) {
+	return m, nil
+}
+
+func (m *memTokenState) Close() error {
+	return nil
+}
+
+func (m *memTokenState) PutToken(tkn *token.DBToken) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.tokens[tkn.ID] = *tkn
+	return nil
+}
+
+func (m *memTokenState) GetToken(id string) (*token.DBToken, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	tkn, exists := m.tokens[id]
+	if !exists {
+		return nil, nil
+	}
+	return &tkn, nil
+}
+
+func (m *memTokenState) GetTokenByHash(hash string) (*token.DBToken, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	for _, tkn := range m.tokens {
+		if tkn.Hash == hash {
+			return &tkn, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memTokenState) ListTokens(owner *authtypes.UserInfo) ([]token.DBToken, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	res := make([]token.DBToken, 0, len(m.tokens))
+	for _, tkn := range m.tokens {
+		if owner == nil || tkn.Owner.Equal(owner) {
+			res = append(res, tkn)
+		}
+	}
+	return res, nil
+}
+
+func (m *memTokenState) DelToken(id string) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	delete(m.tokens, id)
+	return nil
+}
+
+func (m *memTokenState) TouchToken(id string, t, notBefore time.Time) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	tkn := m.tokens[id]
+	if tkn.LastUsedTime.Before(notBefore) {
+		tkn.LastUsedTime = t
+		m.tokens[id] = tkn
+	}
+	return nil
+}
+
+func newTokenTestService() (*V1, *memTokenState) {
+	state := &memTokenState{tokens: map[string]token.DBToken{}}
+	conf := &Config{}
+	conf.Auth.Token.Config.MaxValidity = 365 * 24 * time.Hour
+	conf.Auth.Token.State = state
+	return (&Service{Config: conf}).GetV1(), state
+}
+
+func tokenTestUser(name string, admin bool) *authtypes.DefaultAuthorizationInfo {
+	return &authtypes.DefaultAuthorizationInfo{
+		UserInfo:       &authtypes.UserInfo{Name: name, Email: name + "@example.com"},
+		DomainsAllowed: []string{"example.com."},
+		ReadAllowed:    true,
+		WriteAllowed:   true,
+		AdminAllowed:   admin,
+	}
+}
+
+func TestCreateTokenLimitedToUser(t *testing.T) {
+	v1, state := newTokenTestService()
+	rick := tokenTestUser("rick", false)
+
+	forbidden := []*apiv1.TokenCreateInfo{
+		{Name: "other-domain", Domains: []string{"example.org"}, ValidFor: "30d"},
+		{Name: "admin", Domains: []string{"ci.example.com"}, Admin: true, ValidFor: "30d"},
+	}
+	for _, tinfo := range forbidden {
+		_, err := v1.CreateToken(tinfo, rick)
+		var unauthzed *common.UnauthzedError
+		if !errors.As(err, &unauthzed) {
+			t.Errorf("%s: expected unauthorized error, got %v", tinfo.Name, err)
+		}
+	}
+	for _, validFor := range []string{"2y", "0d", "soon"} {
+		_, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: "ci", Domains: []string{"ci.example.com"},
+			ValidFor: validFor}, rick)
+		var invalid *common.InvalidInputError
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s: expected invalid input error, got %v", validFor, err)
+		}
+	}
+
+	res, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: "ci", Domains: []string{"ci.example.com"},
+		Write: true, ValidFor: "30d"}, rick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Token == "" || res.Domains[0] != "ci.example.com." {
+		t.Errorf("unexpected result %+v", res)
+	}
+	stored := state.tokens[res.ID]
+	if stored.Hash != token.ConvertPlainToken(res.Token) {
+		t.Error("expected only the hash of the token to be stored")
+	}
+
+	_, err = v1.CreateToken(&apiv1.TokenCreateInfo{Name: "ci", Domains: []string{"ci.example.com"},
+		ValidFor: "30d"}, rick)
+	var exists *common.AlreadyExistsError
+	if !errors.As(err, &exists) {
+		t.Errorf("expected duplicate name to be rejected, got %v", err)
+	}
+}
+
+func TestTokenAuthAndRevoke(t *testing.T) {
+	v1, _ := newTokenTestService()
+	rick := tokenTestUser("rick", false)
+	morty := tokenTestUser("morty", false)
+	admin := tokenTestUser("admin", true)
+	prov := &v1.Service.Config.Auth.Token
+
+	res, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: "ci", Domains: []string{"ci.example.com"},
+		ValidFor: "30d"}, rick)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &http.Request{Header: http.Header{}}
+	req.Header.Set(token.TokenHeaderKey, res.Token)
+	authz, err := prov.AuthnGetAuthzInfo(req)
+	if err != nil || authz == nil {
+		t.Fatalf("expected token to authenticate, got %v", err)
+	}
+	if authz.GetUserInfo().Email != "rick@example.com" {
+		t.Errorf("expected owner's e-mail address, got %s", authz.GetUserInfo().Email)
+	}
+	if authz.ChkAuthReadDomain("ci.example.com.") != nil || authz.ChkAuthReadDomain("www.example.com.") == nil ||
+		authz.ChkAuthWriteDomain("ci.example.com.") == nil {
+		t.Errorf("expected token to be limited, got %s", authz.String())
+	}
+
+	tokens, err := v1.GetTokens(false, rick)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsed == "" {
+		t.Errorf("expected the used token to be listed, got %+v, %v", tokens, err)
+	}
+	tokens, err = v1.GetTokens(false, morty)
+	if err != nil || len(tokens) != 0 {
+		t.Errorf("expected no tokens of other users, got %+v, %v", tokens, err)
+	}
+	_, err = v1.GetTokens(true, morty)
+	if err == nil {
+		t.Error("expected listing all tokens to need admin")
+	}
+
+	_, err = v1.RevokeToken(res.ID, morty)
+	if err == nil {
+		t.Error("expected other users not to be able to revoke the token")
+	}
+	_, err = v1.RevokeToken(res.ID, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authz, err = prov.AuthnGetAuthzInfo(req)
+	if err != nil || authz != nil {
+		t.Errorf("expected revoked token not to authenticate, got %v, %v", authz, err)
+	}
+}
+
+func TestCreateTokenRestricted(t *testing.T) {
+	v1, state := newTokenTestService()
+	v1.Service.Config.CA = &ca.Config{Providers: map[string]*ca.ProviderInfo{
+		"le-staging": {}, "sectigo": {},
+	}}
+	rick := tokenTestUser("rick", false)
+
+	res, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: "ingress", Domains: []string{"ingress.example.com"},
+		ValidFor: "30d", Scopes: []string{"cert:read-key"}, CAs: []string{"le-staging"},
+		SourceCIDRs: []string{"10.0.0.0/8"}}, rick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(res.Scopes, []string{"cert:read-key"}) || !slices.Equal(res.CAs, []string{"le-staging"}) {
+		t.Errorf("unexpected result %+v", res)
+	}
+
+	req := &http.Request{Header: http.Header{}, RemoteAddr: "10.0.0.1:4711"}
+	req.Header.Set(token.TokenHeaderKey, res.Token)
+	authz, err := v1.Service.Config.Auth.Token.AuthnGetAuthzInfo(req)
+	if err != nil || authz == nil {
+		t.Fatalf("expected token to authenticate, got %v", err)
+	}
+	if v1.DeleteCertificate("le-staging", "ingress.example.com", authz) == nil {
+		t.Error("expected the token not to be allowed to delete certificates")
+	}
+	var unauthzed *common.UnauthzedError
+	_, err = v1.ClaimCertificateAsync(context.Background(), "sectigo",
+		&apiv1.CertClaimInfo{Name: "ingress.example.com"}, authz)
+	if !errors.As(err, &unauthzed) {
+		t.Errorf("expected the token not to be allowed to claim, got %v", err)
+	}
+
+	//a token cannot have more scopes or CAs than the one creating it
+	_, err = v1.CreateToken(&apiv1.TokenCreateInfo{Name: "sub", Domains: []string{"ingress.example.com"},
+		ValidFor: "1d", Scopes: []string{"cert:delete"}}, authz)
+	if !errors.As(err, &unauthzed) {
+		t.Errorf("expected unauthorized error, got %v", err)
+	}
+	sub, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: "sub", Domains: []string{"ingress.example.com"},
+		ValidFor: "1d"}, authz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := state.tokens[sub.ID]; !slices.Equal(stored.Scopes,
+		[]authtypes.Scope{authtypes.ScopeReadPublic, authtypes.ScopeReadKey}) ||
+		!slices.Equal(stored.CAsAllowed, []string{"le-staging"}) ||
+		!slices.Equal(stored.SourceCIDRs, []string{"10.0.0.0/8"}) {
+		t.Errorf("expected restrictions to be inherited, got %+v", stored)
+	}
+
+	//nor more networks or a longer validity
+	for _, cidr := range []string{"192.168.0.0/16", "0.0.0.0/0", "::/0"} {
+		_, err = v1.CreateToken(&apiv1.TokenCreateInfo{Name: "wide", Domains: []string{"ingress.example.com"},
+			ValidFor: "1d", SourceCIDRs: []string{cidr}}, authz)
+		if !errors.As(err, &unauthzed) {
+			t.Errorf("%s: expected unauthorized error, got %v", cidr, err)
+		}
+	}
+	_, err = v1.CreateToken(&apiv1.TokenCreateInfo{Name: "narrow", Domains: []string{"ingress.example.com"},
+		ValidFor: "1d", SourceCIDRs: []string{"10.1.0.0/16"}}, authz)
+	if err != nil {
+		t.Error(err)
+	}
+	later := tokenTestUser("rick-later", false)
+	notBefore := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	later.Delegation = &authtypes.Delegation{Owner: rick.UserInfo, NotBefore: notBefore,
+		Expiry: notBefore.Add(24 * time.Hour)}
+	early, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: "early", Domains: []string{"ci.example.com"},
+		ValidFor: "30d", NotBefore: time.Now().Format(time.RFC3339)}, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := state.tokens[early.ID]; !stored.NotBefore.Equal(notBefore) {
+		t.Errorf("expected the token not to be valid before the calling token, got %s", stored.NotBefore)
+	}
+
+	var invalid *common.InvalidInputError
+	for _, tinfo := range []*apiv1.TokenCreateInfo{
+		{Name: "badscope", Scopes: []string{"cert:all"}},
+		{Name: "badca", CAs: []string{"nope"}},
+		{Name: "badcidr", SourceCIDRs: []string{"10.0.0.1"}},
+		{Name: "late", NotBefore: time.Now().Add(60 * 24 * time.Hour).Format(time.RFC3339)},
+	} {
+		tinfo.Domains = []string{"ci.example.com"}
+		tinfo.ValidFor = "30d"
+		_, err = v1.CreateToken(tinfo, rick)
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s: expected invalid input error, got %v", tinfo.Name, err)
+		}
+	}
+}
+
+func TestTokenCannotMintTokenBeyondItself(t *testing.T) {
+	v1, state := newTokenTestService()
+	rick := tokenTestUser("rick", false)
+	prov := &v1.Service.Config.Auth.Token
+
+	parent, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: "ci", Domains: []string{"ci.example.com"},
+		ValidFor: "2d"}, rick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &http.Request{Header: http.Header{}}
+	req.Header.Set(token.TokenHeaderKey, parent.Token)
+	authz, err := prov.AuthnGetAuthzInfo(req)
+	if err != nil || authz == nil {
+		t.Fatalf("expected token to authenticate, got %v", err)
+	}
+
+	sub, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: "sub", Domains: []string{"ci.example.com"},
+		ValidFor: "30d"}, authz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := state.tokens[sub.ID]
+	if !stored.Owner.Equal(rick.UserInfo) {
+		t.Errorf("expected the token to be owned by the user of the calling token, got %s", stored.Owner)
+	}
+	if !stored.ExpiryTime.Equal(state.tokens[parent.ID].ExpiryTime) {
+		t.Errorf("expected the token to expire with the calling token, got %s", stored.ExpiryTime)
+	}
+
+	//configured tokens and client certificates have no user who could own the token
+	machine := tokenTestUser("ci-runner", false)
+	machine.Delegation = &authtypes.Delegation{}
+	_, err = v1.CreateToken(&apiv1.TokenCreateInfo{Name: "m2m", Domains: []string{"ci.example.com"},
+		ValidFor: "1d"}, machine)
+	var unauthzed *common.UnauthzedError
+	if !errors.As(err, &unauthzed) {
+		t.Errorf("expected unauthorized error, got %v", err)
+	}
+}
+
+func TestTokenNamedAfterOwner(t *testing.T) {
+	v1, _ := newTokenTestService()
+	rick := tokenTestUser("rick", false)
+	prov := &v1.Service.Config.Auth.Token
+
+	tokenAuthz := func(plain string) authtypes.AuthorizationInfo {
+		req := &http.Request{Header: http.Header{}}
+		req.Header.Set(token.TokenHeaderKey, plain)
+		authz, err := prov.AuthnGetAuthzInfo(req)
+		if err != nil || authz == nil {
+			t.Fatalf("expected token to authenticate, got %v", err)
+		}
+		return authz
+	}
+
+	//both tokens act for rick, regardless of whether they are named like him
+	for _, name := range []string{"rick", "ci"} {
+		res, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: name, Domains: []string{"ci.example.com"},
+			ValidFor: "30d"}, rick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		authz := tokenAuthz(res.Token)
+		sub, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: name + "-sub", Domains: []string{"ci.example.com"},
+			ValidFor: "1d"}, authz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens, err := v1.GetTokens(false, authz)
+		if err != nil || !slices.ContainsFunc(tokens, func(i apiv1.TokenInfo) bool { return i.ID == sub.ID }) {
+			t.Errorf("%s: expected the token to list the tokens of its owner, got %+v, %v", name, tokens, err)
+		}
+		_, err = v1.RevokeToken(sub.ID, authz)
+		if err != nil {
+			t.Errorf("%s: expected the token to revoke a token of its owner, got %v", name, err)
+		}
+	}
+
+	tokens, err := v1.GetTokens(false, rick)
+	if err != nil || len(tokens) != 2 {
+		t.Errorf("expected the two tokens of rick, got %+v, %v", tokens, err)
+	}
+
+	machine := tokenTestUser("rick", false)
+	machine.Delegation = &authtypes.Delegation{}
+	var unauthzed *common.UnauthzedError
+	_, err = v1.GetTokens(false, machine)
+	if !errors.As(err, &unauthzed) {
+		t.Errorf("expected configured tokens not to list tokens, got %v", err)
+	}
+	_, err = v1.RevokeToken(tokens[0].ID, machine)
+	if !errors.As(err, &unauthzed) {
+		t.Errorf("expected configured tokens not to revoke tokens, got %v", err)
+	}
+}
+
+func TestResumedJobRechecksToken(t *testing.T) {
+	v1, _ := newTokenTestService()
+	v1.Service.Config.CA = &ca.Config{Providers: map[string]*ca.ProviderInfo{
+		"le-staging": {}, "sectigo": {},
+	}}
+	rick := tokenTestUser("rick", false)
+	cinfo := &apiv1.CertClaimInfo{Name: "ci.example.com"}
+	now := time.Now()
+
+	res, err := v1.CreateToken(&apiv1.TokenCreateInfo{Name: "ci", Domains: []string{"ci.example.com"},
+		Write: true, ValidFor: "30d", CAs: []string{"le-staging"}}, rick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &http.Request{Header: http.Header{}}
+	req.Header.Set(token.TokenHeaderKey, res.Token)
+	authz, err := v1.Service.Config.Auth.Token.AuthnGetAuthzInfo(req)
+	if err != nil || authz == nil {
+		t.Fatalf("expected token to authenticate, got %v", err)
+	}
+
+	job := &jobs.Job{CAID: "le-staging", CreatedBy: authz.GetUserInfo(),
+		Authz: jobAuthorization(v1.Service.Config, authz)}
+	if job.Authz.TokenID != res.ID || !slices.Equal(job.Authz.CAsAllowed, []string{"le-staging"}) {
+		t.Errorf("expected the token and its restrictions to be recorded, got %+v", job.Authz)
+	}
+	resumed, err := v1.Service.resumedJobAuthzInfo(job, cinfo, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.ChkAuthCA("sectigo") == nil {
+		t.Errorf("expected the restrictions of the token to be kept, got %s", resumed.String())
+	}
+
+	var unauthzed *common.UnauthzedError
+	_, err = v1.Service.resumedJobAuthzInfo(job, cinfo, now.Add(31*24*time.Hour))
+	if !errors.As(err, &unauthzed) {
+		t.Errorf("expected the job of an expired token to fail, got %v", err)
+	}
+	job.CAID = "sectigo"
+	_, err = v1.Service.resumedJobAuthzInfo(job, cinfo, now)
+	if !errors.As(err, &unauthzed) {
+		t.Errorf("expected the job to fail for a CA the token may not use, got %v", err)
+	}
+	job.CAID = "le-staging"
+
+	_, err = v1.RevokeToken(res.ID, rick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v1.Service.resumedJobAuthzInfo(job, cinfo, now)
+	if !errors.As(err, &unauthzed) {
+		t.Errorf("expected the job of a revoked token to fail, got %v", err)
+	}
+
+	job.Authz = nil
+	_, err = v1.Service.resumedJobAuthzInfo(job, cinfo, now)
+	if err == nil {
+		t.Error("expected a job without recorded authorization to fail")
+	}
+}
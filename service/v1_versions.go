@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	apiv1 "github.com/dns3l/dns3l-core/api/v1"
+	"github.com/dns3l/dns3l-core/ca/types"
+	authtypes "github.com/dns3l/dns3l-core/service/auth/types"
+	"github.com/dns3l/dns3l-core/util"
+)
+
+func (s *V1) GetCertificateVersions(caID, crtID string, authz authtypes.AuthorizationInfo) ([]apiv1.CertVersionInfo, error) {
+
+	s.logAction(authz, fmt.Sprintf("GetCertificateVersions %s %s", caID, crtID))
+
+	crtID = util.GetDomainFQDNDot(crtID)
+
+	err := chkAuthCertOp(authz, authtypes.ScopeReadPublic, caID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, domains, err := s.Service.config().CA.Functions.GetCertificateVersions(crtID, caID)
+	if err != nil {
+		return nil, err
+	}
+
+	//does not modify anything, so check permissions after request when we know the domains...
+	err = authz.ChkAuthReadDomainsPublic(domains)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]apiv1.CertVersionInfo, len(versions))
+	for i := range versions {
+		err = apiCertVersionInfoFromCertVersionInfo(&versions[i], &res[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+
+}
+
+func (s *V1) GetCertificateVersionResource(caID, crtID string, version uint, obj string,
+	authz authtypes.AuthorizationInfo) (string, string, error) {
+
+	s.logAction(authz, fmt.Sprintf("GetCertificateVersionResource %s %s %d %s", caID, crtID, version, obj))
+
+	crtID = util.GetDomainFQDNDot(crtID)
+
+	err := authz.ChkAuthCA(caID)
+	if err != nil {
+		return "", "", err
+	}
+
+	res, err := s.Service.config().CA.Functions.GetCertificateVersionResource(crtID, caID, version, obj)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = chkAuthReadResource(authz, res.CanBePublic, res.Domains)
+	if err != nil {
+		return "", "", err
+	}
+
+	return res.PEMData, res.ContentType, nil
+
+}
+
+func (s *V1) RollbackCertificate(caID, crtID string, version uint, authz authtypes.AuthorizationInfo) error {
+
+	s.logAction(authz, fmt.Sprintf("RollbackCertificate %s %s %d", caID, crtID, version))
+
+	err := authz.ChkAuthAdmin()
+	if err != nil {
+		return err
+	}
+	err = authz.ChkAuthCA(caID)
+	if err != nil {
+		return err
+	}
+
+	return s.Service.config().CA.Functions.RollbackCertificate(util.GetDomainFQDNDot(crtID), caID, version)
+
+}
+
+func apiCertVersionInfoFromCertVersionInfo(source *types.CertVersionInfo, target *apiv1.CertVersionInfo) error {
+	cbatch, err := util.ParseCertificatePEM([]byte(source.CertPEM))
+	if err != nil {
+		return err
+	}
+
+	if len(cbatch) <= 0 {
+		return errors.New("stored cert data contains no PEM chunks")
+	}
+
+	cert := cbatch[0]
+	now := time.Now()
+
+	target.Version = source.Version
+	target.Current = source.Current
+	target.Issued = source.IssuedTime.Format(time.RFC3339)
+	target.ValidFrom = source.ValidStartTime.Format(time.RFC3339)
+	target.ValidTo = source.ValidEndTime.Format(time.RFC3339)
+	target.Valid = now.After(source.ValidStartTime) && now.Before(source.ValidEndTime)
+	target.SubjectCN = cert.Subject.CommonName
+	target.IssuerCN = cert.Issuer.CommonName
+	target.Serial = cert.SerialNumber.String()
+
+	return nil
+}
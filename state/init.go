@@ -123,6 +123,233 @@ func createWithMySQL(db *sql.DB, dbProv SQLDBProvider, createdb bool) error {
 		return err
 	}
 
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("jobs") + ` (
+	job_id CHAR(64),
+	job_type CHAR(32),
+	ca_id CHAR(63),
+	key_name CHAR(255),
+	created_by VARCHAR(255),
+	created_by_email VARCHAR(255),
+	authz TEXT,
+	status CHAR(32),
+	steps TEXT,
+	error TEXT,
+	request TEXT,
+	result MEDIUMTEXT,
+	owner VARCHAR(255) DEFAULT '',
+	created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	heartbeat_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (job_id)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + dbProv.DBName("jobs_status_idx") + `
+	ON ` + dbProv.DBName("jobs") + `(status);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("event_outbox") + ` (
+	id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+	webhook_id CHAR(63),
+	event_id CHAR(32),
+	event_type CHAR(32),
+	payload TEXT,
+	status CHAR(16),
+	attempts INT UNSIGNED DEFAULT 0,
+	next_attempt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_error TEXT,
+	created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + dbProv.DBName("event_outbox_due_idx") + `
+	ON ` + dbProv.DBName("event_outbox") + `(status, next_attempt);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("notifications") + ` (
+	ca_id CHAR(63),
+	key_name CHAR(255),
+	event_type CHAR(32),
+	last_sent TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (ca_id, key_name, event_type)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("audit") + ` (
+	id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+	created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	user_name VARCHAR(255),
+	user_email VARCHAR(255),
+	action CHAR(32),
+	ca_id CHAR(63),
+	key_name CHAR(255),
+	source_ip VARCHAR(45),
+	result CHAR(16),
+	error TEXT,
+	PRIMARY KEY (id)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + dbProv.DBName("audit_time_idx") + `
+	ON ` + dbProv.DBName("audit") + `(created_time);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + dbProv.DBName("audit_cert_idx") + `
+	ON ` + dbProv.DBName("audit") + `(ca_id, key_name);`)
+	if err != nil {
+		return err
+	}
+
+	//Every certificate ever issued for a key, the current one is also in keycerts
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("cert_versions") + ` (
+	ca_id CHAR(63),
+	key_name CHAR(255),
+	version INT UNSIGNED,
+	key_hash CHAR(64),
+	cert MEDIUMTEXT,
+	issuer_cert MEDIUMTEXT,
+	issued_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	valid_start_time TIMESTAMP NULL DEFAULT NULL,
+	valid_end_time TIMESTAMP NULL DEFAULT NULL,
+	is_current BOOLEAN DEFAULT FALSE,
+	PRIMARY KEY (ca_id, key_name, version)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	//The private keys of the versions, by the SHA-256 of the PEM
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("cert_version_keys") + ` (
+	ca_id CHAR(63),
+	key_name CHAR(255),
+	key_hash CHAR(64),
+	priv_key TEXT,
+	PRIMARY KEY (ca_id, key_name, key_hash)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	//Certificates issued before the history existed become their first version
+	_, err = db.Exec(`INSERT IGNORE INTO ` + dbProv.DBName("cert_version_keys") + ` (ca_id, key_name, key_hash,
+	priv_key) SELECT ca_id, key_name, SHA2(priv_key, 256), priv_key FROM ` + dbProv.DBName("keycerts") + `;`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT IGNORE INTO ` + dbProv.DBName("cert_versions") + ` (ca_id, key_name, version,
+	key_hash, cert, issuer_cert, issued_time, valid_start_time, valid_end_time, is_current)
+	SELECT ca_id, key_name, 1, SHA2(priv_key, 256), cert, issuer_cert, renewed_time, valid_start_time, valid_end_time, TRUE
+	FROM ` + dbProv.DBName("keycerts") + ` k WHERE NOT EXISTS (SELECT 1 FROM ` + dbProv.DBName("cert_versions") + ` v
+	WHERE v.ca_id = k.ca_id AND v.key_name = k.key_name);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("leases") + ` (
+	name VARCHAR(340),
+	holder VARCHAR(255),
+	expires_time TIMESTAMP NULL DEFAULT NULL,
+	PRIMARY KEY (name)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("renew_retries") + ` (
+	ca_id CHAR(63),
+	key_name CHAR(255),
+	failures INT UNSIGNED DEFAULT 0,
+	last_error TEXT,
+	last_failure_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	next_retry_time TIMESTAMP NULL DEFAULT NULL,
+	PRIMARY KEY (ca_id, key_name)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + dbProv.DBName("renew_retries_due_idx") + `
+	ON ` + dbProv.DBName("renew_retries") + `(next_retry_time);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("renewal_jobs") + ` (
+	id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+	ca_id CHAR(63),
+	key_name CHAR(255),
+	status CHAR(16),
+	job_trigger CHAR(16),
+	owner VARCHAR(255),
+	attempt INT UNSIGNED DEFAULT 1,
+	created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	start_time TIMESTAMP NULL DEFAULT NULL,
+	end_time TIMESTAMP NULL DEFAULT NULL,
+	error TEXT,
+	PRIMARY KEY (id)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + dbProv.DBName("renewal_jobs_cert_idx") + `
+	ON ` + dbProv.DBName("renewal_jobs") + `(ca_id, key_name);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + dbProv.DBName("renewal_jobs_status_idx") + `
+	ON ` + dbProv.DBName("renewal_jobs") + `(status, created_time);`)
+	if err != nil {
+		return err
+	}
+
+	//Tokens users created via the API, only their hash is stored
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + dbProv.DBName("tokens") + ` (
+	token_id CHAR(32),
+	token_name VARCHAR(64),
+	token_hash CHAR(44),
+	owner_name VARCHAR(255),
+	owner_email VARCHAR(255),
+	domains TEXT,
+	write_allowed BOOLEAN DEFAULT FALSE,
+	admin_allowed BOOLEAN DEFAULT FALSE,
+	scopes TEXT,
+	cas TEXT,
+	source_cidrs TEXT,
+	created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expiry_time TIMESTAMP NULL DEFAULT NULL,
+	not_before TIMESTAMP NULL DEFAULT NULL,
+	last_used_time TIMESTAMP NULL DEFAULT NULL,
+	PRIMARY KEY (token_id),
+	UNIQUE (token_hash)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + dbProv.DBName("tokens_owner_idx") + `
+	ON ` + dbProv.DBName("tokens") + `(owner_email, owner_name);`)
+	if err != nil {
+		return err
+	}
+
 	log.Info("Tables set or updated.")
 
 	return nil
@@ -157,7 +384,8 @@ func Truncate(dbProv SQLDBProvider) error {
 		return err
 	}
 
-	for _, table := range []string{"acmeusers", "keycerts", "domains"} {
+	for _, table := range []string{"acmeusers", "keycerts", "domains", "jobs", "event_outbox", "notifications", "audit",
+		"cert_versions", "cert_version_keys", "leases", "renew_retries", "renewal_jobs", "tokens"} {
 		_, err = db.Exec(`TRUNCATE TABLE ` + dbProv.DBName(table) + `;`)
 		if err != nil {
 			return err
@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/dns3l/dns3l-core"
+
+// Exports spans to an OpenTelemetry collector via OTLP over HTTP
+type Config struct {
+	Endpoint    string            `yaml:"endpoint" validate:"required"` //host:port of the collector
+	URLPath     string            `yaml:"urlPath"`                      //defaults to /v1/traces
+	Insecure    bool              `yaml:"insecure"`                     //use HTTP instead of HTTPS
+	Headers     map[string]string `yaml:"headers"`
+	ServiceName string            `yaml:"serviceName" default:"dns3ld"`
+	SampleRatio float64           `yaml:"sampleRatio" default:"1"` //fraction of new traces which are sampled
+}
+
+var propagator = propagation.TraceContext{}
+
+// Init sets up the global tracer provider. The returned function flushes and stops the exporter.
+func Init(conf *Config) (func(context.Context) error, error) {
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(conf.Endpoint)}
+	if conf.URLPath != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(conf.URLPath))
+	}
+	if conf.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(conf.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(conf.Headers))
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(conf.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator)
+	util.TransactionStepHook = TraceTransactionStep
+
+	log.WithField("endpoint", conf.Endpoint).Info("Exporting traces via OTLP")
+
+	return tp.Shutdown, nil
+
+}
+
+// Start starts a span as child of the span in ctx, ctx may be nil.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceTransactionStep runs a step or rollback of a util.TransactionalJobList as a child
+// span of ctx.
+func TraceTransactionStep(ctx context.Context, op string, step int, name string, f func() error) error {
+	attrs := []attribute.KeyValue{attribute.Int("transaction.step", step)}
+	if name != "" {
+		attrs = append(attrs, attribute.String("transaction.step_name", name))
+	}
+	_, span := Start(ctx, "transaction."+op, attrs...)
+	err := f()
+	End(span, err)
+	return err
+}
+
+// Detach returns a context which carries the span of ctx, but is not canceled with ctx.
+// Used for work which goes on in the background after a request has been answered.
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// HTTPMiddleware starts a server span for every request, continuing the trace of the
+// W3C trace context headers of the request if present.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := r.URL.Path
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tmpl, err := cr.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+			))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dns3l/dns3l-core/util"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestRecorder(t *testing.T) *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func TestHTTPMiddlewareContinuesTrace(t *testing.T) {
+	rec := newTestRecorder(t)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/ca/{caID}/crt", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "V1.ClaimCertificate")
+		End(span, errors.New("claim failed"))
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	r.Use(HTTPMiddleware)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/ca/le/crt", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	inner, server := spans[0], spans[1]
+
+	if server.Name() != "POST /api/ca/{caID}/crt" {
+		t.Errorf("unexpected server span name %q", server.Name())
+	}
+	if server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace of the request has not been continued, got trace %s", server.SpanContext().TraceID())
+	}
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" || !server.Parent().IsRemote() {
+		t.Errorf("unexpected parent %s of server span", server.Parent().SpanID())
+	}
+	if server.Status().Code != codes.Error {
+		t.Errorf("expected error status for HTTP 500, got %v", server.Status())
+	}
+
+	if inner.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("span started from the request context must be a child of the server span")
+	}
+	if inner.Status().Code != codes.Error || inner.Status().Description != "claim failed" {
+		t.Errorf("unexpected status %v", inner.Status())
+	}
+}
+
+func TestDetachKeepsSpan(t *testing.T) {
+	newTestRecorder(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, span := Start(ctx, "request")
+	defer span.End()
+	detached := Detach(ctx)
+	cancel()
+
+	if detached.Err() != nil {
+		t.Fatal("detached context must not be canceled with its origin")
+	}
+	_, child := Start(detached, "job")
+	defer child.End()
+	if child.SpanContext().TraceID() != span.SpanContext().TraceID() {
+		t.Fatal("detached context must carry the trace")
+	}
+}
+
+func TestTraceTransactionSteps(t *testing.T) {
+	rec := newTestRecorder(t)
+	prev := util.TransactionStepHook
+	util.TransactionStepHook = TraceTransactionStep
+	t.Cleanup(func() { util.TransactionStepHook = prev })
+
+	failed := errors.New("failed")
+	trl := util.TransactionalJobList{
+		&util.TransactionalJobImpl{Name: "prepare"},
+		&util.TransactionalJobImpl{DoFunc: func() error { return failed }},
+	}
+	if err := trl.CommitContext(context.Background()); !errors.Is(err, failed) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	for i, expected := range []string{"transaction.do", "transaction.do", "transaction.undo"} {
+		if spans[i].Name() != expected {
+			t.Errorf("span %d: expected %s, got %s", i, expected, spans[i].Name())
+		}
+	}
+	if spans[1].Status().Code != codes.Error {
+		t.Error("failed step must be recorded as error")
+	}
+}
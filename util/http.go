@@ -0,0 +1,71 @@
+package util
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIP returns the IP of the client. If the request comes from a trusted proxy, the
+// X-Forwarded-For header is followed from the right to the first address which is not
+// a trusted proxy, since the addresses left of it can be set by the client.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host := peerIP(r)
+	if !isTrustedProxy(host, trustedProxies) {
+		return host
+	}
+
+	var forwarded []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(v, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				forwarded = append(forwarded, addr)
+			}
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		host = forwarded[i]
+		if !isTrustedProxy(host, trustedProxies) {
+			break
+		}
+	}
+	return host
+}
+
+// WithClientIP returns the request with the client IP resolved by ClientIP attached.
+func WithClientIP(r *http.Request, trustedProxies []*net.IPNet) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ClientIP(r, trustedProxies)))
+}
+
+// RequestClientIP returns the client IP attached by WithClientIP, or the IP of the peer if
+// none has been attached.
+func RequestClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrustedProxy(host string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range trustedProxies {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
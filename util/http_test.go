@@ -0,0 +1,35 @@
+package util
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPFromTrustedProxy(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "198.51.100.7", "192.0.2.1"}, //untrusted peers must not set the header
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+		{"10.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"10.0.0.1:1234", "203.0.113.9, 198.51.100.7, 10.1.2.3", "198.51.100.7"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if ip := ClientIP(r, []*net.IPNet{proxies}); ip != tc.expected {
+			t.Errorf("%s via %s: expected %s, got %s", tc.forwarded, tc.remoteAddr, tc.expected, ip)
+		}
+	}
+}
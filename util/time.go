@@ -1,6 +1,11 @@
 package util
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // RFC3339
 func FormatTimeDNS3L(t time.Time) string {
@@ -14,3 +19,16 @@ func DaysToDuration(days uint16) time.Duration {
 func DurationToDays(d time.Duration) uint16 {
 	return uint16(d.Hours() / 24)
 }
+
+// ParseDurationDays parses a duration like time.ParseDuration, additionally accepting
+// whole days like "30d".
+func ParseDurationDays(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.ParseUint(days, 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration in days: %s", s)
+		}
+		return DaysToDuration(uint16(n)), nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,25 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDurationDays(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"0d":  0,
+		"36h": 36 * time.Hour,
+		"90m": 90 * time.Minute,
+	} {
+		d, err := ParseDurationDays(s)
+		if err != nil || d != expected {
+			t.Errorf("%s: expected %s, have %s, %v", s, expected, d, err)
+		}
+	}
+	for _, s := range []string{"", "d", "-3d", "1.5d", "30x"} {
+		if _, err := ParseDurationDays(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
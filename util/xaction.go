@@ -1,18 +1,33 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
 
+// If set, every step and rollback of a TransactionalJobList is run through this hook,
+// e.g. to trace it. op is "do" or "undo", name is empty if the job has none. The hook
+// must call f and return its error.
+var TransactionStepHook func(ctx context.Context, op string, step int, name string, f func() error) error
+
 type TransactionalJobList []TransactionalJob
 
 func (jl TransactionalJobList) Commit() error {
+	return jl.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit, but passes ctx to the TransactionStepHook. If ctx is
+// canceled, the remaining steps are not executed and the executed ones are rolled back.
+func (jl TransactionalJobList) CommitContext(ctx context.Context) error {
 
 	for i := 0; i < len(jl); i++ {
-		err := CatchPanic(jl[i].Do)
+		err := ctx.Err()
+		if err == nil {
+			err = jl.runStep(ctx, "do", i, jl[i].Do)
+		}
 		if err != nil {
-			rberr := jl.rollbackFrom(i-1, err)
+			rberr := jl.rollbackFrom(ctx, i-1, err)
 			if rberr != nil {
 				return rberr
 			}
@@ -24,10 +39,24 @@ func (jl TransactionalJobList) Commit() error {
 
 }
 
-func (jl TransactionalJobList) rollbackFrom(jobID int, origErr error) *TransactionRollbackError {
+func (jl TransactionalJobList) runStep(ctx context.Context, op string, jobID int, f func() error) error {
+	hook := TransactionStepHook
+	if hook == nil {
+		return CatchPanic(f)
+	}
+	name := ""
+	if named, ok := jl[jobID].(interface{ GetName() string }); ok {
+		name = named.GetName()
+	}
+	return hook(ctx, op, jobID, name, func() error {
+		return CatchPanic(f)
+	})
+}
+
+func (jl TransactionalJobList) rollbackFrom(ctx context.Context, jobID int, origErr error) *TransactionRollbackError {
 	var rbErr *TransactionRollbackError = nil
 	for i := jobID; i >= 0; i-- {
-		err := CatchPanic(jl[i].Undo)
+		err := jl.runStep(ctx, "undo", i, jl[i].Undo)
 		if err != nil {
 			if rbErr == nil {
 				rbErr = &TransactionRollbackError{
@@ -91,10 +120,15 @@ func (e *TransactionRollbackError) Error() string {
 }
 
 type TransactionalJobImpl struct {
+	Name     string //optional, shown in traces
 	DoFunc   func() error
 	UndoFunc func() error
 }
 
+func (i *TransactionalJobImpl) GetName() string {
+	return i.Name
+}
+
 func (i *TransactionalJobImpl) Do() error {
 	if i.DoFunc == nil {
 		return nil
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
@@ -271,3 +272,33 @@ func (a *TransactionalTestAction) behav(b string, doneval *bool) error {
 	}
 	return fmt.Errorf("%s: %s", a.Name, b)
 }
+
+func TestXActCanceledRollsBack(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a1 := &TransactionalTestAction{
+		Name:      "Preparation 1",
+		DoBehav:   "",
+		UndoBehav: "",
+	}
+	am := &TransactionalTestAction{
+		Name:      "Main thing",
+		DoBehav:   "",
+		UndoBehav: "",
+	}
+
+	l := TransactionalJobList{a1, &TransactionalJobImpl{
+		DoFunc: func() error {
+			cancel() //e.g. on shutdown
+			return nil
+		},
+	}, am}
+
+	assert.ErrorIs(t, l.CommitContext(ctx), context.Canceled)
+
+	assert.True(t, a1.Done)
+	assert.False(t, am.Done)
+	assert.True(t, a1.Undone)
+
+}